@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// These are the test vectors in test.py in www/files/blake3-2.tar.gz,
+// which came from the BLAKE3 repo: the default hash of the bytes i % 251.
+var vectors = []struct {
+	len  int
+	hash string
+}{
+	{0, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+	{1, "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+	{1023, "10108970eeda3eb932baac1428c7a2163b0e924c9a9e25b35bba72b28f70bd11"},
+	{1024, "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+	{1025, "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+	{2048, "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a"},
+	{2049, "5f4d72f40d7a5f82b15ca2b2e44b1de3c2ef86c426c95c1af0b6879522563030"},
+	{3072, "b98cb0ff3623be03326b373de6b9095218513e64f1ee2edd2525c7ad1e5cffd2"},
+	{3073, "7124b49501012f81cc7f11ca069ec9226cecb8a2c850cfe644e327d22d3e1cd3"},
+	{4096, "015094013f57a5277b59d8475c0501042c0b642e531b0a1c8f58d2163229e969"},
+	{4097, "9b4052b38f1c5fc8b1f9ff7ac7b27cd242487b3d890d15c96a1c25b8aa0fb995"},
+	{5120, "9cadc15fed8b5d854562b26a9536d9707cadeda9b143978f319ab34230535833"},
+	{5121, "628bd2cb2004694adaab7bbd778a25df25c47b9d4155a55f8fbd79f2fe154cff"},
+	{6144, "3e2e5b74e048f3add6d21faab3f83aa44d3b2278afb83b80b3c35164ebeca205"},
+	{6145, "f1323a8631446cc50536a9f705ee5cb619424d46887f3c376c695b70e0f0507f"},
+	{7168, "61da957ec2499a95d6b8023e2b0e604ec7f6b50e80a9678b89d2628e99ada77a"},
+	{7169, "a003fc7a51754a9b3c7fae0367ab3d782dccf28855a03d435f8cfe74605e7817"},
+	{8192, "aae792484c8efe4f19e2ca7d371d8c467ffb10748d8a5a1ae579948f718a2a63"},
+	{8193, "bab6c09cb8ce8cf459261398d2e7aef35700bf488116ceb94a36d0f5f1b7bc3b"},
+	{16384, "f875d6646de28985646f34ee13be9a576fd515f76b5b0a26bb324735041ddde4"},
+	{31744, "62b6960e1a44bcc1eb1a611a8d6235b6b4b78f32e7abc4fb4c6cdcce94895c47"},
+}
+
+// input is long enough to split between goroutines several levels down.
+var input = func() []byte {
+	b := make([]byte, 5<<20+777)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}()
+
+func sum(o output, n int) []byte {
+	out := make([]byte, n)
+	o.rootBytes(out)
+	return out
+}
+
+func streamed(key [8]uint32, flags uint32, p []byte) output {
+	h := newHasher(key, flags)
+	h.Write(p)
+	return h.rootOutput()
+}
+
+var modes = []struct {
+	name  string
+	key   [8]uint32
+	flags uint32
+}{
+	{"hash", iv, 0},
+	{"keyed", keyWords([]byte("whats the Elvish word for friend")), keyedHash},
+	{"derive-key", contextKey("jacko.io b3sum test"), deriveKeyMaterial},
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range vectors {
+		want, _ := hex.DecodeString(v.hash)
+		if got := sum(streamed(iv, 0, input[:v.len]), outLen); !bytes.Equal(got, want) {
+			t.Errorf("%d bytes streamed: got %x, want %x", v.len, got, want)
+		}
+		if got := sum(newTreeHasher(iv, 0, 4).rootOutput(input[:v.len]), outLen); !bytes.Equal(got, want) {
+			t.Errorf("%d bytes all at once: got %x, want %x", v.len, got, want)
+		}
+	}
+}
+
+// Streamed, split between goroutines, and written in pieces should all
+// agree, at lengths around the places the tree changes shape, in all three
+// modes.
+func TestWaysOfHashingAgree(t *testing.T) {
+	var lengths []int
+	for _, chunks := range []int{1, 2, 3, 4, 5, 8, 127, 128, 129, 1024, 4096, 5 << 10} {
+		for _, delta := range []int{-1, 0, 1} {
+			if n := chunks*chunkLen + delta; n <= len(input) {
+				lengths = append(lengths, n)
+			}
+		}
+	}
+	for _, m := range modes {
+		t.Run(m.name, func(t *testing.T) {
+			for _, n := range lengths {
+				want := sum(streamed(m.key, m.flags, input[:n]), 3*blockLen+5)
+				for _, threads := range []int{1, 2, 3, 16} {
+					got := sum(newTreeHasher(m.key, m.flags, threads).rootOutput(input[:n]), 3*blockLen+5)
+					if !bytes.Equal(got, want) {
+						t.Fatalf("%d bytes with %d goroutines: got %x..., want %x...", n, threads, got[:8], want[:8])
+					}
+				}
+				h := newHasher(m.key, m.flags)
+				for rest := input[:n]; len(rest) > 0; {
+					k := min(len(rest), 1+len(rest)%1000)
+					h.Write(rest[:k])
+					rest = rest[k:]
+				}
+				if got := sum(h.rootOutput(), 3*blockLen+5); !bytes.Equal(got, want) {
+					t.Fatalf("%d bytes written in pieces: got %x..., want %x...", n, got[:8], want[:8])
+				}
+			}
+		})
+	}
+}
+
+func TestShorterOutputsArePrefixes(t *testing.T) {
+	long := sum(streamed(iv, 0, input[:3000]), 1000)
+	for _, n := range []int{1, 31, 32, 33, 64, 65, 999} {
+		if short := sum(streamed(iv, 0, input[:3000]), n); !bytes.Equal(short, long[:n]) {
+			t.Errorf("%d bytes of output isn't the start of 1000", n)
+		}
+	}
+}
+
+func TestModesDiffer(t *testing.T) {
+	seen := make(map[string]string)
+	for _, m := range modes {
+		s := string(sum(streamed(m.key, m.flags, input[:100]), outLen))
+		if other, ok := seen[s]; ok {
+			t.Errorf("%s and %s gave the same hash", m.name, other)
+		}
+		seen[s] = m.name
+	}
+}
+
+func TestMappedAndReadFilesAgree(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []int{0, 100, mmapMin - 1, mmapMin, 3<<20 + 1} {
+		name := filepath.Join(dir, fmt.Sprint(n))
+		if err := os.WriteFile(name, input[:n], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		want := sum(streamed(iv, 0, input[:n]), outLen)
+		for _, noMmap := range []bool{false, true} {
+			o, err := hashFile(name, iv, 0, 4, noMmap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sum(o, outLen); !bytes.Equal(got, want) {
+				t.Errorf("a %d-byte file (no-mmap %v): got %x, want %x", n, noMmap, got, want)
+			}
+		}
+	}
+}
+
+func TestNamesSurviveCheckFiles(t *testing.T) {
+	for _, name := range []string{"plain", "back\\slash", "new\nline", "\\\n\\n"} {
+		var buf bytes.Buffer
+		printSum(&buf, name, make([]byte, outLen), &options{})
+		sum, got, err := parseCheckLine(string(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))))
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+			continue
+		}
+		if got != name || !bytes.Equal(sum, make([]byte, outLen)) {
+			t.Errorf("%q came back as %q", name, got)
+		}
+	}
+}
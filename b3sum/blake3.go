@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// BLAKE3, following the reference implementation in the BLAKE3 repo
+// (reference_impl.rs) closely enough that the two can be read side by side.
+// The input is split into 1 KiB chunks, each chunk is hashed into a
+// chaining value, and the chaining values are merged pairwise up a binary
+// tree whose left subtrees are always complete. The root node can be
+// compressed again with an increasing counter to get as much output as
+// anyone asks for.
+
+const (
+	outLen   = 32
+	keyLen   = 32
+	blockLen = 64
+	chunkLen = 1024
+
+	chunkStart        = 1 << 0
+	chunkEnd          = 1 << 1
+	parent            = 1 << 2
+	root              = 1 << 3
+	keyedHash         = 1 << 4
+	deriveKeyContext  = 1 << 5
+	deriveKeyMaterial = 1 << 6
+)
+
+var iv = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+	0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+// schedule is the message word order for each of the seven rounds: the
+// identity, then the permutation applied once more each round.
+var schedule = func() [7][16]byte {
+	permutation := [16]byte{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+	var s [7][16]byte
+	for i := range s[0] {
+		s[0][i] = byte(i)
+	}
+	for r := 1; r < 7; r++ {
+		for i := range s[r] {
+			s[r][i] = s[r-1][permutation[i]]
+		}
+	}
+	return s
+}()
+
+func g(a, b, c, d, x, y uint32) (uint32, uint32, uint32, uint32) {
+	a += b + x
+	d = bits.RotateLeft32(d^a, -16)
+	c += d
+	b = bits.RotateLeft32(b^c, -12)
+	a += b + y
+	d = bits.RotateLeft32(d^a, -8)
+	c += d
+	b = bits.RotateLeft32(b^c, -7)
+	return a, b, c, d
+}
+
+func compress(cv *[8]uint32, block *[16]uint32, counter uint64, blockLen uint32, flags uint32) [16]uint32 {
+	v := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	for r := range schedule {
+		s := &schedule[r]
+		v[0], v[4], v[8], v[12] = g(v[0], v[4], v[8], v[12], block[s[0]], block[s[1]])
+		v[1], v[5], v[9], v[13] = g(v[1], v[5], v[9], v[13], block[s[2]], block[s[3]])
+		v[2], v[6], v[10], v[14] = g(v[2], v[6], v[10], v[14], block[s[4]], block[s[5]])
+		v[3], v[7], v[11], v[15] = g(v[3], v[7], v[11], v[15], block[s[6]], block[s[7]])
+		v[0], v[5], v[10], v[15] = g(v[0], v[5], v[10], v[15], block[s[8]], block[s[9]])
+		v[1], v[6], v[11], v[12] = g(v[1], v[6], v[11], v[12], block[s[10]], block[s[11]])
+		v[2], v[7], v[8], v[13] = g(v[2], v[7], v[8], v[13], block[s[12]], block[s[13]])
+		v[3], v[4], v[9], v[14] = g(v[3], v[4], v[9], v[14], block[s[14]], block[s[15]])
+	}
+	for i := range 8 {
+		v[i] ^= v[i+8]
+		v[i+8] ^= cv[i]
+	}
+	return v
+}
+
+func words(b []byte) [16]uint32 {
+	var w [16]uint32
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return w
+}
+
+// An output is a node that hasn't been compressed yet, because until
+// there's no more input, nobody knows whether it's the root.
+type output struct {
+	inputCV  [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o *output) chainingValue() [8]uint32 {
+	v := compress(&o.inputCV, &o.block, o.counter, o.blockLen, o.flags)
+	return [8]uint32(v[:8])
+}
+
+// rootBytes fills out with the root's output, 64 bytes per compression.
+func (o *output) rootBytes(out []byte) {
+	var block [2 * outLen]byte
+	for counter := uint64(0); len(out) > 0; counter++ {
+		v := compress(&o.inputCV, &o.block, counter, o.blockLen, o.flags|root)
+		for i, w := range v {
+			binary.LittleEndian.PutUint32(block[4*i:], w)
+		}
+		out = out[copy(out, block[:]):]
+	}
+}
+
+func parentOutput(left, right [8]uint32, key *[8]uint32, flags uint32) output {
+	o := output{inputCV: *key, blockLen: blockLen, flags: flags | parent}
+	copy(o.block[:8], left[:])
+	copy(o.block[8:], right[:])
+	return o
+}
+
+type chunkState struct {
+	cv               [8]uint32
+	counter          uint64
+	block            [blockLen]byte
+	blockLen         int
+	blocksCompressed int
+	flags            uint32
+}
+
+func newChunkState(key *[8]uint32, counter uint64, flags uint32) chunkState {
+	return chunkState{cv: *key, counter: counter, flags: flags}
+}
+
+func (c *chunkState) len() int { return blockLen*c.blocksCompressed + c.blockLen }
+
+func (c *chunkState) startFlag() uint32 {
+	if c.blocksCompressed == 0 {
+		return chunkStart
+	}
+	return 0
+}
+
+func (c *chunkState) update(p []byte) {
+	for len(p) > 0 {
+		// A full block only gets compressed once there's more input,
+		// since the last block of a chunk needs the chunkEnd flag.
+		if c.blockLen == blockLen {
+			w := words(c.block[:])
+			v := compress(&c.cv, &w, c.counter, blockLen, c.flags|c.startFlag())
+			c.cv = [8]uint32(v[:8])
+			c.blocksCompressed++
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], p)
+		c.blockLen += n
+		p = p[n:]
+	}
+}
+
+func (c *chunkState) output() output {
+	var block [blockLen]byte
+	copy(block[:], c.block[:c.blockLen])
+	return output{
+		inputCV:  c.cv,
+		block:    words(block[:]),
+		counter:  c.counter,
+		blockLen: uint32(c.blockLen),
+		flags:    c.flags | c.startFlag() | chunkEnd,
+	}
+}
+
+// A hasher takes its input a piece at a time, for stdin and anything else
+// that can't be mapped. It keeps the chaining values of the complete
+// subtrees to its left on a stack, merging two whenever the chunk count
+// says they're siblings.
+type hasher struct {
+	key     [8]uint32
+	flags   uint32
+	chunk   chunkState
+	cvStack [][8]uint32
+}
+
+// newHasher starts a hash with the key and flags of one of the three
+// modes: the IV and no flags for a plain hash, the key and keyedHash, or a
+// contextKey and deriveKeyMaterial.
+func newHasher(key [8]uint32, flags uint32) *hasher {
+	return &hasher{key: key, flags: flags, chunk: newChunkState(&key, 0, flags)}
+}
+
+func keyWords(key []byte) [8]uint32 {
+	var w [8]uint32
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	return w
+}
+
+// contextKey is the key derive-key mode uses for the key material, the
+// hash of the context string.
+func contextKey(context string) [8]uint32 {
+	h := newHasher(iv, deriveKeyContext)
+	h.Write([]byte(context))
+	var key [keyLen]byte
+	h.finish(key[:])
+	return keyWords(key[:])
+}
+
+func (h *hasher) addChunkCV(cv [8]uint32, totalChunks uint64) {
+	for totalChunks&1 == 0 {
+		o := parentOutput(h.cvStack[len(h.cvStack)-1], cv, &h.key, h.flags)
+		cv = o.chainingValue()
+		h.cvStack = h.cvStack[:len(h.cvStack)-1]
+		totalChunks >>= 1
+	}
+	h.cvStack = append(h.cvStack, cv)
+}
+
+func (h *hasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if h.chunk.len() == chunkLen {
+			o := h.chunk.output()
+			total := h.chunk.counter + 1
+			h.addChunkCV(o.chainingValue(), total)
+			h.chunk = newChunkState(&h.key, total, h.flags)
+		}
+		k := min(chunkLen-h.chunk.len(), len(p))
+		h.chunk.update(p[:k])
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (h *hasher) rootOutput() output {
+	o := h.chunk.output()
+	for i := len(h.cvStack) - 1; i >= 0; i-- {
+		o = parentOutput(h.cvStack[i], o.chainingValue(), &h.key, h.flags)
+	}
+	return o
+}
+
+func (h *hasher) finish(out []byte) {
+	o := h.rootOutput()
+	o.rootBytes(out)
+}
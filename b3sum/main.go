@@ -0,0 +1,293 @@
+package main
+
+// b3sum is a Go b3sum, for hashing release files like the ones in
+// www/files without needing Rust around. It takes the same options and
+// prints the same output as the real thing, so checksum files made by one
+// can be checked by the other:
+//
+//     go run ./b3sum www/files/*.tar.gz > SUMS
+//     go run ./b3sum --check SUMS
+//     go run ./b3sum --length 64 --no-names FILE
+//     go run ./b3sum --keyed FILE < 32-byte-key
+//     go run ./b3sum --derive-key "jacko.io 2024 example" --raw FILE
+//
+// Files of 16 KiB and up are mapped, and the BLAKE3 tree over them is split
+// between --num-threads goroutines (by default one per CPU). Smaller files
+// and stdin are read a piece at a time, and --no-mmap reads everything that
+// way, as does every file on systems that aren't Unix. The hash is the same
+// bytes whichever way it's computed.
+//
+// go test ./b3sum checks the BLAKE3 test vectors from the SUPERCOP tarballs,
+// and that mapped, parallel, and streamed hashing agree.
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+type options struct {
+	length    int
+	keyed     bool
+	deriveKey *string
+	noNames   bool
+	raw       bool
+	check     bool
+	quiet     bool
+	threads   int
+	noMmap    bool
+}
+
+// failed is whether anything has gone wrong, for the exit status.
+var failed bool
+
+// fail prints an error the way b3sum does, and carries on.
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "b3sum: %v\n", err)
+	failed = true
+}
+
+// bare drops the operation and path from an error about a file, since the
+// path gets printed anyway.
+func bare(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// escapeName makes a file name fit on one line of a checksum file. Like
+// coreutils and b3sum, a name with a backslash or a newline gets them
+// escaped, and the line that has it starts with a backslash.
+func escapeName(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n") {
+		return name, false
+	}
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(name), true
+}
+
+func unescapeName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '\\' {
+			b.WriteByte(name[i])
+			continue
+		}
+		i++
+		switch {
+		case i < len(name) && name[i] == '\\':
+			b.WriteByte('\\')
+		case i < len(name) && name[i] == 'n':
+			b.WriteByte('\n')
+		default:
+			return "", errors.New("invalid backslash escape")
+		}
+	}
+	return b.String(), nil
+}
+
+func printSum(w io.Writer, name string, sum []byte, opts *options) {
+	if opts.raw {
+		w.Write(sum)
+		return
+	}
+	if opts.noNames {
+		fmt.Fprintf(w, "%x\n", sum)
+		return
+	}
+	escaped, ok := escapeName(name)
+	if ok {
+		fmt.Fprint(w, `\`)
+	}
+	fmt.Fprintf(w, "%x  %s\n", sum, escaped)
+}
+
+func sumFiles(w io.Writer, names []string, key [8]uint32, flags uint32, opts *options) {
+	for _, name := range names {
+		out, err := hashFile(name, key, flags, opts.threads, opts.noMmap)
+		if err != nil {
+			fail(fmt.Errorf("%s: %w", name, bare(err)))
+			continue
+		}
+		sum := make([]byte, opts.length)
+		out.rootBytes(sum)
+		printSum(w, name, sum, opts)
+	}
+}
+
+// parseCheckLine splits a line of a checksum file, as written by printSum
+// with the default options, into the hash and the file name.
+func parseCheckLine(line string) ([]byte, string, error) {
+	escaped := strings.HasPrefix(line, `\`)
+	line = strings.TrimPrefix(line, `\`)
+	hexSum, name, ok := strings.Cut(line, "  ")
+	if !ok || name == "" {
+		return nil, "", errors.New("expected a hash, two spaces, and a file name")
+	}
+	if len(hexSum) != 2*outLen {
+		return nil, "", errors.New("invalid hash length")
+	}
+	sum, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return nil, "", errors.New("invalid hex")
+	}
+	if escaped {
+		if name, err = unescapeName(name); err != nil {
+			return nil, "", err
+		}
+	}
+	return sum, name, nil
+}
+
+// checkFiles reads checksum files and rehashes what they list, printing OK
+// or FAILED for each.
+func checkFiles(w io.Writer, names []string, key [8]uint32, flags uint32, opts *options) {
+	mismatches := 0
+	for _, name := range names {
+		f := os.Stdin
+		if name != "-" {
+			var err error
+			if f, err = os.Open(name); err != nil {
+				fail(fmt.Errorf("%s: %w", name, bare(err)))
+				continue
+			}
+		}
+		scanner := bufio.NewScanner(f)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimSuffix(scanner.Text(), "\r")
+			if line == "" {
+				continue
+			}
+			want, file, err := parseCheckLine(line)
+			if err != nil {
+				fail(fmt.Errorf("%s:%d: %w", name, lineNo, err))
+				continue
+			}
+			shown, ok := escapeName(file)
+			if ok {
+				shown = `\` + shown
+			}
+			out, err := hashFile(file, key, flags, opts.threads, opts.noMmap)
+			if err != nil {
+				fmt.Fprintf(w, "%s: FAILED (%v)\n", shown, bare(err))
+				mismatches++
+				continue
+			}
+			got := make([]byte, outLen)
+			out.rootBytes(got)
+			if string(got) != string(want) {
+				fmt.Fprintf(w, "%s: FAILED\n", shown)
+				mismatches++
+			} else if !opts.quiet {
+				fmt.Fprintf(w, "%s: OK\n", shown)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fail(fmt.Errorf("%s: %w", name, err))
+		}
+		if f != os.Stdin {
+			f.Close()
+		}
+	}
+	if mismatches > 0 {
+		s := "s"
+		if mismatches == 1 {
+			s = ""
+		}
+		fail(fmt.Errorf("WARNING: %d computed checksum%s did NOT match", mismatches, s))
+	}
+}
+
+// mode works out the key and flags for the hash from the options, reading
+// the key from stdin for --keyed.
+func mode(opts *options) ([8]uint32, uint32, error) {
+	switch {
+	case opts.keyed:
+		key, err := io.ReadAll(io.LimitReader(os.Stdin, keyLen+1))
+		if err != nil {
+			return iv, 0, err
+		}
+		if len(key) != keyLen {
+			return iv, 0, fmt.Errorf("key must be exactly %d bytes, got %d", keyLen, len(key))
+		}
+		return keyWords(key), keyedHash, nil
+	case opts.deriveKey != nil:
+		return contextKey(*opts.deriveKey), deriveKeyMaterial, nil
+	}
+	return iv, 0, nil
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("b3sum", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: b3sum [OPTIONS] [FILE]...")
+		fs.PrintDefaults()
+	}
+	var opts options
+	fs.IntVar(&opts.length, "length", outLen, "the number of output bytes, before hex encoding")
+	fs.IntVar(&opts.length, "l", outLen, "short for --length")
+	fs.BoolVar(&opts.keyed, "keyed", false, "use the keyed mode, reading the 32-byte key from stdin")
+	deriveKey := fs.String("derive-key", "", "use the key derivation mode, with this context string")
+	fs.BoolVar(&opts.noNames, "no-names", false, "omit file names from the output")
+	fs.BoolVar(&opts.raw, "raw", false, "write raw output bytes to stdout, rather than hex (only one input allowed)")
+	fs.BoolVar(&opts.check, "check", false, "read BLAKE3 sums from the FILEs and check them")
+	fs.BoolVar(&opts.check, "c", false, "short for --check")
+	fs.BoolVar(&opts.quiet, "quiet", false, "with --check, don't print OK for each file that matches")
+	fs.IntVar(&opts.threads, "num-threads", runtime.NumCPU(), "the most goroutines to hash one file with")
+	fs.BoolVar(&opts.noMmap, "no-mmap", false, "read files instead of mapping them, which also means one goroutine")
+	fs.Parse(args)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "derive-key" {
+			opts.deriveKey = deriveKey
+		}
+	})
+	names := fs.Args()
+	switch {
+	case opts.keyed && opts.deriveKey != nil:
+		return errors.New("--keyed and --derive-key can't be used together")
+	case opts.check && (opts.raw || opts.noNames || opts.length != outLen):
+		return errors.New("--check can't be used with --raw, --no-names, or --length")
+	case opts.length < 1:
+		return errors.New("--length has to be at least 1")
+	case opts.threads < 1:
+		return errors.New("--num-threads has to be at least 1")
+	case opts.raw && len(names) > 1:
+		return errors.New("only one filename can be provided when using --raw")
+	}
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	if opts.keyed && slices.Contains(names, "-") {
+		return errors.New("--keyed reads the key from stdin, so it needs FILE arguments other than -")
+	}
+	key, flags, err := mode(&opts)
+	if err != nil {
+		return err
+	}
+
+	// Unbuffered, so the lines come out in order with the errors.
+	if opts.check {
+		checkFiles(os.Stdout, names, key, flags, &opts)
+	} else {
+		sumFiles(os.Stdout, names, key, flags, &opts)
+	}
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fail(err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Without syscall.Mmap, every file gets read a piece at a time, as if
+// --no-mmap was given.
+func mmap(f *os.File) (data []byte, unmap func(), ok bool) {
+	return nil, nil, false
+}
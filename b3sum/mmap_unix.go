@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps f if it's a regular file big enough to be worth it. Anything
+// that goes wrong here just means reading it the slow way instead.
+func mmap(f *os.File) (data []byte, unmap func(), ok bool) {
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() < mmapMin || int64(int(info.Size())) != info.Size() {
+		return nil, nil, false
+	}
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, false
+	}
+	return data, func() { syscall.Munmap(data) }, true
+}
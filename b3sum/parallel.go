@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"math/bits"
+	"os"
+)
+
+// When the whole input is in memory, which for a file means mapped, there's
+// no need to go a chunk at a time: the tree's shape only depends on the
+// length, so the two halves of any subtree can be hashed at the same time.
+// Splitting the same way the hasher's stack merges means the result is the
+// same bytes either way.
+
+const (
+	// mmapMin is where mapping a file starts to be worth it, the same
+	// cutoff b3sum uses.
+	mmapMin = 16 << 10
+	// parallelMin is the smallest subtree that gets split between
+	// goroutines. Each half is at least 64 chunks of work.
+	parallelMin = 128 << 10
+)
+
+type treeHasher struct {
+	key   [8]uint32
+	flags uint32
+	// Every goroutine but the first needs a token from here.
+	tokens chan struct{}
+}
+
+func newTreeHasher(key [8]uint32, flags uint32, threads int) *treeHasher {
+	return &treeHasher{key: key, flags: flags, tokens: make(chan struct{}, max(threads-1, 0))}
+}
+
+func (t *treeHasher) rootOutput(input []byte) output {
+	if len(input) <= chunkLen {
+		c := newChunkState(&t.key, 0, t.flags)
+		c.update(input)
+		return c.output()
+	}
+	left, right := t.children(input, 0)
+	return parentOutput(left, right, &t.key, t.flags)
+}
+
+func (t *treeHasher) chainingValue(input []byte, counter uint64) [8]uint32 {
+	var o output
+	if len(input) <= chunkLen {
+		c := newChunkState(&t.key, counter, t.flags)
+		c.update(input)
+		o = c.output()
+	} else {
+		left, right := t.children(input, counter)
+		o = parentOutput(left, right, &t.key, t.flags)
+	}
+	return o.chainingValue()
+}
+
+// children hashes the two subtrees under a parent node. The left one is
+// the biggest power-of-two number of chunks that leaves something for the
+// right.
+func (t *treeHasher) children(input []byte, counter uint64) (left, right [8]uint32) {
+	chunks := (len(input) - 1) / chunkLen
+	n := chunkLen << (bits.Len(uint(chunks)) - 1)
+	rightCounter := counter + uint64(n/chunkLen)
+	if len(input) < parallelMin || !t.tryStart() {
+		return t.chainingValue(input[:n], counter), t.chainingValue(input[n:], rightCounter)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer func() { <-t.tokens; close(done) }()
+		left = t.chainingValue(input[:n], counter)
+	}()
+	right = t.chainingValue(input[n:], rightCounter)
+	<-done
+	return left, right
+}
+
+// tryStart takes a token if there's one free, rather than waiting for one,
+// so a goroutine that can't get help just does the work itself.
+func (t *treeHasher) tryStart() bool {
+	select {
+	case t.tokens <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// hashFile hashes a file, mapping it and splitting it between threads
+// goroutines when it's big enough, and otherwise reading it a piece at a
+// time. "-" is stdin.
+func hashFile(name string, key [8]uint32, flags uint32, threads int, noMmap bool) (output, error) {
+	f := os.Stdin
+	if name != "-" {
+		var err error
+		if f, err = os.Open(name); err != nil {
+			return output{}, err
+		}
+		defer f.Close()
+	}
+	if !noMmap {
+		if data, unmap, ok := mmap(f); ok {
+			defer unmap()
+			return newTreeHasher(key, flags, threads).rootOutput(data), nil
+		}
+	}
+	h := newHasher(key, flags)
+	if _, err := io.CopyBuffer(h, f, make([]byte, 64<<10)); err != nil {
+		return output{}, err
+	}
+	return h.rootOutput(), nil
+}
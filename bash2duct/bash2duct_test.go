@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// Each script in testdata sits next to the Go it should turn into. After a
+// change to the translation, look over the diff from
+//
+//	go test ./bash2duct -update
+func TestGolden(t *testing.T) {
+	scripts, err := filepath.Glob(filepath.Join("testdata", "*.sh"))
+	if err != nil || len(scripts) == 0 {
+		t.Fatal("no scripts in testdata")
+	}
+	for _, script := range scripts {
+		t.Run(filepath.Base(script), func(t *testing.T) {
+			goldenPath := strings.TrimSuffix(script, ".sh") + ".go.golden"
+			src, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := translate(script, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) == string(want) {
+				return
+			}
+			gotLines := strings.Split(string(got), "\n")
+			wantLines := strings.Split(string(want), "\n")
+			for i := 0; i < max(len(gotLines), len(wantLines)); i++ {
+				var g, w string
+				if i < len(gotLines) {
+					g = gotLines[i]
+				}
+				if i < len(wantLines) {
+					w = wantLines[i]
+				}
+				if g != w {
+					t.Fatalf("first difference at line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+				}
+			}
+		})
+	}
+}
+
+// The golden files only show what the translation looks like. This builds
+// the translated scripts and runs them next to bash, in the same fresh
+// directory, to check that they print the same things and exit with the
+// same status. curl is a stub that succeeds, so vars.sh doesn't wait for a
+// server.
+func TestMatchesBash(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("no bash")
+	}
+	stubs := t.TempDir()
+	if err := os.WriteFile(filepath.Join(stubs, "curl"), []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := stubs + string(os.PathListSeparator) + os.Getenv("PATH")
+	for _, name := range []string{"pipes.sh", "pipestatus.sh", "vars.sh"} {
+		t.Run(name, func(t *testing.T) {
+			script, err := filepath.Abs(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			src, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _, err := translate(script, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmp := t.TempDir()
+			goFile := filepath.Join(tmp, "script.go")
+			bin := filepath.Join(tmp, "script")
+			if err := os.WriteFile(goFile, code, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			// The generated code imports duct from this module, so it
+			// builds from here.
+			build := exec.Command("go", "build", "-o", bin, goFile)
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("building the translation: %v\n%s", err, out)
+			}
+
+			work := filepath.Join(tmp, "work")
+			run := func(name string, args ...string) (string, int) {
+				if err := os.RemoveAll(work); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Mkdir(work, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				files := map[string]string{"a.txt": "a\n", "list.txt": "skip c.txt\n", "notes.txt": "TODO\nTODO later\n"}
+				for file, content := range files {
+					if err := os.WriteFile(filepath.Join(work, file), []byte(content), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				cmd := exec.Command(name, args...)
+				cmd.Dir = work
+				cmd.Env = append(os.Environ(), "PATH="+path, "PWD="+work)
+				out, err := cmd.Output()
+				status := 0
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					status = exitErr.ExitCode()
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				return string(out), status
+			}
+			wantOut, wantStatus := run("bash", script)
+			gotOut, gotStatus := run(bin)
+			if gotOut != wantOut {
+				t.Errorf("stdout differs from bash\nbash:\n%s\ntranslation:\n%s", wantOut, gotOut)
+			}
+			if gotStatus != wantStatus {
+				t.Errorf("bash exited %d, the translation %d", wantStatus, gotStatus)
+			}
+		})
+	}
+}
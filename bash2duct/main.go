@@ -0,0 +1,80 @@
+package main
+
+// bash2duct translates a bash script into a Go program that uses the Duct
+// port in ../duct. The program imports it from this module, so build it from
+// somewhere inside the repo:
+//
+//     go run ./bash2duct deploy.sh > deploy.go
+//     go build -o deploy deploy.go
+//
+// It handles the parts of bash that scripts like push.py's ancestors were
+// made of: commands, pipelines, && and ||, set -e, redirections, variables,
+// $(...), and simple if/while/for. Anything else is left in the output as a
+// TODO comment with the original lines, listed at the top of the file and on
+// stderr, and bash2duct exits 1 so that a Makefile notices.
+//
+// Variables that the script exports, or reads before it sets them, are
+// environment variables. The rest become Go strings. The translation never
+// splits words, except in for loops, so unquoted expansions get a note.
+//
+// Pipelines only count the last command's status, like bash, unless the
+// script sets -o pipefail.
+//
+// The golden tests are the scripts in testdata, each next to the Go it
+// should turn into. The runnable ones also get built and run next to bash,
+// to check that they print the same things and exit the same way:
+//
+//     go test ./bash2duct
+//     go test ./bash2duct -update
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	output := flag.String("o", "", "write the Go code here instead of stdout")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bash2duct [-o OUT.go] SCRIPT")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code, problems, err := translate(path, src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *output != "" {
+		err = os.WriteFile(*output, code, 0o644)
+	} else {
+		_, err = os.Stdout.Write(code)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	failed := false
+	for _, p := range problems {
+		kind := "note"
+		if p.fatal {
+			kind = "TODO"
+			failed = true
+		}
+		fmt.Fprintf(os.Stderr, "%s:%d: %s: %s\n", path, p.line, kind, p.msg)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
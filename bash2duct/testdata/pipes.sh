@@ -0,0 +1,19 @@
+#!/bin/bash
+# No set -e, so failures don't stop anything.
+
+git log --oneline | head -n 5 > recent.txt
+make 2>&1 | tee build.log
+make check |& grep -v "^ok" >> failures.txt
+ls missing &> /dev/null || echo "nothing missing"
+rm stale.txt 2>/dev/null || true
+GOOS=linux GOARCH=arm64 go build -o bin/ ./... && echo built
+grep -c TODO < notes.txt
+cat <<EOF > greeting.txt
+hello $USER
+costs \$5
+EOF
+	cat <<-'EOF' | wc -l
+	literal $HOME
+	EOF
+tr a-z A-Z <<< "shout"
+{ echo one; echo two; } > both.txt
@@ -0,0 +1,21 @@
+#!/bin/bash
+# Without pipefail, a pipeline's status is its last command's.
+
+false | true || echo "not printed"
+false | true && echo "the last command wins"
+true | false || echo "a failing last command fails the pipeline"
+false | false | true && echo "however long the pipeline is"
+if false | true; then
+    echo "if sees the same status"
+fi
+
+set -e
+false | true
+echo "set -e doesn't stop for a failure on the left"
+
+set -o pipefail
+false | true || echo "with pipefail, the left side counts too"
+true | false || echo "and so does the right"
+true | true && echo "and it's fine when both succeed"
+false | true
+echo "not reached"
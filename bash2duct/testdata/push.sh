@@ -0,0 +1,12 @@
+#!/bin/bash -e
+# The shell version of push.py.
+
+cd "$(dirname "$0")"
+
+if [ -n "$(git status --porcelain)" ]; then
+    echo "repo isn't clean" >&2
+    exit 1
+fi
+
+git push origin master
+ssh jacko@jacko.io "cd /srv/jacko.io && git pull --ff-only && peru sync --no-cache"
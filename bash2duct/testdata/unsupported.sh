@@ -0,0 +1,23 @@
+#!/bin/sh
+set -e
+
+deploy() {
+    rsync -a www/ "$1"
+}
+
+case "$1" in
+    prod) deploy jacko.io:/srv ;;
+    *) echo "usage: $0 prod" ;;
+esac
+
+if [[ -f go.mod ]]; then
+    echo module
+fi
+
+rm -f *.tmp
+n=$((n + 1))
+files=(a b c)
+sleep 10 &
+echo "$@"
+a || b || c
+echo "ok"
@@ -0,0 +1,38 @@
+#!/bin/bash
+set -eo pipefail
+
+name=${1:-world}
+greeting="hello, $name"
+echo "$greeting"
+
+# PATH is read before it's set, so it stays an env var.
+PATH="$HOME/bin:$PATH"
+export GOFLAGS=-mod=mod
+export PATH
+
+count=$(ls | wc -l)
+echo "$count files in $PWD"
+
+for f in a.txt "b c.txt" $(cat list.txt); do
+    if [ "$f" = skip ]; then
+        continue
+    elif [ -f "$f" ]; then
+        wc -c "$f"
+    else
+        echo "no $f" >&2
+    fi
+done
+
+unused=$(date)
+len=len
+echo $len
+
+until curl -sf http://localhost:8000/ > /dev/null; do
+    sleep 1
+done
+while [ -z "$ready" ]; do
+    ready=yes
+done
+[ -d out ] || mkdir out
+cd out && touch stamp
+unset name
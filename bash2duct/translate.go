@@ -0,0 +1,1375 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// A problem is something the reader of the Go code should know about.
+// Untranslated parts are fatal, and they also get a TODO comment in the code
+// where they would have gone. Warnings are for things that were translated,
+// but that don't mean exactly what they meant in bash.
+type problem struct {
+	line  int
+	msg   string
+	fatal bool
+}
+
+type unsupported struct {
+	pos syntax.Pos
+	msg string
+}
+
+func (u *unsupported) Error() string { return u.msg }
+
+func notTranslated(n syntax.Node, format string, args ...any) error {
+	return &unsupported{n.Pos(), fmt.Sprintf(format, args...)}
+}
+
+// A scratch collects the side effects of translating one statement. If the
+// statement can't be translated, they get thrown away along with it.
+type scratch struct {
+	// pre is code that has to run before the statement, like the captures
+	// for $(...).
+	pre     []string
+	reads   []string
+	imports []string
+	usesArg bool
+}
+
+func (s *scratch) merge(inner *scratch) {
+	s.pre = append(s.pre, inner.pre...)
+	s.reads = append(s.reads, inner.reads...)
+	s.imports = append(s.imports, inner.imports...)
+	s.usesArg = s.usesArg || inner.usesArg
+}
+
+type translator struct {
+	name string
+	src  []string
+
+	errexit  bool
+	pipefail bool
+
+	// env holds the variables that live in the environment: everything
+	// exported, and everything read before the script assigns it, since its
+	// first value must have come from the environment. Every other variable
+	// becomes a Go string.
+	env map[string]bool
+	// locals is the Go variables, in order of first assignment.
+	locals []string
+	// read is which locals the generated code reads. It comes from a first
+	// pass over the script, so that the second pass can leave out
+	// assignments nobody reads, which Go wouldn't compile.
+	read     map[string]bool
+	final    bool
+	cur      *scratch
+	tmp      int
+	problems []problem
+	warned   map[string]bool
+}
+
+// Names the generated code already uses, plus Go's keywords and predeclared
+// identifiers. A shell variable with one of these names gets a _ added.
+var reserved = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		break case chan const continue default defer else fallthrough for func go goto if
+		import interface map package range return select struct switch type var
+		any append bool byte cap clear close comparable complex complex64 complex128 copy
+		delete error false float32 float64 imag int int8 int16 int32 int64 iota len make
+		max min new nil panic print println real recover rune string true uint uint8
+		uint16 uint32 uint64 uintptr
+		cmp duct errors fmt os slices strings
+		arg err out run main value`) {
+		reserved[name] = true
+	}
+}
+
+func goName(name string) string {
+	if reserved[name] || (strings.HasPrefix(name, "out") && strings.Trim(name[3:], "0123456789") == "") {
+		return name + "_"
+	}
+	return name
+}
+
+// Builtins that only make sense in the shell itself. The ones that the
+// translation knows what to do with are handled in builtin, and the rest
+// are errors. Anything not in this list runs as a program, including echo,
+// test and [, which all exist as programs too.
+var shellOnly = map[string]bool{
+	"cd": true, "exit": true, "set": true, "true": true, ":": true, "break": true,
+	"continue": true, "unset": true, "export": true,
+	"source": true, ".": true, "eval": true, "exec": true, "read": true, "shift": true,
+	"trap": true, "wait": true, "return": true, "local": true, "declare": true,
+	"typeset": true, "readonly": true, "pushd": true, "popd": true, "alias": true,
+	"getopts": true, "let": true, "ulimit": true, "umask": true,
+}
+
+func translate(name string, src []byte) ([]byte, []problem, error) {
+	f, err := syntax.NewParser(syntax.KeepComments(true), syntax.Variant(syntax.LangBash)).
+		Parse(strings.NewReader(string(src)), name)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := &translator{
+		name:   name,
+		src:    strings.Split(string(src), "\n"),
+		env:    make(map[string]bool),
+		warned: make(map[string]bool),
+	}
+	t.classify(f)
+	// The first pass only finds out which variables get read.
+	t.run(f)
+	reads := make(map[string]bool)
+	for _, r := range t.cur.reads {
+		reads[r] = true
+	}
+	t.read = reads
+	t.final = true
+	body := t.run(f)
+	code := t.file(body)
+	formatted, err := format.Source([]byte(code))
+	if err != nil {
+		// That's a bug in the translator, but the unformatted code is the
+		// best clue to what went wrong.
+		return []byte(code), t.problems, fmt.Errorf("formatting the output: %w", err)
+	}
+	return formatted, t.problems, nil
+}
+
+// classify decides which variables live in the environment, by walking the
+// script in order and seeing whether each name is read or written first.
+func (t *translator) classify(f *syntax.File) {
+	first := make(map[string]string)
+	mark := func(name, how string) {
+		if _, ok := first[name]; !ok {
+			first[name] = how
+		}
+	}
+	var markReads func(n syntax.Node) bool
+	markReads = func(n syntax.Node) bool {
+		if p, ok := n.(*syntax.ParamExp); ok && p.Param != nil {
+			mark(p.Param.Value, "read")
+		}
+		return true
+	}
+	syntax.Walk(f, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.DeclClause:
+			if n.Variant.Value == "export" {
+				for _, a := range n.Args {
+					if a.Name != nil {
+						t.env[a.Name.Value] = true
+					}
+				}
+			}
+		case *syntax.CallExpr:
+			if len(n.Args) == 0 {
+				for _, a := range n.Assigns {
+					// X=$X:more reads X before it writes it.
+					if a.Value != nil {
+						syntax.Walk(a.Value, markReads)
+					}
+					mark(a.Name.Value, "write")
+				}
+			}
+		case *syntax.WordIter:
+			for _, w := range n.Items {
+				syntax.Walk(w, markReads)
+			}
+			mark(n.Name.Value, "write")
+		}
+		return markReads(n)
+	})
+	for name, how := range first {
+		if how == "read" {
+			t.env[name] = true
+		}
+	}
+	var locals []string
+	syntax.Walk(f, func(n syntax.Node) bool {
+		var names []string
+		switch n := n.(type) {
+		case *syntax.CallExpr:
+			if len(n.Args) == 0 {
+				for _, a := range n.Assigns {
+					names = append(names, a.Name.Value)
+				}
+			}
+		case *syntax.WordIter:
+			names = append(names, n.Name.Value)
+		}
+		for _, name := range names {
+			if !t.env[name] && !slices.Contains(locals, name) {
+				locals = append(locals, name)
+			}
+		}
+		return true
+	})
+	t.locals = locals
+}
+
+// run translates the whole script, resetting everything that a pass
+// changes.
+func (t *translator) run(f *syntax.File) []string {
+	t.errexit, t.pipefail = false, false
+	t.tmp = 0
+	t.cur = new(scratch)
+	// A -e on the #! line counts as set -e.
+	if len(f.Stmts) > 0 && len(f.Stmts[0].Comments) > 0 {
+		if c := f.Stmts[0].Comments[0]; strings.HasPrefix(c.Text, "!") {
+			// Anything that isn't a flag is the interpreter's problem.
+			var flags []string
+			for _, flag := range strings.Fields(c.Text)[1:] {
+				if strings.HasPrefix(flag, "-") {
+					flags = append(flags, flag)
+				}
+			}
+			t.setFlags(flags, f.Stmts[0])
+		}
+	}
+	lines := t.stmts(f.Stmts)
+	for _, c := range f.Last {
+		lines = append(lines, "//"+c.Text)
+	}
+	return lines
+}
+
+// ductPackage is where the translated programs get Duct from.
+const ductPackage = "github.com/oconnor663/jacko.io/duct"
+
+func (t *translator) file(body []string) string {
+	imports := []string{"errors", "fmt", "os"}
+	for _, imp := range t.cur.imports {
+		if !slices.Contains(imports, imp) {
+			imports = append(imports, imp)
+		}
+	}
+	slices.Sort(imports)
+
+	var b strings.Builder
+	base := strings.TrimSuffix(filepath.Base(t.name), filepath.Ext(t.name))
+	fmt.Fprintf(&b, "// Translated from %s by bash2duct. It imports the Duct port from\n", filepath.Base(t.name))
+	fmt.Fprintf(&b, "// %s, so build it inside that module:\n//\n//\tgo build -o %s %s.go\n", ductPackage, base, base)
+	if len(t.problems) > 0 {
+		b.WriteString("//\n// Things to check by hand:\n//\n")
+		for _, p := range t.problems {
+			kind := "note"
+			if p.fatal {
+				kind = "TODO"
+			}
+			fmt.Fprintf(&b, "//\t%s:%d: %s: %s\n", filepath.Base(t.name), p.line, kind, p.msg)
+		}
+	}
+	b.WriteString("\npackage main\n\nimport (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "%q\n", imp)
+	}
+	fmt.Fprintf(&b, "\n%q\n", ductPackage)
+	b.WriteString(`)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		// Exit with the status of the command that failed, like bash would.
+		var exitErr *duct.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Output.Status)
+		}
+		os.Exit(1)
+	}
+}
+`)
+	if t.cur.usesArg {
+		b.WriteString(`
+// arg returns the nth command line argument, or "" if there aren't that
+// many, like $1 in the shell.
+func arg(n int) string {
+	if n < len(os.Args) {
+		return os.Args[n]
+	}
+	return ""
+}
+`)
+	}
+	b.WriteString("\nfunc run() error {\n")
+	var declared []string
+	for _, name := range t.locals {
+		if t.read[name] {
+			declared = append(declared, goName(name))
+		}
+	}
+	if len(declared) > 0 {
+		fmt.Fprintf(&b, "var %s string\n", strings.Join(declared, ", "))
+	}
+	for _, line := range body {
+		b.WriteString(line + "\n")
+	}
+	if len(body) == 0 || body[len(body)-1] != "return nil" {
+		b.WriteString("return nil\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (t *translator) warn(n syntax.Node, msg string) {
+	if !t.final {
+		return
+	}
+	key := fmt.Sprint(n.Pos().Line(), msg)
+	if t.warned[key] {
+		return
+	}
+	t.warned[key] = true
+	t.problems = append(t.problems, problem{line: int(n.Pos().Line()), msg: msg})
+}
+
+// todo is what goes in the code in place of a statement we couldn't
+// translate: the reason, and the original lines.
+func (t *translator) todo(s *syntax.Stmt, err error) []string {
+	msg := err.Error()
+	line := int(s.Pos().Line())
+	if u, ok := err.(*unsupported); ok && u.pos.IsValid() {
+		line = int(u.pos.Line())
+	}
+	if t.final {
+		t.problems = append(t.problems, problem{line: line, msg: msg, fatal: true})
+	}
+	lines := []string{fmt.Sprintf("// TODO(bash2duct): line %d: %s", line, msg)}
+	for i := s.Pos().Line(); i <= s.End().Line() && int(i) <= len(t.src); i++ {
+		lines = append(lines, "//\t"+t.src[i-1])
+	}
+	return lines
+}
+
+func (t *translator) use(imp string) {
+	t.cur.imports = append(t.cur.imports, imp)
+}
+
+func (t *translator) takePre() []string {
+	pre := t.cur.pre
+	t.cur.pre = nil
+	return pre
+}
+
+func (t *translator) stmts(list []*syntax.Stmt) []string {
+	var lines []string
+	for _, s := range list {
+		lines = append(lines, t.stmt(s)...)
+	}
+	return lines
+}
+
+func (t *translator) stmt(s *syntax.Stmt) []string {
+	var lines []string
+	for _, c := range s.Comments {
+		if !strings.HasPrefix(c.Text, "!") {
+			lines = append(lines, "//"+c.Text)
+		}
+	}
+	outer := t.cur
+	t.cur = new(scratch)
+	code, err := t.translateStmt(s)
+	if err != nil {
+		code = t.todo(s, err)
+	} else {
+		if len(t.cur.pre) > 0 {
+			panic("bash2duct: leftover code from " + t.src[s.Pos().Line()-1])
+		}
+		outer.merge(t.cur)
+	}
+	t.cur = outer
+	return append(lines, code...)
+}
+
+func (t *translator) translateStmt(s *syntax.Stmt) ([]string, error) {
+	if s.Background {
+		return nil, notTranslated(s, "background jobs aren't translated")
+	}
+	if s.Cmd == nil {
+		return nil, nil
+	}
+	if len(s.Redirs) == 0 && !s.Negated {
+		switch c := s.Cmd.(type) {
+		case *syntax.CallExpr:
+			if len(c.Args) == 0 {
+				return t.assigns(c.Assigns)
+			}
+			if name := c.Args[0].Lit(); shellOnly[name] {
+				return t.builtin(name, c)
+			}
+		case *syntax.DeclClause:
+			return t.decl(c)
+		case *syntax.IfClause:
+			return t.ifClause(c)
+		case *syntax.WhileClause:
+			return t.whileClause(c)
+		case *syntax.ForClause:
+			return t.forClause(c)
+		case *syntax.Block:
+			return t.stmts(c.Stmts), nil
+		case *syntax.BinaryCmd:
+			switch {
+			case c.Op == syntax.OrStmt && !isTrue(c.Y):
+				return t.conditional(c.X, c.Y, true)
+			case c.Op == syntax.AndStmt && (t.errexit || needsShell(c.X) || needsShell(c.Y)):
+				// With set -e, a failure on the left of && doesn't stop the
+				// script, so && is really an if. Without set -e, Then does
+				// the same thing, as long as both sides are expressions.
+				return t.conditional(c.X, c.Y, false)
+			}
+		}
+	}
+	e, err := t.expr(s)
+	if err != nil {
+		return nil, err
+	}
+	if s.Negated {
+		// A negated command never stops a set -e script.
+		e = unchecked(e)
+	}
+	return t.runExpr(e), nil
+}
+
+func (t *translator) runExpr(e string) []string {
+	if !t.errexit {
+		e = unchecked(e)
+	}
+	return append(t.takePre(), "if _, err := "+e+".Run(); err != nil {", "return err", "}")
+}
+
+func unchecked(e string) string {
+	if strings.HasSuffix(e, ".Unchecked()") {
+		return e
+	}
+	return e + ".Unchecked()"
+}
+
+// isTrue matches `true` and `:`, for `cmd || true`.
+func isTrue(s *syntax.Stmt) bool {
+	c, ok := s.Cmd.(*syntax.CallExpr)
+	return ok && len(s.Redirs) == 0 && !s.Negated && len(c.Assigns) == 0 &&
+		len(c.Args) == 1 && (c.Args[0].Lit() == "true" || c.Args[0].Lit() == ":")
+}
+
+// needsShell reports whether s has to run in the script itself, as opposed
+// to in a child process, which means it can't be part of an expression.
+func needsShell(s *syntax.Stmt) bool {
+	switch c := s.Cmd.(type) {
+	case *syntax.CallExpr:
+		return len(c.Args) == 0 || shellOnly[c.Args[0].Lit()]
+	case *syntax.BinaryCmd:
+		return needsShell(c.X) || needsShell(c.Y)
+	case *syntax.Block:
+		return slices.ContainsFunc(c.Stmts, needsShell)
+	case *syntax.Subshell:
+		return false
+	}
+	return true
+}
+
+// setFlags handles the arguments to set, or the flags on the #! line.
+func (t *translator) setFlags(args []string, n syntax.Node) error {
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		if !strings.HasPrefix(flag, "-") && !strings.HasPrefix(flag, "+") {
+			return notTranslated(n, "set with positional arguments isn't translated")
+		}
+		on := flag[0] == '-'
+		for _, c := range flag[1:] {
+			switch c {
+			case 'e':
+				t.errexit = on
+			case 'o':
+				if i+1 == len(args) {
+					return notTranslated(n, "set -o without an option isn't translated")
+				}
+				i++
+				switch opt := args[i]; opt {
+				case "errexit":
+					t.errexit = on
+				case "pipefail":
+					t.pipefail = on
+				default:
+					t.warn(n, fmt.Sprintf("set %co %s isn't translated", flag[0], opt))
+				}
+			case 'u':
+				t.warn(n, "set -u isn't translated; unset variables are just empty")
+			default:
+				t.warn(n, fmt.Sprintf("set %c%c isn't translated", flag[0], c))
+			}
+		}
+	}
+	return nil
+}
+
+func (t *translator) builtin(name string, c *syntax.CallExpr) ([]string, error) {
+	if len(c.Assigns) > 0 {
+		return nil, notTranslated(c, "env vars for the %s builtin aren't translated", name)
+	}
+	args := c.Args[1:]
+	switch name {
+	case "true", ":":
+		return nil, nil
+	case "set":
+		var flags []string
+		for _, a := range args {
+			flags = append(flags, a.Lit())
+		}
+		return nil, t.setFlags(flags, c)
+	case "cd":
+		if len(args) != 1 {
+			return nil, notTranslated(c, "cd needs exactly one directory to be translated")
+		}
+		dir, err := t.word(args[0], true)
+		if err != nil {
+			return nil, err
+		}
+		pre := t.takePre()
+		if t.errexit {
+			return append(pre, "if err := os.Chdir("+dir+"); err != nil {", "return err", "}"), nil
+		}
+		return append(pre, "if err := os.Chdir("+dir+"); err != nil {", "fmt.Fprintln(os.Stderr, err)", "}"), nil
+	case "exit":
+		if len(args) == 0 {
+			return []string{"return nil"}, nil
+		}
+		n, err := strconv.Atoi(args[0].Lit())
+		if err != nil || len(args) > 1 {
+			return nil, notTranslated(c, "exit with a status that isn't a number isn't translated")
+		}
+		if n == 0 {
+			return []string{"return nil"}, nil
+		}
+		return []string{fmt.Sprintf("os.Exit(%d)", n)}, nil
+	case "break", "continue":
+		if len(args) > 0 {
+			return nil, notTranslated(c, "%s with a count isn't translated", name)
+		}
+		return []string{name}, nil
+	case "unset":
+		var lines []string
+		for _, a := range args {
+			v := a.Lit()
+			switch {
+			case v == "" || strings.HasPrefix(v, "-"):
+				return nil, notTranslated(c, "unset is only translated for plain variable names")
+			case t.env[v]:
+				lines = append(lines, fmt.Sprintf("os.Unsetenv(%q)", v))
+			case t.readLocal(v):
+				lines = append(lines, goName(v)+` = ""`)
+			}
+		}
+		return lines, nil
+	}
+	return nil, notTranslated(c, "the %s builtin isn't translated", name)
+}
+
+// readLocal reports whether the generated code reads the local variable
+// name. During the first pass, every local counts as read.
+func (t *translator) readLocal(name string) bool {
+	return t.read == nil || t.read[name]
+}
+
+func (t *translator) assigns(assigns []*syntax.Assign) ([]string, error) {
+	var lines []string
+	for _, a := range assigns {
+		if a.Append || a.Index != nil || a.Array != nil || a.Naked {
+			return nil, notTranslated(a, "arrays and += aren't translated")
+		}
+		value := `""`
+		if a.Value != nil {
+			var err error
+			// The right side of an assignment is never split into words.
+			if value, err = t.word(a.Value, true); err != nil {
+				return nil, err
+			}
+		}
+		lines = append(lines, t.takePre()...)
+		name := a.Name.Value
+		switch {
+		case t.env[name]:
+			lines = append(lines, fmt.Sprintf("os.Setenv(%q, %s)", name, value))
+		case t.readLocal(name):
+			lines = append(lines, goName(name)+" = "+value)
+		case strings.HasPrefix(value, "out"):
+			// Nobody reads the variable, but the capture still has to run,
+			// and Go insists that we use what it captured.
+			lines = append(lines, "_ = "+value)
+		}
+	}
+	return lines, nil
+}
+
+func (t *translator) decl(d *syntax.DeclClause) ([]string, error) {
+	switch d.Variant.Value {
+	case "export", "readonly":
+	default:
+		return nil, notTranslated(d, "%s isn't translated", d.Variant.Value)
+	}
+	var plain []*syntax.Assign
+	for _, a := range d.Args {
+		if a.Name == nil {
+			return nil, notTranslated(d, "%s with options isn't translated", d.Variant.Value)
+		}
+		// A bare `export X` doesn't need any code. The variable has been
+		// in the environment all along.
+		if !a.Naked {
+			plain = append(plain, a)
+		}
+	}
+	return t.assigns(plain)
+}
+
+// A condition is either a Go boolean expression, for tests the translation
+// understands, or a Duct expression to run, which is true if it exits 0.
+type condition struct {
+	boolean string
+	expr    string
+	negate  bool
+}
+
+// header is what goes between `if` and `{`.
+func (c condition) header() string {
+	if c.boolean != "" {
+		if c.negate {
+			return "!(" + c.boolean + ")"
+		}
+		return c.boolean
+	}
+	op := "=="
+	if c.negate {
+		op = "!="
+	}
+	return "out, err := " + unchecked(c.expr) + ".Run(); err != nil {\nreturn err\n} else if out.Status " + op + " 0"
+}
+
+func (t *translator) condition(s *syntax.Stmt) (condition, error) {
+	if s.Background {
+		return condition{}, notTranslated(s, "background jobs aren't translated")
+	}
+	if c, ok := s.Cmd.(*syntax.CallExpr); ok && len(s.Redirs) == 0 && len(c.Assigns) == 0 && len(c.Args) > 0 {
+		switch name := c.Args[0].Lit(); name {
+		case "true", ":":
+			return condition{boolean: "true", negate: s.Negated}, nil
+		case "[", "test":
+			args := c.Args[1:]
+			if name == "[" {
+				if len(args) == 0 || args[len(args)-1].Lit() != "]" {
+					return condition{}, notTranslated(s, "[ without a matching ]")
+				}
+				args = args[:len(args)-1]
+			}
+			if b, ok, err := t.test(args); err != nil {
+				return condition{}, err
+			} else if ok {
+				return condition{boolean: b, negate: s.Negated}, nil
+			}
+		case "cd":
+			if len(c.Args) == 2 {
+				dir, err := t.word(c.Args[1], true)
+				if err != nil {
+					return condition{}, err
+				}
+				return condition{boolean: "os.Chdir(" + dir + ") == nil", negate: s.Negated}, nil
+			}
+		}
+	}
+	if b, ok := s.Cmd.(*syntax.BinaryCmd); ok && b.Op == syntax.AndStmt && needsShell(s) && !s.Negated && len(s.Redirs) == 0 {
+		// Something like `cd dir && [ -z "$X" ]`, which only works if both
+		// sides are Go booleans.
+		x, err := t.condition(b.X)
+		if err != nil {
+			return condition{}, err
+		}
+		y, err := t.condition(b.Y)
+		if err != nil {
+			return condition{}, err
+		}
+		if x.boolean == "" || y.boolean == "" {
+			return condition{}, notTranslated(s, "&& with a builtin in it isn't translated as a condition")
+		}
+		return condition{boolean: x.header() + " && " + y.header()}, nil
+	}
+	neg := s.Negated
+	inner := *s
+	inner.Negated = false
+	e, err := t.expr(&inner)
+	if err != nil {
+		return condition{}, err
+	}
+	return condition{expr: e, negate: neg}, nil
+}
+
+// test translates the string tests that Go can do directly. Anything else
+// (like -f) runs the test program instead.
+func (t *translator) test(args []*syntax.Word) (string, bool, error) {
+	if len(args) > 0 && args[0].Lit() == "!" {
+		b, ok, err := t.test(args[1:])
+		return "!(" + b + ")", ok, err
+	}
+	words := func(ws ...*syntax.Word) ([]string, error) {
+		var out []string
+		for _, w := range ws {
+			// Unquoted variables in tests are a classic bash bug, and the
+			// translation fixes it rather than warning about it.
+			s, err := t.word(w, true)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	switch {
+	case len(args) == 1:
+		w, err := words(args[0])
+		if err != nil {
+			return "", false, err
+		}
+		return w[0] + ` != ""`, true, nil
+	case len(args) == 2 && (args[0].Lit() == "-z" || args[0].Lit() == "-n"):
+		w, err := words(args[1])
+		if err != nil {
+			return "", false, err
+		}
+		if args[0].Lit() == "-z" {
+			return w[0] + ` == ""`, true, nil
+		}
+		return w[0] + ` != ""`, true, nil
+	case len(args) == 3 && (args[1].Lit() == "=" || args[1].Lit() == "==" || args[1].Lit() == "!="):
+		w, err := words(args[0], args[2])
+		if err != nil {
+			return "", false, err
+		}
+		op := "=="
+		if args[1].Lit() == "!=" {
+			op = "!="
+		}
+		return w[0] + " " + op + " " + w[1], true, nil
+	}
+	return "", false, nil
+}
+
+// conditional translates `x && y` and `x || y` into an if statement that
+// runs y depending on how x did.
+func (t *translator) conditional(x, y *syntax.Stmt, onFailure bool) ([]string, error) {
+	cond, err := t.condition(x)
+	if err != nil {
+		return nil, err
+	}
+	if onFailure {
+		cond.negate = !cond.negate
+	}
+	lines := t.takePre()
+	lines = append(lines, "if "+cond.header()+" {")
+	lines = append(lines, t.stmt(y)...)
+	return append(lines, "}"), nil
+}
+
+func (t *translator) ifClause(c *syntax.IfClause) ([]string, error) {
+	var lines []string
+	closers := 1
+	for first := true; c != nil; first, c = false, c.Else {
+		if !c.ThenPos.IsValid() {
+			lines = append(lines, "} else {")
+			lines = append(lines, t.stmts(c.Then)...)
+			break
+		}
+		if len(c.Cond) != 1 {
+			return nil, notTranslated(c, "if with more than one command in the condition isn't translated")
+		}
+		cond, err := t.condition(c.Cond[0])
+		if err != nil {
+			return nil, err
+		}
+		pre := t.takePre()
+		switch {
+		case first:
+			lines = append(lines, pre...)
+			lines = append(lines, "if "+cond.header()+" {")
+		case len(pre) > 0:
+			// The captures for an elif have to run after the earlier
+			// conditions fail, so they go in a nested if.
+			lines = append(lines, "} else {")
+			lines = append(lines, pre...)
+			lines = append(lines, "if "+cond.header()+" {")
+			closers++
+		default:
+			lines = append(lines, "} else if "+cond.header()+" {")
+		}
+		lines = append(lines, t.stmts(c.Then)...)
+	}
+	for range closers {
+		lines = append(lines, "}")
+	}
+	return lines, nil
+}
+
+func (t *translator) whileClause(w *syntax.WhileClause) ([]string, error) {
+	if len(w.Cond) != 1 {
+		return nil, notTranslated(w, "while with more than one command in the condition isn't translated")
+	}
+	cond, err := t.condition(w.Cond[0])
+	if err != nil {
+		return nil, err
+	}
+	pre := t.takePre()
+	var lines []string
+	if cond.boolean != "" && len(pre) == 0 {
+		cond.negate = cond.negate != w.Until
+		lines = append(lines, "for "+cond.header()+" {")
+	} else {
+		// The loop stops when the condition fails (or, for until,
+		// succeeds).
+		cond.negate = cond.negate == w.Until
+		lines = append(lines, "for {")
+		lines = append(lines, pre...)
+		lines = append(lines, "if "+cond.header()+" {", "break", "}")
+	}
+	lines = append(lines, t.stmts(w.Do)...)
+	return append(lines, "}"), nil
+}
+
+func (t *translator) forClause(f *syntax.ForClause) ([]string, error) {
+	iter, ok := f.Loop.(*syntax.WordIter)
+	if !ok || f.Select {
+		return nil, notTranslated(f, "C-style for loops and select aren't translated")
+	}
+	if !iter.InPos.IsValid() {
+		return nil, notTranslated(f, "for loops over the positional parameters aren't translated")
+	}
+	items, err := t.forItems(iter.Items)
+	if err != nil {
+		return nil, err
+	}
+	lines := t.takePre()
+	name := iter.Name.Value
+	switch {
+	case t.env[name]:
+		lines = append(lines, "for _, value := range "+items+" {", fmt.Sprintf("os.Setenv(%q, value)", name))
+	case t.readLocal(name):
+		lines = append(lines, "for _, "+goName(name)+" = range "+items+" {")
+	default:
+		lines = append(lines, "for range "+items+" {")
+	}
+	lines = append(lines, t.stmts(f.Do)...)
+	return append(lines, "}"), nil
+}
+
+// forItems builds the list a for loop iterates over. Unlike everywhere else,
+// an unquoted $X or $(...) here gets split into words, because that's nearly
+// always what a for loop is for.
+func (t *translator) forItems(items []*syntax.Word) (string, error) {
+	var groups []string
+	var plain []string
+	flush := func() {
+		if len(plain) > 0 {
+			groups = append(groups, "[]string{"+strings.Join(plain, ", ")+"}")
+			plain = nil
+		}
+	}
+	for _, w := range items {
+		s, err := t.word(w, true)
+		if err != nil {
+			return "", err
+		}
+		if len(w.Parts) == 1 {
+			switch w.Parts[0].(type) {
+			case *syntax.ParamExp, *syntax.CmdSubst:
+				flush()
+				t.use("strings")
+				groups = append(groups, "strings.Fields("+s+")")
+				continue
+			}
+		}
+		plain = append(plain, s)
+	}
+	flush()
+	switch len(groups) {
+	case 0:
+		return "[]string{}", nil
+	case 1:
+		return groups[0], nil
+	}
+	t.use("slices")
+	return "slices.Concat(" + strings.Join(groups, ", ") + ")", nil
+}
+
+// expr translates a statement that can run as a single Duct expression.
+func (t *translator) expr(s *syntax.Stmt) (string, error) {
+	if s.Background {
+		return "", notTranslated(s, "background jobs aren't translated")
+	}
+	if s.Negated {
+		return "", notTranslated(s, "! inside a pipeline or a list isn't translated")
+	}
+	var e string
+	switch c := s.Cmd.(type) {
+	case *syntax.CallExpr:
+		if len(c.Args) == 0 {
+			return "", notTranslated(s, "assignments inside a pipeline or a list aren't translated")
+		}
+		if name := c.Args[0].Lit(); shellOnly[name] && !isTrue(s) {
+			return "", notTranslated(s, "the %s builtin isn't translated inside a pipeline or a list", name)
+		}
+		var args []string
+		for _, w := range c.Args {
+			a, err := t.word(w, false)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, a)
+		}
+		e = "duct.Cmd(" + strings.Join(args, ", ") + ")"
+		// If a name is repeated, the last one wins, so it has to be the
+		// innermost Env.
+		for i := len(c.Assigns) - 1; i >= 0; i-- {
+			a := c.Assigns[i]
+			if a.Append || a.Index != nil || a.Array != nil || a.Naked {
+				return "", notTranslated(a, "arrays and += aren't translated")
+			}
+			value := `""`
+			if a.Value != nil {
+				var err error
+				if value, err = t.word(a.Value, true); err != nil {
+					return "", err
+				}
+			}
+			e += fmt.Sprintf(".Env(%q, %s)", a.Name.Value, value)
+		}
+	case *syntax.BinaryCmd:
+		if c.Op == syntax.OrStmt {
+			if !isTrue(c.Y) {
+				return "", notTranslated(s, "|| is only translated at the start of a statement, or as || true")
+			}
+			x, err := t.expr(c.X)
+			if err != nil {
+				return "", err
+			}
+			e = unchecked(x)
+			break
+		}
+		x, err := t.expr(c.X)
+		if err != nil {
+			return "", err
+		}
+		y, err := t.expr(c.Y)
+		if err != nil {
+			return "", err
+		}
+		switch c.Op {
+		case syntax.AndStmt:
+			e = x + ".Then(" + y + ")"
+		case syntax.Pipe, syntax.PipeAll:
+			if c.Op == syntax.PipeAll {
+				x += ".StderrToStdout()"
+			}
+			// Duct's pipes are always like set -o pipefail. Without it, only
+			// the last command's status counts, so the rest are unchecked.
+			if !t.pipefail {
+				x = unchecked(x)
+			}
+			e = x + ".Pipe(" + y + ")"
+		}
+	case *syntax.Block, *syntax.Subshell:
+		var list []*syntax.Stmt
+		if b, ok := c.(*syntax.Block); ok {
+			list = b.Stmts
+		} else {
+			list = c.(*syntax.Subshell).Stmts
+		}
+		if len(list) == 0 {
+			return "", notTranslated(s, "empty group")
+		}
+		for i, inner := range list {
+			x, err := t.expr(inner)
+			if err != nil {
+				return "", err
+			}
+			switch {
+			case i == 0:
+				e = x
+			case t.errexit:
+				e = e + ".Then(" + x + ")"
+			default:
+				e = unchecked(e) + ".Then(" + x + ")"
+			}
+		}
+	default:
+		return "", notTranslated(s, "%s", whyNot(c))
+	}
+	// Redirections apply left to right, and the outermost Duct modifier
+	// applies first, so the last one goes innermost.
+	var mods []string
+	for _, r := range s.Redirs {
+		m, err := t.redirect(r)
+		if err != nil {
+			return "", err
+		}
+		mods = append(mods, m...)
+	}
+	for i := len(mods) - 1; i >= 0; i-- {
+		e += "." + mods[i]
+	}
+	return e, nil
+}
+
+// whyNot says why a command can't be an expression.
+func whyNot(c syntax.Command) string {
+	switch c.(type) {
+	case *syntax.FuncDecl:
+		return "functions aren't translated"
+	case *syntax.CaseClause:
+		return "case statements aren't translated"
+	case *syntax.ArithmCmd, *syntax.LetClause:
+		return "arithmetic isn't translated"
+	case *syntax.TestClause:
+		return "[[ ]] tests aren't translated"
+	case *syntax.TimeClause:
+		return "time isn't translated"
+	case *syntax.CoprocClause:
+		return "coprocesses aren't translated"
+	case *syntax.DeclClause:
+		return "declare, local and export aren't translated inside a pipeline or a list"
+	case *syntax.IfClause, *syntax.WhileClause, *syntax.ForClause:
+		return "if, while and for aren't translated inside a pipeline or a list"
+	}
+	return fmt.Sprintf("%T isn't translated", c)
+}
+
+// redirect returns the Duct modifiers for one redirection, in the order bash
+// applies them.
+func (t *translator) redirect(r *syntax.Redirect) ([]string, error) {
+	fd := ""
+	if r.N != nil {
+		fd = r.N.Value
+	}
+	target := func() (string, error) {
+		// Redirection targets aren't split into words either.
+		return t.word(r.Word, true)
+	}
+	isNull := r.Word != nil && r.Word.Lit() == "/dev/null"
+	switch r.Op {
+	case syntax.RdrOut, syntax.RdrClob, syntax.AppOut:
+		stream := "Stdout"
+		switch fd {
+		case "", "1":
+		case "2":
+			stream = "Stderr"
+		default:
+			return nil, notTranslated(r, "redirecting file descriptor %s isn't translated", fd)
+		}
+		if isNull {
+			return []string{stream + "Null()"}, nil
+		}
+		w, err := target()
+		if err != nil {
+			return nil, err
+		}
+		if r.Op == syntax.AppOut {
+			return []string{stream + "Append(" + w + ")"}, nil
+		}
+		return []string{stream + "(" + w + ")"}, nil
+	case syntax.RdrIn:
+		if fd != "" && fd != "0" {
+			return nil, notTranslated(r, "redirecting file descriptor %s isn't translated", fd)
+		}
+		if isNull {
+			return []string{"StdinNull()"}, nil
+		}
+		w, err := target()
+		if err != nil {
+			return nil, err
+		}
+		return []string{"Stdin(" + w + ")"}, nil
+	case syntax.DplOut:
+		switch to := r.Word.Lit(); {
+		case (fd == "" || fd == "1") && to == "2":
+			return []string{"StdoutToStderr()"}, nil
+		case fd == "2" && to == "1":
+			return []string{"StderrToStdout()"}, nil
+		}
+		return nil, notTranslated(r, "only 2>&1 and >&2 are translated")
+	case syntax.RdrAll, syntax.AppAll:
+		if isNull {
+			return []string{"StdoutNull()", "StderrToStdout()"}, nil
+		}
+		w, err := target()
+		if err != nil {
+			return nil, err
+		}
+		if r.Op == syntax.AppAll {
+			return []string{"StdoutAppend(" + w + ")", "StderrToStdout()"}, nil
+		}
+		return []string{"Stdout(" + w + ")", "StderrToStdout()"}, nil
+	case syntax.Hdoc, syntax.DashHdoc:
+		body, err := t.heredoc(r)
+		if err != nil {
+			return nil, err
+		}
+		return []string{"StdinBytes([]byte(" + body + "))"}, nil
+	case syntax.WordHdoc:
+		w, err := target()
+		if err != nil {
+			return nil, err
+		}
+		return []string{"StdinBytes([]byte(" + w + ` + "\n"))`}, nil
+	}
+	return nil, notTranslated(r, "the %s redirection isn't translated", r.Op)
+}
+
+func (t *translator) heredoc(r *syntax.Redirect) (string, error) {
+	if r.Hdoc == nil {
+		return `""`, nil
+	}
+	// If any part of the delimiter is quoted, the body is taken literally.
+	literal := r.Word.Lit() == "" || strings.Contains(r.Word.Lit(), `\`)
+	var c concat
+	atLineStart := true
+	for _, p := range r.Hdoc.Parts {
+		lit, ok := p.(*syntax.Lit)
+		if !ok {
+			if err := t.part(&c, p, true); err != nil {
+				return "", err
+			}
+			atLineStart = false
+			continue
+		}
+		v := lit.Value
+		if !literal {
+			v = unescape(v, `$`+"`"+`\`+"\n")
+		}
+		if r.Op == syntax.DashHdoc {
+			var b strings.Builder
+			for _, ch := range v {
+				if ch == '\t' && atLineStart {
+					continue
+				}
+				atLineStart = ch == '\n'
+				b.WriteRune(ch)
+			}
+			v = b.String()
+		}
+		c.lit(v)
+	}
+	return c.String(), nil
+}
+
+// A concat builds a Go string expression out of literals and other
+// expressions.
+type concat struct {
+	parts   []string
+	pending strings.Builder
+	hasLit  bool
+}
+
+func (c *concat) lit(s string) {
+	c.pending.WriteString(s)
+	c.hasLit = true
+}
+
+func (c *concat) expr(e string) {
+	c.flush()
+	c.parts = append(c.parts, e)
+}
+
+func (c *concat) flush() {
+	if c.hasLit {
+		c.parts = append(c.parts, strconv.Quote(c.pending.String()))
+		c.pending.Reset()
+		c.hasLit = false
+	}
+}
+
+func (c *concat) String() string {
+	c.flush()
+	if len(c.parts) == 0 {
+		return `""`
+	}
+	return strings.Join(c.parts, " + ")
+}
+
+// unescape removes the backslashes in front of the characters in special.
+// Other backslashes stay. Outside of quotes, special is every character.
+func unescape(s, special string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (special == "" || strings.IndexByte(special, s[i+1]) >= 0) {
+			i++
+			if s[i] == '\n' {
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// word translates a shell word into a Go string expression. If quoted is
+// false, the word is in a place where bash would split it, and we warn about
+// expansions that it would have split.
+func (t *translator) word(w *syntax.Word, quoted bool) (string, error) {
+	var c concat
+	for i, p := range w.Parts {
+		if lit, ok := p.(*syntax.Lit); ok && i == 0 && (lit.Value == "~" || strings.HasPrefix(lit.Value, "~/")) {
+			c.expr(t.varRef("HOME"))
+			c.lit(unescape(lit.Value[1:], ""))
+			continue
+		}
+		if err := t.part(&c, p, false); err != nil {
+			return "", err
+		}
+		if !quoted {
+			switch p.(type) {
+			case *syntax.ParamExp, *syntax.CmdSubst:
+				t.warn(p, "an unquoted expansion is passed as one argument, without splitting it into words")
+			}
+		}
+	}
+	return c.String(), nil
+}
+
+func (t *translator) part(c *concat, p syntax.WordPart, inDoubleQuotes bool) error {
+	switch p := p.(type) {
+	case *syntax.Lit:
+		if inDoubleQuotes {
+			c.lit(unescape(p.Value, `$`+"`"+`"\`+"\n"))
+			return nil
+		}
+		if err := checkGlob(p); err != nil {
+			return err
+		}
+		c.lit(unescape(p.Value, ""))
+	case *syntax.SglQuoted:
+		if p.Dollar && strings.Contains(p.Value, `\`) {
+			return notTranslated(p, "escapes in $'...' aren't translated")
+		}
+		c.lit(p.Value)
+	case *syntax.DblQuoted:
+		if p.Dollar {
+			return notTranslated(p, `$"..." isn't translated`)
+		}
+		if len(p.Parts) == 0 {
+			c.lit("")
+		}
+		for _, inner := range p.Parts {
+			if err := t.part(c, inner, true); err != nil {
+				return err
+			}
+		}
+	case *syntax.ParamExp:
+		e, err := t.param(p)
+		if err != nil {
+			return err
+		}
+		c.expr(e)
+	case *syntax.CmdSubst:
+		e, err := t.capture(p)
+		if err != nil {
+			return err
+		}
+		c.expr(e)
+	case *syntax.ArithmExp:
+		return notTranslated(p, "arithmetic isn't translated")
+	case *syntax.ProcSubst:
+		return notTranslated(p, "process substitution isn't translated")
+	default:
+		return notTranslated(p, "%T isn't translated", p)
+	}
+	return nil
+}
+
+// checkGlob rejects unquoted globs and brace expansions. [ on its own isn't
+// a glob, or the [ command wouldn't work.
+func checkGlob(lit *syntax.Lit) error {
+	v := lit.Value
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			i++
+		case '*', '?':
+			return notTranslated(lit, "globs aren't translated")
+		case '[':
+			if strings.Contains(v[i:], "]") {
+				return notTranslated(lit, "globs aren't translated")
+			}
+		case '{':
+			if strings.Contains(v[i:], ",") && strings.Contains(v[i:], "}") {
+				return notTranslated(lit, "brace expansion isn't translated")
+			}
+		}
+	}
+	return nil
+}
+
+func (t *translator) varRef(name string) string {
+	if t.env[name] || !slices.Contains(t.locals, name) {
+		t.use("os")
+		return fmt.Sprintf("os.Getenv(%q)", name)
+	}
+	t.cur.reads = append(t.cur.reads, name)
+	return goName(name)
+}
+
+func (t *translator) param(p *syntax.ParamExp) (string, error) {
+	if p.Param == nil || p.Excl || p.Length || p.Index != nil || p.Slice != nil || p.Repl != nil || p.Names != 0 {
+		return "", notTranslated(p, "${...} is only translated for ${X} and ${X:-default}")
+	}
+	var base string
+	switch name := p.Param.Value; {
+	case name == "0":
+		base = "os.Args[0]"
+	case len(name) == 1 && name[0] >= '1' && name[0] <= '9':
+		t.cur.usesArg = true
+		base = "arg(" + name + ")"
+	case !syntax.ValidName(name):
+		return "", notTranslated(p, "$%s isn't translated", name)
+	default:
+		base = t.varRef(name)
+	}
+	if p.Exp == nil {
+		return base, nil
+	}
+	if p.Exp.Op != syntax.DefaultUnsetOrNull {
+		return "", notTranslated(p, "${X%sY} isn't translated, only ${X:-default}", p.Exp.Op)
+	}
+	def := `""`
+	if p.Exp.Word != nil {
+		var err error
+		if def, err = t.word(p.Exp.Word, true); err != nil {
+			return "", err
+		}
+	}
+	t.use("cmp")
+	return "cmp.Or(" + base + ", " + def + ")", nil
+}
+
+// capture translates $(...) into a Read before the statement it's in. With
+// set -e, a failure is an error, which is a little stricter than bash: bash
+// only stops for failures in plain assignments like X=$(cmd).
+func (t *translator) capture(p *syntax.CmdSubst) (string, error) {
+	if len(p.Stmts) == 0 {
+		return `""`, nil
+	}
+	block := &syntax.Stmt{Cmd: &syntax.Block{Stmts: p.Stmts}, Position: p.Pos()}
+	e, err := t.expr(block)
+	if err != nil {
+		return "", err
+	}
+	if !t.errexit {
+		e = unchecked(e)
+	}
+	t.tmp++
+	name := fmt.Sprintf("out%d", t.tmp)
+	t.cur.pre = append(t.cur.pre, name+", err := "+e+".Read()", "if err != nil {", "return err", "}")
+	return name, nil
+}
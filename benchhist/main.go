@@ -0,0 +1,333 @@
+package main
+
+// benchhist keeps a history of benchmark runs in a JSON-lines file and
+// compares any two of them, benchstat-style.
+//
+//     benchhist run -count 10 -label "atomic.Pointer" ./...
+//     benchhist list
+//     benchhist compare        # the last two runs
+//     benchhist compare 3 7    # runs 3 and 7
+//
+// Each run records the machine it ran on, so comparing runs from different
+// machines is allowed, but you'll get a warning.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// A run is one line in the history file.
+type run struct {
+	ID        int               `json:"id"`
+	Time      time.Time         `json:"time"`
+	Label     string            `json:"label,omitempty"`
+	Host      string            `json:"host"`
+	GoVersion string            `json:"go_version"`
+	Commit    string            `json:"commit,omitempty"`
+	Args      []string          `json:"args"`
+	Config    map[string]string `json:"config"` // goos, goarch, cpu...
+	Results   []result          `json:"results"`
+}
+
+func readHistory(path string) ([]run, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var runs []run
+	scanner := bufio.NewScanner(f)
+	// A run with a lot of benchmarks makes for a long line.
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var r run
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, scanner.Err()
+}
+
+func appendHistory(path string, r run) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func cmdRun(historyPath string, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	count := fs.Int("count", 10, "passed to go test -count")
+	bench := fs.String("bench", ".", "passed to go test -bench")
+	benchtime := fs.String("benchtime", "", "passed to go test -benchtime, if set")
+	label := fs.String("label", "", "a note to remember this run by")
+	fs.Parse(args)
+	packages := fs.Args()
+	if len(packages) == 0 {
+		packages = []string{"."}
+	}
+
+	goArgs := []string{"test", "-run", "^$", "-bench", *bench, "-count", strconv.Itoa(*count)}
+	if *benchtime != "" {
+		goArgs = append(goArgs, "-benchtime", *benchtime)
+	}
+	goArgs = append(goArgs, packages...)
+	cmd := exec.Command("go", goArgs...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Show the output as it happens, since this can take a while.
+	results, config, parseErr := parseBench(io.TeeReader(stdout, os.Stdout))
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("go test failed: %w", err)
+	}
+	if parseErr != nil {
+		return parseErr
+	}
+	if len(results) == 0 {
+		return errors.New("no benchmark results in the output")
+	}
+
+	runs, err := readHistory(historyPath)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	r := run{
+		ID:        1,
+		Time:      time.Now().UTC().Truncate(time.Second),
+		Label:     *label,
+		Host:      host,
+		GoVersion: runtime.Version(),
+		Commit:    gitCommit(),
+		Args:      goArgs,
+		Config:    config,
+		Results:   results,
+	}
+	if len(runs) > 0 {
+		r.ID = runs[len(runs)-1].ID + 1
+	}
+	if err := appendHistory(historyPath, r); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "saved run %d to %s\n", r.ID, historyPath)
+	return nil
+}
+
+func cmdList(historyPath string) error {
+	runs, err := readHistory(historyPath)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "id\ttime\thost\tcpu\tcommit\tresults\tlabel")
+	for _, r := range runs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n", r.ID, r.Time.Local().Format(time.DateTime),
+			r.Host, r.Config["cpu"], r.Commit, len(r.Results), r.Label)
+	}
+	return w.Flush()
+}
+
+func findRun(runs []run, arg string) (run, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return run{}, fmt.Errorf("run IDs are numbers, not %q", arg)
+	}
+	for _, r := range runs {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return run{}, fmt.Errorf("no run with ID %d", id)
+}
+
+// samples groups a run's results by package, benchmark and unit.
+type key struct {
+	pkg, name, unit string
+}
+
+func samples(r run) (map[key][]float64, []key) {
+	m := make(map[key][]float64)
+	var order []key
+	for _, res := range r.Results {
+		// Keep the units in a stable order. ns/op first, like go test.
+		units := make([]string, 0, len(res.Values))
+		for unit := range res.Values {
+			units = append(units, unit)
+		}
+		slices.SortFunc(units, func(a, b string) int {
+			if (a == "ns/op") != (b == "ns/op") {
+				if a == "ns/op" {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a, b)
+		})
+		for _, unit := range units {
+			k := key{res.Pkg, res.Name, unit}
+			if _, ok := m[k]; !ok {
+				order = append(order, k)
+			}
+			m[k] = append(m[k], res.Values[unit])
+		}
+	}
+	return m, order
+}
+
+// higherIsBetter is true for throughput units like MB/s, and false for
+// costs like ns/op, B/op and allocs/op.
+func higherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
+
+func formatCI(xs []float64) string {
+	lo, hi := medianCI(xs, 0.95)
+	m := median(xs)
+	if math.IsInf(lo, 0) || math.IsInf(hi, 0) {
+		return "∞"
+	}
+	if m == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", 100*max(m-lo, hi-m)/m)
+}
+
+func cmdCompare(historyPath string, args []string) (regressions int, err error) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	alpha := fs.Float64("alpha", 0.05, "significance level")
+	fs.Parse(args)
+	runs, err := readHistory(historyPath)
+	if err != nil {
+		return 0, err
+	}
+	var oldRun, newRun run
+	switch fs.NArg() {
+	case 0:
+		if len(runs) < 2 {
+			return 0, errors.New("need at least two runs to compare")
+		}
+		oldRun, newRun = runs[len(runs)-2], runs[len(runs)-1]
+	case 2:
+		if oldRun, err = findRun(runs, fs.Arg(0)); err != nil {
+			return 0, err
+		}
+		if newRun, err = findRun(runs, fs.Arg(1)); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, errors.New("usage: benchhist compare [OLD_ID NEW_ID]")
+	}
+
+	fmt.Printf("old: run %d, %s, %s %s\n", oldRun.ID, oldRun.Time.Local().Format(time.DateTime), oldRun.Commit, oldRun.Label)
+	fmt.Printf("new: run %d, %s, %s %s\n", newRun.ID, newRun.Time.Local().Format(time.DateTime), newRun.Commit, newRun.Label)
+	for _, k := range []string{"goos", "goarch", "cpu"} {
+		if oldRun.Config[k] != newRun.Config[k] {
+			fmt.Printf("warning: %s differs: %q vs %q\n", k, oldRun.Config[k], newRun.Config[k])
+		}
+	}
+	if oldRun.Host != newRun.Host {
+		fmt.Printf("warning: different hosts: %s vs %s\n", oldRun.Host, newRun.Host)
+	}
+	fmt.Println()
+
+	oldSamples, order := samples(oldRun)
+	newSamples, _ := samples(newRun)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "benchmark\tunit\told\t±\tnew\t±\tdelta\tp\t")
+	for _, k := range order {
+		a, b := oldSamples[k], newSamples[k]
+		if len(b) == 0 {
+			continue
+		}
+		ma, mb := median(a), median(b)
+		p := mannWhitney(a, b)
+		delta := "~"
+		note := ""
+		if p < *alpha && ma != 0 {
+			change := (mb - ma) / ma
+			delta = fmt.Sprintf("%+.2f%%", 100*change)
+			if (change > 0) != higherIsBetter(k.unit) && change != 0 {
+				note = "REGRESSION"
+				regressions++
+			}
+		}
+		name := k.name
+		if k.pkg != "" {
+			name = k.pkg + "." + k.name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.4g\t%s\t%.4g\t%s\t%s\tp=%.3f n=%d+%d\t%s\n",
+			name, k.unit, ma, formatCI(a), mb, formatCI(b), delta, p, len(a), len(b), note)
+	}
+	w.Flush()
+	return regressions, nil
+}
+
+func main() {
+	historyPath := flag.String("history", ".benchhist.jsonl", "the history file")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: benchhist [-history FILE] run [flags] [packages] | list | compare [OLD NEW]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "run":
+		err = cmdRun(*historyPath, flag.Args()[1:])
+	case "list":
+		err = cmdList(*historyPath)
+	case "compare":
+		var regressions int
+		regressions, err = cmdCompare(*historyPath, flag.Args()[1:])
+		if err == nil && regressions > 0 {
+			fmt.Fprintf(os.Stderr, "%d significant regression(s)\n", regressions)
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
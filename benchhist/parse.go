@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A result is one line of `go test -bench` output. With -count 10, each
+// benchmark gets ten of these.
+type result struct {
+	Pkg    string             `json:"pkg"`
+	Name   string             `json:"name"`
+	Iters  int64              `json:"iters"`
+	Values map[string]float64 `json:"values"` // unit -> value, like "ns/op" -> 123.4
+}
+
+// parseBench reads the standard benchmark format, which is described in
+// https://go.dev/design/14313-benchmark-format. Configuration lines like
+// "goos: linux" go into config, except for "pkg:", which changes partway
+// through the output when several packages are benchmarked, so it's recorded
+// on each result instead. Everything that isn't a benchmark or a config line
+// (PASS, ok, log output) is ignored.
+func parseBench(r io.Reader) (results []result, config map[string]string, err error) {
+	config = make(map[string]string)
+	pkg := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if res, ok := parseResultLine(line); ok {
+			res.Pkg = pkg
+			results = append(results, res)
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") || key != strings.ToLower(key) {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if key == "pkg" {
+			pkg = value
+		} else {
+			config[key] = value
+		}
+	}
+	return results, config, scanner.Err()
+}
+
+// parseResultLine parses a line like
+//
+//	BenchmarkFoo-8   	 1000000	      1234 ns/op	      16 B/op	       1 allocs/op
+func parseResultLine(line string) (result, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+		return result{}, false
+	}
+	iters, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return result{}, false
+	}
+	res := result{Name: fields[0], Iters: iters, Values: make(map[string]float64)}
+	for i := 2; i < len(fields); i += 2 {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return result{}, false
+		}
+		res.Values[fields[i+1]] = v
+	}
+	return res, true
+}
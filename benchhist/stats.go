@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+func median(xs []float64) float64 {
+	s := slices.Sorted(slices.Values(xs))
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// medianCI returns a distribution-free confidence interval for the median,
+// from the order statistics of the sample. The number of samples below the
+// true median is Binomial(n, 1/2), so we pick the widest k with at most
+// (1-confidence)/2 chance of k or fewer samples landing below it. With too
+// few samples no k works, and the interval is infinite. (benchstat needs six
+// samples for a 95% interval, for the same reason.)
+func medianCI(xs []float64, confidence float64) (lo, hi float64) {
+	s := slices.Sorted(slices.Values(xs))
+	n := len(s)
+	tail := (1 - confidence) / 2
+	k := -1
+	cdf := 0.0
+	for i := 0; i < n; i++ {
+		cdf += binomialPMF(n, i)
+		if cdf > tail {
+			break
+		}
+		k = i
+	}
+	if k < 0 {
+		return math.Inf(-1), math.Inf(1)
+	}
+	return s[k], s[n-1-k]
+}
+
+func binomialPMF(n, k int) float64 {
+	lg := func(x int) float64 { v, _ := math.Lgamma(float64(x + 1)); return v }
+	return math.Exp(lg(n) - lg(k) - lg(n-k) - float64(n)*math.Ln2)
+}
+
+// mannWhitney returns the two-sided p-value of the Mann-Whitney U test, which
+// asks whether values from one sample tend to be larger than values from the
+// other, without assuming anything about their distributions. Benchmark
+// timings are usually skewed and sometimes bimodal, which is why benchstat
+// uses this instead of a t-test.
+func mannWhitney(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	// Rank everything together, giving tied values the average of their
+	// ranks.
+	type sample struct {
+		v     float64
+		fromA bool
+	}
+	var all []sample
+	for _, v := range a {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range b {
+		all = append(all, sample{v, false})
+	}
+	slices.SortFunc(all, func(x, y sample) int {
+		switch {
+		case x.v < y.v:
+			return -1
+		case x.v > y.v:
+			return 1
+		}
+		return 0
+	})
+	rankSumA := 0.0
+	ties := false
+	tieCorrection := 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSumA += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieCorrection += t*t*t - t
+		}
+		i = j
+	}
+	u := rankSumA - float64(n1*(n1+1))/2
+
+	if !ties && n1*n2 <= 2500 {
+		return exactMannWhitney(n1, n2, u)
+	}
+	// The normal approximation, with corrections for ties and continuity.
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - tieCorrection/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma
+	return min(1, math.Erfc(max(z, 0)/math.Sqrt2))
+}
+
+// exactMannWhitney computes the p-value from the exact distribution of U,
+// by counting how many ways of splitting the ranks between the two samples
+// give each value of U.
+func exactMannWhitney(n1, n2 int, u float64) float64 {
+	maxU := n1 * n2
+	// counts[i][j][u] would be the number of arrangements of i samples from
+	// a and j from b with statistic u. We only need the previous i.
+	prev := make([][]float64, n2+1)
+	for j := range prev {
+		prev[j] = make([]float64, maxU+1)
+		prev[j][0] = 1
+	}
+	for i := 1; i <= n1; i++ {
+		cur := make([][]float64, n2+1)
+		cur[0] = make([]float64, maxU+1)
+		cur[0][0] = 1
+		for j := 1; j <= n2; j++ {
+			cur[j] = make([]float64, maxU+1)
+			for x := 0; x <= i*j; x++ {
+				// The largest value is either from a, in which case it beats
+				// all j of b's values, or from b, in which case it beats none
+				// of a's.
+				c := cur[j-1][x]
+				if x >= j {
+					c += prev[j][x-j]
+				}
+				cur[j][x] = c
+			}
+		}
+		prev = cur
+	}
+	dist := prev[n2]
+	total := 0.0
+	for _, c := range dist {
+		total += c
+	}
+	lower, upper := 0.0, 0.0
+	for x, c := range dist {
+		if float64(x) <= u {
+			lower += c
+		}
+		if float64(x) >= u {
+			upper += c
+		}
+	}
+	return min(1, 2*min(lower, upper)/total)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		p    float64
+	}{
+		// Of the 20 ways to split 6 ranks 3 and 3, one puts all of a
+		// below all of b, and one puts it above, so p = 2/20.
+		{"separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.1},
+		{"separated the other way", []float64{4, 5, 6}, []float64{1, 2, 3}, 0.1},
+		// 2 of the 252 ways to split 10 ranks 5 and 5.
+		{"separated, n=5", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		// U = 3, and 7 of the 20 splits have U <= 3.
+		{"interleaved", []float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		// The three 3s share rank 4, so U = 1, and the normal approximation
+		// with tie and continuity corrections gives
+		// z = (|1 - 8| - 0.5) / sqrt(16/12 * (9 - 24/56)).
+		{"ties", []float64{1, 2, 3, 3}, []float64{3, 4, 5, 6}, 0.05451447864382865},
+		// Every value is tied, so the variance is zero.
+		{"all tied", []float64{1, 1}, []float64{1, 1}, 1},
+		{"empty", nil, []float64{1, 2}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if p := mannWhitney(test.a, test.b); math.Abs(p-test.p) > 1e-9 {
+				t.Errorf("got p=%v, want %v", p, test.p)
+			}
+		})
+	}
+}
+
+func TestMedianCI(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs     []float64
+		lo, hi float64
+	}{
+		// P(all 5 below the median) = 1/32 > 0.025, so no interval works.
+		{"too few", []float64{5, 1, 4, 2, 3}, math.Inf(-1), math.Inf(1)},
+		// 1/64 <= 0.025, but 7/64 isn't, so the interval is [min, max].
+		{"six", []float64{6, 3, 1, 5, 2, 4}, 1, 6},
+		// 11/1024 <= 0.025 < 56/1024, so drop one from each end.
+		{"ten", []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5}, 2, 9},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lo, hi := medianCI(test.xs, 0.95)
+			if lo != test.lo || hi != test.hi {
+				t.Errorf("got [%v, %v], want [%v, %v]", lo, hi, test.lo, test.hi)
+			}
+		})
+	}
+	if m := median([]float64{4, 1, 3, 2}); m != 2.5 {
+		t.Errorf("median of 1..4 is %v, want 2.5", m)
+	}
+}
+
+// What `go test -bench . -benchmem` prints for two packages, including a
+// log line from a benchmark and the extra metrics that b.SetBytes and
+// b.ReportMetric add.
+const benchOutput = `goos: linux
+goarch: amd64
+pkg: github.com/oconnor663/jacko.io/ringbuf
+cpu: AMD EPYC 7B13
+BenchmarkPushPop-8   	12918472	        92.61 ns/op	       0 B/op	       0 allocs/op
+BenchmarkContended-8 	  453826	      2634 ns/op	         0.3100 spins/op	      16 B/op	       1 allocs/op
+--- BENCH: BenchmarkContended-8
+    ringbuf_test.go:88: GOMAXPROCS=8
+PASS
+ok  	github.com/oconnor663/jacko.io/ringbuf	3.120s
+pkg: github.com/oconnor663/jacko.io/blake2p
+BenchmarkHashes/BLAKE2bp_1KiB-8         	  881016	      1362 ns/op	 751.82 MB/s	       0 B/op	       0 allocs/op
+PASS
+ok  	github.com/oconnor663/jacko.io/blake2p	1.402s
+`
+
+func TestParseBench(t *testing.T) {
+	results, config, err := parseBench(strings.NewReader(benchOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantConfig := map[string]string{"goos": "linux", "goarch": "amd64", "cpu": "AMD EPYC 7B13"}
+	if len(config) != len(wantConfig) {
+		t.Errorf("got config %v, want %v", config, wantConfig)
+	}
+	for k, v := range wantConfig {
+		if config[k] != v {
+			t.Errorf("config[%q] = %q, want %q", k, config[k], v)
+		}
+	}
+
+	want := []result{
+		{"github.com/oconnor663/jacko.io/ringbuf", "BenchmarkPushPop-8", 12918472,
+			map[string]float64{"ns/op": 92.61, "B/op": 0, "allocs/op": 0}},
+		{"github.com/oconnor663/jacko.io/ringbuf", "BenchmarkContended-8", 453826,
+			map[string]float64{"ns/op": 2634, "spins/op": 0.31, "B/op": 16, "allocs/op": 1}},
+		{"github.com/oconnor663/jacko.io/blake2p", "BenchmarkHashes/BLAKE2bp_1KiB-8", 881016,
+			map[string]float64{"ns/op": 1362, "MB/s": 751.82, "B/op": 0, "allocs/op": 0}},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(results), len(want), results)
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.Pkg != w.Pkg || r.Name != w.Name || r.Iters != w.Iters || len(r.Values) != len(w.Values) {
+			t.Errorf("result %d: got %+v, want %+v", i, r, w)
+			continue
+		}
+		for unit, v := range w.Values {
+			if got, ok := r.Values[unit]; !ok || got != v {
+				t.Errorf("result %d: %s = %v, want %v", i, unit, got, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash"
+	"os"
+	"runtime"
+	"testing"
+	"text/tabwriter"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+)
+
+// A contender is one way of hashing a whole input from scratch. The
+// Benchmark functions in blake2p_test.go run the same ones, so that
+// go test -bench compares them too.
+type contender struct {
+	name string
+	sum  func([]byte)
+}
+
+var benchSizes = []int{1 << 10, 64 << 10, 1 << 20, 16 << 20}
+
+func contenders() []contender {
+	hashTree := func(newTree func(int, []byte) (*tree, error), size int, sequential bool) func([]byte) {
+		h, err := newTree(size, nil)
+		if err != nil {
+			panic(err)
+		}
+		h.sequential = sequential
+		return func(p []byte) { h.Reset(); h.Write(p); h.Sum(nil) }
+	}
+	hashPlain := func(alg string, size int) func([]byte) {
+		return func(p []byte) { n := plain(alg, size, nil); n.write(p); n.chainingValue() }
+	}
+	hashStd := func(h hash.Hash, err error) func([]byte) {
+		if err != nil {
+			panic(err)
+		}
+		return func(p []byte) { h.Reset(); h.Write(p); h.Sum(nil) }
+	}
+	return []contender{
+		{"BLAKE2bp", hashTree(newBP, 64, false)},
+		{"BLAKE2bp, one goroutine", hashTree(newBP, 64, true)},
+		{"BLAKE2b, this package", hashPlain("blake2b", 64)},
+		{"BLAKE2b, x/crypto", hashStd(blake2b.New512(nil))},
+		{"BLAKE2sp", hashTree(newSP, 32, false)},
+		{"BLAKE2sp, one goroutine", hashTree(newSP, 32, true)},
+		{"BLAKE2s, this package", hashPlain("blake2s", 32)},
+		{"BLAKE2s, x/crypto", hashStd(blake2s.New256(nil))},
+	}
+}
+
+func cmdBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.Parse(args)
+
+	fmt.Printf("GOMAXPROCS=%d, MB/s\n\n", runtime.GOMAXPROCS(0))
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "\t")
+	for _, size := range benchSizes {
+		fmt.Fprintf(w, "%s\t", byteSize(size))
+	}
+	fmt.Fprintln(w)
+	for _, c := range contenders() {
+		fmt.Fprintf(w, "%s\t", c.name)
+		for _, size := range benchSizes {
+			input := make([]byte, size)
+			r := testing.Benchmark(func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					c.sum(input)
+				}
+			})
+			mbps := float64(r.Bytes) * float64(r.N) / r.T.Seconds() / 1e6
+			fmt.Fprintf(w, "%.0f\t", mbps)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+func byteSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%d MiB", n>>20)
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KiB", n>>10)
+	}
+	return fmt.Sprintf("%d B", n)
+}
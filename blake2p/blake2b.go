@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// This is plain BLAKE2b with the whole parameter block exposed, since the
+// tree modes need fanout, depth, node offset, and the last-node flag, and
+// x/crypto/blake2b only takes a key and a size.
+
+const (
+	blake2bBlock = 128
+	blake2bOut   = 64
+)
+
+var blake2bIV = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+// The message schedule, shared with BLAKE2s, which uses the first ten rows.
+var sigma = [12][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+}
+
+// treeParams are the fields of the parameter block that the tree modes
+// set. The salt and personalization are always zero here.
+type treeParams struct {
+	digestLength byte
+	keyLength    byte
+	fanout       byte
+	depth        byte
+	leafLength   uint32
+	nodeOffset   uint64
+	nodeDepth    byte
+	innerLength  byte
+	lastNode     bool
+}
+
+type blake2bState struct {
+	h        [8]uint64
+	t        uint64 // bytes compressed so far; inputs past 2^64 bytes aren't a concern
+	buf      [blake2bBlock]byte
+	n        int // bytes in buf
+	lastNode bool
+}
+
+func newBlake2b(p treeParams) *blake2bState {
+	var block [64]byte
+	block[0] = p.digestLength
+	block[1] = p.keyLength
+	block[2] = p.fanout
+	block[3] = p.depth
+	binary.LittleEndian.PutUint32(block[4:], p.leafLength)
+	binary.LittleEndian.PutUint64(block[8:], p.nodeOffset)
+	block[16] = p.nodeDepth
+	block[17] = p.innerLength
+	d := &blake2bState{lastNode: p.lastNode}
+	for i := range d.h {
+		d.h[i] = blake2bIV[i] ^ binary.LittleEndian.Uint64(block[8*i:])
+	}
+	return d
+}
+
+// write buffers the last block, even when it's full, because only the
+// final block gets compressed with the finalization flag.
+func (d *blake2bState) write(p []byte) {
+	if d.n > 0 && len(p) > blake2bBlock-d.n {
+		k := copy(d.buf[d.n:], p)
+		p = p[k:]
+		d.t += blake2bBlock
+		d.compress(d.buf[:], false)
+		d.n = 0
+	}
+	for len(p) > blake2bBlock {
+		d.t += blake2bBlock
+		d.compress(p[:blake2bBlock], false)
+		p = p[blake2bBlock:]
+	}
+	d.n += copy(d.buf[d.n:], p)
+}
+
+// finish returns the whole 64-byte chaining value, whatever the digest
+// length in the parameters. Leaves always give the root all 64 bytes, like
+// the reference implementation; the root's output is cut to length by the
+// caller.
+func (d *blake2bState) finish() [blake2bOut]byte {
+	d.t += uint64(d.n)
+	clear(d.buf[d.n:])
+	d.compress(d.buf[:], true)
+	var out [blake2bOut]byte
+	for i, v := range d.h {
+		binary.LittleEndian.PutUint64(out[8*i:], v)
+	}
+	return out
+}
+
+func (d *blake2bState) compress(block []byte, final bool) {
+	var m [16]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[8*i:])
+	}
+	var v [16]uint64
+	copy(v[:8], d.h[:])
+	copy(v[8:], blake2bIV[:])
+	v[12] ^= d.t
+	if final {
+		v[14] = ^v[14]
+		if d.lastNode {
+			v[15] = ^v[15]
+		}
+	}
+	g := func(a, b, c, dd int, x, y uint64) {
+		v[a] += v[b] + x
+		v[dd] = bits.RotateLeft64(v[dd]^v[a], -32)
+		v[c] += v[dd]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+		v[a] += v[b] + y
+		v[dd] = bits.RotateLeft64(v[dd]^v[a], -16)
+		v[c] += v[dd]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+	}
+	for r := range 12 {
+		s := &sigma[r]
+		g(0, 4, 8, 12, m[s[0]], m[s[1]])
+		g(1, 5, 9, 13, m[s[2]], m[s[3]])
+		g(2, 6, 10, 14, m[s[4]], m[s[5]])
+		g(3, 7, 11, 15, m[s[6]], m[s[7]])
+		g(0, 5, 10, 15, m[s[8]], m[s[9]])
+		g(1, 6, 11, 12, m[s[10]], m[s[11]])
+		g(2, 7, 8, 13, m[s[12]], m[s[13]])
+		g(3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+	for i := range d.h {
+		d.h[i] ^= v[i] ^ v[i+8]
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+)
+
+var kat = flag.String("kat", "", "a comma-separated list of more vector files to check, like blake2-kat.json")
+
+// vectorFiles is every JSON file in testdata, so vendoring blake2-kat.json
+// there is all it takes to check it, plus any given with -kat.
+func vectorFiles(t *testing.T) []string {
+	names, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *kat != "" {
+		names = append(names, strings.Split(*kat, ",")...)
+	}
+	return names
+}
+
+func readVectors(t *testing.T, name string) []vector {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return vectors
+}
+
+func TestVectors(t *testing.T) {
+	for _, name := range vectorFiles(t) {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			vectors := readVectors(t, name)
+			counts := make(map[string]int)
+			for i, v := range vectors {
+				got, ok, err := runVector(v)
+				if err != nil {
+					t.Fatalf("vector %d: %v", i, err)
+				} else if !ok {
+					continue
+				}
+				counts[v.Hash]++
+				if hex.EncodeToString(got) != v.Out {
+					t.Errorf("%s, %d bytes in, %d bytes of key: got %x, want %s", v.Hash, len(v.In)/2, len(v.Key)/2, got, v.Out)
+				}
+			}
+			if len(counts) == 0 {
+				t.Fatal("no BLAKE2b, BLAKE2s, BLAKE2bp, or BLAKE2sp vectors")
+			}
+			t.Logf("checked %v", counts)
+		})
+	}
+}
+
+// hashlib can't make keyed vectors, so the key only gets checked by the
+// other files: blake2sp_ref.json from the reference code, blake2bp_keyed.json
+// from keyed_vectors.py, and blake2-kat.json once it's vendored.
+func TestKeyedVectors(t *testing.T) {
+	keyed := make(map[string]int)
+	for _, name := range vectorFiles(t) {
+		for _, v := range readVectors(t, name) {
+			if v.Key != "" {
+				keyed[v.Hash]++
+			}
+		}
+	}
+	for _, alg := range []string{"blake2bp", "blake2sp"} {
+		if keyed[alg] == 0 {
+			t.Errorf("no keyed %s vectors; vendor blake2-kat.json from github.com/BLAKE2/BLAKE2 into testdata", alg)
+		}
+	}
+}
+
+// input is random, but the same every time.
+var input = func() []byte {
+	rng := rand.New(rand.NewPCG(1, 2))
+	b := make([]byte, 3<<20+12345)
+	for i := range b {
+		b[i] = byte(rng.Uint32())
+	}
+	return b
+}()
+
+// Lengths on and around block boundaries, keyed and not, with short digests
+// too.
+func TestMatchesXCrypto(t *testing.T) {
+	for _, n := range []int{0, 1, 63, 64, 65, 127, 128, 129, 1000, 1 << 20} {
+		for _, keyLen := range []int{0, 1, 32} {
+			key := input[len(input)-keyLen:]
+			// x/crypto's BLAKE2s only has 128- and 256-bit digests, and 128
+			// needs a key, so this sticks to 256.
+			h, err := blake2s.New256(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.Write(input[:n])
+			s := plain("blake2s", blake2sOut, key)
+			s.write(input[:n])
+			if !bytes.Equal(s.chainingValue(), h.Sum(nil)) {
+				t.Errorf("BLAKE2s-256, %d bytes in, %d bytes of key", n, keyLen)
+			}
+			for _, size := range []int{1, 20, 64} {
+				h, err := blake2b.New(size, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				h.Write(input[:n])
+				b := plain("blake2b", size, key)
+				b.write(input[:n])
+				if !bytes.Equal(b.chainingValue()[:size], h.Sum(nil)) {
+					t.Errorf("BLAKE2b-%d, %d bytes in, %d bytes of key", 8*size, n, keyLen)
+				}
+			}
+		}
+	}
+}
+
+func testTree(t *testing.T, alg string, size int, key []byte) *tree {
+	t.Helper()
+	h, err := newHash(alg, 8*size, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.(*tree)
+}
+
+var treeKey = []byte("a key for checking the parallel hashes")[:20]
+
+func TestGoroutinesDontChangeTheHash(t *testing.T) {
+	for _, alg := range []string{"bp", "sp"} {
+		for _, size := range []int{1, 16, 32} {
+			for _, key := range [][]byte{nil, treeKey} {
+				seq := testTree(t, alg, size, key)
+				seq.sequential = true
+				seq.Write(input)
+				par := testTree(t, alg, size, key)
+				par.Write(input)
+				if !bytes.Equal(seq.Sum(nil), par.Sum(nil)) {
+					t.Errorf("%s: %d-byte digest, %d bytes of key", alg, size, len(key))
+				}
+			}
+		}
+	}
+}
+
+func TestWritingInPieces(t *testing.T) {
+	for _, alg := range []string{"bp", "sp"} {
+		whole := testTree(t, alg, 32, treeKey)
+		whole.Write(input)
+		want := whole.Sum(nil)
+		// Odd chunk sizes, so the buffer fills and drains at every offset,
+		// with big chunks mixed in for the parallel path.
+		for _, chunks := range [][]int{{1}, {7, 1000}, {129, 65, parallelMin + 3}, {1 << 20, 1}} {
+			h := testTree(t, alg, 32, treeKey)
+			rest := input
+			for i := 0; len(rest) > 0; i++ {
+				n := min(chunks[i%len(chunks)], len(rest))
+				h.Write(rest[:n])
+				rest = rest[n:]
+			}
+			if got := h.Sum(nil); !bytes.Equal(got, want) {
+				t.Errorf("%s: writing in chunks of %v gave %x, not %x", alg, chunks, got[:8], want[:8])
+			}
+		}
+	}
+}
+
+func TestSumAndReset(t *testing.T) {
+	for _, alg := range []string{"bp", "sp"} {
+		h := testTree(t, alg, 32, treeKey)
+		h.Write(input[:5000])
+		first := h.Sum(nil)
+		if again := h.Sum(nil); !bytes.Equal(first, again) {
+			t.Errorf("%s: a second Sum gave %x, not %x", alg, again[:8], first[:8])
+		}
+		h.Write(input[5000:10000])
+		want := testTree(t, alg, 32, treeKey)
+		want.Write(input[:10000])
+		if !bytes.Equal(h.Sum(nil), want.Sum(nil)) {
+			t.Errorf("%s: writing after Sum went wrong", alg)
+		}
+		h.Reset()
+		h.Write(input[:5000])
+		if got := h.Sum(nil); !bytes.Equal(got, first) {
+			t.Errorf("%s: after Reset, got %x, not %x", alg, got[:8], first[:8])
+		}
+	}
+}
+
+func TestKeyAndSizeGoIntoTheHash(t *testing.T) {
+	for _, alg := range []string{"bp", "sp"} {
+		var hs []hash.Hash
+		var names []string
+		for _, key := range [][]byte{nil, treeKey[:1], treeKey} {
+			for _, size := range []int{16, 32} {
+				hs = append(hs, testTree(t, alg, size, key))
+				names = append(names, fmt.Sprintf("%d-byte digest with %d bytes of key", size, len(key)))
+			}
+		}
+		seen := make(map[string]string)
+		for i, h := range hs {
+			sum := string(h.Sum(nil))
+			if other, ok := seen[sum]; ok {
+				t.Errorf("%s: %s and %s gave the same hash", alg, other, names[i])
+			}
+			seen[sum] = names[i]
+		}
+	}
+}
+
+var benchName = strings.NewReplacer(", ", "_", "x/crypto", "xcrypto", " ", "_")
+
+// The same comparison as the bench subcommand, for go test -bench. For
+// example, BLAKE2bp against x/crypto's BLAKE2b:
+//
+//	go test ./blake2p -run NONE -bench 'Hashes/^(BLAKE2bp|BLAKE2b_xcrypto)$'
+func BenchmarkHashes(b *testing.B) {
+	for _, c := range contenders() {
+		for _, size := range benchSizes {
+			input := make([]byte, size)
+			name := benchName.Replace(c.name)
+			b.Run(name+"/"+strings.ReplaceAll(byteSize(size), " ", ""), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					c.sum(input)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// BLAKE2s is BLAKE2b with 32-bit words: half the block and output size,
+// ten rounds, and different rotations.
+
+const (
+	blake2sBlock = 64
+	blake2sOut   = 32
+)
+
+var blake2sIV = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+	0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+type blake2sState struct {
+	h        [8]uint32
+	t        uint64
+	buf      [blake2sBlock]byte
+	n        int
+	lastNode bool
+}
+
+func newBlake2s(p treeParams) *blake2sState {
+	var block [32]byte
+	block[0] = p.digestLength
+	block[1] = p.keyLength
+	block[2] = p.fanout
+	block[3] = p.depth
+	binary.LittleEndian.PutUint32(block[4:], p.leafLength)
+	// The node offset is 48 bits here.
+	binary.LittleEndian.PutUint32(block[8:], uint32(p.nodeOffset))
+	binary.LittleEndian.PutUint16(block[12:], uint16(p.nodeOffset>>32))
+	block[14] = p.nodeDepth
+	block[15] = p.innerLength
+	d := &blake2sState{lastNode: p.lastNode}
+	for i := range d.h {
+		d.h[i] = blake2sIV[i] ^ binary.LittleEndian.Uint32(block[4*i:])
+	}
+	return d
+}
+
+func (d *blake2sState) write(p []byte) {
+	if d.n > 0 && len(p) > blake2sBlock-d.n {
+		k := copy(d.buf[d.n:], p)
+		p = p[k:]
+		d.t += blake2sBlock
+		d.compress(d.buf[:], false)
+		d.n = 0
+	}
+	for len(p) > blake2sBlock {
+		d.t += blake2sBlock
+		d.compress(p[:blake2sBlock], false)
+		p = p[blake2sBlock:]
+	}
+	d.n += copy(d.buf[d.n:], p)
+}
+
+func (d *blake2sState) finish() [blake2sOut]byte {
+	d.t += uint64(d.n)
+	clear(d.buf[d.n:])
+	d.compress(d.buf[:], true)
+	var out [blake2sOut]byte
+	for i, v := range d.h {
+		binary.LittleEndian.PutUint32(out[4*i:], v)
+	}
+	return out
+}
+
+func (d *blake2sState) compress(block []byte, final bool) {
+	var m [16]uint32
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+	var v [16]uint32
+	copy(v[:8], d.h[:])
+	copy(v[8:], blake2sIV[:])
+	v[12] ^= uint32(d.t)
+	v[13] ^= uint32(d.t >> 32)
+	if final {
+		v[14] = ^v[14]
+		if d.lastNode {
+			v[15] = ^v[15]
+		}
+	}
+	g := func(a, b, c, dd int, x, y uint32) {
+		v[a] += v[b] + x
+		v[dd] = bits.RotateLeft32(v[dd]^v[a], -16)
+		v[c] += v[dd]
+		v[b] = bits.RotateLeft32(v[b]^v[c], -12)
+		v[a] += v[b] + y
+		v[dd] = bits.RotateLeft32(v[dd]^v[a], -8)
+		v[c] += v[dd]
+		v[b] = bits.RotateLeft32(v[b]^v[c], -7)
+	}
+	for r := range 10 {
+		s := &sigma[r]
+		g(0, 4, 8, 12, m[s[0]], m[s[1]])
+		g(1, 5, 9, 13, m[s[2]], m[s[3]])
+		g(2, 6, 10, 14, m[s[4]], m[s[5]])
+		g(3, 7, 11, 15, m[s[6]], m[s[7]])
+		g(0, 5, 10, 15, m[s[8]], m[s[9]])
+		g(1, 6, 11, 12, m[s[10]], m[s[11]])
+		g(2, 7, 8, 13, m[s[12]], m[s[13]])
+		g(3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+	for i := range d.h {
+		d.h[i] ^= v[i] ^ v[i+8]
+	}
+}
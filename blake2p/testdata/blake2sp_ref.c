@@ -0,0 +1,51 @@
+// Writes blake2sp_ref.json, keyed BLAKE2sp vectors from the BLAKE2 reference
+// code, laid out like blake2-kat.json from the BLAKE2 repo: a 32-byte key of
+// 0, 1, 2, ..., and inputs of 0, 1, 2, ... up to 255 bytes long. Hashlib
+// can't make keyed vectors (see hashlib_vectors.py), so these cover the key
+// until the official file is vendored here. Link it against blake2sp-ref.c
+// and blake2s-ref.c from github.com/BLAKE2/BLAKE2, or the copies libarchive
+// ships as archive_blake2sp_ref.c and archive_blake2s_ref.c:
+//
+//     cc -o blake2sp_ref blake2sp_ref.c blake2sp-ref.c blake2s-ref.c
+//     ./blake2sp_ref > blake2sp_ref.json
+//
+// There's no keyed BLAKE2bp here, since libarchive only has the sp half.
+// keyed_vectors.py makes those.
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdio.h>
+
+int blake2sp(void *out, size_t outlen, const void *in, size_t inlen,
+             const void *key, size_t keylen);
+
+static void hex(const uint8_t *p, size_t n) {
+	for (size_t i = 0; i < n; i++) {
+		printf("%02x", p[i]);
+	}
+}
+
+int main(void) {
+	uint8_t key[32], in[256], out[32];
+	for (int i = 0; i < 32; i++) {
+		key[i] = i;
+	}
+	for (int i = 0; i < 256; i++) {
+		in[i] = i;
+	}
+	printf("[\n");
+	for (int n = 0; n < 256; n++) {
+		if (blake2sp(out, sizeof out, in, n, key, sizeof key) != 0) {
+			return 1;
+		}
+		printf("  {\n    \"hash\": \"blake2sp\",\n    \"in\": \"");
+		hex(in, n);
+		printf("\",\n    \"key\": \"");
+		hex(key, sizeof key);
+		printf("\",\n    \"out\": \"");
+		hex(out, sizeof out);
+		printf("\"\n  }%s\n", n < 255 ? "," : "");
+	}
+	printf("]\n");
+	return 0;
+}
@@ -0,0 +1,52 @@
+#! /usr/bin/env python3
+
+# Writes hashlib.json, BLAKE2bp and BLAKE2sp vectors in the same format as
+# blake2-kat.json from the BLAKE2 repo, computed with the tree parameters of
+# Python's hashlib. That's an independent BLAKE2 implementation, but it
+# can't set the key length in the root's parameters without also hashing
+# the key there, so these vectors are all unkeyed. Keyed BLAKE2sp comes
+# from the reference code (blake2sp_ref.c), and keyed BLAKE2bp from
+# keyed_vectors.py, until the official file is vendored here.
+
+import hashlib
+import json
+from pathlib import Path
+
+here = Path(__file__).parent
+
+LENGTHS = [0, 1, 2, 3, 63, 64, 65, 127, 128, 129, 255, 256, 257, 511, 512,
+           513, 1023, 1024, 1025, 2048, 4095]
+
+
+def tree_hash(blake2, degree, block, data):
+    out = blake2.MAX_DIGEST_SIZE
+    common = dict(digest_size=out, fanout=degree, depth=2, inner_size=out)
+    root = blake2(node_depth=1, last_node=True, **common)
+    for i in range(degree):
+        leaf = blake2(node_offset=i, node_depth=0,
+                      last_node=(i == degree - 1), **common)
+        for start in range(i * block, len(data), degree * block):
+            leaf.update(data[start:start + block])
+        root.update(leaf.digest())
+    return root.hexdigest()
+
+
+def main():
+    vectors = []
+    for name, blake2, degree, block in [("blake2bp", hashlib.blake2b, 4, 128),
+                                        ("blake2sp", hashlib.blake2s, 8, 64)]:
+        for n in LENGTHS:
+            data = bytes(i % 256 for i in range(n))
+            vectors.append({
+                "hash": name,
+                "in": data.hex(),
+                "key": "",
+                "out": tree_hash(blake2, degree, block, data),
+            })
+    with open(here / "hashlib.json", "w") as f:
+        json.dump(vectors, f, indent=2)
+        f.write("\n")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"hash"
+	"sync"
+)
+
+// BLAKE2bp and BLAKE2sp are fixed two-level trees. There are 4 (bp) or 8
+// (sp) leaves, and the input is dealt out to them one block at a time,
+// round robin: block 0 to leaf 0, block 1 to leaf 1, and so on, wrapping
+// around. The root then hashes the leaves' chaining values in order. This
+// follows blake2bp.c and blake2sp.c from the reference implementation,
+// including a few details the spec leaves to the implementer:
+//
+//   - Every node's digest length is the final output length, but the leaves
+//     still give the root their whole 64- or 32-byte state.
+//   - With a key, every leaf hashes the key block first, like keyed BLAKE2.
+//     The root has the key length in its parameters but never sees the key.
+//   - The last leaf and the root both set the last-node flag.
+//
+// Since the leaves are independent, one big Write can hash all of them at
+// once, one goroutine each.
+
+// node is a BLAKE2b or BLAKE2s state, seen from the tree.
+type node interface {
+	write(p []byte)
+	chainingValue() []byte
+	clone() node
+}
+
+type bNode struct{ *blake2bState }
+
+func (n bNode) chainingValue() []byte { cv := n.finish(); return cv[:] }
+func (n bNode) clone() node           { d := *n.blake2bState; return bNode{&d} }
+
+type sNode struct{ *blake2sState }
+
+func (n sNode) chainingValue() []byte { cv := n.finish(); return cv[:] }
+func (n sNode) clone() node           { d := *n.blake2sState; return sNode{&d} }
+
+// parallelMin is how much input a single Write needs before it's worth
+// starting goroutines. Below about this much, the goroutines cost more
+// than they save.
+const parallelMin = 32 << 10
+
+type tree struct {
+	size      int // digest length
+	blockSize int
+	outSize   int // the leaves' chaining value size
+	key       []byte
+	newNode   func(treeParams) node
+	leaves    []node
+	buf       []byte // one block for each leaf
+	n         int    // bytes in buf
+
+	// sequential turns off the goroutines, for comparing the two.
+	sequential bool
+}
+
+var (
+	_ hash.Hash = (*tree)(nil)
+
+	errSize = errors.New("blake2p: bad digest size")
+	errKey  = errors.New("blake2p: key too long")
+)
+
+// newBP returns a BLAKE2bp hash with a digest of 1 to 64 bytes and an
+// optional key of up to 64 bytes.
+func newBP(size int, key []byte) (*tree, error) {
+	return newTree(size, key, 4, blake2bBlock, blake2bOut, func(p treeParams) node {
+		return bNode{newBlake2b(p)}
+	})
+}
+
+// newSP returns a BLAKE2sp hash with a digest of 1 to 32 bytes and an
+// optional key of up to 32 bytes.
+func newSP(size int, key []byte) (*tree, error) {
+	return newTree(size, key, 8, blake2sBlock, blake2sOut, func(p treeParams) node {
+		return sNode{newBlake2s(p)}
+	})
+}
+
+func newTree(size int, key []byte, degree, blockSize, outSize int, newNode func(treeParams) node) (*tree, error) {
+	if size < 1 || size > outSize {
+		return nil, errSize
+	}
+	if len(key) > outSize {
+		return nil, errKey
+	}
+	t := &tree{
+		size:      size,
+		blockSize: blockSize,
+		outSize:   outSize,
+		key:       append([]byte(nil), key...),
+		newNode:   newNode,
+		leaves:    make([]node, degree),
+		buf:       make([]byte, degree*blockSize),
+	}
+	t.Reset()
+	return t, nil
+}
+
+func (t *tree) params(offset, depth int, last bool) treeParams {
+	return treeParams{
+		digestLength: byte(t.size),
+		keyLength:    byte(len(t.key)),
+		fanout:       byte(len(t.leaves)),
+		depth:        2,
+		nodeOffset:   uint64(offset),
+		nodeDepth:    byte(depth),
+		innerLength:  byte(t.outSize),
+		lastNode:     last,
+	}
+}
+
+func (t *tree) Reset() {
+	for i := range t.leaves {
+		t.leaves[i] = t.newNode(t.params(i, 0, i == len(t.leaves)-1))
+		if len(t.key) > 0 {
+			block := make([]byte, t.blockSize)
+			copy(block, t.key)
+			t.leaves[i].write(block)
+		}
+	}
+	t.n = 0
+}
+
+func (t *tree) Size() int      { return t.size }
+func (t *tree) BlockSize() int { return t.blockSize }
+
+func (t *tree) Write(p []byte) (int, error) {
+	written := len(p)
+	if t.n > 0 && len(p) >= len(t.buf)-t.n {
+		k := copy(t.buf[t.n:], p)
+		p = p[k:]
+		for i, leaf := range t.leaves {
+			leaf.write(t.buf[i*t.blockSize : (i+1)*t.blockSize])
+		}
+		t.n = 0
+	}
+	// Each leaf takes every degree'th block of the whole stripes in p.
+	// What's left over waits in buf for the next Write or for Sum.
+	whole := len(p) - len(p)%len(t.buf)
+	if whole > 0 {
+		stripes := p[:whole]
+		if t.sequential || whole < parallelMin {
+			for i, leaf := range t.leaves {
+				t.feed(leaf, i, stripes)
+			}
+		} else {
+			var wg sync.WaitGroup
+			for i, leaf := range t.leaves {
+				wg.Go(func() { t.feed(leaf, i, stripes) })
+			}
+			wg.Wait()
+		}
+	}
+	t.n += copy(t.buf[t.n:], p[whole:])
+	return written, nil
+}
+
+func (t *tree) feed(leaf node, i int, stripes []byte) {
+	for off := i * t.blockSize; off < len(stripes); off += len(t.buf) {
+		leaf.write(stripes[off : off+t.blockSize])
+	}
+}
+
+// Sum appends the digest to b without changing the state, so more can be
+// written afterwards.
+func (t *tree) Sum(b []byte) []byte {
+	root := t.newNode(t.params(0, 1, true))
+	for i, leaf := range t.leaves {
+		leaf = leaf.clone()
+		if start := i * t.blockSize; t.n > start {
+			leaf.write(t.buf[start:min(t.n, start+t.blockSize)])
+		}
+		root.write(leaf.chainingValue())
+	}
+	return append(b, root.chainingValue()[:t.size]...)
+}
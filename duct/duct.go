@@ -0,0 +1,807 @@
+// Package duct is a small Go port of Duct (see ../duct.md). An Expression is
+// a tree: commands at the leaves, Pipe and Then joining two subtrees, and IO
+// and environment modifiers wrapping a subtree. Nothing runs until you call
+// Run, Read or Start, so an expression can be built once, printed, and run as
+// many times as you like.
+//
+//	duct.Cmd("git", "status").Env("GIT_DIR", "/tmp/foo").Stdout("/tmp/bar").Run()
+//	out, err := duct.Cmd("echo", "foo").Pipe(duct.Sh("grep f")).Read()
+//
+// Like the other ports, any non-zero exit status anywhere in the tree is an
+// error, unless that part of the tree is wrapped in Unchecked. For a pipe,
+// that means the right side's status wins if it failed, and otherwise the
+// left side's, like `set -o pipefail`.
+package duct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+type exprKind int
+
+const (
+	cmdExpr exprKind = iota
+	shExpr
+	pipeExpr
+	thenExpr
+	ioExpr
+	remoteExpr
+)
+
+type ioKind int
+
+const (
+	stdinPath ioKind = iota
+	stdinBytes
+	stdinNull
+	stdoutPath
+	stdoutAppend
+	stdoutNull
+	stdoutCapture
+	stdoutToStderr
+	stderrPath
+	stderrAppend
+	stderrNull
+	stderrCapture
+	stderrToStdout
+	dir
+	env
+	envRemove
+	unchecked
+)
+
+// An Expression is immutable. Every method returns a new one, so it's fine to
+// share subtrees between expressions.
+type Expression struct {
+	kind exprKind
+	// argv is the command line for Cmd, and the script for Sh.
+	argv []string
+	// left and right are the two halves of a Pipe or Then. An IO modifier
+	// or a Remote wraps left.
+	left, right *Expression
+	io          ioKind
+	// path is the file, directory or env var name, depending on io, or the
+	// host for a Remote.
+	path  string
+	value string
+	data  []byte
+}
+
+// Cmd runs a program with arguments. There's no shell involved, so there's no
+// quoting to get wrong.
+func Cmd(program string, args ...string) *Expression {
+	return &Expression{kind: cmdExpr, argv: append([]string{program}, args...)}
+}
+
+// Sh runs a string of shell code with /bin/sh.
+func Sh(script string) *Expression {
+	return &Expression{kind: shExpr, argv: []string{script}}
+}
+
+// Pipe connects e's stdout to right's stdin and runs them at the same time.
+func (e *Expression) Pipe(right *Expression) *Expression {
+	return &Expression{kind: pipeExpr, left: e, right: right}
+}
+
+// Then runs right after e finishes, but only if e succeeded (or is
+// unchecked), like && in the shell.
+func (e *Expression) Then(right *Expression) *Expression {
+	return &Expression{kind: thenExpr, left: e, right: right}
+}
+
+// Remote runs e on another machine, with `ssh host -- sh -c '...'`. The whole
+// tree goes over as one shell command, quoted so that every argument arrives
+// exactly as it was given, and the remote stdin, stdout, stderr and exit status
+// come back through ssh, so Remote fits anywhere in a local tree. Paths in
+// e's modifiers are paths on the remote machine.
+//
+// Captures and StdinBytes can't be separated from the rest of ssh's output
+// and input, so they aren't allowed inside e. Put them around the Remote
+// instead. An Unchecked inside e becomes `|| :`, so the status it hides comes
+// back as 0. ssh itself exits with status 255 if it can't connect.
+func Remote(host string, e *Expression) *Expression {
+	return &Expression{kind: remoteExpr, left: e, path: host}
+}
+
+func (e *Expression) wrap(kind ioKind, path, value string, data []byte) *Expression {
+	return &Expression{kind: ioExpr, left: e, io: kind, path: path, value: value, data: data}
+}
+
+func (e *Expression) Stdin(path string) *Expression      { return e.wrap(stdinPath, path, "", nil) }
+func (e *Expression) StdinBytes(b []byte) *Expression    { return e.wrap(stdinBytes, "", "", b) }
+func (e *Expression) StdinNull() *Expression             { return e.wrap(stdinNull, "", "", nil) }
+func (e *Expression) Stdout(path string) *Expression     { return e.wrap(stdoutPath, path, "", nil) }
+func (e *Expression) StdoutNull() *Expression            { return e.wrap(stdoutNull, "", "", nil) }
+func (e *Expression) StdoutCapture() *Expression         { return e.wrap(stdoutCapture, "", "", nil) }
+func (e *Expression) StdoutToStderr() *Expression        { return e.wrap(stdoutToStderr, "", "", nil) }
+func (e *Expression) Stderr(path string) *Expression     { return e.wrap(stderrPath, path, "", nil) }
+func (e *Expression) StderrNull() *Expression            { return e.wrap(stderrNull, "", "", nil) }
+func (e *Expression) StderrCapture() *Expression         { return e.wrap(stderrCapture, "", "", nil) }
+func (e *Expression) StderrToStdout() *Expression        { return e.wrap(stderrToStdout, "", "", nil) }
+func (e *Expression) Dir(path string) *Expression        { return e.wrap(dir, path, "", nil) }
+func (e *Expression) Env(name, value string) *Expression { return e.wrap(env, name, value, nil) }
+func (e *Expression) EnvRemove(name string) *Expression  { return e.wrap(envRemove, name, "", nil) }
+
+// StdoutAppend and StderrAppend are like Stdout and Stderr, but they add to
+// the end of the file instead of truncating it. The other ports leave this to
+// the caller opening the file themselves, but >> is common enough in shell
+// scripts to get its own method here.
+func (e *Expression) StdoutAppend(path string) *Expression {
+	return e.wrap(stdoutAppend, path, "", nil)
+}
+func (e *Expression) StderrAppend(path string) *Expression {
+	return e.wrap(stderrAppend, path, "", nil)
+}
+
+// Unchecked makes a non-zero exit status anywhere inside e not count as an
+// error. The status is still reported in the Output.
+func (e *Expression) Unchecked() *Expression { return e.wrap(unchecked, "", "", nil) }
+
+// String returns the Go code that builds e.
+func (e *Expression) String() string {
+	quote := func(args []string) string {
+		quoted := make([]string, len(args))
+		for i, a := range args {
+			quoted[i] = fmt.Sprintf("%q", a)
+		}
+		return strings.Join(quoted, ", ")
+	}
+	switch e.kind {
+	case cmdExpr:
+		return "Cmd(" + quote(e.argv) + ")"
+	case shExpr:
+		return "Sh(" + quote(e.argv) + ")"
+	case pipeExpr:
+		return e.left.String() + ".Pipe(" + e.right.String() + ")"
+	case thenExpr:
+		return e.left.String() + ".Then(" + e.right.String() + ")"
+	case remoteExpr:
+		return fmt.Sprintf("Remote(%q, %s)", e.path, e.left)
+	}
+	method, args := e.modifier()
+	return fmt.Sprintf("%s.%s(%s)", e.left, method, quote(args))
+}
+
+// modifier returns the name and arguments of an IO modifier's method.
+func (e *Expression) modifier() (string, []string) {
+	switch e.io {
+	case stdinPath:
+		return "Stdin", []string{e.path}
+	case stdinBytes:
+		return "StdinBytes", []string{string(e.data)}
+	case stdinNull:
+		return "StdinNull", nil
+	case stdoutPath:
+		return "Stdout", []string{e.path}
+	case stdoutAppend:
+		return "StdoutAppend", []string{e.path}
+	case stdoutNull:
+		return "StdoutNull", nil
+	case stdoutCapture:
+		return "StdoutCapture", nil
+	case stdoutToStderr:
+		return "StdoutToStderr", nil
+	case stderrPath:
+		return "Stderr", []string{e.path}
+	case stderrAppend:
+		return "StderrAppend", []string{e.path}
+	case stderrNull:
+		return "StderrNull", nil
+	case stderrCapture:
+		return "StderrCapture", nil
+	case stderrToStdout:
+		return "StderrToStdout", nil
+	case dir:
+		return "Dir", []string{e.path}
+	case env:
+		return "Env", []string{e.path, e.value}
+	case envRemove:
+		return "EnvRemove", []string{e.path}
+	}
+	return "Unchecked", nil
+}
+
+// Tree draws e as an indented tree, one node per line.
+func (e *Expression) Tree() string {
+	var b strings.Builder
+	var draw func(e *Expression, prefix, childPrefix string)
+	draw = func(e *Expression, prefix, childPrefix string) {
+		var label string
+		var children []*Expression
+		switch e.kind {
+		case cmdExpr:
+			label = "Cmd " + quoteArgs(e.argv)
+		case shExpr:
+			label = "Sh " + quoteArgs(e.argv)
+		case pipeExpr:
+			label = "Pipe"
+			children = []*Expression{e.left, e.right}
+		case thenExpr:
+			label = "Then"
+			children = []*Expression{e.left, e.right}
+		case remoteExpr:
+			label = "Remote " + quoteArgs([]string{e.path})
+			children = []*Expression{e.left}
+		default:
+			method, args := e.modifier()
+			label = strings.TrimSpace(method + " " + quoteArgs(args))
+			children = []*Expression{e.left}
+		}
+		b.WriteString(prefix + label + "\n")
+		for i, c := range children {
+			if i == len(children)-1 {
+				draw(c, childPrefix+"└── ", childPrefix+"    ")
+			} else {
+				draw(c, childPrefix+"├── ", childPrefix+"│   ")
+			}
+		}
+	}
+	draw(e, "", "")
+	return b.String()
+}
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = fmt.Sprintf("%q", a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// An Output is what a finished expression leaves behind. Stdout and Stderr
+// are only filled in if they were captured.
+type Output struct {
+	Status int
+	Stdout []byte
+	Stderr []byte
+}
+
+// An ExitError is returned when a checked command exits with a non-zero
+// status. Expr is the command that failed, which might be deep inside the
+// expression that was run.
+type ExitError struct {
+	Expr   *Expression
+	Output *Output
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command %s exited with status %d", e.Expr, e.Output.Status)
+}
+
+// Run starts e and waits for it.
+func (e *Expression) Run() (*Output, error) {
+	h, err := e.Start()
+	if err != nil {
+		return nil, err
+	}
+	return h.Wait()
+}
+
+// Read captures e's stdout, like backticks in the shell, and trims the
+// trailing newlines.
+func (e *Expression) Read() (string, error) {
+	out, err := e.StdoutCapture().Run()
+	if out == nil {
+		return "", err
+	}
+	return strings.TrimRight(string(out.Stdout), "\n"), err
+}
+
+// A Handle is a running expression.
+type Handle struct {
+	expr     *Expression
+	root     *handle
+	captures *captures
+	once     sync.Once
+	output   *Output
+	err      error
+}
+
+// Start starts every process that e can start right away. The right sides of
+// Then start later, from a background goroutine, when their left sides
+// finish.
+func (e *Expression) Start() (*Handle, error) {
+	caps := new(captures)
+	ctx := ioContext{
+		stdin:    os.Stdin,
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		env:      os.Environ(),
+		captures: caps,
+	}
+	root, err := e.start(ctx)
+	if err != nil {
+		caps.finish()
+		return nil, err
+	}
+	return &Handle{expr: e, root: root, captures: caps}, nil
+}
+
+// Wait waits for every process in the expression to exit. It's safe to call
+// more than once, and from more than one goroutine.
+func (h *Handle) Wait() (*Output, error) {
+	h.once.Do(func() {
+		res := h.root.wait()
+		h.output = &Output{Status: res.status}
+		h.output.Stdout, h.output.Stderr = h.captures.finish()
+		switch {
+		case res.err != nil:
+			h.err = res.err
+		case res.checked && res.status != 0:
+			h.err = &ExitError{Expr: res.expr, Output: h.output}
+		}
+	})
+	return h.output, h.err
+}
+
+// Kill kills every process in the expression, and keeps any more from
+// starting. It doesn't wait for them.
+func (h *Handle) Kill() {
+	h.root.kill()
+}
+
+// An ioContext is what an expression inherits from its parent. Modifiers
+// change a copy of it for their subtree.
+type ioContext struct {
+	stdin, stdout, stderr *os.File
+	dir                   string
+	env                   []string
+	captures              *captures
+}
+
+// captures owns the capture pipes for one Start. They're shared by the whole
+// tree, so that StdoutCapture anywhere inside it ends up in the Output.
+type captures struct {
+	mu             sync.Mutex
+	stdout, stderr *capture
+}
+
+type capture struct {
+	w    *os.File
+	buf  bytes.Buffer
+	done chan struct{}
+}
+
+func (c *captures) get(which **capture) (*os.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if *which == nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		c := &capture{w: w, done: make(chan struct{})}
+		go func() {
+			c.buf.ReadFrom(r)
+			r.Close()
+			close(c.done)
+		}()
+		*which = c
+	}
+	return (*which).w, nil
+}
+
+// finish closes our ends of the capture pipes and waits for the readers to
+// hit EOF. That only happens once every child holding a write end has
+// exited, which is why it has to wait until the whole tree is done.
+func (c *captures) finish() (stdout, stderr []byte) {
+	read := func(c *capture) []byte {
+		if c == nil {
+			return nil
+		}
+		c.w.Close()
+		<-c.done
+		return c.buf.Bytes()
+	}
+	return read(c.stdout), read(c.stderr)
+}
+
+// A result is how a subtree finished. checked is false if the status came
+// from inside an Unchecked. expr is the command the status came from.
+type result struct {
+	status  int
+	checked bool
+	expr    *Expression
+	err     error
+}
+
+func (r result) failed() bool {
+	return r.err != nil || (r.checked && r.status != 0)
+}
+
+// A handle is one running node of the tree. Every node has a goroutine that
+// waits for its children, releases whatever the node opened (pipes, files),
+// and then closes done. The rule that keeps file descriptors from leaking or
+// closing too early is that a node closes what it opened only after its
+// whole subtree has finished.
+type handle struct {
+	done chan struct{}
+	res  result
+	kill func()
+}
+
+func (h *handle) wait() result {
+	<-h.done
+	return h.res
+}
+
+func newHandle(kill func()) *handle {
+	return &handle{done: make(chan struct{}), kill: kill}
+}
+
+func (e *Expression) start(ctx ioContext) (*handle, error) {
+	switch e.kind {
+	case cmdExpr, shExpr, remoteExpr:
+		return e.startCmd(ctx)
+	case pipeExpr:
+		return e.startPipe(ctx)
+	case thenExpr:
+		return e.startThen(ctx)
+	}
+	return e.startIO(ctx)
+}
+
+func (e *Expression) startCmd(ctx ioContext) (*handle, error) {
+	argv, err := e.commandLine()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = ctx.stdin, ctx.stdout, ctx.stderr
+	cmd.Dir = ctx.dir
+	cmd.Env = ctx.env
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	h := newHandle(func() { cmd.Process.Kill() })
+	go func() {
+		err := cmd.Wait()
+		h.res = result{status: exitStatus(cmd.ProcessState), checked: true, expr: e}
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			h.res.err = err
+		}
+		close(h.done)
+	}()
+	return h, nil
+}
+
+// commandLine is the argv that a Cmd, Sh or Remote runs.
+func (e *Expression) commandLine() ([]string, error) {
+	switch e.kind {
+	case shExpr:
+		return []string{"/bin/sh", "-c", e.argv[0]}, nil
+	case remoteExpr:
+		if strings.HasPrefix(e.path, "-") {
+			return nil, fmt.Errorf("Remote: host %q looks like an ssh option", e.path)
+		}
+		script, err := shellCode(e.left)
+		if err != nil {
+			return nil, err
+		}
+		// ssh joins everything after the host with spaces and hands it to
+		// the remote user's login shell, which might not be sh. So the
+		// script gets quoted one more time, as a single argument to sh -c,
+		// and that's the only parsing the login shell has to do.
+		return []string{"ssh", e.path, "--", "sh -c " + shellQuote(script)}, nil
+	}
+	return e.argv, nil
+}
+
+// exitStatus follows the shell convention of 128+N for a process killed by
+// signal N.
+func exitStatus(ps *os.ProcessState) int {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ps.ExitCode()
+}
+
+func (e *Expression) startPipe(ctx ioContext) (*handle, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	leftCtx, rightCtx := ctx, ctx
+	leftCtx.stdout = w
+	rightCtx.stdin = r
+	left, err := e.left.start(leftCtx)
+	if err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	right, err := e.right.start(rightCtx)
+	if err != nil {
+		left.kill()
+		w.Close()
+		left.wait()
+		r.Close()
+		return nil, err
+	}
+	h := newHandle(func() {
+		left.kill()
+		right.kill()
+	})
+	// Each end of the pipe gets closed as soon as its side is done. If the
+	// right side exits early, closing the read end is what lets the left
+	// side get SIGPIPE instead of blocking forever on a full pipe.
+	leftDone := make(chan result)
+	go func() {
+		res := left.wait()
+		w.Close()
+		leftDone <- res
+	}()
+	go func() {
+		rightRes := right.wait()
+		r.Close()
+		leftRes := <-leftDone
+		if rightRes.failed() || !leftRes.failed() {
+			h.res = rightRes
+		} else {
+			h.res = leftRes
+		}
+		close(h.done)
+	}()
+	return h, nil
+}
+
+func (e *Expression) startThen(ctx ioContext) (*handle, error) {
+	left, err := e.left.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var right *handle
+	killed := false
+	h := newHandle(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		killed = true
+		left.kill()
+		if right != nil {
+			right.kill()
+		}
+	})
+	go func() {
+		defer close(h.done)
+		h.res = left.wait()
+		if h.res.failed() {
+			return
+		}
+		mu.Lock()
+		if killed {
+			mu.Unlock()
+			h.res = result{err: errors.New("killed"), expr: e}
+			return
+		}
+		var startErr error
+		right, startErr = e.right.start(ctx)
+		mu.Unlock()
+		if startErr != nil {
+			h.res = result{err: startErr, expr: e.right}
+			return
+		}
+		h.res = right.wait()
+	}()
+	return h, nil
+}
+
+func openRead(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+func openWrite(path string, appending bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	return os.OpenFile(path, flags, 0o666)
+}
+
+func (e *Expression) startIO(ctx ioContext) (*handle, error) {
+	// opened is everything this node has to close when its subtree is done.
+	var opened []io.Closer
+	closeAll := func() {
+		for _, c := range opened {
+			c.Close()
+		}
+	}
+	var f *os.File
+	var err error
+	switch e.io {
+	case stdinPath:
+		f, err = openRead(e.path)
+		ctx.stdin = f
+	case stdinNull:
+		f, err = openRead(os.DevNull)
+		ctx.stdin = f
+	case stdinBytes:
+		var w *os.File
+		f, w, err = os.Pipe()
+		if err == nil {
+			// If the child exits without reading everything, this write
+			// fails with EPIPE, which is fine.
+			go func() {
+				w.Write(e.data)
+				w.Close()
+			}()
+		}
+		ctx.stdin = f
+	case stdoutPath, stdoutAppend:
+		f, err = openWrite(e.path, e.io == stdoutAppend)
+		ctx.stdout = f
+	case stdoutNull:
+		f, err = openWrite(os.DevNull, false)
+		ctx.stdout = f
+	case stdoutCapture:
+		// The captures own this one.
+		ctx.stdout, err = ctx.captures.get(&ctx.captures.stdout)
+	case stdoutToStderr:
+		ctx.stdout = ctx.stderr
+	case stderrPath, stderrAppend:
+		f, err = openWrite(e.path, e.io == stderrAppend)
+		ctx.stderr = f
+	case stderrNull:
+		f, err = openWrite(os.DevNull, false)
+		ctx.stderr = f
+	case stderrCapture:
+		ctx.stderr, err = ctx.captures.get(&ctx.captures.stderr)
+	case stderrToStdout:
+		ctx.stderr = ctx.stdout
+	case dir:
+		if filepath.IsAbs(e.path) || ctx.dir == "" {
+			ctx.dir = e.path
+		} else {
+			ctx.dir = filepath.Join(ctx.dir, e.path)
+		}
+	case env:
+		ctx.env = setEnv(ctx.env, e.path, e.value)
+	case envRemove:
+		ctx.env = removeEnv(ctx.env, e.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		opened = append(opened, f)
+	}
+	inner, err := e.left.start(ctx)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	h := newHandle(inner.kill)
+	go func() {
+		h.res = inner.wait()
+		if e.io == unchecked {
+			h.res.checked = false
+		}
+		closeAll()
+		close(h.done)
+	}()
+	return h, nil
+}
+
+// removeEnv and setEnv return modified copies of env, since other nodes
+// might share the original.
+func removeEnv(env []string, name string) []string {
+	return slices.DeleteFunc(slices.Clone(env), func(kv string) bool {
+		return strings.HasPrefix(kv, name+"=")
+	})
+}
+
+func setEnv(env []string, name, value string) []string {
+	return append(removeEnv(env, name), name+"="+value)
+}
+
+// shellQuote quotes s for a POSIX shell. Single quotes keep everything
+// literal, except single quotes themselves, which have to end the quoted
+// part, appear escaped, and start a new one.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isShellName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	return strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_") == ""
+}
+
+// shellCode turns e into sh code that does the same thing, for Remote. Every
+// subtree that isn't a single command goes in braces, so precedence never
+// comes up.
+func shellCode(e *Expression) (string, error) {
+	group := func(e *Expression) (string, error) {
+		code, err := shellCode(e)
+		if err != nil || e.kind == cmdExpr || e.kind == shExpr || e.kind == remoteExpr {
+			return code, err
+		}
+		return "{ " + code + "; }", nil
+	}
+	switch e.kind {
+	case cmdExpr, shExpr, remoteExpr:
+		argv, err := e.commandLine()
+		if err != nil {
+			return "", err
+		}
+		quoted := make([]string, len(argv))
+		for i, arg := range argv {
+			quoted[i] = shellQuote(arg)
+		}
+		return strings.Join(quoted, " "), nil
+	}
+	left, err := group(e.left)
+	if err != nil {
+		return "", err
+	}
+	switch e.kind {
+	case pipeExpr:
+		right, err := group(e.right)
+		if err != nil {
+			return "", err
+		}
+		// Plain sh doesn't have pipefail, so the left side's status comes
+		// out of the pipe on fd 4, into $_s, and the right side's stdout
+		// goes around the $(...) on fd 3. Then the status is the right
+		// side's if it failed, and otherwise the left side's.
+		return "{ _s=$( { { " + left + " 4>&-; echo $? >&4; } | { " + right + "; } 4>&- >&3 3>&-; } 4>&1 ); " +
+			`_r=$?; [ "$_r" -ne 0 ] || _r=$_s; (exit "$_r"); } 3>&1`, nil
+	case thenExpr:
+		right, err := group(e.right)
+		if err != nil {
+			return "", err
+		}
+		return left + " && " + right, nil
+	}
+	switch e.io {
+	case stdinPath:
+		return left + " < " + shellQuote(e.path), nil
+	case stdinNull:
+		return left + " < /dev/null", nil
+	case stdoutPath:
+		return left + " > " + shellQuote(e.path), nil
+	case stdoutAppend:
+		return left + " >> " + shellQuote(e.path), nil
+	case stdoutNull:
+		return left + " > /dev/null", nil
+	case stdoutToStderr:
+		return left + " >&2", nil
+	case stderrPath:
+		return left + " 2> " + shellQuote(e.path), nil
+	case stderrAppend:
+		return left + " 2>> " + shellQuote(e.path), nil
+	case stderrNull:
+		return left + " 2> /dev/null", nil
+	case stderrToStdout:
+		return left + " 2>&1", nil
+	case dir:
+		return "( cd " + shellQuote(e.path) + " && " + left + " )", nil
+	case env, envRemove:
+		if !isShellName(e.path) {
+			return "", fmt.Errorf("Remote: can't set env var %q with sh", e.path)
+		}
+		if e.io == envRemove {
+			return "( unset " + e.path + "; " + left + " )", nil
+		}
+		return "( export " + e.path + "=" + shellQuote(e.value) + "; " + left + " )", nil
+	case unchecked:
+		return left + " || :", nil
+	}
+	method, _ := e.modifier()
+	return "", fmt.Errorf("Remote: %s only works outside of a Remote", method)
+}
@@ -0,0 +1,301 @@
+package duct
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run runs e with stdout captured, and returns what it printed and its
+// status. err is whatever Run returned.
+func run(e *Expression) (string, int, error) {
+	out, err := e.StdoutCapture().Run()
+	if out == nil {
+		return "", -1, err
+	}
+	return string(out.Stdout), out.Status, err
+}
+
+// failedCommand returns the command an ExitError blames, or "" if err isn't
+// one.
+func failedCommand(err error) string {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Expr.String()
+	}
+	return ""
+}
+
+func TestStatus(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		expr   *Expression
+		out    string
+		status int
+		// blame is the command the ExitError names, or "" for no error.
+		blame string
+	}{
+		{"success", Cmd("true"), "", 0, ""},
+		{"failure", Cmd("false"), "", 1, `Cmd("false")`},
+		{"a pipe fails if the left side does", Cmd("false").Pipe(Cmd("true")), "", 1, `Cmd("false")`},
+		{"a pipe fails if the right side does", Cmd("true").Pipe(Cmd("false")), "", 1, `Cmd("false")`},
+		{"the right side's failure wins", Sh("exit 2").Pipe(Sh("exit 3")), "", 3, `Sh("exit 3")`},
+		{"an unchecked left side doesn't fail the pipe", Cmd("false").Unchecked().Pipe(Cmd("true")), "", 0, ""},
+		{"an unchecked right side still reports its status", Cmd("true").Pipe(Cmd("false").Unchecked()), "", 1, ""},
+		{"an unchecked pipe still reports its status", Cmd("false").Pipe(Cmd("true")).Unchecked(), "", 1, ""},
+		{"a pipe passes data", Cmd("echo", "hi").Pipe(Cmd("tr", "a-z", "A-Z")), "HI\n", 0, ""},
+		// The left side gets SIGPIPE, and like with pipefail, that counts.
+		{"the right side can exit early", Sh("yes").Pipe(Cmd("head", "-n", "1")), "y\n", 141, `Sh("yes")`},
+		{"then runs the right side after the left", Cmd("echo", "a").Then(Cmd("echo", "b")), "a\nb\n", 0, ""},
+		{"then stops at a failure", Cmd("false").Then(Cmd("echo", "no")), "", 1, `Cmd("false")`},
+		{"then goes on after an unchecked failure", Cmd("false").Unchecked().Then(Cmd("echo", "yes")), "yes\n", 0, ""},
+		{"then takes the right side's status", Cmd("true").Then(Sh("exit 4")), "", 4, `Sh("exit 4")`},
+		{"killed by a signal is 128+N", Sh("kill -9 $$"), "", 137, `Sh("kill -9 $$")`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out, status, err := run(c.expr)
+			if out != c.out || status != c.status {
+				t.Errorf("got %q and status %d, want %q and status %d", out, status, c.out, c.status)
+			}
+			if blame := failedCommand(err); blame != c.blame {
+				t.Errorf("got error %v, want one blaming %q", err, c.blame)
+			} else if blame == "" && err != nil {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestExitErrorMessage(t *testing.T) {
+	_, err := Cmd("echo", "hi").Pipe(Sh("exit 5")).Run()
+	want := `command Sh("exit 5") exited with status 5`
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Modifiers apply from the outside in, so the innermost one has the last
+// word, like redirections in the shell read left to right.
+func TestRedirections(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out.txt")
+	both := Sh("echo out; echo err >&2")
+
+	t.Run("stderr follows stdout into the file", func(t *testing.T) {
+		// Like `sh >out.txt 2>&1`.
+		if _, err := both.StderrToStdout().Stdout(file).Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, file); got != "out\nerr\n" {
+			t.Errorf("file has %q", got)
+		}
+	})
+
+	t.Run("stderr goes where stdout was before the file", func(t *testing.T) {
+		// Like `sh 2>&1 >out.txt`.
+		out, err := both.Stdout(file).StderrToStdout().StdoutCapture().Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, file); got != "out\n" {
+			t.Errorf("file has %q", got)
+		}
+		if string(out.Stdout) != "err\n" {
+			t.Errorf("captured %q", out.Stdout)
+		}
+	})
+
+	t.Run("append", func(t *testing.T) {
+		path := filepath.Join(dir, "log.txt")
+		for range 2 {
+			if _, err := Cmd("echo", "line").StdoutAppend(path).Run(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := Cmd("echo", "err").StdoutToStderr().StderrAppend(path).Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, path); got != "line\nline\nerr\n" {
+			t.Errorf("file has %q", got)
+		}
+		if _, err := Cmd("echo", "new").Stdout(path).Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, path); got != "new\n" {
+			t.Errorf("Stdout didn't truncate: %q", got)
+		}
+	})
+
+	t.Run("captures and null", func(t *testing.T) {
+		out, err := both.StdoutNull().StderrCapture().Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Stdout) != 0 || string(out.Stderr) != "err\n" {
+			t.Errorf("got stdout %q and stderr %q", out.Stdout, out.Stderr)
+		}
+		out, err = both.StderrNull().StdoutCapture().Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out.Stdout) != "out\n" || len(out.Stderr) != 0 {
+			t.Errorf("got stdout %q and stderr %q", out.Stdout, out.Stderr)
+		}
+	})
+
+	t.Run("a capture inside a pipe", func(t *testing.T) {
+		out, err := Sh("echo left >&2; echo piped").StderrCapture().Pipe(Cmd("tr", "a-z", "A-Z")).StdoutCapture().Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out.Stdout) != "PIPED\n" || string(out.Stderr) != "left\n" {
+			t.Errorf("got stdout %q and stderr %q", out.Stdout, out.Stderr)
+		}
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		path := filepath.Join(dir, "in.txt")
+		if err := os.WriteFile(path, []byte("from a file\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range []struct {
+			expr *Expression
+			want string
+		}{
+			{Cmd("cat").Stdin(path), "from a file"},
+			{Cmd("cat").StdinBytes([]byte("from bytes\n")), "from bytes"},
+			{Cmd("cat").StdinNull(), ""},
+			// The inner one wins.
+			{Cmd("cat").StdinNull().Stdin(path), ""},
+		} {
+			if got, err := c.expr.Read(); err != nil || got != c.want {
+				t.Errorf("%s: got %q, %v, want %q", c.expr, got, err, c.want)
+			}
+		}
+	})
+
+	t.Run("dir and env", func(t *testing.T) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil && !os.IsExist(err) {
+			t.Fatal(err)
+		}
+		t.Setenv("DUCT_TEST", "from outside")
+		for _, c := range []struct {
+			expr *Expression
+			want string
+		}{
+			{Cmd("pwd").Dir(real), real},
+			// A relative Dir inside another one is relative to it.
+			{Cmd("pwd").Dir("sub").Dir(real), filepath.Join(real, "sub")},
+			{Sh(`echo "$DUCT_TEST"`), "from outside"},
+			{Sh(`echo "$DUCT_TEST"`).Env("DUCT_TEST", "inner").Env("DUCT_TEST", "outer"), "inner"},
+			{Sh(`echo "${DUCT_TEST-unset}"`).EnvRemove("DUCT_TEST"), "unset"},
+			{Sh(`echo "$DUCT_TEST"`).Env("DUCT_TEST", "back").EnvRemove("DUCT_TEST"), "back"},
+		} {
+			if got, err := c.expr.Read(); err != nil || got != c.want {
+				t.Errorf("%s: got %q, %v, want %q", c.expr, got, err, c.want)
+			}
+		}
+	})
+
+	t.Run("a file that can't be opened", func(t *testing.T) {
+		_, err := Cmd("cat").Stdin(filepath.Join(dir, "missing")).Run()
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("got %v, want a not-exist error", err)
+		}
+	})
+}
+
+// TestRemote runs Remote against the fake ssh in testdata, which runs the
+// command locally the way sshd would: joined with spaces and handed to a
+// shell. So anything the quoting gets wrong shows up here.
+func TestRemote(t *testing.T) {
+	testdata, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", testdata+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, c := range []struct {
+		name   string
+		expr   *Expression
+		out    string
+		status int
+		failed bool
+	}{
+		{"quotes and dollars", Cmd("echo", "it's $HOME; rm -rf /"), "it's $HOME; rm -rf /\n", 0, false},
+		{"spaces and empty args", Cmd("printf", "%s|", "a b", "", `c"d`, `\`, "*"), `a b||c"d|\|*|`, 0, false},
+		{"a pipe's left status", Sh("exit 3").Pipe(Cmd("cat")), "", 3, true},
+		{"a pipe's right status", Cmd("echo", "hi").Pipe(Sh("cat; exit 5")), "hi\n", 5, true},
+		{"the right side's failure wins", Sh("exit 2").Pipe(Sh("exit 3")), "", 3, true},
+		{"a longer pipe", Cmd("echo", "hi").Pipe(Cmd("tr", "a-z", "A-Z")).Pipe(Cmd("tr", "H", "J")), "JI\n", 0, false},
+		{"a pipe inside a pipe", Cmd("echo", "hi").Pipe(Sh("cat; exit 6").Pipe(Cmd("cat"))), "hi\n", 6, true},
+		{"then stops at a failure", Cmd("false").Then(Cmd("echo", "no")), "", 1, true},
+		{"unchecked is status 0", Cmd("false").Unchecked().Then(Cmd("echo", "yes")), "yes\n", 0, false},
+		{"stderr into the pipe", Sh("echo oops >&2").StderrToStdout().Pipe(Cmd("tr", "a-z", "A-Z")), "OOPS\n", 0, false},
+		{"stdout to null", Cmd("echo", "quiet").StdoutNull(), "", 0, false},
+		{"env", Sh(`echo "$X"`).Env("X", "a'b c"), "a'b c\n", 0, false},
+		{"env remove", Sh(`echo "${HOME-unset}"`).EnvRemove("HOME"), "unset\n", 0, false},
+		{"dir", Cmd("pwd").Dir("/"), "/\n", 0, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out, status, err := run(Remote("h", c.expr))
+			if out != c.out || status != c.status {
+				t.Errorf("got %q and status %d, want %q and status %d", out, status, c.out, c.status)
+			}
+			if blame := failedCommand(err); c.failed != (blame != "") {
+				t.Errorf("got error %v", err)
+			} else if c.failed && !strings.HasPrefix(blame, `Remote("h", `) {
+				t.Errorf("the error blames %s, not the Remote", blame)
+			} else if !c.failed && err != nil {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+
+	t.Run("stdin goes through ssh", func(t *testing.T) {
+		got, err := Remote("h", Cmd("tr", "a-z", "A-Z")).StdinBytes([]byte("piped\n")).Read()
+		if err != nil || got != "PIPED" {
+			t.Errorf("got %q, %v", got, err)
+		}
+	})
+
+	t.Run("stdout goes through ssh into a local pipe", func(t *testing.T) {
+		got, err := Remote("h", Cmd("echo", "remote")).Pipe(Cmd("tr", "a-z", "A-Z")).Read()
+		if err != nil || got != "REMOTE" {
+			t.Errorf("got %q, %v", got, err)
+		}
+	})
+
+	for _, c := range []struct {
+		name string
+		expr *Expression
+		want string
+	}{
+		{"a host that looks like an option", Remote("-oProxyCommand=x", Cmd("echo", "hi")), "looks like an ssh option"},
+		{"a capture inside", Remote("h", Cmd("echo", "hi").StdoutCapture()), "StdoutCapture only works outside of a Remote"},
+		{"stdin bytes inside", Remote("h", Cmd("cat").StdinBytes([]byte("x"))), "StdinBytes only works outside of a Remote"},
+		{"an env var sh can't set", Remote("h", Cmd("true").Env("A-B", "x")), `can't set env var "A-B"`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := c.expr.Run()
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("got %v, want an error about %q", err, c.want)
+			}
+		})
+	}
+}
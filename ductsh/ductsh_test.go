@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// :remote turns a whole line into one Remote. Remote itself, and its
+// quoting, are tested in ../duct, against the fake ssh there.
+func TestRemote(t *testing.T) {
+	testdata, err := filepath.Abs(filepath.Join("..", "duct", "testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", testdata+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DUCTSH_TEST", "expanded here")
+	s := new(shell)
+
+	for _, c := range []struct {
+		line   string
+		want   string
+		status int
+	}{
+		// ; keeps going after a failure, and && doesn't.
+		{"false; echo yes", "yes", 0},
+		{"false && echo no", "", 1},
+		{"echo $DUCTSH_TEST", "expanded here", 0},
+		{`echo hi | sh -c "cat; exit 5"`, "hi", 5},
+	} {
+		expr, err := s.remote("h", c.line)
+		if err != nil {
+			t.Errorf("%s: %v", c.line, err)
+			continue
+		}
+		out, _ := expr.StdoutCapture().Unchecked().Run()
+		if got := strings.TrimSpace(string(out.Stdout)); got != c.want || out.Status != c.status {
+			t.Errorf("%s: got %q and status %d, want %q and status %d", c.line, got, out.Status, c.want, c.status)
+		}
+	}
+
+	for _, line := range []string{"cd /tmp", "echo hi; X=1", "exit"} {
+		if _, err := s.remote("h", line); err == nil || !strings.Contains(err.Error(), "can't run remotely") {
+			t.Errorf("%s: got %v, want an error about builtins", line, err)
+		}
+	}
+}
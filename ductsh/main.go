@@ -0,0 +1,354 @@
+package main
+
+// ductsh is a small interactive shell that runs everything through the Duct
+// port in ../duct. It's meant for trying out Duct expressions, and for
+// seeing what a line of shell actually means as a tree:
+//
+//	go run ./ductsh
+//	ductsh$ :explain echo hi | tr a-z A-Z >out.txt && cat out.txt
+//
+// The language is a safe subset of sh (see parse.go). Every line is parsed
+// into Duct expressions before anything runs, so a syntax error anywhere
+// means nothing runs at all. Pipelines fail like Duct's do: if any command in
+// a pipe exits non-zero, so does the pipe, and the error message says which
+// command it was.
+//
+// Lines starting with : are commands for the shell itself. :explain LINE
+// prints the trees for LINE without running it, and :explain on its own
+// toggles printing them before every line. :remote HOST LINE runs all of
+// LINE on HOST over ssh, as a single Remote expression. Besides those, cd and
+// exit are the only builtins, and NAME=value on its own sets an environment
+// variable.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oconnor663/jacko.io/duct"
+)
+
+var builtins = []string{"cd", "exit"}
+
+type shell struct {
+	status  int
+	explain bool
+	sigint  chan os.Signal
+	// exit is set by the exit builtin.
+	exit *int
+}
+
+// A pipeline is special if it's a builtin or a bare assignment. Those run in
+// the shell itself, so they can't be part of a Duct expression.
+func special(p pipeline) bool {
+	if len(p) != 1 {
+		return false
+	}
+	c := p[0]
+	if len(c.args) == 0 {
+		return true
+	}
+	name, ok := c.args[0].literal()
+	return ok && slices.Contains(builtins, name)
+}
+
+func (s *shell) lookup(name string) string {
+	return lookupEnv(s.status)(name)
+}
+
+func (s *shell) runSpecial(c simpleCommand) int {
+	if len(c.args) == 0 {
+		for _, a := range c.assigns {
+			os.Setenv(a.name, a.value.expand(s.lookup))
+		}
+		return 0
+	}
+	if len(c.assigns) > 0 || len(c.redirs) > 0 {
+		fmt.Fprintln(os.Stderr, "ductsh: builtins don't take env vars or redirections")
+		return 2
+	}
+	args := make([]string, len(c.args))
+	for i, a := range c.args {
+		args[i] = a.expand(s.lookup)
+	}
+	switch args[0] {
+	case "cd":
+		dir := os.Getenv("HOME")
+		if len(args) > 1 {
+			dir = args[1]
+		}
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, "ductsh: cd:", err)
+			return 1
+		}
+		return 0
+	case "exit":
+		code := s.status
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "ductsh: exit: not a number:", args[1])
+				return 2
+			}
+			code = n
+		}
+		s.exit = &code
+		return code
+	}
+	panic("not a builtin: " + args[0])
+}
+
+// steps splits an andList into the parts that run in the shell and the
+// parts that run as Duct expressions. Consecutive pipelines that aren't
+// special get joined with Then, so `a && b | c` is a single tree.
+func (s *shell) steps(list andList, do func(special *simpleCommand, expr *duct.Expression) bool) {
+	for i := 0; i < len(list); {
+		if special(list[i]) {
+			if !do(&list[i][0], nil) {
+				return
+			}
+			i++
+			continue
+		}
+		expr := list[i].toExpression(s.lookup)
+		for i++; i < len(list) && !special(list[i]); i++ {
+			expr = expr.Then(list[i].toExpression(s.lookup))
+		}
+		if !do(nil, expr) {
+			return
+		}
+	}
+}
+
+func printExplanation(c *simpleCommand, expr *duct.Expression, lookup func(string) string) {
+	if expr != nil {
+		fmt.Print(expr.Tree())
+		fmt.Printf("  = %s\n", expr)
+		return
+	}
+	var parts []string
+	for _, a := range c.assigns {
+		parts = append(parts, a.name+"="+strconv.Quote(a.value.expand(lookup)))
+	}
+	for _, a := range c.args {
+		parts = append(parts, strconv.Quote(a.expand(lookup)))
+	}
+	if len(c.args) == 0 {
+		fmt.Println("set " + strings.Join(parts, " "))
+	} else {
+		fmt.Println("builtin " + strings.Join(parts, " "))
+	}
+}
+
+// explainOnly prints the trees for a line without running it. Variables are
+// expanded with their current values, which might not be what they'd be by
+// the time a later statement on the line ran.
+func (s *shell) explainOnly(prog program) {
+	for i, list := range prog {
+		if i > 0 {
+			fmt.Println(";")
+		}
+		s.steps(list, func(c *simpleCommand, expr *duct.Expression) bool {
+			printExplanation(c, expr, s.lookup)
+			return true
+		})
+	}
+}
+
+// run runs one Duct expression in the foreground and returns its status.
+func (s *shell) run(expr *duct.Expression) int {
+	h, err := expr.Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ductsh:", err)
+		if errors.Is(err, exec.ErrNotFound) {
+			return 127
+		}
+		return 126
+	}
+	out, err := h.Wait()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ductsh:", err)
+	}
+	if out.Status == 0 && err != nil {
+		return 1
+	}
+	return out.Status
+}
+
+func (s *shell) interrupted() bool {
+	select {
+	case <-s.sigint:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *shell) runLine(line string) {
+	line = strings.TrimSpace(line)
+	if cmd, ok := strings.CutPrefix(line, ":"); ok {
+		s.meta(cmd)
+		return
+	}
+	prog, err := parse(line)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ductsh: syntax error:", err)
+		s.status = 2
+		return
+	}
+	// Drop any Ctrl-C from before this line started.
+	s.interrupted()
+	for _, list := range prog {
+		s.steps(list, func(c *simpleCommand, expr *duct.Expression) bool {
+			if s.explain {
+				printExplanation(c, expr, s.lookup)
+			}
+			if c != nil {
+				s.status = s.runSpecial(*c)
+			} else {
+				s.status = s.run(expr)
+			}
+			return s.status == 0 && s.exit == nil
+		})
+		// Ctrl-C goes to the whole foreground process group, so the
+		// children have already gotten it. All we have to do is not start
+		// anything else.
+		if s.exit != nil || s.interrupted() {
+			return
+		}
+	}
+}
+
+// remote builds the expression for :remote. The whole line becomes one tree,
+// with ; turning into an Unchecked Then, so builtins, which would have to run
+// in this shell, aren't allowed. Variables are expanded here, before the line
+// goes anywhere.
+func (s *shell) remote(host, line string) (*duct.Expression, error) {
+	prog, err := parse(line)
+	if err != nil {
+		return nil, err
+	}
+	var expr *duct.Expression
+	for _, list := range prog {
+		var e *duct.Expression
+		for _, p := range list {
+			if special(p) {
+				return nil, errors.New("builtins and assignments can't run remotely")
+			}
+			if e == nil {
+				e = p.toExpression(s.lookup)
+			} else {
+				e = e.Then(p.toExpression(s.lookup))
+			}
+		}
+		if expr == nil {
+			expr = e
+		} else {
+			expr = expr.Unchecked().Then(e)
+		}
+	}
+	if expr == nil {
+		return nil, errors.New("nothing to run")
+	}
+	return duct.Remote(host, expr), nil
+}
+
+func (s *shell) meta(cmd string) {
+	name, rest, _ := strings.Cut(strings.TrimSpace(cmd), " ")
+	switch name {
+	case "explain":
+		if strings.TrimSpace(rest) == "" {
+			s.explain = !s.explain
+			fmt.Printf("explain is %s\n", map[bool]string{true: "on", false: "off"}[s.explain])
+			return
+		}
+		prog, err := parse(rest)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ductsh: syntax error:", err)
+			return
+		}
+		s.explainOnly(prog)
+	case "remote":
+		host, line, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		if host == "" || strings.TrimSpace(line) == "" {
+			fmt.Fprintln(os.Stderr, "ductsh: usage: :remote HOST LINE")
+			s.status = 2
+			return
+		}
+		expr, err := s.remote(host, line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ductsh: remote:", err)
+			s.status = 2
+			return
+		}
+		if s.explain {
+			printExplanation(nil, expr, s.lookup)
+		}
+		s.status = s.run(expr)
+	case "help":
+		fmt.Println(`:explain LINE      show the Duct trees for LINE without running it
+:explain           toggle showing the trees before running each line
+:remote HOST LINE  run LINE on HOST with ssh, as one Remote expression
+:help              this
+cd DIR, exit [N], NAME=value, and anything else is a command.`)
+	default:
+		fmt.Fprintf(os.Stderr, "ductsh: unknown command :%s (try :help)\n", name)
+	}
+}
+
+func (s *shell) prompt() string {
+	dir, _ := os.Getwd()
+	if home := os.Getenv("HOME"); home != "" && (dir == home || strings.HasPrefix(dir, home+"/")) {
+		dir = "~" + strings.TrimPrefix(dir, home)
+	}
+	if s.status != 0 {
+		return fmt.Sprintf("ductsh %s [%d]$ ", filepath.Base(dir), s.status)
+	}
+	return fmt.Sprintf("ductsh %s$ ", filepath.Base(dir))
+}
+
+func main() {
+	command := flag.String("c", "", "run this line and exit, instead of starting a REPL")
+	historyPath := flag.String("history", defaultHistoryPath(), "where to keep the line history (empty for none)")
+	flag.Parse()
+
+	s := &shell{sigint: make(chan os.Signal, 1)}
+	// The shell itself ignores Ctrl-C. The terminal sends it to the
+	// foreground children too, and they decide what to do with it.
+	signal.Notify(s.sigint, os.Interrupt)
+
+	if *command != "" {
+		s.runLine(*command)
+		if s.exit != nil {
+			os.Exit(*s.exit)
+		}
+		os.Exit(s.status)
+	}
+
+	r := newLineReader(*historyPath)
+	for s.exit == nil {
+		line, err := r.readLine(s.prompt())
+		if errors.Is(err, errInterrupted) {
+			s.status = 130
+			continue
+		} else if err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "ductsh:", err)
+			os.Exit(1)
+		}
+		s.runLine(line)
+	}
+	if s.exit != nil {
+		os.Exit(*s.exit)
+	}
+	os.Exit(s.status)
+}
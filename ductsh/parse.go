@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/oconnor663/jacko.io/duct"
+)
+
+// The shell language here is a small, safe subset of sh:
+//
+//	FOO=bar cmd 'arg one' "arg $TWO" <in >out 2>&1 | grep x && echo ok; echo done
+//
+// That's pipes, &&, ;, redirections (<, >, >>, 2>, 2>>, 2>&1, >&2), env
+// prefixes, single and double quotes, backslashes, $NAME, ${NAME} and $?.
+// Expanding a variable never splits it into more than one word, and there's
+// no globbing, so an unquoted * is an error rather than a surprise. Anything
+// else that sh would do something clever with is an error too.
+
+// A wordPart is either literal text or the name of a variable. Variables are
+// expanded when a statement runs, not when it's parsed, so that
+// `FOO=1; echo $FOO` works.
+type wordPart struct {
+	text     string
+	variable bool
+}
+
+type word []wordPart
+
+type assignment struct {
+	name  string
+	value word
+}
+
+// A redirect's op is one of "<", ">", ">>", "2>", "2>>", "2>&1" and "1>&2".
+// The last two don't have a target.
+type redirect struct {
+	op     string
+	target word
+}
+
+type simpleCommand struct {
+	assigns []assignment
+	args    []word
+	redirs  []redirect
+}
+
+type pipeline []simpleCommand
+
+// An andList is pipelines joined by &&, and a program is andLists separated
+// by ;.
+type andList []pipeline
+
+type program []andList
+
+type syntaxError struct {
+	pos int
+	msg string
+}
+
+func (e *syntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.pos+1, e.msg)
+}
+
+type tokenKind int
+
+const (
+	wordTok tokenKind = iota
+	pipeTok
+	andTok
+	semiTok
+	redirTok
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	// op is the operator for everything but words.
+	op   string
+	word word
+	// assign is set for a word that looks like NAME=value, with the NAME
+	// and the = unquoted. The NAME= is left out of word.
+	assign string
+}
+
+type lexer struct {
+	src []rune
+	pos int
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return &syntaxError{l.pos, fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) peek(offset int) rune {
+	if l.pos+offset < len(l.src) {
+		return l.src[l.pos+offset]
+	}
+	return 0
+}
+
+func isNameRune(r rune, first bool) bool {
+	return r == '_' || unicode.IsLetter(r) || (!first && unicode.IsDigit(r))
+}
+
+func lex(line string) ([]token, error) {
+	l := &lexer{src: []rune(line)}
+	var tokens []token
+	for {
+		for unicode.IsSpace(l.peek(0)) {
+			l.pos++
+		}
+		if l.pos >= len(l.src) || l.peek(0) == '#' {
+			return tokens, nil
+		}
+		start := l.pos
+		switch c := l.peek(0); {
+		case c == '|':
+			if l.peek(1) == '|' {
+				return nil, l.errorf("|| isn't supported")
+			}
+			l.pos++
+			tokens = append(tokens, token{kind: pipeTok, pos: start, op: "|"})
+		case c == '&':
+			if l.peek(1) != '&' {
+				return nil, l.errorf("background jobs and &> aren't supported")
+			}
+			l.pos += 2
+			tokens = append(tokens, token{kind: andTok, pos: start, op: "&&"})
+		case c == ';':
+			l.pos++
+			tokens = append(tokens, token{kind: semiTok, pos: start, op: ";"})
+		case c == '<' || c == '>' || ((c == '1' || c == '2') && l.peek(1) == '>'):
+			op, err := l.redirect()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: redirTok, pos: start, op: op})
+		default:
+			t, err := l.word()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+		}
+	}
+}
+
+func (l *lexer) redirect() (string, error) {
+	fd := "1"
+	if c := l.peek(0); c == '1' || c == '2' {
+		fd = string(c)
+		l.pos++
+	}
+	if l.peek(0) == '<' {
+		l.pos++
+		if l.peek(0) == '<' {
+			return "", l.errorf("heredocs aren't supported")
+		}
+		return "<", nil
+	}
+	l.pos++ // the >
+	switch {
+	case l.peek(0) == '>':
+		l.pos++
+		if fd == "2" {
+			return "2>>", nil
+		}
+		return ">>", nil
+	case l.peek(0) == '&':
+		target := string(l.peek(1))
+		if (fd == "1" && target == "2") || (fd == "2" && target == "1") {
+			l.pos += 2
+			return fd + ">&" + target, nil
+		}
+		return "", l.errorf("only 2>&1 and >&2 are supported")
+	case fd == "2":
+		return "2>", nil
+	}
+	return ">", nil
+}
+
+func (l *lexer) word() (token, error) {
+	t := token{kind: wordTok, pos: l.pos}
+	// Check for NAME= at the very start of the word.
+	if isNameRune(l.peek(0), true) {
+		n := 1
+		for isNameRune(l.peek(n), false) {
+			n++
+		}
+		if l.peek(n) == '=' {
+			t.assign = string(l.src[l.pos : l.pos+n])
+			l.pos += n + 1
+		}
+	}
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			t.word = append(t.word, wordPart{text: lit.String()})
+			lit.Reset()
+		}
+	}
+	addVar := func(name string) {
+		flush()
+		t.word = append(t.word, wordPart{text: name, variable: true})
+	}
+	// ~ and ~/ at the start of a word are the only tilde expansions.
+	if l.peek(0) == '~' && (l.pos+1 == len(l.src) || l.peek(1) == '/' || unicode.IsSpace(l.peek(1))) {
+		addVar("HOME")
+		l.pos++
+	}
+	for l.pos < len(l.src) {
+		c := l.peek(0)
+		switch {
+		case unicode.IsSpace(c) || strings.ContainsRune("|&;<>", c):
+			flush()
+			return t, nil
+		case c == '\\':
+			if l.pos+1 == len(l.src) {
+				return t, l.errorf("trailing backslash")
+			}
+			lit.WriteRune(l.peek(1))
+			l.pos += 2
+		case c == '\'':
+			end := strings.IndexRune(string(l.src[l.pos+1:]), '\'')
+			if end < 0 {
+				return t, l.errorf("unterminated single quote")
+			}
+			quoted := string(l.src[l.pos+1:])[:end]
+			lit.WriteString(quoted)
+			l.pos += len([]rune(quoted)) + 2
+		case c == '"':
+			l.pos++
+			for {
+				if l.pos >= len(l.src) {
+					return t, l.errorf("unterminated double quote")
+				}
+				c := l.peek(0)
+				if c == '"' {
+					l.pos++
+					break
+				}
+				if c == '\\' && strings.ContainsRune(`$"\`, l.peek(1)) {
+					lit.WriteRune(l.peek(1))
+					l.pos += 2
+					continue
+				}
+				if c == '`' {
+					return t, l.errorf("command substitution isn't supported")
+				}
+				if c == '$' {
+					name, err := l.variable()
+					if err != nil {
+						return t, err
+					}
+					if name != "" {
+						addVar(name)
+						continue
+					}
+				}
+				lit.WriteRune(c)
+				l.pos++
+			}
+		case c == '$':
+			name, err := l.variable()
+			if err != nil {
+				return t, err
+			}
+			if name != "" {
+				addVar(name)
+				continue
+			}
+			lit.WriteRune(c)
+			l.pos++
+		case c == '*' || c == '?' || c == '[':
+			return t, l.errorf("globs aren't supported (quote the %c if you meant it)", c)
+		case c == '(' || c == ')' || c == '`':
+			return t, l.errorf("%c isn't supported", c)
+		default:
+			lit.WriteRune(c)
+			l.pos++
+		}
+	}
+	flush()
+	return t, nil
+}
+
+// variable reads $NAME, ${NAME} or $? and returns the name. It returns "" and
+// doesn't move if the $ doesn't start a variable, in which case it's just a
+// $.
+func (l *lexer) variable() (string, error) {
+	switch c := l.peek(1); {
+	case c == '?':
+		l.pos += 2
+		return "?", nil
+	case c == '(':
+		return "", l.errorf("command substitution isn't supported")
+	case c == '{':
+		end := l.pos + 2
+		for end < len(l.src) && isNameRune(l.src[end], end == l.pos+2) {
+			end++
+		}
+		if end == l.pos+2 || end == len(l.src) || l.src[end] != '}' {
+			return "", l.errorf("only ${NAME} is supported")
+		}
+		name := string(l.src[l.pos+2 : end])
+		l.pos = end + 1
+		return name, nil
+	case isNameRune(c, true):
+		end := l.pos + 2
+		for end < len(l.src) && isNameRune(l.src[end], false) {
+			end++
+		}
+		name := string(l.src[l.pos+1 : end])
+		l.pos = end
+		return name, nil
+	}
+	return "", nil
+}
+
+func parse(line string) (program, error) {
+	tokens, err := lex(line)
+	if err != nil {
+		return nil, err
+	}
+	var prog program
+	var list andList
+	var pipe pipeline
+	var cmd simpleCommand
+	// expectCommand is true right after an operator, when an operator
+	// would be a syntax error.
+	expectCommand := false
+	endCommand := func(pos int) error {
+		if len(cmd.assigns) == 0 && len(cmd.args) == 0 && len(cmd.redirs) == 0 {
+			return &syntaxError{pos, "missing command"}
+		}
+		if len(cmd.args) == 0 && len(cmd.redirs) > 0 {
+			return &syntaxError{pos, "redirection without a command"}
+		}
+		pipe = append(pipe, cmd)
+		cmd = simpleCommand{}
+		return nil
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.kind {
+		case wordTok:
+			if t.assign != "" && len(cmd.args) == 0 {
+				cmd.assigns = append(cmd.assigns, assignment{t.assign, t.word})
+			} else {
+				w := t.word
+				if t.assign != "" {
+					// A NAME=value after the command name is just an argument.
+					w = append(word{{text: t.assign + "="}}, w...)
+				}
+				cmd.args = append(cmd.args, w)
+			}
+			expectCommand = false
+		case redirTok:
+			r := redirect{op: t.op}
+			if t.op != "2>&1" && t.op != "1>&2" {
+				if i+1 == len(tokens) || tokens[i+1].kind != wordTok {
+					return nil, &syntaxError{t.pos, t.op + " needs a file name"}
+				}
+				i++
+				r.target = tokens[i].word
+				if tokens[i].assign != "" {
+					r.target = append(word{{text: tokens[i].assign + "="}}, r.target...)
+				}
+			}
+			cmd.redirs = append(cmd.redirs, r)
+			expectCommand = false
+		case pipeTok, andTok, semiTok:
+			if t.kind == semiTok && len(pipe) == 0 && len(cmd.assigns)+len(cmd.args)+len(cmd.redirs) == 0 && !expectCommand {
+				// An empty statement, like a trailing ; or ;;. sh is picky
+				// about these, but there's no harm in allowing them.
+				continue
+			}
+			if err := endCommand(t.pos); err != nil {
+				return nil, err
+			}
+			if t.kind != pipeTok {
+				list = append(list, pipe)
+				pipe = nil
+			}
+			if t.kind == semiTok {
+				prog = append(prog, list)
+				list = nil
+				expectCommand = false
+			} else {
+				expectCommand = true
+			}
+		}
+	}
+	if expectCommand {
+		return nil, &syntaxError{len([]rune(line)), "missing command at the end"}
+	}
+	if len(cmd.assigns)+len(cmd.args)+len(cmd.redirs) > 0 {
+		if err := endCommand(len([]rune(line))); err != nil {
+			return nil, err
+		}
+		list = append(list, pipe)
+		prog = append(prog, list)
+	}
+	return prog, nil
+}
+
+// expand turns a word into a string, looking up variables with lookup.
+// Unset variables expand to nothing, like in sh.
+func (w word) expand(lookup func(string) string) string {
+	var b strings.Builder
+	for _, p := range w {
+		if p.variable {
+			b.WriteString(lookup(p.text))
+		} else {
+			b.WriteString(p.text)
+		}
+	}
+	return b.String()
+}
+
+// literal returns the word as written, if it has no variables in it.
+func (w word) literal() (string, bool) {
+	var b strings.Builder
+	for _, p := range w {
+		if p.variable {
+			return "", false
+		}
+		b.WriteString(p.text)
+	}
+	return b.String(), true
+}
+
+// toExpression builds the Duct expression for a pipeline. Redirections apply
+// left to right in sh, so `>out 2>&1` sends both to out, but `2>&1 >out`
+// sends only stdout there. In Duct, the outermost modifier applies first, so
+// we wrap them in reverse order. Env prefixes get the same treatment, so
+// that if a name is repeated, the last one wins.
+func (p pipeline) toExpression(lookup func(string) string) *duct.Expression {
+	var expr *duct.Expression
+	for _, c := range p {
+		args := make([]string, len(c.args))
+		for i, a := range c.args {
+			args[i] = a.expand(lookup)
+		}
+		e := duct.Cmd(args[0], args[1:]...)
+		for i := len(c.redirs) - 1; i >= 0; i-- {
+			r := c.redirs[i]
+			target := r.target.expand(lookup)
+			switch r.op {
+			case "<":
+				e = e.Stdin(target)
+			case ">":
+				e = e.Stdout(target)
+			case ">>":
+				e = e.StdoutAppend(target)
+			case "2>":
+				e = e.Stderr(target)
+			case "2>>":
+				e = e.StderrAppend(target)
+			case "2>&1":
+				e = e.StderrToStdout()
+			case "1>&2":
+				e = e.StdoutToStderr()
+			}
+		}
+		for i := len(c.assigns) - 1; i >= 0; i-- {
+			a := c.assigns[i]
+			e = e.Env(a.name, a.value.expand(lookup))
+		}
+		if expr == nil {
+			expr = e
+		} else {
+			expr = expr.Pipe(e)
+		}
+	}
+	return expr
+}
+
+// lookupEnv is the usual lookup function. status is the value of $?.
+func lookupEnv(status int) func(string) string {
+	return func(name string) string {
+		if name == "?" {
+			return fmt.Sprint(status)
+		}
+		return os.Getenv(name)
+	}
+}
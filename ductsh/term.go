@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+type lineReader interface {
+	// readLine returns errInterrupted if the user hits Ctrl-C, and io.EOF
+	// when there's no more input.
+	readLine(prompt string) (string, error)
+}
+
+func newLineReader(historyPath string) lineReader {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return &plainReader{bufio.NewScanner(os.Stdin)}
+	}
+	return &termReader{fd: fd, history: loadHistory(historyPath)}
+}
+
+// A plainReader is for when stdin isn't a terminal, like `ductsh < script`.
+// There's no prompt, and no editing.
+type plainReader struct {
+	in *bufio.Scanner
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	if !r.in.Scan() {
+		if err := r.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.in.Text(), nil
+}
+
+// A termReader puts the terminal in raw mode while it reads a line, and puts
+// it back before returning, so that the commands we run get a normal
+// terminal.
+type termReader struct {
+	fd      int
+	history *history
+	t       *term.Terminal
+	in      *ctrlCReader
+}
+
+// term.Terminal returns io.EOF for both Ctrl-C and Ctrl-D. A shell needs to
+// tell them apart, so we watch the input for Ctrl-C ourselves.
+type ctrlCReader struct {
+	r        io.Reader
+	sawCtrlC bool
+}
+
+func (c *ctrlCReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if bytes.IndexByte(p[:n], 3) >= 0 {
+		c.sawCtrlC = true
+	}
+	return n, err
+}
+
+func (r *termReader) readLine(prompt string) (string, error) {
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(r.fd, state)
+	if r.t == nil {
+		r.in = &ctrlCReader{r: os.Stdin}
+		r.t = term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{r.in, os.Stdout}, "")
+		r.t.History = r.history
+		r.t.AutoCompleteCallback = r.complete
+	}
+	if w, h, err := term.GetSize(r.fd); err == nil && w > 0 {
+		r.t.SetSize(w, h)
+	}
+	r.t.SetPrompt(prompt)
+	line, err := r.t.ReadLine()
+	if errors.Is(err, term.ErrPasteIndicator) {
+		err = nil
+	}
+	if err == io.EOF {
+		if r.in.sawCtrlC {
+			os.Stdout.WriteString("^C\r\n")
+			// The Terminal keeps the half-typed line around, so start
+			// over with a fresh one. The history is ours, so it survives.
+			r.t = nil
+			return "", errInterrupted
+		}
+		os.Stdout.WriteString("\r\n")
+	}
+	return line, err
+}
+
+// complete is called on every key press. Tab completes the word before the
+// cursor: a command name if it's in command position, and a file name
+// otherwise. If there's more than one match, it completes as far as it can,
+// and lists the matches if that doesn't get any further.
+func (r *termReader) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	start := strings.LastIndexAny(line[:pos], " \t|&;<>") + 1
+	prefix := line[start:pos]
+	var candidates []string
+	if commandPosition(line[:start]) && !strings.Contains(prefix, "/") {
+		candidates = commandsWithPrefix(prefix)
+	} else {
+		candidates = filesWithPrefix(prefix)
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	completion := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "/") {
+		completion += " "
+	}
+	if completion == prefix {
+		if len(candidates) > 1 {
+			list := candidates
+			if len(list) > 100 {
+				list = append(list[:100:100], "...")
+			}
+			r.t.Write([]byte(strings.Join(list, "  ") + "\n"))
+		}
+		return "", 0, false
+	}
+	return line[:start] + completion + line[pos:], start + len(completion), true
+}
+
+// commandPosition reports whether a word that comes after before would be a
+// command name, rather than an argument. Env prefixes don't count as
+// commands.
+func commandPosition(before string) bool {
+	fields := strings.Fields(before)
+	for len(fields) > 0 {
+		last := fields[len(fields)-1]
+		if strings.HasSuffix(last, "|") || strings.HasSuffix(last, "&&") || strings.HasSuffix(last, ";") {
+			return true
+		}
+		name, _, ok := strings.Cut(last, "=")
+		if !ok || name == "" || strings.ContainsAny(name, "'\"$") {
+			return false
+		}
+		fields = fields[:len(fields)-1]
+	}
+	return true
+}
+
+func commandsWithPrefix(prefix string) []string {
+	var names []string
+	for _, b := range builtins {
+		if strings.HasPrefix(b, prefix) {
+			names = append(names, b)
+		}
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !strings.HasPrefix(e.Name(), prefix) {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, e.Name()))
+			if err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func filesWithPrefix(prefix string) []string {
+	dir, base := filepath.Split(prefix)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, dir+name)
+	}
+	return names
+}
+
+// history implements term.History, and appends every line to a file so that
+// it survives between sessions.
+type history struct {
+	lines []string
+	path  string
+}
+
+const maxHistory = 1000
+
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ductsh_history")
+}
+
+func loadHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+	return h
+}
+
+func (h *history) Add(entry string) {
+	if strings.TrimSpace(entry) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == entry) {
+		return
+	}
+	h.lines = append(h.lines, entry)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[1:]
+	}
+	if h.path == "" {
+		return
+	}
+	// Losing history isn't worth interrupting anyone over, so errors here
+	// are ignored.
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err == nil {
+		f.WriteString(entry + "\n")
+		f.Close()
+	}
+}
+
+func (h *history) Len() int { return len(h.lines) }
+
+func (h *history) At(i int) string { return h.lines[len(h.lines)-1-i] }
@@ -0,0 +1,17 @@
+module github.com/oconnor663/jacko.io
+
+go 1.25.0
+
+require (
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.57.0
+	golang.org/x/term v0.45.0
+	golang.org/x/tools v0.47.0
+	mvdan.cc/sh/v3 v3.13.1
+)
+
+require (
+	golang.org/x/mod v0.37.0 // indirect
+	golang.org/x/sync v0.21.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+)
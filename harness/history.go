@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// An op is one recorded Store or Load, with the times (relative to the start
+// of the run) when it was called and when it returned. These are the input to
+// the linearizability checker in ../linearize.
+type op struct {
+	Mode   string `json:"mode"`
+	Client string `json:"client"`
+	Kind   string `json:"kind"`
+	Value  Foo    `json:"value"`
+	Invoke int64  `json:"invoke_ns"`
+	Return int64  `json:"return_ns"`
+}
+
+// We can't record every op in a run (there are hundreds of millions), so a
+// recorder captures a window at the start of the run. Two things make that
+// tricky. First, every recorded read has to be able to find the write it read
+// from in the history, so the writer can't stop recording while the reader
+// might still be recording. The reader always finishes first, and the writer
+// records until it has. Second, the window has to actually interleave reads
+// and writes. Left alone, the writer usually runs a lot faster than the
+// reader, and on a single CPU it gets whole timeslices to itself, so it could
+// fill any fixed budget of writes before the reader recorded anything. So
+// neither side gets to record more than maxLead ops ahead of the other, and
+// whichever is ahead yields until the other catches up. The reader also
+// doesn't start until the writer has, since a window full of reads of the
+// zero Foo isn't very interesting.
+type recorder struct {
+	mode     string
+	start    time.Time
+	maxReads int
+
+	writerStarted atomic.Bool
+	readerStopped atomic.Bool
+	// How many ops each side has recorded, for keeping them in step.
+	numReads  atomic.Int64
+	numWrites atomic.Int64
+
+	// Each of these is only touched by one goroutine until the run is over.
+	reads      []op
+	writes     []op
+	readerDone bool
+	writerDone bool
+}
+
+const maxLead = 16
+
+func newRecorder(mode string, maxReads int) *recorder {
+	return &recorder{
+		mode:     mode,
+		start:    time.Now(),
+		maxReads: maxReads,
+	}
+}
+
+func (r *recorder) now() int64 {
+	return int64(time.Since(r.start))
+}
+
+// readerRecording is called by the reader before each Load. A nil recorder
+// never records. When the reader is too far ahead it skips recording this
+// Load and yields, which is harmless: leaving reads out of a history can't
+// make it look any more linearizable than it is.
+func (r *recorder) readerRecording() bool {
+	if r == nil || r.readerDone || !r.writerStarted.Load() {
+		return false
+	}
+	if len(r.reads) == r.maxReads {
+		r.finishReader()
+		return false
+	}
+	if int64(len(r.reads)) >= r.numWrites.Load()+maxLead {
+		runtime.Gosched()
+		return false
+	}
+	return true
+}
+
+// finishReader is also called by the reader when the run ends.
+func (r *recorder) finishReader() {
+	if r == nil || r.readerDone {
+		return
+	}
+	r.readerDone = true
+	r.readerStopped.Store(true)
+}
+
+// writerRecording is called by the writer before each Store. Unlike the
+// reader, the writer can't skip recording while the window is open, so when
+// it's too far ahead it waits.
+func (r *recorder) writerRecording() bool {
+	if r == nil || r.writerDone {
+		return false
+	}
+	r.writerStarted.Store(true)
+	for {
+		if r.readerStopped.Load() {
+			r.writerDone = true
+			return false
+		}
+		if int64(len(r.writes)) < r.numReads.Load()+maxLead {
+			return true
+		}
+		runtime.Gosched()
+	}
+}
+
+func (r *recorder) recordRead(f Foo, invoke int64) {
+	r.reads = append(r.reads, op{r.mode, "reader", "read", f, invoke, r.now()})
+	r.numReads.Store(int64(len(r.reads)))
+}
+
+func (r *recorder) recordWrite(f Foo, invoke int64) {
+	r.writes = append(r.writes, op{r.mode, "writer", "write", f, invoke, r.now()})
+	r.numWrites.Store(int64(len(r.writes)))
+}
+
+// writeTo writes the history as JSON lines, sorted by invoke time.
+func (r *recorder) writeTo(w io.Writer) error {
+	ops := slices.Concat(r.writes, r.reads)
+	slices.SortFunc(ops, func(a, b op) int { return cmp.Compare(a.Invoke, b.Invoke) })
+	enc := json.NewEncoder(w)
+	for _, o := range ops {
+		if err := enc.Encode(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
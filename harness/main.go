@@ -0,0 +1,200 @@
+package main
+
+// This is a harness for the experiment in not_atomic.go. Instead of stopping
+// at the first inconsistent Foo, it runs each strategy for a fixed amount of
+// time and counts how often the reader sees A != B.
+//
+//     go run ./harness/*.go -mode plain,atomicfields -duration 2s
+//
+// With -history, it also records the invoke and return times of the first
+// few thousand reads and writes for each strategy, for ../linearize to check.
+//
+// Several of these strategies are data races on purpose, so running this
+// under -race will (correctly) complain about them.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+type result struct {
+	Mode        string  `json:"mode"`
+	Broken      bool    `json:"broken"`
+	Seconds     float64 `json:"seconds"`
+	Reads       int64   `json:"reads"`
+	Writes      int64   `json:"writes"`
+	Tears       int64   `json:"tears"`
+	TearsPerSec float64 `json:"tears_per_sec"`
+	// FirstTear is nil if the reader never saw a torn Foo.
+	FirstTear *float64 `json:"first_tear_seconds,omitempty"`
+	// TearSizes is a histogram of |A - B| for the torn reads. Bucket i counts
+	// the tears where that difference was in [2^i, 2^(i+1)).
+	TearSizes []int64 `json:"tear_sizes,omitempty"`
+}
+
+// run runs one strategy. If h isn't nil, it also records a window of the
+// history.
+func run(s strategy, duration time.Duration, h *recorder) result {
+	p := s.new()
+	var done atomic.Bool
+	writes := make(chan int64)
+	go func() {
+		var i int64
+		for !done.Load() {
+			newFoo := Foo{A: int(i), B: int(i)}
+			if h.writerRecording() {
+				invoke := h.now()
+				p.Store(newFoo)
+				h.recordWrite(newFoo, invoke)
+			} else {
+				p.Store(newFoo)
+			}
+			i++
+		}
+		writes <- i
+	}()
+
+	r := result{Mode: s.name, Broken: s.broken}
+	var sizes [64]int64
+	start := time.Now()
+	for {
+		// Checking the clock is expensive compared to a read, so only do it
+		// every so often.
+		for range 1024 {
+			var fooCopy Foo
+			if h.readerRecording() {
+				invoke := h.now()
+				fooCopy = p.Load()
+				h.recordRead(fooCopy, invoke)
+			} else {
+				fooCopy = p.Load()
+			}
+			r.Reads++
+			if fooCopy.A != fooCopy.B {
+				r.Tears++
+				sizes[bits.Len(uint(absDiff(fooCopy.A, fooCopy.B)))-1]++
+				if r.FirstTear == nil {
+					t := time.Since(start).Seconds()
+					r.FirstTear = &t
+				}
+			}
+		}
+		if time.Since(start) >= duration {
+			break
+		}
+	}
+	h.finishReader()
+	done.Store(true)
+	r.Writes = <-writes
+	r.Seconds = time.Since(start).Seconds()
+	r.TearsPerSec = float64(r.Tears) / r.Seconds
+	for i := len(sizes); i > 0; i-- {
+		if sizes[i-1] != 0 {
+			r.TearSizes = sizes[:i]
+			break
+		}
+	}
+	return r
+}
+
+func absDiff(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func parseModes(arg string) ([]strategy, error) {
+	if arg == "all" {
+		return strategies, nil
+	}
+	var modes []strategy
+	for _, name := range strings.Split(arg, ",") {
+		s, ok := lookupStrategy(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown mode %q (try -list)", name)
+		}
+		modes = append(modes, s)
+	}
+	return modes, nil
+}
+
+func main() {
+	mode := flag.String("mode", "all", "comma-separated strategies to run, or \"all\"")
+	duration := flag.Duration("duration", time.Second, "how long to run each strategy")
+	jsonOut := flag.Bool("json", false, "print one JSON result per line instead of a table")
+	list := flag.Bool("list", false, "list the available strategies and exit")
+	history := flag.String("history", "", "record a window of each run's history to this file, for ../linearize")
+	historyReads := flag.Int("history-reads", 1000, "how many reads to record per strategy with -history")
+	flag.Parse()
+
+	if *list {
+		for _, s := range strategies {
+			fmt.Printf("%-14s %s\n", s.name, s.doc)
+		}
+		return
+	}
+	modes, err := parseModes(*mode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var historyFile *os.File
+	if *history != "" {
+		historyFile, err = os.Create(*history)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer historyFile.Close()
+	}
+
+	var results []result
+	for _, s := range modes {
+		var h *recorder
+		if historyFile != nil {
+			h = newRecorder(s.name, *historyReads)
+		}
+		r := run(s, *duration, h)
+		if h != nil {
+			if err := h.writeTo(historyFile); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if *jsonOut {
+			json.NewEncoder(os.Stdout).Encode(r)
+		}
+		results = append(results, r)
+	}
+	if !*jsonOut {
+		printTable(results)
+	}
+	for _, r := range results {
+		if !r.Broken && r.Tears > 0 {
+			fmt.Fprintf(os.Stderr, "%s is supposed to be correct, but it tore %d times!\n", r.Mode, r.Tears)
+			os.Exit(1)
+		}
+	}
+}
+
+func printTable(results []result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "mode\treads\twrites\ttears\ttears/sec\tfirst tear\t")
+	for _, r := range results {
+		first := "never"
+		if r.FirstTear != nil {
+			first = time.Duration(*r.FirstTear * float64(time.Second)).String()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.0f\t%s\t\n", r.Mode, r.Reads, r.Writes, r.Tears, r.TearsPerSec, first)
+	}
+	w.Flush()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type Foo struct {
+	A int
+	B int
+}
+
+// A publisher is one way of sharing a Foo between the writer goroutine and
+// the reader goroutine. Some of these are correct, and some of them are
+// mistakes that people actually make when they try to fix not_atomic.go.
+type publisher interface {
+	Store(Foo)
+	Load() Foo
+}
+
+type strategy struct {
+	name string
+	// Broken strategies are expected to tear. Fixed strategies should never
+	// produce a Foo where A != B, and if they do that's a bug in the harness.
+	broken bool
+	doc    string
+	new    func() publisher
+}
+
+var strategies = []strategy{
+	{"plain", true, "plain struct assignment, exactly like not_atomic.go", func() publisher { return new(plainFoo) }},
+	{"atomicfields", true, "A and B are each an atomic.Int64, but the pair isn't read as a unit", func() publisher { return new(atomicFields) }},
+	{"writerlock", true, "the writer takes a Mutex, but the reader doesn't", func() publisher { return new(writerLock) }},
+	{"rlockwriter", true, "the writer takes RLock instead of Lock, so it doesn't exclude readers", func() publisher { return new(rlockWriter) }},
+	{"mutex", false, "both sides take a Mutex", func() publisher { return new(mutexFoo) }},
+	{"rwmutex", false, "the writer takes Lock and the reader takes RLock", func() publisher { return new(rwmutexFoo) }},
+	{"atomicpointer", false, "each write publishes a fresh *Foo through an atomic.Pointer", func() publisher { return new(atomicPointer) }},
+}
+
+func lookupStrategy(name string) (strategy, bool) {
+	for _, s := range strategies {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return strategy{}, false
+}
+
+type plainFoo struct {
+	foo Foo
+}
+
+func (p *plainFoo) Store(f Foo) { p.foo = f }
+func (p *plainFoo) Load() Foo   { return p.foo }
+
+// Each individual load and store here is atomic, and the race detector is
+// perfectly happy with it. But the writer can run in between the reader's
+// load of A and its load of B, so the reader can still see A != B.
+type atomicFields struct {
+	a atomic.Int64
+	b atomic.Int64
+}
+
+func (p *atomicFields) Store(f Foo) {
+	p.a.Store(int64(f.A))
+	p.b.Store(int64(f.B))
+}
+
+func (p *atomicFields) Load() Foo {
+	return Foo{A: int(p.a.Load()), B: int(p.b.Load())}
+}
+
+// Locking only in the writer keeps writers from stepping on each other, but
+// there's only one writer. The reader doesn't wait for anything.
+type writerLock struct {
+	mu  sync.Mutex
+	foo Foo
+}
+
+func (p *writerLock) Store(f Foo) {
+	p.mu.Lock()
+	p.foo = f
+	p.mu.Unlock()
+}
+
+func (p *writerLock) Load() Foo { return p.foo }
+
+// Any number of RLocks can be held at the same time, so a writer holding
+// RLock doesn't exclude a reader holding RLock.
+type rlockWriter struct {
+	mu  sync.RWMutex
+	foo Foo
+}
+
+func (p *rlockWriter) Store(f Foo) {
+	p.mu.RLock()
+	p.foo = f
+	p.mu.RUnlock()
+}
+
+func (p *rlockWriter) Load() Foo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.foo
+}
+
+type mutexFoo struct {
+	mu  sync.Mutex
+	foo Foo
+}
+
+func (p *mutexFoo) Store(f Foo) {
+	p.mu.Lock()
+	p.foo = f
+	p.mu.Unlock()
+}
+
+func (p *mutexFoo) Load() Foo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.foo
+}
+
+type rwmutexFoo struct {
+	mu  sync.RWMutex
+	foo Foo
+}
+
+func (p *rwmutexFoo) Store(f Foo) {
+	p.mu.Lock()
+	p.foo = f
+	p.mu.Unlock()
+}
+
+func (p *rwmutexFoo) Load() Foo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.foo
+}
+
+// The Foo behind the pointer is never modified after it's published, so
+// readers can copy it without any further synchronization.
+type atomicPointer struct {
+	ptr atomic.Pointer[Foo]
+}
+
+func (p *atomicPointer) Store(f Foo) { p.ptr.Store(&f) }
+
+func (p *atomicPointer) Load() Foo {
+	if f := p.ptr.Load(); f != nil {
+		return *f
+	}
+	return Foo{}
+}
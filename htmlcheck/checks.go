@@ -0,0 +1,314 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+type problem struct {
+	line int
+	msg  string
+}
+
+// A checker runs every check on one document and collects the problems.
+type checker struct {
+	doc      *document
+	styles   *styles
+	level    string // AA or AAA
+	problems []problem
+	// pairs counts text by the colors it's drawn in, for -v.
+	pairs map[colorPair]*pairUse
+}
+
+type colorPair struct {
+	fg, bg string
+	large  bool
+}
+
+type pairUse struct {
+	ratio float64
+	line  int
+	text  string
+	count int
+}
+
+func (c *checker) report(n *node, format string, args ...any) {
+	c.problems = append(c.problems, problem{n.line, fmt.Sprintf(format, args...)})
+}
+
+// find returns every element with the given tag.
+func (c *checker) find(tag string) []*node {
+	var found []*node
+	c.doc.root.walk(func(n *node) {
+		if n.tag == tag {
+			found = append(found, n)
+		}
+	})
+	return found
+}
+
+func (c *checker) run() {
+	c.document()
+	c.images()
+	c.links()
+	c.headings()
+	c.ids()
+	c.contrast()
+	slices.SortFunc(c.problems, func(a, b problem) int {
+		return cmp.Or(a.line-b.line, strings.Compare(a.msg, b.msg))
+	})
+}
+
+// document checks the things every page needs once.
+func (c *checker) document() {
+	if c.doc.doctype == "" {
+		c.report(c.doc.root, "no <!DOCTYPE html>, so browsers render the page in quirks mode")
+	} else if !strings.EqualFold(strings.TrimSpace(c.doc.doctype), "html") {
+		c.report(c.doc.root, "<!DOCTYPE %s> is an old doctype; use <!DOCTYPE html>", c.doc.doctype)
+	}
+	htmls := c.find("html")
+	if len(htmls) == 0 {
+		c.report(c.doc.root, "no <html> element, so there's nowhere to say what language the page is in")
+	} else if strings.TrimSpace(htmls[0].attrs["lang"]) == "" {
+		c.report(htmls[0], "<html> has no lang attribute, so screen readers have to guess the language")
+	}
+	charset := false
+	for _, m := range c.find("meta") {
+		if _, ok := m.attr("charset"); ok {
+			charset = true
+		} else if strings.EqualFold(m.attrs["http-equiv"], "content-type") &&
+			strings.Contains(strings.ToLower(m.attrs["content"]), "charset=") {
+			charset = true
+		}
+	}
+	if !charset {
+		c.report(c.doc.root, `no <meta charset="utf-8">, so the encoding depends on the server and the browser`)
+	}
+	titles := c.find("title")
+	if len(titles) == 0 || titles[0].textContent() == "" {
+		c.report(c.doc.root, "no <title>")
+	}
+	for _, s := range c.find("style") {
+		if !inside(s, "head") {
+			c.report(s, "<style> belongs in <head>")
+		}
+	}
+}
+
+func inside(n *node, tag string) bool {
+	for p := n.parent; p != nil; p = p.parent {
+		if p.tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func describeImg(n *node) string {
+	if src := n.attrs["src"]; src != "" {
+		return fmt.Sprintf("<img src=%q>", src)
+	}
+	return "<img>"
+}
+
+// hasDimension says whether an image's width or height is set, by attribute
+// or inline style, so the browser can save it space before it loads.
+func hasDimension(n *node, prop string) bool {
+	if _, ok := n.attr(prop); ok {
+		return true
+	}
+	for _, d := range parseDeclarations(n.attrs["style"]) {
+		if d.property == prop || d.property == "aspect-ratio" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) images() {
+	for _, img := range c.find("img") {
+		if _, ok := img.attr("alt"); !ok {
+			c.report(img, `%s has no alt text (use alt="" if it's only decoration)`, describeImg(img))
+		}
+		w, h := hasDimension(img, "width"), hasDimension(img, "height")
+		switch {
+		case !w && !h:
+			c.report(img, "%s has no width or height, so the page jumps when it loads", describeImg(img))
+		case !w || !h:
+			// One is enough for the layout once the image is in, but not
+			// before.
+			missing := "width"
+			if w {
+				missing = "height"
+			}
+			c.report(img, "%s has no %s, so the page jumps when it loads", describeImg(img), missing)
+		}
+	}
+}
+
+// accessibleName is roughly what a screen reader announces for n: its
+// aria-label, or else its text with the alt text of its images, or else its
+// title.
+func accessibleName(n *node) string {
+	if label := strings.TrimSpace(n.attrs["aria-label"]); label != "" {
+		return label
+	}
+	var parts []string
+	var visit func(*node)
+	visit = func(d *node) {
+		switch {
+		case d.tag == "":
+			parts = append(parts, d.text)
+		case d.attrs["aria-hidden"] == "true":
+		case d.tag == "img":
+			parts = append(parts, d.attrs["alt"])
+		default:
+			for _, child := range d.children {
+				visit(child)
+			}
+		}
+	}
+	visit(n)
+	if name := strings.Join(strings.Fields(strings.Join(parts, " ")), " "); name != "" {
+		return name
+	}
+	return strings.TrimSpace(n.attrs["title"])
+}
+
+func (c *checker) links() {
+	for _, a := range c.find("a") {
+		href, ok := a.attr("href")
+		if !ok {
+			continue
+		}
+		if accessibleName(a) == "" {
+			what := "has no text"
+			if len(c.imagesIn(a)) > 0 {
+				what = "has only an image with no alt text"
+			}
+			c.report(a, "the link to %s %s, so screen readers can only read out the URL", href, what)
+		}
+	}
+}
+
+func (c *checker) imagesIn(n *node) []*node {
+	var imgs []*node
+	n.walk(func(d *node) {
+		if d.tag == "img" || d.tag == "svg" {
+			imgs = append(imgs, d)
+		}
+	})
+	return imgs
+}
+
+// headings checks that the outline starts at h1 and never skips a level on
+// the way down. Going back up any number of levels is fine.
+func (c *checker) headings() {
+	prev := 0
+	c.doc.root.walk(func(n *node) {
+		level := headingLevel(n.tag)
+		if level == 0 {
+			return
+		}
+		if n.textContent() == "" && accessibleName(n) == "" {
+			c.report(n, "<%s> is empty", n.tag)
+		}
+		switch {
+		case prev == 0 && level != 1:
+			c.report(n, "the first heading is <%s>, not <h1>", n.tag)
+		case prev != 0 && level > prev+1:
+			c.report(n, "<%s> comes right after <h%d>, skipping a level", n.tag, prev)
+		}
+		prev = level
+	})
+}
+
+func (c *checker) ids() {
+	seen := make(map[string]*node)
+	c.doc.root.walk(func(n *node) {
+		id, ok := n.attr("id")
+		if !ok || n.tag == "" {
+			return
+		}
+		if first, dup := seen[id]; dup {
+			c.report(n, "id %q is already used on line %d", id, first.line)
+		} else {
+			seen[id] = n
+		}
+	})
+}
+
+// Text that isn't drawn, or isn't drawn from the page's CSS.
+var hiddenText = []string{"head", "style", "script", "noscript", "template", "title", "svg", "textarea", "select"}
+
+// WCAG's minimum contrast ratios, for normal text and for large text.
+var thresholds = map[string][2]float64{
+	"AA":  {4.5, 3},
+	"AAA": {7, 4.5},
+}
+
+// contrast works out the colors of every piece of visible text and reports
+// the pairs that don't meet the level. Each pair gets one problem, at the
+// first place it shows up, since fixing the CSS fixes all of them.
+func (c *checker) contrast() {
+	c.doc.root.walk(func(n *node) {
+		if n.tag != "" || strings.TrimSpace(n.text) == "" || n.parent == nil {
+			return
+		}
+		for p := n.parent; p != nil; p = p.parent {
+			if slices.Contains(hiddenText, p.tag) {
+				return
+			}
+		}
+		fg, bg, ok := c.styles.colors(n.parent)
+		if !ok {
+			return
+		}
+		large := false
+		for p := n.parent; p != nil; p = p.parent {
+			if level := headingLevel(p.tag); level > 0 && level <= 3 {
+				large = true
+			}
+		}
+		key := colorPair{fg.String(), bg.String(), large}
+		if use, ok := c.pairs[key]; ok {
+			use.count++
+			return
+		}
+		text := strings.Join(strings.Fields(n.text), " ")
+		if r := []rune(text); len(r) > 30 {
+			text = string(r[:27]) + "..."
+		}
+		c.pairs[key] = &pairUse{ratio: contrast(fg, bg), line: n.line, text: text, count: 1}
+	})
+	for key, use := range c.pairs {
+		need := thresholds[c.level][0]
+		size := ""
+		if key.large {
+			need, size = thresholds[c.level][1], "large "
+		}
+		if use.ratio < need {
+			c.problems = append(c.problems, problem{use.line, fmt.Sprintf(
+				"%stext %q is %s on %s, a contrast of %.2f:1, and %s needs %g:1%s",
+				size, use.text, key.fg, key.bg, truncate(use.ratio), c.level, need, elsewhere(use.count))})
+		}
+	}
+}
+
+// truncate rounds down to what %.2f prints, so 4.499 doesn't fail as 4.50.
+func truncate(ratio float64) float64 {
+	return math.Floor(ratio*100) / 100
+}
+
+func elsewhere(count int) string {
+	switch count {
+	case 1:
+		return ""
+	case 2:
+		return " (and 1 more place)"
+	}
+	return fmt.Sprintf(" (and %d more places)", count-1)
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This is just enough CSS to work out what color text is and what it sits
+// on: colors, simple selectors, specificity, source order, and inheritance.
+// Rules with pseudo-classes, attribute selectors, or sibling combinators
+// are skipped, and so are font sizes. Headings count as large text, since
+// nothing here makes them smaller.
+
+type color struct{ r, g, b, a float64 }
+
+func (c color) String() string {
+	s := fmt.Sprintf("#%02x%02x%02x", int(math.Round(c.r)), int(math.Round(c.g)), int(math.Round(c.b)))
+	// Shorten to #rgb when that's exact, like people write them.
+	if s[1] == s[2] && s[3] == s[4] && s[5] == s[6] {
+		s = "#" + s[1:2] + s[3:4] + s[5:6]
+	}
+	if c.a < 1 {
+		s += fmt.Sprintf(" at %.0f%%", c.a*100)
+	}
+	return s
+}
+
+var namedColors = map[string]color{
+	"black":       {0, 0, 0, 1},
+	"white":       {255, 255, 255, 1},
+	"gray":        {128, 128, 128, 1},
+	"grey":        {128, 128, 128, 1},
+	"silver":      {192, 192, 192, 1},
+	"red":         {255, 0, 0, 1},
+	"green":       {0, 128, 0, 1},
+	"blue":        {0, 0, 255, 1},
+	"yellow":      {255, 255, 0, 1},
+	"orange":      {255, 165, 0, 1},
+	"purple":      {128, 0, 128, 1},
+	"navy":        {0, 0, 128, 1},
+	"maroon":      {128, 0, 0, 1},
+	"teal":        {0, 128, 128, 1},
+	"olive":       {128, 128, 0, 1},
+	"lime":        {0, 255, 0, 1},
+	"aqua":        {0, 255, 255, 1},
+	"fuchsia":     {255, 0, 255, 1},
+	"transparent": {0, 0, 0, 0},
+}
+
+var rgbFunc = regexp.MustCompile(`^rgba?\(\s*([\d.]+)[\s,]+([\d.]+)[\s,]+([\d.]+)\s*(?:[,/]\s*([\d.]+%?)\s*)?\)$`)
+
+// parseColor understands hex colors, rgb() and rgba(), and the basic
+// names. Anything else, like currentColor or hsl(), comes back false.
+func parseColor(s string) (color, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColors[s]; ok {
+		return c, true
+	}
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) == 3 || len(hex) == 4 {
+			var long strings.Builder
+			for _, ch := range hex {
+				long.WriteRune(ch)
+				long.WriteRune(ch)
+			}
+			hex = long.String()
+		}
+		if len(hex) != 6 && len(hex) != 8 {
+			return color{}, false
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return color{}, false
+		}
+		if len(hex) == 6 {
+			v = v<<8 | 0xff
+		}
+		return color{float64(v >> 24), float64(v >> 16 & 0xff), float64(v >> 8 & 0xff), float64(v&0xff) / 255}, true
+	}
+	m := rgbFunc.FindStringSubmatch(s)
+	if m == nil {
+		return color{}, false
+	}
+	var c color
+	for i, p := range []*float64{&c.r, &c.g, &c.b} {
+		*p, _ = strconv.ParseFloat(m[i+1], 64)
+	}
+	c.a = 1
+	if alpha, ok := strings.CutSuffix(m[4], "%"); ok {
+		c.a, _ = strconv.ParseFloat(alpha, 64)
+		c.a /= 100
+	} else if m[4] != "" {
+		c.a, _ = strconv.ParseFloat(m[4], 64)
+	}
+	return c, true
+}
+
+// over composites c onto an opaque background.
+func (c color) over(bg color) color {
+	mix := func(x, y float64) float64 { return x*c.a + y*(1-c.a) }
+	return color{mix(c.r, bg.r), mix(c.g, bg.g), mix(c.b, bg.b), 1}
+}
+
+// luminance and contrast are straight from WCAG 2.
+func (c color) luminance() float64 {
+	channel := func(v float64) float64 {
+		v /= 255
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.r) + 0.7152*channel(c.g) + 0.0722*channel(c.b)
+}
+
+func contrast(a, b color) float64 {
+	la, lb := a.luminance(), b.luminance()
+	return (max(la, lb) + 0.05) / (min(la, lb) + 0.05)
+}
+
+// A compound is one piece of a selector, like a.external or #top.
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+func (c compound) matches(n *node) bool {
+	if n.tag == "" || (c.tag != "" && c.tag != "*" && c.tag != n.tag) {
+		return false
+	}
+	if c.id != "" && n.attrs["id"] != c.id {
+		return false
+	}
+	classes := strings.Fields(n.attrs["class"])
+	for _, want := range c.classes {
+		found := false
+		for _, have := range classes {
+			found = found || have == want
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// A selector is compounds joined by descendant or child combinators, last
+// one first, since that's the order they're matched in.
+type selector struct {
+	parts       []compound
+	child       []bool // child[i] is true if parts[i] and parts[i+1] are joined by >
+	specificity [3]int
+}
+
+var compoundPattern = regexp.MustCompile(`^([a-z][a-z0-9]*|\*)?((?:[.#][\w-]+)*)$`)
+var compoundPiece = regexp.MustCompile(`[.#][\w-]+`)
+
+func parseSelector(s string) (selector, bool) {
+	var sel selector
+	fields := strings.Fields(strings.ReplaceAll(strings.TrimSpace(s), ">", " > "))
+	nextIsChild := false
+	for i := len(fields) - 1; i >= 0; i-- {
+		f := strings.ToLower(fields[i])
+		if f == ">" {
+			if len(sel.parts) == 0 || nextIsChild {
+				return selector{}, false
+			}
+			nextIsChild = true
+			continue
+		}
+		m := compoundPattern.FindStringSubmatch(f)
+		if m == nil {
+			return selector{}, false
+		}
+		c := compound{tag: m[1]}
+		if c.tag != "" && c.tag != "*" {
+			sel.specificity[2]++
+		}
+		for _, piece := range compoundPiece.FindAllString(m[2], -1) {
+			if piece[0] == '#' {
+				c.id = piece[1:]
+				sel.specificity[0]++
+			} else {
+				c.classes = append(c.classes, piece[1:])
+				sel.specificity[1]++
+			}
+		}
+		if len(sel.parts) > 0 {
+			sel.child = append(sel.child, nextIsChild)
+		}
+		nextIsChild = false
+		sel.parts = append(sel.parts, c)
+	}
+	return sel, len(sel.parts) > 0 && !nextIsChild
+}
+
+func (s selector) matches(n *node) bool {
+	return s.matchFrom(0, n)
+}
+
+func (s selector) matchFrom(i int, n *node) bool {
+	if !s.parts[i].matches(n) {
+		return false
+	}
+	if i+1 == len(s.parts) {
+		return true
+	}
+	for p := n.parent; p != nil; p = p.parent {
+		if s.matchFrom(i+1, p) {
+			return true
+		}
+		if s.child[i] {
+			return false
+		}
+	}
+	return false
+}
+
+type declaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+type rule struct {
+	selector selector
+	decls    []declaration
+	order    int
+}
+
+var cssComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+func parseDeclarations(s string) []declaration {
+	var decls []declaration
+	for _, d := range strings.Split(s, ";") {
+		prop, val, ok := strings.Cut(d, ":")
+		if !ok {
+			continue
+		}
+		val, important := strings.CutSuffix(strings.TrimSpace(val), "!important")
+		decls = append(decls, declaration{
+			property:  strings.ToLower(strings.TrimSpace(prop)),
+			value:     strings.TrimSpace(val),
+			important: important,
+		})
+	}
+	return decls
+}
+
+// parseStylesheet returns a rule per selector. At-rules like @media are
+// skipped whole, which means we check the page as it looks on a screen wider
+// than any breakpoint.
+func parseStylesheet(css string, order *int) []rule {
+	var rules []rule
+	css = cssComment.ReplaceAllString(css, "")
+	for len(css) > 0 {
+		open := strings.Index(css, "{")
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[:open])
+		if strings.HasPrefix(prelude, "@") {
+			// Find the brace that matches this one.
+			depth, end := 0, len(css)
+			for i := open; i < len(css); i++ {
+				if css[i] == '{' {
+					depth++
+				} else if css[i] == '}' {
+					if depth--; depth == 0 {
+						end = i + 1
+						break
+					}
+				}
+			}
+			css = css[end:]
+			continue
+		}
+		end := strings.Index(css[open:], "}")
+		if end < 0 {
+			break
+		}
+		decls := parseDeclarations(css[open+1 : open+end])
+		css = css[open+end+1:]
+		for _, s := range strings.Split(prelude, ",") {
+			sel, ok := parseSelector(s)
+			if !ok {
+				continue
+			}
+			*order++
+			rules = append(rules, rule{sel, decls, *order})
+		}
+	}
+	return rules
+}
+
+// The user agent stylesheet, as far as color goes.
+const uaStylesheet = `
+html { color: black; background-color: white }
+a { color: #0000ee }
+mark { color: black; background-color: yellow }
+`
+
+type styles struct {
+	ua, author []rule
+}
+
+// lookup finds the cascaded value of prop on n, and whether there is one.
+func (s *styles) lookup(n *node, prop string) (string, bool) {
+	if inline, ok := n.attrs["style"]; ok {
+		var val string
+		found := false
+		for _, d := range parseDeclarations(inline) {
+			if d.property == prop || (prop == "background-color" && d.property == "background") {
+				val, found = d.value, true
+			}
+		}
+		// Inline styles beat everything but !important, which nobody here
+		// uses on text colors.
+		if found {
+			return val, true
+		}
+	}
+	for _, rules := range [][]rule{s.author, s.ua} {
+		var best *declaration
+		var bestRule rule
+		for _, r := range rules {
+			if !r.selector.matches(n) {
+				continue
+			}
+			for i, d := range r.decls {
+				if d.property != prop && !(prop == "background-color" && d.property == "background") {
+					continue
+				}
+				if best == nil || beats(d, r, *best, bestRule) {
+					best, bestRule = &r.decls[i], r
+				}
+			}
+		}
+		if best != nil {
+			return best.value, true
+		}
+	}
+	return "", false
+}
+
+func beats(d declaration, r rule, best declaration, bestRule rule) bool {
+	if d.important != best.important {
+		return d.important
+	}
+	for i := range r.selector.specificity {
+		if r.selector.specificity[i] != bestRule.selector.specificity[i] {
+			return r.selector.specificity[i] > bestRule.selector.specificity[i]
+		}
+	}
+	return r.order >= bestRule.order
+}
+
+// backgroundColor picks the color out of a background shorthand.
+func backgroundColor(val string) (color, bool) {
+	if val == "none" {
+		return namedColors["transparent"], true
+	}
+	if c, ok := parseColor(val); ok {
+		return c, true
+	}
+	for _, f := range strings.Fields(val) {
+		if c, ok := parseColor(f); ok {
+			return c, true
+		}
+	}
+	return color{}, false
+}
+
+// colors works out the text color of n and the color behind it. Text color
+// inherits; backgrounds don't, but a transparent one shows its parent's, so
+// it's the same walk up the tree either way. ok is false if something along
+// the way isn't a color we understand, or the background is an image.
+func (s *styles) colors(n *node) (fg, bg color, ok bool) {
+	var chain []*node
+	for p := n; p != nil; p = p.parent {
+		if p.tag != "" && p.tag != "#document" {
+			chain = append(chain, p)
+		}
+	}
+	fg, bg = color{0, 0, 0, 1}, color{255, 255, 255, 1}
+	// From the root down, so each background composites onto its parent's.
+	for i := len(chain) - 1; i >= 0; i-- {
+		e := chain[i]
+		if val, found := s.lookup(e, "background-color"); found {
+			if strings.Contains(val, "url(") || strings.Contains(val, "gradient(") {
+				return fg, bg, false
+			}
+			c, parsed := backgroundColor(val)
+			if !parsed {
+				return fg, bg, false
+			}
+			bg = c.over(bg)
+		}
+		if val, found := s.lookup(e, "color"); found && val != "inherit" {
+			c, parsed := parseColor(val)
+			if !parsed {
+				return fg, bg, false
+			}
+			fg = c
+		}
+	}
+	return fg.over(bg), bg, true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A node is an element or a run of text, with the line it starts on.
+// html.Parse would build a more faithful tree, but it throws away positions,
+// and every problem needs a line number. The tokenizer keeps the raw bytes,
+// so we build our own tree from that, with just enough of the parsing rules
+// to get the nesting right for pages like ours.
+type node struct {
+	tag      string // empty for text
+	attrs    map[string]string
+	text     string
+	line     int
+	parent   *node
+	children []*node
+}
+
+func (n *node) attr(key string) (string, bool) {
+	v, ok := n.attrs[key]
+	return v, ok
+}
+
+// walk calls f on n and everything under it, in document order.
+func (n *node) walk(f func(*node)) {
+	f(n)
+	for _, c := range n.children {
+		c.walk(f)
+	}
+}
+
+// textContent is all the text under n, with whitespace collapsed.
+func (n *node) textContent() string {
+	var b strings.Builder
+	n.walk(func(d *node) {
+		if d.tag == "" {
+			b.WriteString(d.text)
+			b.WriteByte(' ')
+		}
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// textContentRaw is the text under n as it was written, for <style>.
+func (n *node) textContentRaw() string {
+	var b strings.Builder
+	n.walk(func(d *node) {
+		if d.tag == "" {
+			b.WriteString(d.text)
+		}
+	})
+	return b.String()
+}
+
+// A document is the tree plus what the tokenizer saw outside of it.
+type document struct {
+	root    *node
+	doctype string
+}
+
+var voidElements = []string{
+	"area", "base", "br", "col", "embed", "hr", "img", "input",
+	"link", "meta", "param", "source", "track", "wbr",
+}
+
+// Starting one of these closes an open element of the same kind, like a <li>
+// that never got its </li>.
+var selfClosing = []string{"li", "p", "dt", "dd", "option", "tr", "td", "th"}
+
+func parse(r io.Reader) (*document, error) {
+	doc := &document{root: &node{tag: "#document", line: 1}}
+	z := html.NewTokenizer(r)
+	line := 1
+	open := []*node{doc.root}
+	top := func() *node { return open[len(open)-1] }
+	for {
+		tt := z.Next()
+		raw := z.Raw()
+		start := line
+		line += bytes.Count(raw, []byte("\n"))
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, fmt.Errorf("line %d: %w", start, err)
+			}
+			return doc, nil
+		case html.DoctypeToken:
+			doc.doctype = string(z.Text())
+		case html.TextToken:
+			n := &node{text: string(z.Text()), line: start, parent: top()}
+			top().children = append(top().children, n)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			n := &node{tag: string(name), attrs: make(map[string]string), line: start}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				n.attrs[string(key)] = string(val)
+			}
+			if slices.Contains(selfClosing, n.tag) && top().tag == n.tag {
+				open = open[:len(open)-1]
+			}
+			n.parent = top()
+			top().children = append(top().children, n)
+			if tt == html.StartTagToken && !slices.Contains(voidElements, n.tag) {
+				open = append(open, n)
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			// Close everything up to the matching element, if it's open at
+			// all. A stray end tag is ignored, like a browser would.
+			for i := len(open) - 1; i > 0; i-- {
+				if open[i].tag == string(name) {
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+}
+
+// headingLevel returns the level of an h1 through h6, or 0.
+func headingLevel(tag string) int {
+	if len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6' {
+		return int(tag[1] - '0')
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the .want files")
+
+// Each testdata/NAME.html has its findings in testdata/NAME.want, one per
+// line as the tool prints them. clean.html should have none. After changing
+// a message, regenerate them and read the diff:
+//
+//	go test ./htmlcheck -update
+func TestFixtures(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join("testdata", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("no fixtures in testdata")
+	}
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".html")
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			n, err := checkFile(&out, page, "AA", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := filepath.ToSlash(out.String())
+			if name == "clean" && got != "" {
+				t.Errorf("clean.html isn't clean:\n%s", got)
+			}
+			if lines := strings.Count(got, "\n"); lines != n {
+				t.Errorf("checkFile says %d problems but printed %d", n, lines)
+			}
+			wantPath := filepath.Join("testdata", name+".want")
+			if *update {
+				if err := os.WriteFile(wantPath, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(wantPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// At AAA, the large heading's 3.5:1 isn't enough either, and #767676, which
+// just passes AA, fails.
+func TestAAA(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := checkFile(&out, filepath.Join("testdata", "contrast.html"), "AAA", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`:17: text "Just over 4.5:1." is #767676 on #fff, a contrast of 4.54:1, and AAA needs 7:1`,
+		`:18: large text "Large text passes at 3.5:1" is #888 on #fff, a contrast of 3.54:1, and AAA needs 4.5:1`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("no %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestContrast(t *testing.T) {
+	tests := []struct {
+		fg, bg string
+		ratio  float64
+	}{
+		{"black", "white", 21},
+		{"white", "white", 1},
+		{"#777", "white", 4.47},
+		{"#767676", "#fff", 4.54},
+		{"rgb(0 0 238)", "#333", 1.34},
+	}
+	for _, test := range tests {
+		fg, ok1 := parseColor(test.fg)
+		bg, ok2 := parseColor(test.bg)
+		if !ok1 || !ok2 {
+			t.Errorf("can't parse %q or %q", test.fg, test.bg)
+			continue
+		}
+		if r := truncate(contrast(fg, bg)); r != test.ratio {
+			t.Errorf("%s on %s: got %.2f:1, want %.2f:1", test.fg, test.bg, r, test.ratio)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+// htmlcheck reads the site's HTML and reports accessibility and validity
+// problems: images without alt text or dimensions, links with nothing for a
+// screen reader to say, headings that skip levels, a missing doctype, lang,
+// <meta charset>, or <title>, duplicate ids, and text whose color doesn't
+// contrast enough with what's behind it. Colors come from the page's own
+// <style> blocks, local stylesheets, and inline styles, cascaded the way a
+// browser would for the simple selectors we use.
+//
+//     go run ./htmlcheck
+//     go run ./htmlcheck -level AAA -v www/index.html
+//
+// It prints one line per problem, as FILE:LINE: MESSAGE, and exits 1 if
+// there are any. With -v it also lists every text color it found, with its
+// contrast ratio.
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// loadStyles collects the author rules for a page, from <style> blocks and
+// <link rel=stylesheet> to local files, in document order.
+func loadStyles(doc *document, path string) *styles {
+	s := &styles{}
+	order := 0
+	s.ua = parseStylesheet(uaStylesheet, &order)
+	order = 0
+	doc.root.walk(func(n *node) {
+		switch {
+		case n.tag == "style":
+			s.author = append(s.author, parseStylesheet(n.textContentRaw(), &order)...)
+		case n.tag == "link" && strings.EqualFold(n.attrs["rel"], "stylesheet"):
+			href := n.attrs["href"]
+			if href == "" || strings.Contains(href, "://") || strings.HasPrefix(href, "//") {
+				return
+			}
+			css, err := os.ReadFile(filepath.Join(filepath.Dir(path), filepath.FromSlash(href)))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s:%d: can't read the stylesheet: %v\n", path, n.line, err)
+				return
+			}
+			s.author = append(s.author, parseStylesheet(string(css), &order)...)
+		}
+	})
+	return s
+}
+
+func checkFile(w io.Writer, path, level string, verbose bool) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	doc, err := parse(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	c := &checker{doc: doc, styles: loadStyles(doc, path), level: level, pairs: make(map[colorPair]*pairUse)}
+	c.run()
+	for _, p := range c.problems {
+		fmt.Fprintf(w, "%s:%d: %s\n", path, p.line, p.msg)
+	}
+	if verbose {
+		keys := make([]colorPair, 0, len(c.pairs))
+		for k := range c.pairs {
+			keys = append(keys, k)
+		}
+		slices.SortFunc(keys, func(a, b colorPair) int {
+			return cmp.Or(cmp.Compare(c.pairs[a].line, c.pairs[b].line), strings.Compare(a.fg, b.fg), strings.Compare(a.bg, b.bg))
+		})
+		for _, k := range keys {
+			use := c.pairs[k]
+			size := ""
+			if k.large {
+				size = " (large)"
+			}
+			places := "places"
+			if use.count == 1 {
+				places = "place"
+			}
+			fmt.Fprintf(w, "%s:%d: colors: %s on %s%s, %.2f:1, %d %s\n",
+				path, use.line, k.fg, k.bg, size, truncate(use.ratio), use.count, places)
+		}
+	}
+	return len(c.problems), nil
+}
+
+func main() {
+	level := flag.String("level", "AA", "the WCAG contrast level to check, AA or AAA")
+	verbose := flag.Bool("v", false, "also list every text color and its contrast")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: htmlcheck [-level AA|AAA] [-v] [PATH...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	*level = strings.ToUpper(*level)
+	if _, ok := thresholds[*level]; !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"www"}
+	}
+	problems := 0
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if ext := strings.ToLower(filepath.Ext(path)); ext != ".html" && ext != ".htm" {
+				return nil
+			}
+			n, err := checkFile(os.Stdout, path, *level, *verbose)
+			problems += n
+			return err
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,34 @@
+// Package harnessbin builds the torn-read harness for the tools that run it
+// in subprocesses (knobs, quiz, report and slides), so that each of them
+// doesn't need its own copy of the go build dance.
+package harnessbin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Build compiles the Go files in dir into a temporary directory and returns
+// the path to the binary, along with a function that deletes it. The
+// compiler's errors go to stderr.
+func Build(dir string) (bin string, cleanup func(), err error) {
+	sources, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil || len(sources) == 0 {
+		return "", nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	tmp, err := os.MkdirTemp("", "harness")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(tmp) }
+	bin = filepath.Join(tmp, "harness")
+	cmd := exec.Command("go", append([]string{"build", "-o", bin}, sources...)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("building the harness: %w", err)
+	}
+	return bin, cleanup, nil
+}
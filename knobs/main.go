@@ -0,0 +1,277 @@
+package main
+
+// knobs reruns the harness in subprocesses under different runtime settings,
+// to see which ones change how often a Foo tears. The suspects are async
+// preemption (which can stop the writer halfway through a struct copy), the
+// GC (which stops everyone now and then), and how many Ps there are to run
+// the writer and the reader at the same time.
+//
+//     go run ./knobs/*.go -mode plain -runs 5 -duration 1s
+//
+// Every combination of the values below gets run -runs times. That's a lot of
+// runs, so trim the lists for a quick look.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oconnor663/jacko.io/internal/harnessbin"
+)
+
+// A knob is one environment variable and the values to try for it. The
+// value "default" means leaving the variable unset.
+type knob struct {
+	name   string
+	env    string
+	values []string
+}
+
+type harnessResult struct {
+	TearsPerSec float64  `json:"tears_per_sec"`
+	FirstTear   *float64 `json:"first_tear_seconds"`
+}
+
+type combo struct {
+	settings []string // one value per knob
+	rates    []float64
+	// firstTears only has entries for the runs that tore at all.
+	firstTears []float64
+	runs       int
+}
+
+func runHarness(bin, mode string, duration time.Duration, knobs []knob, settings []string) (harnessResult, error) {
+	cmd := exec.Command(bin, "-json", "-mode", mode, "-duration", duration.String())
+	cmd.Env = os.Environ()
+	for i, k := range knobs {
+		if settings[i] != "default" {
+			cmd.Env = setEnv(cmd.Env, k.env, settings[i])
+		}
+	}
+	cmd.Stderr = os.Stderr
+	// The harness exits with an error if a supposedly correct strategy tears.
+	// We still want to count that run, so only give up if there's no output.
+	out, err := cmd.Output()
+	var r harnessResult
+	if jsonErr := json.Unmarshal(out, &r); jsonErr != nil {
+		if err == nil {
+			err = jsonErr
+		}
+		return r, fmt.Errorf("%s %v: %w", mode, settings, err)
+	}
+	return r, nil
+}
+
+// setEnv sets a variable in env. GODEBUG holds a list of settings, so a knob
+// there goes on the end of whatever's already set, rather than replacing it.
+// When a setting appears twice, the last one wins.
+func setEnv(env []string, name, value string) []string {
+	prefix := name + "="
+	for i, kv := range env {
+		if rest, ok := strings.CutPrefix(kv, prefix); ok {
+			if name == "GODEBUG" && rest != "" {
+				value = rest + "," + value
+			}
+			env[i] = prefix + value
+			return env
+		}
+	}
+	return append(env, prefix+value)
+}
+
+// combinations returns every way of picking one value from each knob.
+func combinations(knobs []knob) [][]string {
+	combos := [][]string{nil}
+	for _, k := range knobs {
+		var next [][]string
+		for _, c := range combos {
+			for _, v := range k.values {
+				next = append(next, append(slices.Clone(c), v))
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" && !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func main() {
+	harnessDir := flag.String("harness", "harness", "directory containing the harness source")
+	mode := flag.String("mode", "plain", "which harness strategy to run")
+	runs := flag.Int("runs", 5, "how many times to repeat each combination")
+	duration := flag.Duration("duration", time.Second, "how long each run lasts")
+	preempt := flag.String("asyncpreemptoff", "0,1", "GODEBUG=asyncpreemptoff values to try")
+	gogc := flag.String("gogc", "default,off,10", "GOGC values to try")
+	memlimit := flag.String("gomemlimit", "default,64MiB", "GOMEMLIMIT values to try")
+	procs := flag.String("gomaxprocs", fmt.Sprintf("1,2,%d", runtime.NumCPU()), "GOMAXPROCS values to try")
+	flag.Parse()
+
+	var preemptValues []string
+	for _, v := range splitList(*preempt) {
+		preemptValues = append(preemptValues, "asyncpreemptoff="+v)
+	}
+	knobs := []knob{
+		{"asyncpreemptoff", "GODEBUG", preemptValues},
+		{"GOGC", "GOGC", splitList(*gogc)},
+		{"GOMEMLIMIT", "GOMEMLIMIT", splitList(*memlimit)},
+		{"GOMAXPROCS", "GOMAXPROCS", splitList(*procs)},
+	}
+
+	bin, cleanup, err := harnessbin.Build(*harnessDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer cleanup()
+
+	settings := combinations(knobs)
+	total := len(settings) * *runs
+	fmt.Fprintf(os.Stderr, "%d combinations x %d runs x %s = about %s\n",
+		len(settings), *runs, *duration, time.Duration(total)**duration)
+	var combos []*combo
+	for _, s := range settings {
+		combos = append(combos, &combo{settings: s})
+	}
+	// Interleave the repeats, rather than doing all the runs of one
+	// combination back to back, so that slow drift in the machine's state
+	// (thermals, other load) doesn't line up with any one combination.
+	done := 0
+	for range *runs {
+		for _, c := range combos {
+			r, err := runHarness(bin, *mode, *duration, knobs, c.settings)
+			done++
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			c.runs++
+			c.rates = append(c.rates, r.TearsPerSec)
+			if r.FirstTear != nil {
+				c.firstTears = append(c.firstTears, *r.FirstTear)
+			}
+			fmt.Fprintf(os.Stderr, "\r%d/%d runs", done, total)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+
+	printCombos(knobs, combos)
+	fmt.Println()
+	printEffects(knobs, combos)
+}
+
+func printCombos(knobs []knob, combos []*combo) {
+	slices.SortFunc(combos, func(a, b *combo) int {
+		return -cmpFloat(mean(a.rates), mean(b.rates))
+	})
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, k := range knobs {
+		fmt.Fprintf(w, "%s\t", k.name)
+	}
+	fmt.Fprintln(w, "tears/sec\t±95%\tfirst tear\t±95%\ttore\t")
+	for _, c := range combos {
+		if c.runs == 0 {
+			continue
+		}
+		for _, s := range c.settings {
+			fmt.Fprintf(w, "%s\t", strings.TrimPrefix(s, "asyncpreemptoff="))
+		}
+		first, firstCI := "-", "-"
+		if len(c.firstTears) > 0 {
+			first = formatSeconds(mean(c.firstTears))
+			firstCI = formatSeconds(ci95(c.firstTears))
+		}
+		fmt.Fprintf(w, "%.0f\t%s\t%s\t%s\t%d/%d\t\n",
+			mean(c.rates), formatFloat(ci95(c.rates)), first, firstCI, len(c.firstTears), c.runs)
+	}
+	w.Flush()
+}
+
+// printEffects ranks the knobs by how much they matter. For each value of a
+// knob, we average the tear rate over every combination that uses that value.
+// A knob's effect is the spread between its best and worst values. This is a
+// crude main-effects analysis that ignores interactions between knobs, but
+// it's a good first look at where to dig.
+func printEffects(knobs []knob, combos []*combo) {
+	type effect struct {
+		knob   string
+		spread float64
+		levels []string
+	}
+	var effects []effect
+	for i, k := range knobs {
+		e := effect{knob: k.name}
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, v := range k.values {
+			var rates []float64
+			for _, c := range combos {
+				if c.settings[i] == v {
+					rates = append(rates, c.rates...)
+				}
+			}
+			if len(rates) == 0 {
+				continue
+			}
+			m := mean(rates)
+			lo, hi = min(lo, m), max(hi, m)
+			e.levels = append(e.levels, fmt.Sprintf("%s: %.0f", strings.TrimPrefix(v, "asyncpreemptoff="), m))
+		}
+		e.spread = hi - lo
+		effects = append(effects, e)
+	}
+	slices.SortFunc(effects, func(a, b effect) int { return -cmpFloat(a.spread, b.spread) })
+	fmt.Println("knobs ranked by effect on tears/sec:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, e := range effects {
+		fmt.Fprintf(w, "%d.\t%s\t%.0f\t%s\t\n", i+1, e.knob, e.spread, strings.Join(e.levels, ", "))
+	}
+	w.Flush()
+}
+
+// cmpFloat treats NaN as less than everything, so that it sorts last in the
+// descending sorts above.
+func cmpFloat(a, b float64) int {
+	switch {
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return -1
+	case math.IsNaN(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func formatFloat(x float64) string {
+	if math.IsNaN(x) {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", x)
+}
+
+func formatSeconds(s float64) string {
+	if math.IsNaN(s) {
+		return "-"
+	}
+	return time.Duration(s * float64(time.Second)).Round(time.Microsecond).String()
+}
@@ -0,0 +1,48 @@
+package main
+
+import "math"
+
+func mean(xs []float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+func stddev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	m := mean(xs)
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - m) * (x - m)
+	}
+	return math.Sqrt(ss / float64(len(xs)-1))
+}
+
+// Two-sided 95% critical values of Student's t distribution, indexed by
+// degrees of freedom. We only ever do a handful of runs per combination, so
+// the normal approximation (1.96) would make the intervals look much tighter
+// than they are.
+var t95 = []float64{
+	math.NaN(), 12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262,
+	2.228, 2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093,
+	2.086, 2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045,
+	2.042,
+}
+
+// ci95 returns the half-width of a 95% confidence interval for the mean of
+// xs, or NaN if there aren't enough samples to say.
+func ci95(xs []float64) float64 {
+	df := len(xs) - 1
+	if df < 1 {
+		return math.NaN()
+	}
+	t := 1.96
+	if df < len(t95) {
+		t = t95[df]
+	}
+	return t * stddev(xs) / math.Sqrt(float64(len(xs)))
+}
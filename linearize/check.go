@@ -0,0 +1,202 @@
+package main
+
+// This is the Wing & Gong linearizability search, with Lowe's memoization,
+// in roughly the shape that Porcupine uses. The history is a list of call and
+// return events sorted by time. We walk it from the front, trying to
+// linearize each op whose call we reach. When an op fits the model, we lift
+// it (and its return) out of the list and start over from the front. When we
+// reach a return whose op we haven't linearized, we're stuck, and we undo the
+// most recent lift and try the next candidate instead. If we run out of lifts
+// to undo, the history isn't linearizable.
+
+import (
+	"cmp"
+	"hash/maphash"
+	"slices"
+)
+
+type Foo struct {
+	A int
+	B int
+}
+
+type operation struct {
+	Client string `json:"client"`
+	Kind   string `json:"kind"`
+	Value  Foo    `json:"value"`
+	Invoke int64  `json:"invoke_ns"`
+	Return int64  `json:"return_ns"`
+}
+
+// The model is a single register holding a Foo. It starts out zeroed, like
+// the var in not_atomic.go. A write always succeeds, and a read has to return
+// exactly what's in the register.
+func step(state Foo, o *operation) (Foo, bool) {
+	if o.Kind == "write" {
+		return o.Value, true
+	}
+	return state, o.Value == state
+}
+
+type entry struct {
+	id    int
+	op    *operation
+	call  bool
+	time  int64
+	match *entry
+	prev  *entry
+	next  *entry
+}
+
+// lift removes a call and its matching return from the list. Lifts are always
+// undone in the reverse order, which is what lets unlift put them back
+// without searching.
+func (e *entry) lift() {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	m := e.match
+	m.prev.next = m.next
+	if m.next != nil {
+		m.next.prev = m.prev
+	}
+}
+
+func (e *entry) unlift() {
+	m := e.match
+	m.prev.next = m
+	if m.next != nil {
+		m.next.prev = m
+	}
+	e.prev.next = e
+	e.next.prev = e
+}
+
+func buildList(ops []operation) *entry {
+	var events []*entry
+	for i := range ops {
+		call := &entry{id: i, op: &ops[i], call: true, time: ops[i].Invoke}
+		ret := &entry{id: i, op: &ops[i], time: ops[i].Return, match: call}
+		call.match = ret
+		events = append(events, call, ret)
+	}
+	// When a return and a call have the same timestamp, we can't tell which
+	// came first, so put the call first and treat the ops as concurrent.
+	slices.SortStableFunc(events, func(a, b *entry) int {
+		if c := cmp.Compare(a.time, b.time); c != 0 {
+			return c
+		}
+		if a.call != b.call {
+			if a.call {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	})
+	head := new(entry)
+	prev := head
+	for _, e := range events {
+		prev.next = e
+		e.prev = prev
+		prev = e
+	}
+	return head
+}
+
+type bitset []uint64
+
+func (b bitset) set(i int)   { b[i/64] |= 1 << (i % 64) }
+func (b bitset) clear(i int) { b[i/64] &^= 1 << (i % 64) }
+
+// The cache remembers every (set of linearized ops, register state) pair
+// that we've already explored. Reaching the same pair again by linearizing
+// the same ops in a different order can't lead anywhere new.
+type cacheEntry struct {
+	linearized bitset
+	state      Foo
+}
+
+type cache struct {
+	seed    maphash.Seed
+	entries map[uint64][]cacheEntry
+}
+
+// insert adds the pair to the cache and returns true if it wasn't already
+// there.
+func (c *cache) insert(linearized bitset, state Foo) bool {
+	var h maphash.Hash
+	h.SetSeed(c.seed)
+	for _, w := range linearized {
+		maphash.WriteComparable(&h, w)
+	}
+	maphash.WriteComparable(&h, state)
+	key := h.Sum64()
+	for _, e := range c.entries[key] {
+		if e.state == state && slices.Equal(e.linearized, linearized) {
+			return false
+		}
+	}
+	c.entries[key] = append(c.entries[key], cacheEntry{slices.Clone(linearized), state})
+	return true
+}
+
+type verdict struct {
+	ok bool
+	// If the history isn't linearizable, stuck is the op we couldn't place
+	// at the deepest point the search reached, and order is the longest
+	// linearization it found, as indexes into the history. state is the
+	// register value at the end of that linearization.
+	stuck int
+	order []int
+	state Foo
+}
+
+func check(ops []operation) verdict {
+	head := buildList(ops)
+	linearized := make(bitset, (len(ops)+63)/64)
+	seen := &cache{seed: maphash.MakeSeed(), entries: make(map[uint64][]cacheEntry)}
+	type frame struct {
+		e     *entry
+		state Foo
+	}
+	var stack []frame
+	var state Foo
+	v := verdict{stuck: -1}
+	e := head.next
+	for head.next != nil {
+		if e.call {
+			if next, ok := step(state, e.op); ok {
+				linearized.set(e.id)
+				if seen.insert(linearized, next) {
+					stack = append(stack, frame{e, state})
+					state = next
+					e.lift()
+					e = head.next
+					continue
+				}
+				linearized.clear(e.id)
+			}
+			e = e.next
+			continue
+		}
+		// We've reached the return of an op that we couldn't linearize.
+		if v.stuck < 0 || len(stack) > len(v.order) {
+			v.stuck = e.id
+			v.state = state
+			v.order = v.order[:0]
+			for _, f := range stack {
+				v.order = append(v.order, f.e.id)
+			}
+		}
+		if len(stack) == 0 {
+			return v
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		state = top.state
+		linearized.clear(top.e.id)
+		top.e.unlift()
+		e = top.e.next
+	}
+	return verdict{ok: true}
+}
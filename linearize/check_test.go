@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func w(client string, a, b int, invoke, ret int64) operation {
+	return operation{Client: client, Kind: "write", Value: Foo{a, b}, Invoke: invoke, Return: ret}
+}
+
+func r(client string, a, b int, invoke, ret int64) operation {
+	return operation{Client: client, Kind: "read", Value: Foo{a, b}, Invoke: invoke, Return: ret}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []operation
+		// For histories that aren't linearizable, stuck is the op the
+		// checker should blame, and explain is part of what it should say
+		// about it.
+		ok      bool
+		stuck   int
+		explain string
+	}{
+		{
+			name: "sequential",
+			ops: []operation{
+				r("a", 0, 0, 0, 10),
+				w("a", 1, 1, 20, 30),
+				r("b", 1, 1, 40, 50),
+				w("b", 2, 2, 60, 70),
+				r("a", 2, 2, 80, 90),
+			},
+			ok: true,
+		},
+		{
+			name: "read during a write sees the old value",
+			ops: []operation{
+				w("a", 1, 1, 0, 100),
+				r("b", 0, 0, 10, 20),
+				r("b", 1, 1, 30, 40),
+			},
+			ok: true,
+		},
+		{
+			name: "overlapping writes in either order",
+			ops: []operation{
+				w("a", 1, 1, 0, 50),
+				w("b", 2, 2, 10, 60),
+				r("c", 2, 2, 20, 30),
+				r("c", 1, 1, 40, 70),
+			},
+			ok: true,
+		},
+		{
+			name: "same timestamp counts as concurrent",
+			ops: []operation{
+				w("a", 1, 1, 0, 10),
+				r("b", 0, 0, 10, 20),
+			},
+			ok: true,
+		},
+		{
+			name: "stale read after a completed write",
+			ops: []operation{
+				w("a", 1, 1, 0, 10),
+				w("a", 2, 2, 20, 30),
+				r("b", 1, 1, 40, 50),
+			},
+			stuck:   2,
+			explain: "can't be placed after the first 2 ops, which leave the register holding {2 2}",
+		},
+		{
+			name: "stale read of the initial value",
+			ops: []operation{
+				w("a", 1, 1, 0, 10),
+				r("b", 0, 0, 20, 30),
+			},
+			stuck:   1,
+			explain: "can't be placed after the first 1 ops",
+		},
+		{
+			name: "torn read",
+			ops: []operation{
+				w("a", 1, 1, 0, 10),
+				w("a", 2, 2, 20, 40),
+				r("b", 1, 2, 30, 50),
+			},
+			stuck:   2,
+			explain: "is torn",
+		},
+		{
+			name: "read of a value nobody wrote",
+			ops: []operation{
+				w("a", 1, 1, 0, 10),
+				r("b", 3, 3, 20, 30),
+			},
+			stuck:   1,
+			explain: "no recorded write stored",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := check(test.ops)
+			if v.ok != test.ok {
+				t.Fatalf("got ok=%v, want %v", v.ok, test.ok)
+			}
+			if test.ok {
+				return
+			}
+			if v.stuck != test.stuck {
+				t.Errorf("stuck on op %d, want %d", v.stuck, test.stuck)
+			}
+			if got := explain(test.ops, v); !strings.Contains(got, test.explain) {
+				t.Errorf("explain says %q, want it to contain %q", got, test.explain)
+			}
+			if svg := timeline(test.name, test.ops, v); !bytes.HasPrefix(svg, []byte("<svg")) {
+				t.Errorf("timeline doesn't start with <svg: %.40q", svg)
+			}
+		})
+	}
+}
+
+func TestReadLessHistoriesAreRejected(t *testing.T) {
+	input := strings.Join([]string{
+		`{"mode":"atomic","client":"a","kind":"write","value":{"A":1,"B":1},"invoke_ns":0,"return_ns":10}`,
+		`{"mode":"mutex","client":"a","kind":"write","value":{"A":1,"B":1},"invoke_ns":0,"return_ns":10}`,
+		`{"mode":"atomic","client":"b","kind":"write","value":{"A":2,"B":2},"invoke_ns":5,"return_ns":15}`,
+		`{"mode":"mutex","client":"b","kind":"read","value":{"A":1,"B":1},"invoke_ns":20,"return_ns":30}`,
+	}, "\n")
+	modes, byMode, err := readHistory(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modes) != 2 || modes[0] != "atomic" || modes[1] != "mutex" {
+		t.Fatalf("got modes %q, want [atomic mutex]", modes)
+	}
+	// The writes alone linearize, but that's not worth reporting.
+	if !check(byMode["atomic"]).ok {
+		t.Error("two writes don't linearize")
+	}
+	if hasReads(byMode["atomic"]) {
+		t.Error("atomic has no reads, but hasReads says it does")
+	}
+	if !hasReads(byMode["mutex"]) {
+		t.Error("mutex has a read, but hasReads says it doesn't")
+	}
+}
+
+func TestReadHistoryReportsTheBadLine(t *testing.T) {
+	input := `{"mode":"atomic","kind":"write","value":{"A":1,"B":1}}` + "\n" + `{"mode":`
+	_, _, err := readHistory(strings.NewReader(input))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("got %v, want an error about line 2", err)
+	}
+}
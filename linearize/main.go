@@ -0,0 +1,134 @@
+package main
+
+// linearize checks the histories recorded by `harness -history` against a
+// register model. The harness only notices a read where A != B, but a read
+// can also be wrong by returning a value that was already overwritten before
+// the read started. A history is linearizable if there's some order of all
+// its ops, consistent with when each one was called and returned, in which
+// every read returns the latest write.
+//
+//     go run ./harness/*.go -history /tmp/history.jsonl
+//     go run ./linearize -svg /tmp/timelines /tmp/history.jsonl
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type record struct {
+	Mode string `json:"mode"`
+	operation
+}
+
+// readHistory groups the ops by mode, keeping the modes in the order they
+// first appear.
+func readHistory(r io.Reader) ([]string, map[string][]operation, error) {
+	var modes []string
+	byMode := make(map[string][]operation)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, ok := byMode[rec.Mode]; !ok {
+			modes = append(modes, rec.Mode)
+		}
+		byMode[rec.Mode] = append(byMode[rec.Mode], rec.operation)
+	}
+	return modes, byMode, scanner.Err()
+}
+
+// With no reads, every history is trivially linearizable, which says more
+// about the recording than about the mode.
+func hasReads(ops []operation) bool {
+	return slices.ContainsFunc(ops, func(o operation) bool { return o.Kind == "read" })
+}
+
+func explain(ops []operation, v verdict) string {
+	o := ops[v.stuck]
+	// The register starts out zeroed, so a read of the zero Foo doesn't need
+	// a write.
+	written := o.Value == Foo{}
+	for _, w := range ops {
+		if w.Kind == "write" && w.Value == o.Value {
+			written = true
+			break
+		}
+	}
+	desc := fmt.Sprintf("%s of %v at [%d, %d]ns", o.Kind, o.Value, o.Invoke, o.Return)
+	switch {
+	case o.Kind == "read" && o.Value.A != o.Value.B:
+		return fmt.Sprintf("%s is torn: no write ever stored it", desc)
+	case o.Kind == "read" && !written:
+		return fmt.Sprintf("%s returned a value that no recorded write stored", desc)
+	default:
+		return fmt.Sprintf("%s can't be placed after the first %d ops, which leave the register holding %v", desc, len(v.order), v.state)
+	}
+}
+
+func main() {
+	svgDir := flag.String("svg", "", "write a timeline of each history to DIR/<mode>.svg")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: linearize [-svg DIR] [HISTORY_FILE]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	input := os.Stdin
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	} else if flag.NArg() == 1 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		input = f
+	}
+	modes, byMode, err := readHistory(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *svgDir != "" {
+		if err := os.MkdirAll(*svgDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	empty := false
+	for _, mode := range modes {
+		ops := byMode[mode]
+		if !hasReads(ops) {
+			fmt.Printf("%s: no reads recorded (%d ops), nothing to check\n", mode, len(ops))
+			empty = true
+			continue
+		}
+		v := check(ops)
+		if v.ok {
+			fmt.Printf("%s: linearizable (%d ops)\n", mode, len(ops))
+		} else {
+			fmt.Printf("%s: NOT linearizable (%d ops)\n    %s\n", mode, len(ops), explain(ops, v))
+		}
+		if *svgDir != "" {
+			path := filepath.Join(*svgDir, mode+".svg")
+			if err := os.WriteFile(path, timeline(mode, ops, v), 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	}
+	if empty {
+		os.Exit(1)
+	}
+}
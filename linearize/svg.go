@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"slices"
+)
+
+const (
+	svgWidth   = 1200
+	laneHeight = 40
+	margin     = 80
+	// How many ops to show on either side of the one we got stuck on. The
+	// full history is thousands of ops, which would be unreadable.
+	windowOps = 20
+)
+
+// timeline draws the ops around the point where the checker got stuck, or
+// the start of the history if it didn't, with one lane per client. Ops in
+// the longest linearization the checker found are green, the op it couldn't
+// place is red, and everything else is gray.
+func timeline(mode string, ops []operation, v verdict) []byte {
+	center := 0
+	if !v.ok {
+		center = v.stuck
+	}
+	lo := max(0, center-windowOps)
+	hi := min(len(ops), center+windowOps+1)
+	window := ops[lo:hi]
+
+	var clients []string
+	t0, t1 := window[0].Invoke, window[0].Return
+	for _, o := range window {
+		if !slices.Contains(clients, o.Client) {
+			clients = append(clients, o.Client)
+		}
+		t0 = min(t0, o.Invoke)
+		t1 = max(t1, o.Return)
+	}
+	x := func(t int64) float64 {
+		if t1 == t0 {
+			return margin
+		}
+		return margin + float64(t-t0)/float64(t1-t0)*(svgWidth-2*margin)
+	}
+	inOrder := make(map[int]bool)
+	for _, i := range v.order {
+		inOrder[i] = true
+	}
+
+	var b bytes.Buffer
+	height := (len(clients)+1)*laneHeight + 20
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", svgWidth, height)
+	fmt.Fprintf(&b, `<text x="10" y="20" font-size="14">%s: ops %d-%d, %dns</text>`+"\n", html.EscapeString(mode), lo, hi-1, t1-t0)
+	for lane, client := range clients {
+		y := (lane+1)*laneHeight + 10
+		fmt.Fprintf(&b, `<text x="10" y="%d">%s</text>`+"\n", y+15, html.EscapeString(client))
+		for i, o := range window {
+			if o.Client != client {
+				continue
+			}
+			id := lo + i
+			fill := "#ccc"
+			switch {
+			case !v.ok && id == v.stuck:
+				fill = "#f66"
+			case inOrder[id]:
+				fill = "#9d9"
+			}
+			label := fmt.Sprint(o.Value.A)
+			if o.Value.A != o.Value.B {
+				label = fmt.Sprintf("%d/%d", o.Value.A, o.Value.B)
+			}
+			left, right := x(o.Invoke), x(o.Return)
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="%.1f" height="20" fill="%s" stroke="#555"><title>%s %v [%d, %d]ns</title></rect>`+"\n",
+				left, y, max(right-left, 1), fill, o.Kind, o.Value, o.Invoke, o.Return)
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d">%s %s</text>`+"\n", left+2, y+14, o.Kind[:1], label)
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
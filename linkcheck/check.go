@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const maxRedirects = 10
+
+// A result is what we learned about one URL. Final is only set if the URL
+// redirects, and Permanent says whether every hop on the way was a 301 or a
+// 308, which is when the link itself should change.
+type result struct {
+	Status    int       `json:"status,omitempty"`
+	Final     string    `json:"final,omitempty"`
+	Permanent bool      `json:"permanent,omitempty"`
+	Err       string    `json:"error,omitempty"`
+	Checked   time.Time `json:"checked"`
+}
+
+func (r result) dead() bool {
+	return r.Err != "" || (r.Status >= 400 && !r.blocked())
+}
+
+// blocked is for sites that turn away robots, or us in particular, without
+// saying anything about the page. Twitter and LinkedIn are the usual
+// suspects. There's no telling whether those links are alive.
+func (r result) blocked() bool {
+	switch r.Status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, 999:
+		return true
+	}
+	return false
+}
+
+// cacheable leaves out the results that say more about the moment than
+// about the link: network errors and being turned away.
+func (r result) cacheable() bool {
+	return r.Err == "" && !r.blocked() && r.Status < 500
+}
+
+// A limiter spaces out requests to each host. Redirects can lead anywhere,
+// so every request goes through it, not just the first one for each link.
+type limiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[string]time.Time
+}
+
+func (l *limiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	at := time.Now()
+	if next := l.next[host]; next.After(at) {
+		at = next
+	}
+	l.next[host] = at.Add(l.interval)
+	l.mu.Unlock()
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type checker struct {
+	client  *http.Client
+	limiter *limiter
+	// sem bounds the number of requests in flight across all hosts.
+	sem chan struct{}
+}
+
+func newChecker(transport http.RoundTripper, interval, timeout time.Duration, jobs int) *checker {
+	return &checker{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			// We follow redirects ourselves, to see where they go.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		limiter: &limiter{interval: interval, next: make(map[string]time.Time)},
+		sem:     make(chan struct{}, max(jobs, 1)),
+	}
+}
+
+func (c *checker) request(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	if err := c.limiter.wait(ctx, u.Host); err != nil {
+		return nil, err
+	}
+	c.sem <- struct{}{}
+	defer func() { <-c.sem }()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "linkcheck (+https://jacko.io)")
+	req.Header.Set("Accept", "text/html,*/*")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// We only want the status, but reading a little lets the connection
+	// be reused for small pages.
+	io.CopyN(io.Discard, resp.Body, 64<<10)
+	resp.Body.Close()
+	return resp, nil
+}
+
+// fetch asks for u with HEAD, and falls back to GET if that fails, since
+// plenty of servers get HEAD wrong.
+func (c *checker) fetch(ctx context.Context, u *url.URL) (*http.Response, error) {
+	resp, err := c.request(ctx, "HEAD", u)
+	if err == nil && resp.StatusCode < 400 {
+		return resp, nil
+	}
+	return c.request(ctx, "GET", u)
+}
+
+func (c *checker) check(ctx context.Context, link string) result {
+	res := result{Checked: time.Now().UTC(), Permanent: true}
+	u, err := url.Parse(link)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	for range maxRedirects + 1 {
+		resp, err := c.fetch(ctx, u)
+		if err != nil {
+			res.Err = err.Error()
+			return res
+		}
+		loc := resp.Header.Get("Location")
+		switch resp.StatusCode {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			if loc == "" {
+				break
+			}
+			next, err := u.Parse(loc)
+			if err != nil {
+				res.Err = fmt.Sprintf("bad redirect to %q", loc)
+				return res
+			}
+			res.Permanent = res.Permanent &&
+				(resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusPermanentRedirect)
+			next.Fragment = ""
+			u = next
+			res.Final = u.String()
+			continue
+		}
+		res.Status = resp.StatusCode
+		if res.Final == "" {
+			res.Permanent = false
+		}
+		return res
+	}
+	res.Err = fmt.Sprintf("more than %d redirects", maxRedirects)
+	res.Permanent = false
+	return res
+}
+
+// checkAll checks every link it isn't handed a fresh result for. Each host
+// gets its own goroutine working through that host's links in order, so one
+// slow host doesn't hold up the rest, and the limiter keeps any one host from
+// seeing more than one request per interval.
+func (c *checker) checkAll(ctx context.Context, links []string, cached map[string]result) map[string]result {
+	results := maps.Clone(cached)
+	if results == nil {
+		results = make(map[string]result)
+	}
+	byHost := make(map[string][]string)
+	for _, link := range links {
+		if _, ok := results[link]; ok {
+			continue
+		}
+		u, err := url.Parse(link)
+		if err != nil {
+			results[link] = result{Err: err.Error(), Checked: time.Now().UTC()}
+			continue
+		}
+		byHost[u.Host] = append(byHost[u.Host], link)
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, hostLinks := range byHost {
+		wg.Go(func() {
+			for _, link := range hostLinks {
+				res := c.check(ctx, link)
+				mu.Lock()
+				results[link] = res
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// The cache is a JSON object from URL to result. Anything older than the
+// TTL gets checked again.
+func loadCache(path string, ttl time.Duration) (map[string]result, error) {
+	cache := make(map[string]result)
+	if path == "" {
+		return cache, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	maps.DeleteFunc(cache, func(_ string, r result) bool { return time.Since(r.Checked) > ttl })
+	return cache, nil
+}
+
+// saveCache writes the cacheable results for the links we still have. Links
+// that are gone from the site drop out of the cache with them.
+func saveCache(path string, results map[string]result, links []string) error {
+	if path == "" {
+		return nil
+	}
+	keep := make(map[string]result)
+	for _, link := range links {
+		if r, ok := results[link]; ok && r.cacheable() {
+			keep[link] = r
+		}
+	}
+	data, err := json.MarshalIndent(keep, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// sortedKeys is for printing maps in a stable order.
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// links maps each external URL to the files that link to it.
+type links map[string][]string
+
+func (l links) add(raw, file string, internal []string) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return
+	}
+	if slices.Contains(internal, u.Hostname()) {
+		return
+	}
+	// The fragment never goes to the server.
+	u.Fragment = ""
+	key := u.String()
+	if !slices.Contains(l[key], file) {
+		l[key] = append(l[key], file)
+	}
+}
+
+// Attributes that hold URLs the browser will fetch or follow. srcset and
+// the like are rare enough here to leave out.
+var urlAttrs = map[string]bool{"href": true, "src": true, "poster": true, "data": true, "action": true}
+
+func extractHTML(l links, path string, internal []string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	z := html.NewTokenizer(f)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			return nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for {
+				key, val, more := z.TagAttr()
+				if urlAttrs[string(key)] {
+					l.add(string(val), path, internal)
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Markdown posts get a rougher treatment: inline links, autolinks, and bare
+// URLs. Trailing punctuation usually belongs to the sentence, not the URL.
+var markdownURL = regexp.MustCompile(`https?://[^\s<>()\[\]"'` + "`" + `]+`)
+
+func extractMarkdown(l links, path string, internal []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, m := range markdownURL.FindAllString(string(data), -1) {
+		l.add(strings.TrimRight(m, ".,;:!?*_"), path, internal)
+	}
+	return nil
+}
+
+// extract finds the external links in every HTML and Markdown file under
+// the given paths.
+func extract(paths, internal []string) (links, error) {
+	l := make(links)
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".html", ".htm":
+				return extractHTML(l, path, internal)
+			case ".md":
+				return extractMarkdown(l, path, internal)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
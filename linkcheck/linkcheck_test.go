@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A standIn plays every host on the internet. The transport below sends
+// every connection to it, whatever the URL says, and it decides what to do
+// from the Host header. It also keeps a log of requests by host, to check
+// the rate limit and the cache.
+type standIn struct {
+	mu  sync.Mutex
+	log map[string][]time.Time
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	s.mu.Lock()
+	s.log[host] = append(s.log[host], time.Now())
+	s.mu.Unlock()
+	switch host {
+	case "ok.test", "slow.test":
+	case "nohead.test":
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+	case "gone.test":
+		http.NotFound(w, r)
+		return
+	case "moved.test":
+		http.Redirect(w, r, "https://ok.test/new", http.StatusMovedPermanently)
+		return
+	case "temp.test":
+		http.Redirect(w, r, "http://ok.test/", http.StatusFound)
+		return
+	case "chain.test":
+		if r.URL.Path == "/a" {
+			http.Redirect(w, r, "/b", http.StatusPermanentRedirect)
+		} else {
+			http.Redirect(w, r, "http://ok.test/c", http.StatusTemporaryRedirect)
+		}
+		return
+	case "movedgone.test":
+		http.Redirect(w, r, "http://gone.test/x", http.StatusMovedPermanently)
+		return
+	case "loop.test":
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		return
+	case "busy.test":
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	case "broken.test":
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	default:
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	w.Write([]byte("<p>hello</p>"))
+}
+
+func (s *standIn) requests() map[string][]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := s.log
+	s.log = make(map[string][]time.Time)
+	return log
+}
+
+// TestLinkcheck runs the checker against the stand-in. The subtests share
+// one checker and its results, and each builds on the ones before it.
+func TestLinkcheck(t *testing.T) {
+	dir := t.TempDir()
+	page := `<!DOCTYPE html>
+<a href="https://ok.test/">fine</a>
+<a href="https://ok.test/#top">the same page</a>
+<a href="http://nohead.test/">no HEAD</a>
+<a href="https://gone.test/page">gone</a>
+<a href="https://moved.test/old">moved</a>
+<a href="https://temp.test/">moved for now</a>
+<a href="http://chain.test/a">a 308 and then a 307</a>
+<a href="http://movedgone.test/">moved and gone</a>
+<img src="https://loop.test/img.png">
+<a href="https://busy.test/">busy</a>
+<a href="https://broken.test/">broken</a>
+<a href="https://jacko.io/duct.html">ourselves</a>
+<a href="mailto:someone@example.com">mail</a>
+<a href="/relative.html">relative</a>
+`
+	for i := range 4 {
+		page += fmt.Sprintf("<a href=\"https://slow.test/%d\">slow</a>\n", i)
+	}
+	post := "See [the same page](https://ok.test/), <https://gone.test/page>, and https://ok.test/post.\n"
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "post.md"), []byte(post), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &standIn{log: make(map[string][]time.Time)}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	var dialer net.Dialer
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+	}
+	// The stand-in only speaks plain HTTP, so https URLs go to it as http.
+	transport.RegisterProtocol("https", httpsAsHTTP{transport})
+
+	l, err := extract([]string{dir}, []string{"jacko.io"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sortedKeys(l)
+	t.Run("extracting external links, without fragments or duplicates", func(t *testing.T) {
+		want := []string{
+			"http://chain.test/a",
+			"http://movedgone.test/",
+			"http://nohead.test/",
+			"https://broken.test/",
+			"https://busy.test/",
+			"https://gone.test/page",
+			"https://loop.test/img.png",
+			"https://moved.test/old",
+			"https://ok.test/",
+			"https://ok.test/post",
+			"https://slow.test/0",
+			"https://slow.test/1",
+			"https://slow.test/2",
+			"https://slow.test/3",
+			"https://temp.test/",
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("got\n  %s", strings.Join(got, "\n  "))
+		}
+		if n := len(l["https://gone.test/page"]); n != 2 {
+			t.Errorf("gone.test is linked from %d files, not 2", n)
+		}
+	})
+
+	const rate = 50 * time.Millisecond
+	c := newChecker(transport, rate, 5*time.Second, 4)
+	results := c.checkAll(context.Background(), got, nil)
+	for _, x := range []struct {
+		name      string
+		link      string
+		status    int
+		final     string
+		permanent bool
+		errText   string
+	}{
+		{"a live link", "https://ok.test/", 200, "", false, ""},
+		{"falling back to GET when HEAD fails", "http://nohead.test/", 200, "", false, ""},
+		{"a dead link", "https://gone.test/page", 404, "", false, ""},
+		{"a permanent redirect", "https://moved.test/old", 200, "https://ok.test/new", true, ""},
+		{"a temporary redirect", "https://temp.test/", 200, "http://ok.test/", false, ""},
+		{"a permanent redirect followed by a temporary one", "http://chain.test/a", 200, "http://ok.test/c", false, ""},
+		{"a redirect to a dead link", "http://movedgone.test/", 404, "http://gone.test/x", true, ""},
+		{"a redirect loop", "https://loop.test/img.png", 0, "https://loop.test/img.png", false, "redirects"},
+		{"a site that's too busy", "https://busy.test/", 429, "", false, ""},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			r := results[x.link]
+			if r.Status != x.status || r.Final != x.final || r.Permanent != x.permanent || !strings.Contains(r.Err, x.errText) ||
+				(x.errText == "" && r.Err != "") {
+				t.Errorf("%s: got %+v", x.link, r)
+			}
+		})
+	}
+
+	t.Run("one request per host per interval", func(t *testing.T) {
+		log := s.requests()
+		for host, times := range log {
+			for i := 1; i < len(times); i++ {
+				// A little slack for the trip through the network stack.
+				if gap := times[i].Sub(times[i-1]); gap < rate*8/10 {
+					t.Errorf("%s got two requests %v apart", host, gap)
+				}
+			}
+		}
+		if n := len(log["slow.test"]); n != 4 {
+			t.Errorf("slow.test got %d requests, not 4", n)
+		}
+	})
+
+	t.Run("the report", func(t *testing.T) {
+		var out strings.Builder
+		dead := report(&out, l, results)
+		if dead != 4 {
+			t.Errorf("%d dead links, not 4", dead)
+		}
+		for _, line := range []string{
+			"dead (4):",
+			"      404 Not Found\n      in " + filepath.Join(dir, "index.html") + "\n      in " + filepath.Join(dir, "post.md"),
+			"      404 Not Found at http://gone.test/x",
+			"      500 Internal Server Error",
+			"moved permanently (1):\n  https://moved.test/old\n      -> https://ok.test/new",
+			"couldn't tell (1):\n  https://busy.test/",
+			"15 links: 4 dead, 1 moved, 1 couldn't tell",
+		} {
+			if !strings.Contains(out.String(), line) {
+				t.Errorf("the report is missing %q", line)
+			}
+		}
+		if t.Failed() {
+			t.Log(out.String())
+		}
+	})
+
+	cachePath := filepath.Join(dir, "cache.json")
+	t.Run("a second run only rechecks what isn't cached", func(t *testing.T) {
+		if _, err := loadCache(cachePath, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveCache(cachePath, results, got); err != nil {
+			t.Fatal(err)
+		}
+		cached, err := loadCache(cachePath, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.requests()
+		c.checkAll(context.Background(), got, cached)
+		var hosts []string
+		for host := range s.requests() {
+			hosts = append(hosts, host)
+		}
+		slices.Sort(hosts)
+		// Errors, 5xx, and being turned away say nothing lasting about the
+		// link, so those get checked again.
+		if want := []string{"broken.test", "busy.test", "loop.test"}; !slices.Equal(hosts, want) {
+			t.Errorf("the second run asked %v, not %v", hosts, want)
+		}
+	})
+
+	t.Run("cached results expire", func(t *testing.T) {
+		cached, err := loadCache(cachePath, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cached) != 0 {
+			t.Errorf("%d results outlived the TTL", len(cached))
+		}
+	})
+}
+
+// httpsAsHTTP sends https requests over plain http, for the stand-in.
+type httpsAsHTTP struct{ t *http.Transport }
+
+func (h httpsAsHTTP) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = "http"
+	return h.t.RoundTrip(r)
+}
@@ -0,0 +1,128 @@
+package main
+
+// linkcheck finds the external links in the site and checks that they still
+// go somewhere. It pulls every http and https URL out of the HTML under www/
+// and the Markdown posts, checks them a few at a time with no more than one
+// request per host per -rate, and follows redirects itself so it can say
+// where they lead. Results are cached in -cache for -ttl, so running it
+// twice in a row doesn't knock on everyone's door twice.
+//
+//     go run ./linkcheck
+//     go run ./linkcheck -ttl 0 www/index.html
+//
+// It prints the dead links, the permanent redirects worth updating, and the
+// links from sites that wouldn't say, and it exits 1 if anything is dead.
+// go test ./linkcheck runs the checker against an httptest server that
+// stands in for every host, so it needs no network.
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// report prints what's wrong, grouped by kind, and returns how many links
+// are dead.
+func report(w io.Writer, l links, results map[string]result) int {
+	var dead, moved, blocked []string
+	for _, link := range sortedKeys(l) {
+		r := results[link]
+		switch {
+		case r.blocked():
+			blocked = append(blocked, link)
+		case r.dead():
+			dead = append(dead, link)
+		case r.Final != "" && r.Permanent:
+			moved = append(moved, link)
+		}
+	}
+	section := func(title string, group []string, describe func(result) string) {
+		if len(group) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s (%d):\n", title, len(group))
+		for _, link := range group {
+			fmt.Fprintf(w, "  %s\n      %s\n", link, describe(results[link]))
+			for _, file := range l[link] {
+				fmt.Fprintf(w, "      in %s\n", file)
+			}
+		}
+	}
+	section("dead", dead, func(r result) string {
+		what := r.Err
+		if what == "" {
+			what = fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status))
+		}
+		if r.Final != "" {
+			what += " at " + r.Final
+		}
+		return what
+	})
+	section("moved permanently", moved, func(r result) string { return "-> " + r.Final })
+	section("couldn't tell", blocked, func(r result) string {
+		return fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status))
+	})
+	fmt.Fprintf(w, "%d links: %d dead, %d moved, %d couldn't tell\n", len(l), len(dead), len(moved), len(blocked))
+	return len(dead)
+}
+
+func run(paths, internal []string, cachePath string, ttl, rate, timeout time.Duration, jobs int) (int, error) {
+	l, err := extract(paths, internal)
+	if err != nil {
+		return 0, err
+	}
+	cached, err := loadCache(cachePath, ttl)
+	if err != nil {
+		return 0, err
+	}
+	linkList := sortedKeys(l)
+	fresh := 0
+	for _, link := range linkList {
+		if _, ok := cached[link]; ok {
+			fresh++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "checking %d links (%d cached)\n", len(linkList)-fresh, fresh)
+	c := newChecker(http.DefaultTransport, rate, timeout, jobs)
+	results := c.checkAll(context.Background(), linkList, cached)
+	if err := saveCache(cachePath, results, linkList); err != nil {
+		return 0, err
+	}
+	return report(os.Stdout, l, results), nil
+}
+
+func main() {
+	cachePath := flag.String("cache", ".linkcheck-cache.json", "where to keep results between runs, or empty for nowhere")
+	ttl := flag.Duration("ttl", 7*24*time.Hour, "how long a cached result stays good")
+	rate := flag.Duration("rate", time.Second, "the least time between two requests to the same host")
+	timeout := flag.Duration("timeout", 20*time.Second, "how long to wait for each request")
+	jobs := flag.Int("j", 8, "how many requests to have in flight at once")
+	internal := flag.String("internal", "jacko.io,www.jacko.io", "comma-separated hosts that count as the site itself")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: linkcheck [flags] [PATH...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"www", "duct.md", "iterator_invalidation.md"}
+		paths = slices.DeleteFunc(paths, func(p string) bool {
+			_, err := os.Stat(p)
+			return err != nil
+		})
+	}
+	dead, err := run(paths, strings.Split(*internal, ","), *cachePath, *ttl, *rate, *timeout, *jobs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if dead > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// These are classic litmus tests, run in-process. Each round, two goroutines
+// each do two memory operations, and we count the rounds that end in the
+// "weird" outcome. Rounds are lined up with a spinning barrier, so that the
+// two goroutines are as close as possible to running their operations at
+// the same time. (Starting a goroutine per round would take so long that
+// they'd never overlap.)
+//
+// The plain-variable versions are data races on purpose.
+
+type litmus func(rounds int) (weird int)
+
+// barrier lines up two goroutines at the start of each round.
+type barrier struct {
+	arrived atomic.Int64
+}
+
+func (b *barrier) wait(round int64) {
+	b.arrived.Add(1)
+	for b.arrived.Load() < 2*round {
+		runtime.Gosched()
+	}
+}
+
+// Message passing: the writer stores data and then sets a flag. Can the
+// reader see the flag set but the data missing?
+func messagePassingPlain(rounds int) int {
+	var data, flag int
+	var b barrier
+	results := make(chan int)
+	go func() {
+		for r := 1; r <= rounds; r++ {
+			b.wait(int64(2*r - 1))
+			data = 1
+			flag = 1
+			b.wait(int64(2 * r))
+		}
+	}()
+	go func() {
+		weird := 0
+		for r := 1; r <= rounds; r++ {
+			b.wait(int64(2*r - 1))
+			f := flag
+			d := data
+			if f == 1 && d == 0 {
+				weird++
+			}
+			b.wait(int64(2 * r))
+			// The other goroutine is waiting at the next barrier, so it's
+			// safe to reset.
+			data, flag = 0, 0
+		}
+		results <- weird
+	}()
+	return <-results
+}
+
+func messagePassingAtomic(rounds int) int {
+	var data int
+	var flag atomic.Int64
+	var b barrier
+	results := make(chan int)
+	go func() {
+		for r := 1; r <= rounds; r++ {
+			b.wait(int64(2*r - 1))
+			data = 1
+			flag.Store(1)
+			b.wait(int64(2 * r))
+		}
+	}()
+	go func() {
+		weird := 0
+		for r := 1; r <= rounds; r++ {
+			b.wait(int64(2*r - 1))
+			if flag.Load() == 1 && data == 0 {
+				weird++
+			}
+			b.wait(int64(2 * r))
+			data = 0
+			flag.Store(0)
+		}
+		results <- weird
+	}()
+	return <-results
+}
+
+// Store buffering: each goroutine stores to one variable and then loads the
+// other. Can both loads miss both stores? On x86, plain stores sit in a
+// store buffer for a while before other cores can see them, so yes.
+func storeBufferingPlain(rounds int) int {
+	var x, y int
+	var b barrier
+	r1s := make(chan int, 1)
+	weirdCh := make(chan int)
+	go func() {
+		for r := 1; r <= rounds; r++ {
+			b.wait(int64(2*r - 1))
+			x = 1
+			r1s <- y
+			b.wait(int64(2 * r))
+		}
+	}()
+	go func() {
+		weird := 0
+		for r := 1; r <= rounds; r++ {
+			b.wait(int64(2*r - 1))
+			y = 1
+			r2 := x
+			r1 := <-r1s
+			if r1 == 0 && r2 == 0 {
+				weird++
+			}
+			b.wait(int64(2 * r))
+			x, y = 0, 0
+		}
+		weirdCh <- weird
+	}()
+	return <-weirdCh
+}
+
+func storeBufferingAtomic(rounds int) int {
+	var x, y atomic.Int64
+	var b barrier
+	r1s := make(chan int64, 1)
+	weirdCh := make(chan int)
+	go func() {
+		for r := 1; r <= rounds; r++ {
+			b.wait(int64(2*r - 1))
+			x.Store(1)
+			r1s <- y.Load()
+			b.wait(int64(2 * r))
+		}
+	}()
+	go func() {
+		weird := 0
+		for r := 1; r <= rounds; r++ {
+			b.wait(int64(2*r - 1))
+			y.Store(1)
+			r2 := x.Load()
+			r1 := <-r1s
+			if r1 == 0 && r2 == 0 {
+				weird++
+			}
+			b.wait(int64(2 * r))
+			x.Store(0)
+			y.Store(0)
+		}
+		weirdCh <- weird
+	}()
+	return <-weirdCh
+}
@@ -0,0 +1,233 @@
+package main
+
+// quiz is for teaching with not_atomic.go. It shows an experiment, asks
+// everyone to guess what will happen, and only then runs it. Scores are kept
+// per person in -dir, so you can see how a group did over a few sessions.
+//
+//     go run ./quiz/*.go -name ada
+//     go run ./quiz/*.go -only plain,mp-plain,sb-plain
+//
+// The UI is plain lines on stdin and stdout, no cursor tricks or colors, so it
+// works the same over SSH, in tmux, or piped from a file.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oconnor663/jacko.io/internal/harnessbin"
+)
+
+type harnessResult struct {
+	Reads int64 `json:"reads"`
+	Tears int64 `json:"tears"`
+}
+
+type harness struct {
+	bin      string
+	duration time.Duration
+}
+
+func (h harness) run(mode string) (harnessResult, error) {
+	cmd := exec.Command(h.bin, "-json", "-mode", mode, "-duration", h.duration.String())
+	cmd.Stderr = os.Stderr
+	// The harness exits with an error if a correct strategy tears, but that's
+	// still a result worth showing.
+	out, err := cmd.Output()
+	var r harnessResult
+	if jsonErr := json.Unmarshal(out, &r); jsonErr != nil {
+		if err == nil {
+			err = jsonErr
+		}
+		return r, fmt.Errorf("running %s: %w", mode, err)
+	}
+	return r, nil
+}
+
+// The prompter reads one line at a time. It gives up (with io.EOF) when
+// stdin does, so that a dropped SSH connection ends the quiz instead of
+// spinning on empty answers.
+type prompter struct {
+	in *bufio.Scanner
+}
+
+func (p *prompter) line(prompt string) (string, error) {
+	fmt.Print(prompt)
+	if !p.in.Scan() {
+		fmt.Println()
+		if err := p.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return strings.TrimSpace(p.in.Text()), nil
+}
+
+func (p *prompter) yesNo(prompt string) (bool, error) {
+	for {
+		s, err := p.line(prompt + " [y/n] ")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(s) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Println("Please answer y or n.")
+	}
+}
+
+func indent(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = "    " + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func ask(p *prompter, h harness, rounds int, n, total int, q question) (answer, error) {
+	fmt.Printf("\n=== %d/%d: %s ===\n\n%s\n\n", n, total, q.title, indent(q.code))
+	guess, err := p.yesNo(q.ask)
+	if err != nil {
+		return answer{}, err
+	}
+	a := answer{Question: q.id, Guess: guess, Correct: guess == q.allowed}
+
+	if q.harnessMode != "" {
+		fmt.Printf("Running the %s harness for %s...\n", q.harnessMode, h.duration)
+		r, err := h.run(q.harnessMode)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			a.Observed, a.Tries = r.Tears, r.Reads
+			fmt.Printf("Torn reads: %d out of %d.\n", r.Tears, r.Reads)
+		}
+	} else {
+		fmt.Printf("Running %d rounds...\n", rounds)
+		a.Observed, a.Tries = int64(q.litmus(rounds)), int64(rounds)
+		fmt.Printf("Weird outcome: %d out of %d rounds.\n", a.Observed, a.Tries)
+	}
+
+	verdict := "forbidden"
+	if q.allowed {
+		verdict = "allowed"
+	}
+	if a.Correct {
+		fmt.Printf("\nRight! It's %s.\n", verdict)
+	} else {
+		fmt.Printf("\nNope, it's %s.\n", verdict)
+	}
+	if q.allowed && a.Observed == 0 {
+		fmt.Println("(It just didn't happen this time. Allowed doesn't mean likely.)")
+	}
+	if !q.allowed && a.Observed > 0 {
+		// This would be a bug in the runtime, or more likely in this quiz.
+		fmt.Println("(It happened anyway?! That's a bug somewhere. Please report it.)")
+	}
+	fmt.Printf("\n%s\n", q.explain)
+	return a, nil
+}
+
+func printHistory(r record) {
+	if len(r.Sessions) == 0 {
+		return
+	}
+	fmt.Printf("\nSessions for %s:\n", r.Name)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, s := range r.Sessions {
+		fmt.Fprintf(w, "%s\t%d/%d\t\n", s.Time.Local().Format(time.DateTime), s.score(), len(s.Answers))
+	}
+	w.Flush()
+}
+
+func main() {
+	name := flag.String("name", "", "who's answering (asked for if not set)")
+	dir := flag.String("dir", ".quiz", "where to keep everyone's answers")
+	harnessDir := flag.String("harness", "harness", "directory containing the harness source")
+	duration := flag.Duration("duration", time.Second, "how long to run each harness experiment")
+	rounds := flag.Int("rounds", 100000, "how many rounds of each litmus test to run")
+	only := flag.String("only", "", "comma-separated question IDs to ask (default: all)")
+	list := flag.Bool("list", false, "list the question IDs and exit")
+	flag.Parse()
+
+	if *list {
+		for _, q := range questions {
+			fmt.Printf("%-14s %s\n", q.id, q.title)
+		}
+		return
+	}
+
+	qs := questions
+	if *only != "" {
+		qs = nil
+		for _, id := range strings.Split(*only, ",") {
+			i := slices.IndexFunc(questions, func(q question) bool { return q.id == strings.TrimSpace(id) })
+			if i < 0 {
+				fmt.Fprintf(os.Stderr, "no question %q (try -list)\n", id)
+				os.Exit(1)
+			}
+			qs = append(qs, questions[i])
+		}
+	}
+
+	p := &prompter{bufio.NewScanner(os.Stdin)}
+	for *name == "" {
+		var err error
+		if *name, err = p.line("What's your name? "); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	rec, err := loadRecord(*dir, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var h harness
+	if slices.ContainsFunc(qs, func(q question) bool { return q.harnessMode != "" }) {
+		bin, cleanup, err := harnessbin.Build(*harnessDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer cleanup()
+		h = harness{bin, *duration}
+	}
+
+	fmt.Printf("Hi %s. For each experiment, guess whether the weird outcome is possible.\n", *name)
+	s := session{Time: time.Now().UTC().Truncate(time.Second)}
+	for i, q := range qs {
+		a, err := ask(p, h, *rounds, i+1, len(qs), q)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		s.Answers = append(s.Answers, a)
+	}
+	if len(s.Answers) == 0 {
+		return
+	}
+	fmt.Printf("\nScore: %d/%d\n", s.score(), len(s.Answers))
+	rec.Sessions = append(rec.Sessions, s)
+	if err := saveRecord(*dir, rec); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	printHistory(rec)
+}
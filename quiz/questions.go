@@ -0,0 +1,200 @@
+package main
+
+// Every question asks whether some weird outcome is allowed. The answer
+// comes from the Go memory model, not from whatever this machine happens to
+// do, because "it didn't happen when I tried it" is exactly the trap we're
+// trying to teach people out of. We still run the experiment, though, since
+// seeing it happen (or not) is what sticks.
+type question struct {
+	id      string
+	title   string
+	code    string
+	ask     string
+	allowed bool
+	explain string
+	// Either harnessMode or litmus is set.
+	harnessMode string
+	litmus      litmus
+}
+
+var questions = []question{
+	{
+		id:    "plain",
+		title: "not_atomic.go",
+		code: `type Foo struct{ A, B int }
+
+// writer goroutine:
+for i := 0; ; i++ {
+    *fooPtr = Foo{A: i, B: i}
+}
+
+// reader goroutine:
+fooCopy := myFoo
+if fooCopy.A != fooCopy.B { ... }`,
+		ask:         "Can the reader ever see A != B?",
+		allowed:     true,
+		harnessMode: "plain",
+		explain: `A struct assignment is two separate stores (and a struct copy is two
+separate loads), and nothing stops the reader from running in between. It's
+also a data race, so the memory model doesn't promise anything at all. How
+often it actually happens depends on the CPU count, on preemption and on
+whether the compiler keeps the loads together.`,
+	},
+	{
+		id:    "atomicfields",
+		title: "make each field atomic",
+		code: `type Foo struct{ A, B atomic.Int64 }
+
+// writer:
+foo.A.Store(i)
+foo.B.Store(i)
+
+// reader:
+a, b := foo.A.Load(), foo.B.Load()`,
+		ask:         "Can the reader ever see a != b?",
+		allowed:     true,
+		harnessMode: "atomicfields",
+		explain: `Each load and store is atomic, and the race detector is happy, but the
+pair isn't. The writer can store A, the reader can load both, and then the
+writer can store B. Atomic fields are not an atomic struct.`,
+	},
+	{
+		id:    "writerlock",
+		title: "lock in the writer",
+		code: `// writer:
+mu.Lock()
+myFoo = Foo{A: i, B: i}
+mu.Unlock()
+
+// reader:
+fooCopy := myFoo`,
+		ask:         "Can the reader ever see A != B?",
+		allowed:     true,
+		harnessMode: "writerlock",
+		explain: `A mutex only excludes other goroutines that also lock it. The reader never
+waits for anything, so the lock doesn't change what it can see.`,
+	},
+	{
+		id:    "rlockwriter",
+		title: "RLock in the writer",
+		code: `// writer:
+mu.RLock()
+myFoo = Foo{A: i, B: i}
+mu.RUnlock()
+
+// reader:
+mu.RLock()
+fooCopy := myFoo
+mu.RUnlock()`,
+		ask:         "Can the reader ever see A != B?",
+		allowed:     true,
+		harnessMode: "rlockwriter",
+		explain: `Any number of goroutines can hold RLock at once, so the writer and the
+reader don't exclude each other at all. (The race detector only catches this
+one sometimes. It depends on scheduling: with GOMAXPROCS=1 it tends to miss
+it, and with more Ps it usually doesn't. It's a race either way.)`,
+	},
+	{
+		id:    "mutex",
+		title: "lock on both sides",
+		code: `// writer:
+mu.Lock()
+myFoo = Foo{A: i, B: i}
+mu.Unlock()
+
+// reader:
+mu.Lock()
+fooCopy := myFoo
+mu.Unlock()`,
+		ask:         "Can the reader ever see A != B?",
+		allowed:     false,
+		harnessMode: "mutex",
+		explain: `Now the writer's whole store and the reader's whole load are each inside a
+critical section, and critical sections on the same mutex never overlap.`,
+	},
+	{
+		id:    "atomicpointer",
+		title: "publish through atomic.Pointer",
+		code: `// writer:
+ptr.Store(&Foo{A: i, B: i})
+
+// reader:
+fooCopy := *ptr.Load()`,
+		ask:         "Can the reader ever see A != B?",
+		allowed:     false,
+		harnessMode: "atomicpointer",
+		explain: `Each Foo is fully built before its pointer is stored, and nobody writes to
+it after that. The atomic store and load guarantee the reader sees the
+fields that were written before the store.`,
+	},
+	{
+		id:    "mp-plain",
+		title: "message passing with plain variables",
+		code: `// goroutine 1:
+data = 1
+flag = 1
+
+// goroutine 2:
+f := flag
+d := data`,
+		ask:     "Can goroutine 2 see f == 1 but d == 0?",
+		allowed: true,
+		litmus:  messagePassingPlain,
+		explain: `This is a data race, so the memory model allows anything. x86 happens to
+keep stores in order and loads in order, so you probably won't see it there,
+but ARM reorders both, and the compiler is allowed to reorder them anywhere.`,
+	},
+	{
+		id:    "mp-atomic",
+		title: "message passing with an atomic flag",
+		code: `// goroutine 1:
+data = 1
+flag.Store(1)
+
+// goroutine 2:
+f := flag.Load()
+d := data`,
+		ask:     "Can goroutine 2 see f == 1 but d == 0?",
+		allowed: false,
+		litmus:  messagePassingAtomic,
+		explain: `If the load of flag sees the store, the store synchronizes with the load,
+so everything before the store (data = 1) happens before everything after
+the load. This is how every lock and channel works under the hood.`,
+	},
+	{
+		id:    "sb-plain",
+		title: "store buffering with plain variables",
+		code: `// goroutine 1:
+x = 1
+r1 := y
+
+// goroutine 2:
+y = 1
+r2 := x`,
+		ask:     "Can both r1 and r2 be 0?",
+		allowed: true,
+		litmus:  storeBufferingPlain,
+		explain: `It seems like whichever store happened first should be visible to the other
+goroutine's load. But even x86 lets a load run ahead of an earlier store to a
+different address, because stores wait in a store buffer before other cores
+can see them. With two or more CPUs this one shows up a lot.`,
+	},
+	{
+		id:    "sb-atomic",
+		title: "store buffering with atomics",
+		code: `// goroutine 1:
+x.Store(1)
+r1 := y.Load()
+
+// goroutine 2:
+y.Store(1)
+r2 := x.Load()`,
+		ask:     "Can both r1 and r2 be 0?",
+		allowed: false,
+		litmus:  storeBufferingAtomic,
+		explain: `Go's atomics are sequentially consistent: all of them happen in a single
+total order that every goroutine agrees on. Whichever store comes first in
+that order is visible to the other goroutine's load. On x86 that costs a
+full fence (or an XCHG) on every atomic store.`,
+	},
+}
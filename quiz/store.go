@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Each person's answers live in their own file, <dir>/<name>.json, so that a
+// room full of people sharing one machine over SSH don't step on each other.
+type record struct {
+	Name     string    `json:"name"`
+	Sessions []session `json:"sessions"`
+}
+
+type session struct {
+	Time    time.Time `json:"time"`
+	Answers []answer  `json:"answers"`
+}
+
+type answer struct {
+	Question string `json:"question"`
+	Guess    bool   `json:"guess"`
+	Correct  bool   `json:"correct"`
+	// Observed is how many times the weird outcome actually showed up, and
+	// out of how many tries (reads or rounds).
+	Observed int64 `json:"observed"`
+	Tries    int64 `json:"tries"`
+}
+
+func (s session) score() int {
+	n := 0
+	for _, a := range s.Answers {
+		if a.Correct {
+			n++
+		}
+	}
+	return n
+}
+
+// fileName keeps names like "../../etc/passwd" or "Ada Lovelace" from
+// turning into surprising paths.
+func fileName(dir, name string) string {
+	clean := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, name)
+	return filepath.Join(dir, clean+".json")
+}
+
+func loadRecord(dir, name string) (record, error) {
+	data, err := os.ReadFile(fileName(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return record{Name: name}, nil
+	} else if err != nil {
+		return record{}, err
+	}
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return record{}, err
+	}
+	return r, nil
+}
+
+// saveRecord writes to a temp file and renames it, so that Ctrl-C in the
+// middle of a save doesn't lose everyone's earlier sessions.
+func saveRecord(dir string, r record) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := fileName(dir, r.Name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,395 @@
+package main
+
+// iterator_invalidation.md starts with Rust refusing to compile this:
+//
+//     for i in &mylist {
+//         if *i == 2 {
+//             mylist.push(4);
+//         }
+//     }
+//
+// Go compiles the same thing without a word, and it even does something
+// well defined. But it's probably not what the author meant. A range
+// statement evaluates its operand once, so:
+//
+//   - Appending to a slice that's being ranged over never shows the loop the
+//     new elements.
+//   - Deleting from it with append(s[:i], s[i+1:]...) or slices.Delete
+//     shifts the elements the loop hasn't reached yet down by one, so it
+//     skips the element after each deletion and sees the last one twice.
+//   - Assigning something else to the variable doesn't change what the loop
+//     is going over.
+//   - Inserting into or deleting from a map that's being ranged over makes
+//     which entries the loop sees depend on the iteration order, which is
+//     random.
+//
+// This pass reports all of those. It leaves alone the cases that are fine:
+// a change that's followed right away by a break or return, like the usual
+// "find it, delete it, stop" loop; updating or deleting the map entry the
+// loop is on; and anything inside a function literal, which might run some
+// other time.
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "rangemut",
+	Doc:      "report appends, deletes and reassignments of a slice or map inside a range over it",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	filter := []ast.Node{(*ast.AssignStmt)(nil), (*ast.IncDecStmt)(nil), (*ast.ExprStmt)(nil)}
+	insp.WithStack(filter, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		for _, c := range changes(pass, n.(ast.Stmt)) {
+			for _, loop := range enclosingRanges(pass, stack, c.target) {
+				if !leavesLoop(pass, stack, loop) {
+					report(pass, c, stack[loop].(*ast.RangeStmt))
+				}
+			}
+		}
+		return true
+	})
+	return nil, nil
+}
+
+type changeKind int
+
+const (
+	appendTo changeKind = iota
+	deleteFrom
+	reassign
+	insertInto
+)
+
+// A change is something a statement does to a variable that matters if
+// the statement is inside a range over that variable.
+type change struct {
+	kind   changeKind
+	pos    token.Pos
+	target ast.Expr
+	// key is the map key inserted or deleted, or nil for all of them.
+	key ast.Expr
+}
+
+func changes(pass *analysis.Pass, stmt ast.Stmt) []change {
+	var cs []change
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		if stmt.Tok == token.DEFINE {
+			// Only ever declares new variables, even if one of them
+			// shadows the one being ranged over.
+			return nil
+		}
+		for i, lhs := range stmt.Lhs {
+			lhs = ast.Unparen(lhs)
+			if index, ok := lhs.(*ast.IndexExpr); ok && isMap(pass, index.X) {
+				cs = append(cs, change{kind: insertInto, pos: lhs.Pos(), target: index.X, key: index.Index})
+				continue
+			}
+			var rhs ast.Expr
+			if len(stmt.Rhs) == len(stmt.Lhs) && stmt.Tok == token.ASSIGN {
+				rhs = stmt.Rhs[i]
+			}
+			cs = append(cs, change{kind: classify(pass, lhs, rhs), pos: lhs.Pos(), target: lhs})
+		}
+	case *ast.IncDecStmt:
+		if index, ok := ast.Unparen(stmt.X).(*ast.IndexExpr); ok && isMap(pass, index.X) {
+			cs = append(cs, change{kind: insertInto, pos: stmt.Pos(), target: index.X, key: index.Index})
+		}
+	case *ast.ExprStmt:
+		call, ok := ast.Unparen(stmt.X).(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			break
+		}
+		switch fn := typeutil.Callee(pass.TypesInfo, call); {
+		case isBuiltin(fn, "delete") && len(call.Args) == 2:
+			cs = append(cs, change{kind: deleteFrom, pos: call.Pos(), target: call.Args[0], key: call.Args[1]})
+		case isBuiltin(fn, "clear") && isMap(pass, call.Args[0]):
+			cs = append(cs, change{kind: deleteFrom, pos: call.Pos(), target: call.Args[0]})
+		case isFunc(fn, "maps", "DeleteFunc"):
+			cs = append(cs, change{kind: deleteFrom, pos: call.Pos(), target: call.Args[0]})
+		case isFunc(fn, "maps", "Copy"):
+			cs = append(cs, change{kind: insertInto, pos: call.Pos(), target: call.Args[0]})
+		}
+	}
+	return cs
+}
+
+// classify says what assigning rhs to lhs does, when lhs is a slice. It's
+// a plain reassignment unless rhs is one of the usual ways of growing or
+// shrinking lhs in place.
+func classify(pass *analysis.Pass, lhs, rhs ast.Expr) changeKind {
+	call, ok := ast.Unparen(rhs).(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return reassign
+	}
+	first := ast.Unparen(call.Args[0])
+	switch fn := typeutil.Callee(pass.TypesInfo, call); {
+	case isBuiltin(fn, "append"):
+		if sameVar(pass, first, lhs) {
+			return appendTo
+		}
+		// append(s[:i], s[i+1:]...) deletes; so does anything else that
+		// appends to a prefix of s, which overwrites the rest in place.
+		if slice, ok := first.(*ast.SliceExpr); ok && slice.Low == nil && sameVar(pass, slice.X, lhs) {
+			return deleteFrom
+		}
+	case isFunc(fn, "slices", "Delete"), isFunc(fn, "slices", "DeleteFunc"),
+		isFunc(fn, "slices", "Compact"), isFunc(fn, "slices", "CompactFunc"):
+		if sameVar(pass, first, lhs) {
+			return deleteFrom
+		}
+	case isFunc(fn, "slices", "Insert"):
+		if sameVar(pass, first, lhs) {
+			return appendTo
+		}
+	}
+	return reassign
+}
+
+// enclosingRanges returns the range statements around the top of stack
+// that go over target, from the innermost out, stopping at a function
+// literal.
+func enclosingRanges(pass *analysis.Pass, stack []ast.Node, target ast.Expr) []int {
+	var loops []int
+	for i := len(stack) - 2; i >= 0; i-- {
+		switch n := stack[i].(type) {
+		case *ast.FuncLit:
+			return loops
+		case *ast.RangeStmt:
+			// The range operand is evaluated before the loop starts, so
+			// a change inside it doesn't count.
+			if stack[i+1] != n.Body {
+				continue
+			}
+			if (isMap(pass, n.X) || isSlice(pass, n.X)) && sameVar(pass, n.X, target) {
+				loops = append(loops, i)
+			}
+		}
+	}
+	return loops
+}
+
+// leavesLoop reports whether, once the statement at the top of stack has
+// run, the loop at stack[loop] can't get around to another iteration:
+// everything after it ends in a return, a panic, a goto, or a break that
+// goes far enough, with no continue on the way.
+func leavesLoop(pass *analysis.Pass, stack []ast.Node, loop int) bool {
+	// Labels on the loop and anything around it, which a labeled break can
+	// use to leave the loop.
+	outer := make(map[types.Object]bool)
+	for _, n := range stack[:loop] {
+		if labeled, ok := n.(*ast.LabeledStmt); ok {
+			outer[pass.TypesInfo.Defs[labeled.Label]] = true
+		}
+	}
+	var own types.Object
+	if labeled, ok := stack[loop-1].(*ast.LabeledStmt); ok {
+		own = pass.TypesInfo.Defs[labeled.Label]
+	}
+
+	// Work outwards from the statement. Falling off the end of a block
+	// goes on to whatever follows the block, until the end of the loop
+	// body, which is another iteration.
+	for i := len(stack) - 1; i >= loop+2; i-- {
+		var list []ast.Stmt
+		switch parent := stack[i-1].(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			// The end of an inner loop's body goes around that loop.
+			return false
+		case *ast.BlockStmt:
+			switch stack[i-2].(type) {
+			case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+				// The other cases don't follow this one.
+				continue
+			}
+			list = parent.List
+		case *ast.CaseClause:
+			list = parent.Body
+		case *ast.CommClause:
+			list = parent.Body
+		default:
+			continue
+		}
+		rest := list[slices.Index(list, stack[i].(ast.Stmt))+1:]
+		if continues(pass, rest, own) {
+			return false
+		}
+		// An unlabeled break only leaves the innermost for, switch, or
+		// select.
+		nested := slices.ContainsFunc(stack[loop+1:i], func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+				return true
+			}
+			return false
+		})
+		if len(rest) > 0 && terminates(pass, rest[len(rest)-1], nested, outer) {
+			return true
+		}
+	}
+	return false
+}
+
+// terminates reports whether stmt never finishes normally, but leaves the
+// loop instead, like a terminating statement in the spec but with breaks.
+func terminates(pass *analysis.Pass, stmt ast.Stmt, nested bool, outer map[types.Object]bool) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.ExprStmt:
+		call, ok := ast.Unparen(stmt.X).(*ast.CallExpr)
+		return ok && isBuiltin(typeutil.Callee(pass.TypesInfo, call), "panic")
+	case *ast.BranchStmt:
+		switch stmt.Tok {
+		case token.GOTO:
+			return true
+		case token.BREAK:
+			if stmt.Label == nil {
+				return !nested
+			}
+			return outer[pass.TypesInfo.Uses[stmt.Label]]
+		}
+	case *ast.BlockStmt:
+		return len(stmt.List) > 0 && terminates(pass, stmt.List[len(stmt.List)-1], nested, outer)
+	case *ast.IfStmt:
+		return stmt.Else != nil && terminates(pass, stmt.Body, nested, outer) && terminates(pass, stmt.Else, nested, outer)
+	case *ast.LabeledStmt:
+		return terminates(pass, stmt.Stmt, nested, outer)
+	}
+	return false
+}
+
+// continues reports whether any of stmts has a continue that goes back to
+// the top of the loop labeled own, or of the innermost loop if they aren't
+// inside another one.
+func continues(pass *analysis.Pass, stmts []ast.Stmt, own types.Object) bool {
+	found := false
+	var loops []bool // for each node on the way down, whether it's a loop
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if n == nil {
+				loops = loops[:len(loops)-1]
+				return true
+			}
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.BranchStmt:
+				if n.Tok == token.CONTINUE {
+					if n.Label == nil {
+						found = found || !slices.Contains(loops, true)
+					} else {
+						found = found || own != nil && pass.TypesInfo.Uses[n.Label] == own
+					}
+				}
+			}
+			_, isFor := n.(*ast.ForStmt)
+			_, isRange := n.(*ast.RangeStmt)
+			loops = append(loops, isFor || isRange)
+			return true
+		})
+	}
+	return found
+}
+
+func report(pass *analysis.Pass, c change, loop *ast.RangeStmt) {
+	name := types.ExprString(loop.X)
+	switch c.kind {
+	case appendTo:
+		pass.Reportf(c.pos, "appending to %s inside a range over it: the loop won't see the new elements", name)
+	case deleteFrom:
+		if isMap(pass, loop.X) {
+			if c.key != nil && loop.Key != nil && sameVar(pass, c.key, loop.Key) {
+				return // the entry the loop is on
+			}
+			pass.Reportf(c.pos, "deleting from %s inside a range over it: whether the loop still sees the deleted entries depends on the iteration order", name)
+		} else {
+			pass.Reportf(c.pos, "deleting from %s inside a range over it: the elements after it shift down, so the loop skips one", name)
+		}
+	case insertInto:
+		if c.key != nil && loop.Key != nil && sameVar(pass, c.key, loop.Key) {
+			return
+		}
+		pass.Reportf(c.pos, "inserting into %s inside a range over it: the loop may or may not see the new entries", name)
+	case reassign:
+		pass.Reportf(c.pos, "assigning to %s inside a range over it: the loop keeps going over the old value", name)
+	}
+}
+
+func isBuiltin(obj types.Object, name string) bool {
+	b, ok := obj.(*types.Builtin)
+	return ok && b.Name() == name
+}
+
+func isFunc(obj types.Object, pkg, name string) bool {
+	fn, ok := obj.(*types.Func)
+	return ok && fn.Pkg() != nil && fn.Pkg().Path() == pkg && fn.Name() == name
+}
+
+func isMap(pass *analysis.Pass, e ast.Expr) bool {
+	t := pass.TypesInfo.TypeOf(e)
+	if t == nil {
+		return false
+	}
+	_, ok := t.Underlying().(*types.Map)
+	return ok
+}
+
+func isSlice(pass *analysis.Pass, e ast.Expr) bool {
+	t := pass.TypesInfo.TypeOf(e)
+	if t == nil {
+		return false
+	}
+	_, ok := t.Underlying().(*types.Slice)
+	return ok
+}
+
+// sameVar reports whether a and b are the same variable: the same local or
+// global, or the same field path from one, like s.items and s.items. Index
+// expressions, calls and pointer dereferences don't count, since two of
+// them could be different places.
+func sameVar(pass *analysis.Pass, a, b ast.Expr) bool {
+	pa, pb := varPath(pass, a), varPath(pass, b)
+	return pa != nil && slices.Equal(pa, pb)
+}
+
+func varPath(pass *analysis.Pass, e ast.Expr) []types.Object {
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		if v, ok := pass.TypesInfo.ObjectOf(e).(*types.Var); ok {
+			return []types.Object{v}
+		}
+	case *ast.SelectorExpr:
+		sel, ok := pass.TypesInfo.Selections[e]
+		if !ok {
+			// A qualified identifier, like pkg.Var.
+			if v, ok := pass.TypesInfo.ObjectOf(e.Sel).(*types.Var); ok {
+				return []types.Object{v}
+			}
+			return nil
+		}
+		if sel.Kind() != types.FieldVal {
+			return nil
+		}
+		if base := varPath(pass, e.X); base != nil {
+			return append(base, sel.Obj())
+		}
+	}
+	return nil
+}
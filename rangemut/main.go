@@ -0,0 +1,19 @@
+package main
+
+// rangemut is a vet-style checker for loops that append to, delete from, or
+// reassign the slice or map they're ranging over. See analyzer.go for the
+// details.
+//
+//     rangemut ./...
+//     go vet -vettool=$(which rangemut) ./...
+//
+// The examples in testdata are checked with analysistest, against their
+// "// want" comments:
+//
+//     go test ./rangemut
+
+import "golang.org/x/tools/go/analysis/singlechecker"
+
+func main() {
+	singlechecker.Main(Analyzer)
+}
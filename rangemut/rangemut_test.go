@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// invalidation has the loops from iterator_invalidation.md, and the ways of
+// writing them that rangemut should leave alone.
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "invalidation")
+}
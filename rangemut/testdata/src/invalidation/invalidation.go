@@ -0,0 +1,213 @@
+package invalidation
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// The Python loop at the top of iterator_invalidation.md, which Rust won't
+// compile. Python's loop sees the 4. Go's doesn't.
+func pushWhileIterating() {
+	mylist := []int{1, 2, 3}
+	for _, i := range mylist {
+		if i == 2 {
+			mylist = append(mylist, 4) // want `appending to mylist inside a range over it: the loop won't see the new elements`
+		}
+	}
+	fmt.Println(mylist)
+}
+
+// Ranging over the indexes doesn't help: the length is fixed too.
+func pushByIndex() {
+	mylist := []int{1, 2, 3}
+	for i := range mylist {
+		if mylist[i] == 2 {
+			mylist = slices.Insert(mylist, i, 4) // want `appending to mylist`
+		}
+	}
+}
+
+// Deleting as we go skips whatever comes right after each deleted element.
+func deleteWhileIterating() {
+	mylist := []string{"a", "b", "b", "c"}
+	for i, s := range mylist {
+		if s == "b" {
+			mylist = append(mylist[:i], mylist[i+1:]...) // want `deleting from mylist inside a range over it: the elements after it shift down, so the loop skips one`
+		}
+	}
+	for i, s := range mylist {
+		if s == "c" {
+			mylist = slices.Delete(mylist, i, i+1) // want `deleting from mylist`
+		}
+	}
+}
+
+// Finding one element and stopping is fine, since the loop never looks at
+// the shifted elements.
+func deleteFirst(mylist []string, target string) []string {
+	for i, s := range mylist {
+		if s == target {
+			mylist = append(mylist[:i], mylist[i+1:]...)
+			break
+		}
+	}
+	for i, s := range mylist {
+		if s == target {
+			mylist = slices.Delete(mylist, i, i+1)
+			return mylist
+		}
+	}
+	return mylist
+}
+
+// But a break inside a switch only leaves the switch.
+func deleteInSwitch(mylist []string) {
+	for i, s := range mylist {
+		switch s {
+		case "x":
+			mylist = slices.Delete(mylist, i, i+1) // want `deleting from mylist`
+			break
+		}
+	}
+outer:
+	for i, s := range mylist {
+		switch s {
+		case "y":
+			mylist = slices.Delete(mylist, i, i+1)
+			break outer
+		}
+	}
+}
+
+// Assigning a different slice to the variable doesn't redirect the loop,
+// which already has the old one.
+func reassignWhileIterating(mylist []string, more []string) {
+	for _, s := range mylist {
+		if s == "a" {
+			mylist = more // want `assigning to mylist inside a range over it: the loop keeps going over the old value`
+		}
+	}
+	for _, s := range mylist {
+		fmt.Println(s)
+		mylist = mylist[1:] // want `assigning to mylist`
+	}
+}
+
+// Fields count too, as long as it's the same field of the same variable.
+type queue struct {
+	items []int
+}
+
+func (q *queue) drain(other *queue) {
+	for _, item := range q.items {
+		if item > 0 {
+			q.items = append(q.items, -item) // want `appending to q.items`
+		}
+		other.items = append(other.items, item)
+	}
+}
+
+// Things that only look like the ranged-over slice.
+func lookalikes(mylist []int) {
+	for _, x := range mylist {
+		mylist := append(mylist, x) // a new variable
+		_ = mylist
+	}
+	for _, x := range mylist {
+		go func() {
+			mylist = append(mylist, x) // runs some other time
+		}()
+	}
+	out := mylist[:0]
+	for _, x := range mylist {
+		if x > 0 {
+			out = append(out, x) // the filter-in-place idiom
+		}
+	}
+	for i, x := range mylist {
+		mylist[i] = x * 2 // writing elements doesn't change the length
+	}
+	for _, x := range mylist {
+		fmt.Println(x)
+	}
+	mylist = append(mylist, 1) // after the loop
+}
+
+// Maps: which entries the loop sees depends on the order, which is random.
+func mapsWhileIterating(m map[string]int) {
+	for k, v := range m {
+		if v > 10 {
+			m[k+"'"] = v / 2 // want `inserting into m inside a range over it: the loop may or may not see the new entries`
+		}
+	}
+	for k := range m {
+		m[k]++          // the current entry is fine
+		m[k] = m[k] * 2 // so is this
+		if m[k] == 0 {
+			delete(m, k) // and deleting it
+		}
+	}
+	for k, v := range m {
+		if v == 0 {
+			delete(m, k+"'") // want `deleting from m inside a range over it: whether the loop still sees the deleted entries depends on the iteration order`
+		}
+	}
+	for range m {
+		clear(m) // want `deleting from m`
+	}
+	for k := range m {
+		maps.Copy(m, map[string]int{k + "!": 1}) // want `inserting into m`
+	}
+	for range m {
+		m = map[string]int{} // want `assigning to m`
+	}
+}
+
+// Once the loop has changed the slice, it can still do whatever it likes,
+// as long as every way through ends up leaving the loop.
+func trim(s []byte) []byte {
+	for lo, c := range s {
+		if c == ' ' {
+			continue
+		}
+		s = s[lo:]
+		for hi := len(s) - 1; hi >= 0; hi-- {
+			if s[hi] != ' ' {
+				return s[:hi+1]
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+// Unless it might.
+func trimSome(s []byte) []byte {
+	for lo, c := range s {
+		s = s[lo:] // want `assigning to s`
+		if c == ' ' {
+			continue
+		}
+		return s
+	}
+search:
+	for lo, c := range s {
+		for range 2 {
+			s = s[lo:] // want `assigning to s`
+			if c == ' ' {
+				continue search
+			}
+		}
+		return s
+	}
+	for lo, c := range s {
+		s = s[lo:]
+		if c == ' ' {
+			break
+		} else {
+			return s
+		}
+	}
+	return s
+}
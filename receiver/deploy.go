@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type config struct {
+	// checkout is a clone of the site repo, with the repo we're deploying
+	// from as origin. It gets reset to each pushed commit.
+	checkout string
+	// releases holds one directory per deploy, plus a symlink called
+	// current pointing to the live one. That's what nginx serves.
+	releases string
+	branch   string
+	// peru and build are shell commands run in the checkout. Either can be
+	// empty. build gets the release directory in $RELEASE, and has to fill it
+	// in. Without a build command, the release is a copy of www/.
+	peru  string
+	build string
+	// keep is how many old releases to keep around for rolling back by
+	// hand.
+	keep int
+}
+
+// A deployment is one push, from the moment it's received.
+type deployment struct {
+	ID       int       `json:"id"`
+	Commit   string    `json:"commit"`
+	State    string    `json:"state"` // queued, running, ok, failed, or superseded
+	Received time.Time `json:"received"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+	Release  string    `json:"release,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	// Log is what the deploy printed. It's left out of /status, which
+	// anyone can read, and goes to the daemon's stderr instead.
+	Log string `json:"-"`
+}
+
+// A deployer runs one deploy at a time. Pushes that arrive while a deploy is
+// running wait, and if several pile up, only the newest one runs. The older
+// ones would be overwritten immediately anyway.
+type deployer struct {
+	cfg config
+
+	mu      sync.Mutex
+	history []*deployment
+	pending *deployment
+	nextID  int
+	wake    chan struct{}
+	// events, if it's set, gets a line whenever a deploy starts or ends.
+	events io.Writer
+}
+
+const maxHistory = 50
+
+func newDeployer(cfg config) *deployer {
+	return &deployer{cfg: cfg, wake: make(chan struct{}, 1), nextID: 1}
+}
+
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// enqueue records a push and returns a copy of its deployment. The commit
+// has to be a full hash, so that nothing we pass to git can be mistaken for
+// an option.
+func (d *deployer) enqueue(commit string) (deployment, error) {
+	if !commitPattern.MatchString(commit) {
+		return deployment{}, fmt.Errorf("not a commit hash: %q", commit)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dep := &deployment{ID: d.nextID, Commit: commit, State: "queued", Received: time.Now()}
+	d.nextID++
+	if d.pending != nil {
+		d.pending.State = "superseded"
+	}
+	d.pending = dep
+	d.history = append(d.history, dep)
+	if len(d.history) > maxHistory {
+		d.history = slices.Delete(d.history, 0, len(d.history)-maxHistory)
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return *dep, nil
+}
+
+// loop runs queued deploys forever.
+func (d *deployer) loop() {
+	for range d.wake {
+		d.mu.Lock()
+		dep := d.pending
+		d.pending = nil
+		if dep != nil {
+			dep.State = "running"
+			dep.Started = time.Now()
+		}
+		d.mu.Unlock()
+		if dep == nil {
+			continue
+		}
+		d.event("deploy %d: building %s", dep.ID, dep.Commit)
+		var log bytes.Buffer
+		release, err := d.deploy(dep.Commit, &log)
+		d.mu.Lock()
+		dep.Finished = time.Now()
+		dep.Log = log.String()
+		dep.Release = release
+		switch {
+		case errors.Is(err, errNotTip):
+			dep.State = "superseded"
+			dep.Error = err.Error()
+		case err != nil:
+			dep.State = "failed"
+			dep.Error = err.Error()
+		default:
+			dep.State = "ok"
+		}
+		d.mu.Unlock()
+		if d.events != nil {
+			d.events.Write(log.Bytes())
+		}
+		if err != nil {
+			d.event("deploy %d: %v", dep.ID, err)
+		} else {
+			d.event("deploy %d: %s is live", dep.ID, release)
+		}
+	}
+}
+
+func (d *deployer) event(format string, args ...any) {
+	if d.events != nil {
+		fmt.Fprintf(d.events, time.Now().Format(time.DateTime)+" "+format+"\n", args...)
+	}
+}
+
+// status returns copies of the recent deployments, newest first.
+func (d *deployer) status() []deployment {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var deps []deployment
+	for _, dep := range slices.Backward(d.history) {
+		deps = append(deps, *dep)
+	}
+	return deps
+}
+
+func (d *deployer) lookup(id int) (deployment, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, dep := range d.history {
+		if dep.ID == id {
+			return *dep, true
+		}
+	}
+	return deployment{}, false
+}
+
+// cleanEnv is our environment without git's variables. A post-receive hook
+// runs with GIT_DIR pointing at the bare repo, and every git command in the
+// checkout would quietly use that instead.
+func cleanEnv() []string {
+	return slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		return strings.HasPrefix(kv, "GIT_")
+	})
+}
+
+// run runs a command in the checkout, with its output going to log.
+func (d *deployer) run(log io.Writer, extraEnv []string, name string, args ...string) error {
+	fmt.Fprintf(log, "$ %s %s\n", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	cmd.Dir = d.cfg.checkout
+	cmd.Env = append(cleanEnv(), extraEnv...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// output runs a git command in the checkout and returns what it printed.
+func (d *deployer) output(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = d.cfg.checkout
+	cmd.Env = cleanEnv()
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// errNotTip means a deploy was asked for a commit that isn't what the
+// branch points to in origin, either because a newer push came in or
+// because the request was a replay.
+var errNotTip = errors.New("not the tip of the branch")
+
+// deploy builds commit into a new release directory and makes it current,
+// as long as commit is still the tip of the branch in origin. If anything
+// fails, the current release stays where it was.
+func (d *deployer) deploy(commit string, log io.Writer) (string, error) {
+	unlock, err := lockCheckout(d.cfg.checkout)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if err := d.run(log, nil, "git", "fetch", "--quiet", "origin", d.cfg.branch); err != nil {
+		return "", err
+	}
+	// Only the branch's tip goes out. A webhook doesn't say when it was
+	// sent, so without this, replaying an old one would roll the site back.
+	tip, err := d.output("git", "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+	if tip != commit {
+		return "", fmt.Errorf("%w: %s is at %s", errNotTip, d.cfg.branch, tip)
+	}
+	if err := d.run(log, nil, "git", "reset", "--quiet", "--hard", commit); err != nil {
+		return "", err
+	}
+	if d.cfg.peru != "" {
+		if err := d.run(log, nil, "sh", "-c", d.cfg.peru); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(d.cfg.releases, 0o755); err != nil {
+		return "", err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000Z") + "-" + commit[:12]
+	release := filepath.Join(d.cfg.releases, name)
+	if d.cfg.build != "" {
+		abs, err := filepath.Abs(release)
+		if err != nil {
+			return "", err
+		}
+		if err := d.run(log, []string{"RELEASE=" + abs}, "sh", "-c", d.cfg.build); err != nil {
+			os.RemoveAll(release)
+			return "", err
+		}
+		if _, err := os.Stat(release); err != nil {
+			return "", fmt.Errorf("the build didn't create $RELEASE: %w", err)
+		}
+	} else {
+		fmt.Fprintf(log, "copying www/ to %s\n", release)
+		if err := copyDir(filepath.Join(d.cfg.checkout, "www"), release); err != nil {
+			os.RemoveAll(release)
+			return "", err
+		}
+	}
+	if err := d.swap(name); err != nil {
+		return release, err
+	}
+	fmt.Fprintf(log, "%s is live\n", name)
+	d.prune(name, log)
+	return release, nil
+}
+
+// swap points the current symlink at the named release. Renaming a new
+// symlink over the old one is atomic, so nginx never sees a missing or
+// half-copied site. The link is relative, so the releases directory can
+// move.
+func (d *deployer) swap(name string) error {
+	tmp := filepath.Join(d.cfg.releases, ".current.tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(name, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(d.cfg.releases, "current"))
+}
+
+// prune deletes all but the newest keep releases. The names start with the
+// time, so sorting them sorts by age. Errors only get logged, since the
+// deploy itself already worked.
+func (d *deployer) prune(live string, log io.Writer) {
+	entries, err := os.ReadDir(d.cfg.releases)
+	if err != nil {
+		fmt.Fprintln(log, "pruning:", err)
+		return
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+	for len(names) > max(d.cfg.keep, 1) {
+		if names[0] != live {
+			fmt.Fprintf(log, "removing old release %s\n", names[0])
+			if err := os.RemoveAll(filepath.Join(d.cfg.releases, names[0])); err != nil {
+				fmt.Fprintln(log, "pruning:", err)
+			}
+		}
+		names = names[1:]
+	}
+}
+
+// copyDir copies a tree of regular files, directories and symlinks.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case entry.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case entry.Type().IsRegular():
+			return copyFile(path, target)
+		}
+		return errors.New("can't copy special file " + path)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,28 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Without flock, the lock is a file that only one process can create. Unlike
+// flock, it outlives a deploy that crashes, so a stale one has to be deleted
+// by hand.
+func lockCheckout(checkout string) (func(), error) {
+	path := filepath.Join(checkout, ".git", "receiver.lock")
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
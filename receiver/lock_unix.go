@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockCheckout keeps two deploys from using the checkout at once. The
+// deployer only runs one at a time, but two pushes can run two hooks.
+func lockCheckout(checkout string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(checkout, ".git", "receiver.lock"), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Closing the file releases the lock.
+	return func() { f.Close() }, nil
+}
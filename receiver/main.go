@@ -0,0 +1,152 @@
+package main
+
+// receiver deploys the site when master gets pushed, so that push.py doesn't
+// need to log into the server to run git pull and peru sync. It can run two
+// ways. As a daemon, behind nginx, it takes signed webhooks:
+//
+//     go run ./receiver serve -secret-file /etc/receiver.secret \
+//         -checkout /srv/jacko.io/checkout -releases /srv/jacko.io/releases
+//
+// Or as the post-receive hook of a bare repo on the server, so that a plain
+// `git push server master` deploys, and the pusher sees the output:
+//
+//     #!/bin/sh
+//     exec /usr/local/bin/receiver hook \
+//         -checkout /srv/jacko.io/checkout -releases /srv/jacko.io/releases
+//
+// Either way, a deploy resets the checkout to the pushed commit, runs peru
+// sync, and builds the site into a new directory under releases. Then it
+// points releases/current at it, which is what nginx's root should be. If
+// any step fails, current doesn't move. The old releases stick around
+// (-keep) for rolling back by hand. Only the branch's current tip in origin
+// ever gets deployed, so a replayed webhook can't roll the site back. The
+// daemon reports on deploys at /status and /status/ID, and writes their logs
+// to stderr.
+//
+// go test ./receiver runs the whole thing against local bare repos, with an
+// httptest server in front.
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func configFlags(fs *flag.FlagSet) *config {
+	cfg := new(config)
+	fs.StringVar(&cfg.checkout, "checkout", "", "a clone of the site repo, with origin pointing where pushes go (required)")
+	fs.StringVar(&cfg.releases, "releases", "", "the directory to build releases in (required)")
+	fs.StringVar(&cfg.branch, "branch", "master", "the branch to deploy")
+	fs.StringVar(&cfg.peru, "peru", "peru sync --no-cache", "the command that fetches peru imports (empty for none)")
+	fs.StringVar(&cfg.build, "build", "", "a command that builds the site into $RELEASE (default: copy www/)")
+	fs.IntVar(&cfg.keep, "keep", 5, "how many releases to keep")
+	return cfg
+}
+
+func parseConfig(fs *flag.FlagSet, cfg *config, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.checkout == "" || cfg.releases == "" {
+		return errors.New("-checkout and -releases are required")
+	}
+	return nil
+}
+
+func cmdServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfg := configFlags(fs)
+	addr := fs.String("addr", "localhost:8040", "where to listen")
+	secretFile := fs.String("secret-file", "", "the file with the webhook secret (default: $RECEIVER_SECRET)")
+	if err := parseConfig(fs, cfg, args); err != nil {
+		return err
+	}
+	secret := os.Getenv("RECEIVER_SECRET")
+	if *secretFile != "" {
+		data, err := os.ReadFile(*secretFile)
+		if err != nil {
+			return err
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	if secret == "" {
+		return errors.New("no secret: use -secret-file or $RECEIVER_SECRET")
+	}
+	d := newDeployer(*cfg)
+	d.events = os.Stderr
+	go d.loop()
+	fmt.Fprintf(os.Stderr, "listening on %s\n", *addr)
+	return http.ListenAndServe(*addr, newServer(d, []byte(secret)))
+}
+
+func cmdHook(args []string) error {
+	fs := flag.NewFlagSet("hook", flag.ExitOnError)
+	cfg := configFlags(fs)
+	if err := parseConfig(fs, cfg, args); err != nil {
+		return err
+	}
+	return hook(newDeployer(*cfg), os.Stdin, os.Stdout)
+}
+
+// hook is the post-receive hook. git gives it a line for each updated ref,
+// "OLD NEW REF", and shows the pusher whatever it prints. By then the push
+// has already happened, so a failed deploy doesn't undo it.
+func hook(d *deployer, stdin io.Reader, out io.Writer) error {
+	var commit string
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[2] == "refs/heads/"+d.cfg.branch && strings.Trim(fields[1], "0") != "" {
+			commit = fields[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if commit == "" {
+		fmt.Fprintf(out, "receiver: nothing pushed to %s, so nothing to deploy\n", d.cfg.branch)
+		return nil
+	}
+	if !commitPattern.MatchString(commit) {
+		return fmt.Errorf("receiver: not a commit hash: %q", commit)
+	}
+	fmt.Fprintf(out, "receiver: deploying %s\n", commit[:12])
+	if _, err := d.deploy(commit, out); errors.Is(err, errNotTip) {
+		// Another push got in first, and its hook will deploy it.
+		fmt.Fprintf(out, "receiver: not deploying: %v\n", err)
+	} else if err != nil {
+		return fmt.Errorf("receiver: deploy failed: %w", err)
+	}
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: receiver serve [flags] | hook [flags]")
+		fmt.Fprintln(os.Stderr, "run `receiver serve -h` or `receiver hook -h` for the flags")
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch flag.Arg(0) {
+	case "serve":
+		err = cmdServe(flag.Args()[1:])
+	case "hook":
+		err = cmdHook(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary stand in for receiver itself, so that the
+// hook test can install it as a real post-receive hook.
+func TestMain(m *testing.M) {
+	if os.Getenv("RECEIVER_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// A site is a throwaway bare repo, a clone of it to push from, a checkout
+// for the deployer, and a releases directory.
+type site struct {
+	t        *testing.T
+	dir      string
+	bare     string
+	work     string
+	checkout string
+	releases string
+}
+
+func newSite(t *testing.T) (*site, string) {
+	dir := t.TempDir()
+	s := &site{
+		t:        t,
+		dir:      dir,
+		bare:     filepath.Join(dir, "site.git"),
+		work:     filepath.Join(dir, "work"),
+		checkout: filepath.Join(dir, "checkout"),
+		releases: filepath.Join(dir, "releases"),
+	}
+	s.git(dir, "init", "-q", "--bare", s.bare)
+	s.git(dir, "clone", "-q", s.bare, s.work)
+	v1, _ := s.commit("v1")
+	s.git(dir, "clone", "-q", s.bare, s.checkout)
+	return s, v1
+}
+
+func (s *site) config() config {
+	return config{checkout: s.checkout, releases: s.releases, branch: "master", keep: 2}
+}
+
+func (s *site) git(dir string, args ...string) string {
+	s.t.Helper()
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com",
+		"-c", "init.defaultBranch=master"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = cleanEnv()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		s.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit commits a new index.html and pushes it. It returns the new commit
+// and what git push printed, which includes the hook's output once there is
+// a hook.
+func (s *site) commit(content string) (string, string) {
+	s.t.Helper()
+	if err := os.MkdirAll(filepath.Join(s.work, "www"), 0o755); err != nil {
+		s.t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.work, "www", "index.html"), []byte(content), 0o644); err != nil {
+		s.t.Fatal(err)
+	}
+	s.git(s.work, "add", "-A")
+	s.git(s.work, "commit", "-q", "-m", content)
+	pushed := s.git(s.work, "push", "origin", "master")
+	return s.git(s.work, "rev-parse", "HEAD"), pushed
+}
+
+// live checks what the live site says.
+func (s *site) live(want string) {
+	s.t.Helper()
+	got, err := os.ReadFile(filepath.Join(s.releases, "current", "index.html"))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if string(got) != want {
+		s.t.Fatalf("the live site says %q, not %q", got, want)
+	}
+}
+
+func payload(ref, commit string) string {
+	return fmt.Sprintf(`{"ref": %q, "after": %q}`, ref, commit)
+}
+
+func post(t *testing.T, url, body, signature string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest("POST", url+"/deploy", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature != "" {
+		req.Header.Set("X-Hub-Signature-256", signature)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	text, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(text)
+}
+
+// TestWebhook sends signed and unsigned webhooks to an httptest server. The
+// subtests share one site, and each one builds on the last.
+func TestWebhook(t *testing.T) {
+	s, v1 := newSite(t)
+	d := newDeployer(s.config())
+	go d.loop()
+	secret := []byte("not very secret")
+	srv := httptest.NewServer(newServer(d, secret))
+	defer srv.Close()
+
+	expectStatus := func(body, signature string, want int) {
+		t.Helper()
+		if code, text := post(t, srv.URL, body, signature); code != want {
+			t.Errorf("status %d, not %d: %s", code, want, text)
+		}
+	}
+	// push sends a signed push for commit and waits for the deploy to
+	// finish, however it finishes.
+	push := func(commit string) deployment {
+		t.Helper()
+		body := payload("refs/heads/master", commit)
+		code, text := post(t, srv.URL, body, sign(secret, []byte(body)))
+		if code != http.StatusAccepted {
+			t.Fatalf("status %d: %s", code, text)
+		}
+		var queued deployment
+		if err := json.Unmarshal([]byte(text), &queued); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(time.Minute)
+		for time.Now().Before(deadline) {
+			dep, _ := d.lookup(queued.ID)
+			if dep.State != "queued" && dep.State != "running" {
+				return dep
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatal("timed out waiting for the deploy")
+		return deployment{}
+	}
+	deployVia := func(commit string) {
+		t.Helper()
+		if dep := push(commit); dep.State != "ok" {
+			t.Fatalf("deploy %s: %s\n%s", dep.State, dep.Error, dep.Log)
+		}
+	}
+
+	body := payload("refs/heads/master", v1)
+	t.Run("an unsigned push is rejected", func(t *testing.T) {
+		expectStatus(body, "", http.StatusUnauthorized)
+	})
+	t.Run("a push signed with the wrong secret is rejected", func(t *testing.T) {
+		expectStatus(body, sign([]byte("wrong"), []byte(body)), http.StatusUnauthorized)
+	})
+	t.Run("a push to another branch is ignored", func(t *testing.T) {
+		other := payload("refs/heads/other", v1)
+		expectStatus(other, sign(secret, []byte(other)), http.StatusOK)
+	})
+	t.Run("a push of something that isn't a hash is rejected", func(t *testing.T) {
+		bogus := payload("refs/heads/master", "--upload-pack=touch /tmp/owned")
+		expectStatus(bogus, sign(secret, []byte(bogus)), http.StatusBadRequest)
+	})
+	t.Run("a signed push deploys", func(t *testing.T) {
+		deployVia(v1)
+		s.live("v1")
+	})
+	t.Run("the next push replaces it", func(t *testing.T) {
+		v2, _ := s.commit("v2")
+		deployVia(v2)
+		s.live("v2")
+	})
+	t.Run("old releases get pruned", func(t *testing.T) {
+		v3, _ := s.commit("v3")
+		deployVia(v3)
+		s.live("v3")
+		entries, err := os.ReadDir(s.releases)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Two releases plus the current link.
+		if len(entries) != 3 {
+			t.Errorf("%d entries in the releases directory", len(entries))
+		}
+	})
+	t.Run("a replayed push doesn't roll the site back", func(t *testing.T) {
+		if dep := push(v1); dep.State != "superseded" {
+			t.Errorf("the replay was %s: %s", dep.State, dep.Error)
+		}
+		s.live("v3")
+	})
+	t.Run("status doesn't show the build logs", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		text, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(text), v1) {
+			t.Fatalf("status doesn't mention %s:\n%s", v1, text)
+		}
+		if strings.Contains(string(text), "git fetch") || strings.Contains(string(text), `"log"`) {
+			t.Errorf("status shows a build log:\n%s", text)
+		}
+	})
+}
+
+func TestFailedBuild(t *testing.T) {
+	s, v1 := newSite(t)
+	if _, err := newDeployer(s.config()).deploy(v1, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	v2, _ := s.commit("v2")
+	broken := s.config()
+	broken.build = "echo building; exit 3"
+	var log bytes.Buffer
+	if _, err := newDeployer(broken).deploy(v2, &log); err == nil {
+		t.Fatal("the deploy worked")
+	}
+	if !strings.Contains(log.String(), "building") {
+		t.Errorf("the log is missing the build output: %q", log.String())
+	}
+	s.live("v1")
+}
+
+func TestOnlyTheTipDeploys(t *testing.T) {
+	s, v1 := newSite(t)
+	s.commit("v2")
+	var log bytes.Buffer
+	if _, err := newDeployer(s.config()).deploy(v1, &log); !errors.Is(err, errNotTip) {
+		t.Fatalf("deploying an old commit: %v\n%s", err, log.String())
+	}
+	if _, err := os.Stat(filepath.Join(s.releases, "current")); !os.IsNotExist(err) {
+		t.Errorf("something went live anyway: %v", err)
+	}
+}
+
+func TestBuildCommand(t *testing.T) {
+	s, v1 := newSite(t)
+	built := s.config()
+	built.build = `mkdir "$RELEASE" && cp -R www/. "$RELEASE" && echo yes > "$RELEASE/built.txt"`
+	if _, err := newDeployer(built).deploy(v1, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.releases, "current", "built.txt")); err != nil {
+		t.Error(err)
+	}
+	s.live("v1")
+}
+
+func TestNewerPushSupersedes(t *testing.T) {
+	d := newDeployer(config{branch: "master"})
+	first, err := d.enqueue(strings.Repeat("1", 40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.enqueue(strings.Repeat("2", 40)); err != nil {
+		t.Fatal(err)
+	}
+	if dep, _ := d.lookup(first.ID); dep.State != "superseded" {
+		t.Errorf("the first push is %s", dep.State)
+	}
+}
+
+// TestHook installs the hook for real, with this test binary playing
+// receiver, and pushes.
+func TestHook(t *testing.T) {
+	s, _ := newSite(t)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf("#!/bin/sh\nRECEIVER_TEST_MAIN=1 exec '%s' hook -peru '' -checkout '%s' -releases '%s'\n",
+		exe, s.checkout, s.releases)
+	if err := os.WriteFile(filepath.Join(s.bare, "hooks", "post-receive"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	_, pushed := s.commit("v2")
+	if !strings.Contains(pushed, "remote: receiver: deploying") {
+		t.Errorf("the push didn't show the hook's output:\n%s", pushed)
+	}
+	s.live("v2")
+}
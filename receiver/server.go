@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The webhook format is GitHub's, so a GitHub webhook can point straight at
+// this: a JSON body with the ref and the new commit, signed with
+// HMAC-SHA256 in the X-Hub-Signature-256 header. Anything that can compute
+// an HMAC can send one too:
+//
+//	body='{"ref":"refs/heads/master","after":"<commit>"}'
+//	sig=$(printf %s "$body" | openssl dgst -sha256 -hmac "$secret" -r | cut -d" " -f1)
+//	curl -H "X-Hub-Signature-256: sha256=$sig" -d "$body" https://jacko.io/deploy
+//
+// There's no timestamp in the signature, so a captured request can be
+// replayed. That's why a deploy checks that the commit is still the tip of
+// the branch in origin, and does nothing if it isn't: a replay can only
+// redeploy what's already live.
+type pushEvent struct {
+	Ref   string `json:"ref"`
+	After string `json:"after"`
+}
+
+const maxBody = 1 << 20
+
+type server struct {
+	d      *deployer
+	secret []byte
+}
+
+func newServer(d *deployer, secret []byte) http.Handler {
+	s := &server{d: d, secret: secret}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /deploy", s.deploy)
+	mux.HandleFunc("GET /status", s.status)
+	mux.HandleFunc("GET /status/{id}", s.status)
+	return mux
+}
+
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func (s *server) deploy(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	// Check the signature before looking at the body at all.
+	got := r.Header.Get("X-Hub-Signature-256")
+	if !hmac.Equal([]byte(got), []byte(sign(s.secret, body))) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	// GitHub sends a ping when a webhook is created.
+	if r.Header.Get("X-GitHub-Event") == "ping" {
+		fmt.Fprintln(w, "pong")
+		return
+	}
+	var event pushEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "bad payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if event.Ref != "refs/heads/"+s.d.cfg.branch {
+		fmt.Fprintf(w, "ignoring a push to %s\n", event.Ref)
+		return
+	}
+	if strings.Trim(event.After, "0") == "" {
+		fmt.Fprintf(w, "ignoring the deletion of %s\n", event.Ref)
+		return
+	}
+	dep, err := s.d.enqueue(event.After)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/status/%d", dep.ID))
+	writeJSON(w, http.StatusAccepted, dep)
+}
+
+// status reports the recent deploys, or just one. It's public, since it only
+// says which commits went out and when. The build logs aren't in it, since
+// they can say more about the server than anyone outside needs to know.
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	if idText := r.PathValue("id"); idText != "" {
+		id, err := strconv.Atoi(idText)
+		if err != nil {
+			http.Error(w, "bad id", http.StatusBadRequest)
+			return
+		}
+		dep, ok := s.d.lookup(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, dep)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.d.status())
+}
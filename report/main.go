@@ -0,0 +1,261 @@
+package main
+
+// report runs the harness (or reads its -json output) and writes a single
+// self-contained HTML page with the results: a summary table, a comparison of
+// the strategies, histograms of tear sizes, and what machine it all ran on.
+// There are no external assets, so the page can go straight into
+// www/experiments/ and get deployed with the rest of the site.
+//
+//     go run ./report/*.go -runs 5 -o www/experiments/tearing.html
+//     go run ./harness/*.go -json > results.jsonl
+//     go run ./report/*.go -in results.jsonl -o report.html
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oconnor663/jacko.io/internal/harnessbin"
+)
+
+// This matches the harness's JSON output.
+type result struct {
+	Mode        string   `json:"mode"`
+	Broken      bool     `json:"broken"`
+	Seconds     float64  `json:"seconds"`
+	Reads       int64    `json:"reads"`
+	Writes      int64    `json:"writes"`
+	Tears       int64    `json:"tears"`
+	TearsPerSec float64  `json:"tears_per_sec"`
+	FirstTear   *float64 `json:"first_tear_seconds"`
+	TearSizes   []int64  `json:"tear_sizes"`
+}
+
+// A summary adds up all the runs of one strategy.
+type summary struct {
+	Mode       string
+	Broken     bool
+	Runs       int
+	Reads      int64
+	Writes     int64
+	Tears      int64
+	rates      []float64
+	firstTears []float64
+	sizes      []int64
+	Histogram  template.HTML
+}
+
+func (s *summary) add(r result) {
+	s.Runs++
+	s.Reads += r.Reads
+	s.Writes += r.Writes
+	s.Tears += r.Tears
+	s.rates = append(s.rates, r.TearsPerSec)
+	if r.FirstTear != nil {
+		s.firstTears = append(s.firstTears, *r.FirstTear)
+	}
+	for i, c := range r.TearSizes {
+		for len(s.sizes) <= i {
+			s.sizes = append(s.sizes, 0)
+		}
+		s.sizes[i] += c
+	}
+}
+
+func (s *summary) meanRate() float64 {
+	total := 0.0
+	for _, r := range s.rates {
+		total += r
+	}
+	return total / float64(len(s.rates))
+}
+
+// RateRange shows the mean, and the range across runs if there was more
+// than one.
+func (s *summary) RateRange() string {
+	if len(s.rates) == 1 {
+		return formatCount(s.rates[0])
+	}
+	return fmt.Sprintf("%s (%s–%s)", formatCount(s.meanRate()), formatCount(slices.Min(s.rates)), formatCount(slices.Max(s.rates)))
+}
+
+func (s *summary) FirstTearText() string {
+	if len(s.firstTears) == 0 {
+		return "never"
+	}
+	sorted := slices.Sorted(slices.Values(s.firstTears))
+	text := formatSeconds(sorted[len(sorted)/2])
+	if len(sorted) > 1 {
+		text = "median " + text
+	}
+	if len(sorted) < s.Runs {
+		text += fmt.Sprintf(" (%d of %d runs)", len(sorted), s.Runs)
+	}
+	return text
+}
+
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Microsecond).String()
+}
+
+func readResults(r io.Reader) ([]result, error) {
+	var results []result
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var res result
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		results = append(results, res)
+	}
+	return results, scanner.Err()
+}
+
+func runHarness(dir, mode string, duration time.Duration, runs int) ([]result, error) {
+	bin, cleanup, err := harnessbin.Build(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var results []result
+	for i := range runs {
+		fmt.Fprintf(os.Stderr, "run %d/%d\n", i+1, runs)
+		cmd := exec.Command(bin, "-json", "-mode", mode, "-duration", duration.String())
+		cmd.Stderr = os.Stderr
+		// A correct strategy tearing makes the harness exit with an error,
+		// and that's exactly the sort of thing the report should show.
+		out, err := cmd.Output()
+		rs, parseErr := readResults(strings.NewReader(string(out)))
+		if parseErr != nil || len(rs) == 0 {
+			return nil, fmt.Errorf("harness run %d failed: %v %v", i+1, err, parseErr)
+		}
+		results = append(results, rs...)
+	}
+	return results, nil
+}
+
+type envVar struct {
+	Name, Value string
+}
+
+func environment() []envVar {
+	host, _ := os.Hostname()
+	env := []envVar{
+		{"host", host},
+		{"go", runtime.Version()},
+		{"os/arch", runtime.GOOS + "/" + runtime.GOARCH},
+		{"CPUs", fmt.Sprint(runtime.NumCPU())},
+		{"GOMAXPROCS", fmt.Sprint(runtime.GOMAXPROCS(0))},
+	}
+	if cpuinfo, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		for _, line := range strings.Split(string(cpuinfo), "\n") {
+			if name, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(name) == "model name" {
+				env = append(env, envVar{"CPU", strings.TrimSpace(value)})
+				break
+			}
+		}
+	}
+	if out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output(); err == nil {
+		env = append(env, envVar{"commit", strings.TrimSpace(string(out))})
+	}
+	for _, name := range []string{"GODEBUG", "GOGC", "GOMEMLIMIT"} {
+		if v := os.Getenv(name); v != "" {
+			env = append(env, envVar{name, v})
+		}
+	}
+	return env
+}
+
+func main() {
+	in := flag.String("in", "", "read harness -json output from this file instead of running the harness")
+	out := flag.String("o", "report.html", "where to write the report")
+	title := flag.String("title", "torn Foo experiments", "the page title")
+	harnessDir := flag.String("harness", "harness", "directory containing the harness source")
+	mode := flag.String("mode", "all", "which harness strategies to run")
+	duration := flag.Duration("duration", time.Second, "how long to run each strategy")
+	runs := flag.Int("runs", 3, "how many times to run the harness")
+	flag.Parse()
+
+	var results []result
+	var err error
+	var env []envVar
+	generated := "Generated " + time.Now().Format("January 2, 2006")
+	if *in != "" {
+		var f *os.File
+		if f, err = os.Open(*in); err == nil {
+			results, err = readResults(f)
+			f.Close()
+		}
+		// The results could've come from any machine, so we don't know what
+		// to say about the environment.
+		env = []envVar{{"results", filepath.Base(*in)}}
+	} else {
+		results, err = runHarness(*harnessDir, *mode, *duration, *runs)
+		env = environment()
+		generated += fmt.Sprintf(" from %d runs of %s per strategy", *runs, *duration)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var summaries []*summary
+	byMode := make(map[string]*summary)
+	for _, r := range results {
+		s, ok := byMode[r.Mode]
+		if !ok {
+			s = &summary{Mode: r.Mode, Broken: r.Broken}
+			byMode[r.Mode] = s
+			summaries = append(summaries, s)
+		}
+		s.add(r)
+	}
+	var labels []string
+	var rates []float64
+	var broken []bool
+	anyTears := false
+	for _, s := range summaries {
+		labels = append(labels, s.Mode)
+		rates = append(rates, s.meanRate())
+		broken = append(broken, s.Broken)
+		if s.Tears > 0 {
+			s.Histogram = histogram(s.sizes)
+			anyTears = true
+		}
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = page.Execute(f, map[string]any{
+		"Title":       *title,
+		"Generated":   generated,
+		"Summaries":   summaries,
+		"Comparison":  barChart(labels, rates, broken),
+		"AnyTears":    anyTears,
+		"Environment": env,
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
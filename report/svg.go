@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+)
+
+// The charts are plain inline SVG, so the report works offline and doesn't
+// need any JavaScript. The colors come from www/index.html.
+const (
+	textColor = "#555"
+	barColor  = "#55f"
+	okColor   = "#9d9"
+)
+
+// barChart draws one horizontal bar per label. Tear rates run from zero to
+// hundreds of millions per second, so the scale is logarithmic.
+func barChart(labels []string, values []float64, highlight []bool) template.HTML {
+	const (
+		labelWidth = 120
+		barWidth   = 420
+		rowHeight  = 24
+	)
+	maxLog := 0.0
+	for _, v := range values {
+		maxLog = max(maxLog, math.Log10(1+v))
+	}
+	var b strings.Builder
+	height := rowHeight*len(labels) + 10
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="13">`,
+		labelWidth+barWidth+140, height)
+	for i, label := range labels {
+		y := i*rowHeight + 5
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="%s">%s</text>`,
+			labelWidth-8, y+15, textColor, html.EscapeString(label))
+		w := 0.0
+		if maxLog > 0 {
+			w = math.Log10(1+values[i]) / maxLog * barWidth
+		}
+		color := okColor
+		if highlight[i] {
+			color = barColor
+		}
+		if w > 0 {
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"/>`, labelWidth, y+2, w, rowHeight-6, color)
+		}
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" fill="%s">%s</text>`, labelWidth+w+6, y+15, textColor, formatCount(values[i]))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// histogram draws the harness's tear size buckets, where bucket i counts the
+// tears with |A - B| in [2^i, 2^(i+1)). Counts are also on a log scale.
+func histogram(buckets []int64) template.HTML {
+	const (
+		colWidth = 22
+		height   = 140
+		axis     = 30
+	)
+	maxLog := 0.0
+	for _, c := range buckets {
+		maxLog = max(maxLog, math.Log10(1+float64(c)))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">`,
+		colWidth*len(buckets)+20, height+axis)
+	for i, c := range buckets {
+		x := 10 + i*colWidth
+		h := 0.0
+		if maxLog > 0 {
+			h = math.Log10(1+float64(c)) / maxLog * (height - 14)
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%.1f" width="%d" height="%.1f" fill="%s"><title>|A-B| in [%d, %d): %d tears</title></rect>`,
+			x, height-h, colWidth-4, h, barColor, uint64(1)<<i, uint64(1)<<(i+1), c)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s">2<tspan dy="-4" font-size="8">%d</tspan></text>`, x+2, height+14, textColor, i)
+	}
+	fmt.Fprintf(&b, `<text x="10" y="%d" fill="%s">|A - B|</text>`, height+axis-2, textColor)
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func formatCount(x float64) string {
+	switch {
+	case x >= 1e9:
+		return fmt.Sprintf("%.1fG", x/1e9)
+	case x >= 1e6:
+		return fmt.Sprintf("%.1fM", x/1e6)
+	case x >= 1e3:
+		return fmt.Sprintf("%.1fk", x/1e3)
+	}
+	return fmt.Sprintf("%.0f", x)
+}
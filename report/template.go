@@ -0,0 +1,117 @@
+package main
+
+import "html/template"
+
+// The style is copied from www/index.html, plus what the tables need, so
+// that a report in www/experiments/ looks like the rest of the site.
+var page = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+
+<style>
+body {
+  /* https://jgthms.com/web-design-in-4-minutes */
+  margin: 0 auto;
+  max-width: 50em;
+  font-family: sans-serif;
+  line-height: 1.5;
+  padding: 4em 1em;
+  color: #555;
+}
+h1,
+h2,
+strong {
+  color: #333;
+}
+a {
+  color: #55f;
+  text-decoration: none;
+}
+ul {
+  margin: 0;
+}
+table {
+  border-collapse: collapse;
+  margin: 1em 0;
+}
+th,
+td {
+  padding: 0.2em 0.8em;
+  border-bottom: 1px solid #ddd;
+}
+th {
+  color: #333;
+  text-align: left;
+}
+td.num {
+  text-align: right;
+  font-variant-numeric: tabular-nums;
+}
+</style>
+
+<h1>{{.Title}}</h1>
+
+<p>
+{{.Generated}}.
+The harness runs one goroutine that writes <code>Foo{i, i}</code> over and over
+and another that reads it, and counts the reads where <code>A != B</code>.
+See <a href="https://github.com/oconnor663/jacko.io/blob/master/not_atomic.go">not_atomic.go</a>
+for the original example.
+</p>
+
+<h2>summary</h2>
+
+<table>
+<tr><th>strategy</th><th>expected</th><th>runs</th><th>reads</th><th>writes</th><th>tears</th><th>tears/sec</th><th>first tear</th></tr>
+{{range .Summaries}}
+<tr>
+<td>{{.Mode}}</td>
+<td>{{if .Broken}}broken{{else}}correct{{end}}</td>
+<td class="num">{{.Runs}}</td>
+<td class="num">{{.Reads}}</td>
+<td class="num">{{.Writes}}</td>
+<td class="num">{{if and (not .Broken) .Tears}}<strong>{{.Tears}}</strong>{{else}}{{.Tears}}{{end}}</td>
+<td class="num">{{.RateRange}}</td>
+<td class="num">{{.FirstTearText}}</td>
+</tr>
+{{end}}
+</table>
+
+<h2>strategy comparison</h2>
+
+<p>Mean tears per second, on a log scale. Strategies that are supposed to be
+correct are green, and they should all be at zero.</p>
+
+{{.Comparison}}
+
+<h2>tear sizes</h2>
+
+<p>How far apart <code>A</code> and <code>B</code> were in the torn reads. A
+difference of 1 means the reader caught the writer between storing
+<code>A</code> and storing <code>B</code>. Bigger differences mean the writer
+got through several whole writes in between the reader's loads.</p>
+
+{{if .AnyTears}}
+{{range .Summaries}}{{if .Histogram}}
+<h3>{{.Mode}}</h3>
+{{.Histogram}}
+{{end}}{{end}}
+{{else}}
+<p>No tears.</p>
+{{end}}
+
+<h2>environment</h2>
+
+<table>
+{{range .Environment}}
+<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}
+</table>
+
+</body>
+</html>
+`))
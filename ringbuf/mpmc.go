@@ -0,0 +1,143 @@
+package ringbuf
+
+import "sync/atomic"
+
+// Every slot carries a sequence number that says whose turn it is. A slot at
+// position pos is free for the producer that claims pos when seq == pos, and
+// it's full and ready for the consumer that claims pos when seq == pos+1.
+// After the consumer empties it, it sets seq to pos+capacity, which is the
+// position that the next lap around the ring will use.
+type slot[T any] struct {
+	seq atomic.Uint64
+	val T
+}
+
+// MPMC is a bounded queue for any number of producer and consumer
+// goroutines.
+type MPMC[T any] struct {
+	_      pad
+	enq    atomic.Uint64
+	_      pad
+	deq    atomic.Uint64
+	_      pad
+	mask   uint64
+	slots  []slot[T]
+	closed atomic.Bool
+}
+
+// NewMPMC returns an empty queue that holds at least capacity values. The
+// capacity is rounded up to a power of two.
+func NewMPMC[T any](capacity int) *MPMC[T] {
+	n := roundCapacity(capacity)
+	q := &MPMC[T]{mask: n - 1, slots: make([]slot[T], n)}
+	for i := range q.slots {
+		q.slots[i].seq.Store(uint64(i))
+	}
+	return q
+}
+
+// TryPush adds v to the queue and returns true, or returns false if the
+// queue is full. It's lock-free but not wait-free: it can retry if other
+// producers keep winning the race for the next slot.
+func (q *MPMC[T]) TryPush(v T) bool {
+	if q.closed.Load() {
+		panic("ringbuf: push on closed queue")
+	}
+	pos := q.enq.Load()
+	for {
+		s := &q.slots[pos&q.mask]
+		seq := s.seq.Load()
+		switch diff := int64(seq - pos); {
+		case diff == 0:
+			// The slot is free. Claim position pos, if no one beat us to it.
+			if q.enq.CompareAndSwap(pos, pos+1) {
+				s.val = v
+				s.seq.Store(pos + 1)
+				return true
+			}
+			pos = q.enq.Load()
+		case diff < 0:
+			// The slot still holds a value from the previous lap, so the
+			// queue is full.
+			return false
+		default:
+			// Another producer claimed pos after we loaded it.
+			pos = q.enq.Load()
+		}
+	}
+}
+
+// TryPop removes the oldest value from the queue and returns it, or returns
+// false if the queue is empty.
+func (q *MPMC[T]) TryPop() (T, bool) {
+	var zero T
+	pos := q.deq.Load()
+	for {
+		s := &q.slots[pos&q.mask]
+		seq := s.seq.Load()
+		switch diff := int64(seq - (pos + 1)); {
+		case diff == 0:
+			if q.deq.CompareAndSwap(pos, pos+1) {
+				v := s.val
+				s.val = zero
+				s.seq.Store(pos + q.mask + 1)
+				return v, true
+			}
+			pos = q.deq.Load()
+		case diff < 0:
+			// The producer for this position hasn't finished (or started)
+			// writing it, so as far as we're concerned the queue is empty.
+			return zero, false
+		default:
+			pos = q.deq.Load()
+		}
+	}
+}
+
+// Push adds v to the queue, waiting for space if it's full. It panics if the
+// queue is closed.
+func (q *MPMC[T]) Push(v T) {
+	var b backoff
+	for !q.TryPush(v) {
+		b.wait()
+	}
+}
+
+// Pop removes the oldest value from the queue, waiting for one if the queue
+// is empty. It returns false if the queue is closed and there's nothing left
+// in it.
+func (q *MPMC[T]) Pop() (T, bool) {
+	var b backoff
+	for {
+		if v, ok := q.TryPop(); ok {
+			return v, true
+		}
+		if q.closed.Load() {
+			return q.TryPop()
+		}
+		b.wait()
+	}
+}
+
+// Close tells consumers that no more values are coming. It should only be
+// called once every producer has returned from its last push.
+func (q *MPMC[T]) Close() {
+	q.closed.Store(true)
+}
+
+// Len returns the number of values in the queue, or at least it did at some
+// point while Len was running.
+func (q *MPMC[T]) Len() int {
+	for {
+		d := q.deq.Load()
+		e := q.enq.Load()
+		if d == q.deq.Load() {
+			return int(e - d)
+		}
+	}
+}
+
+// Cap returns the number of values the queue can hold.
+func (q *MPMC[T]) Cap() int {
+	return len(q.slots)
+}
@@ -0,0 +1,57 @@
+// Package ringbuf provides bounded lock-free queues for handing values from
+// one goroutine to another.
+//
+// Passing a snapshot through a queue sidesteps the problem in not_atomic.go
+// entirely: the producer builds a whole Foo, pushes it, and never touches it
+// again. The consumer gets its own copy, and there's no shared Foo for anyone
+// to tear.
+//
+// SPSC is for exactly one producer goroutine and one consumer goroutine, and
+// its TryPush and TryPop are wait-free. MPMC allows any number of each, using
+// Dmitry Vyukov's bounded queue with a sequence number in every slot.
+//
+// The Try methods never block. Push and Pop spin and then yield until they
+// can make progress. Like a channel, a queue can be closed by the producer
+// side once it's done pushing, and Pop reports when a closed queue has been
+// drained.
+package ringbuf
+
+import (
+	"runtime"
+	"time"
+)
+
+// Keep the producer and consumer indexes on separate cache lines, so that
+// the two sides aren't constantly invalidating each other's caches.
+const cacheLine = 64
+
+type pad [cacheLine]byte
+
+// roundCapacity rounds up to a power of two, so that we can turn positions
+// into slot indexes with a mask instead of a division.
+func roundCapacity(capacity int) uint64 {
+	if capacity < 1 {
+		panic("ringbuf: capacity must be at least 1")
+	}
+	n := uint64(1)
+	for n < uint64(capacity) {
+		n <<= 1
+	}
+	return n
+}
+
+// backoff is what the blocking methods do in between failed attempts. A
+// short wait usually resolves itself in a few spins, a longer one should let
+// other goroutines run, and a really long one shouldn't burn a whole CPU.
+type backoff int
+
+func (b *backoff) wait() {
+	*b++
+	switch {
+	case *b <= 16:
+	case *b <= 1024:
+		runtime.Gosched()
+	default:
+		time.Sleep(50 * time.Microsecond)
+	}
+}
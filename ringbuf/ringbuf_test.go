@@ -0,0 +1,259 @@
+package ringbuf
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Foo is the struct from not_atomic.go. Every Foo that goes into a queue in
+// these tests has A == B, so a torn one shows up as A != B.
+type Foo struct {
+	A int
+	B int
+}
+
+func stressCount(t *testing.T) int {
+	if testing.Short() {
+		return 10_000
+	}
+	return 200_000
+}
+
+func TestCapacityRounding(t *testing.T) {
+	for _, c := range []struct{ in, want int }{{1, 1}, {2, 2}, {3, 4}, {1000, 1024}, {1024, 1024}} {
+		if got := NewSPSC[Foo](c.in).Cap(); got != c.want {
+			t.Errorf("NewSPSC(%d).Cap() = %d, want %d", c.in, got, c.want)
+		}
+		if got := NewMPMC[Foo](c.in).Cap(); got != c.want {
+			t.Errorf("NewMPMC(%d).Cap() = %d, want %d", c.in, got, c.want)
+		}
+	}
+}
+
+// queue is what SPSC and MPMC have in common, so the single-goroutine tests
+// can cover both.
+type queue interface {
+	TryPush(Foo) bool
+	TryPop() (Foo, bool)
+	Pop() (Foo, bool)
+	Close()
+	Len() int
+}
+
+func queues(capacity int) map[string]queue {
+	return map[string]queue{
+		"SPSC": NewSPSC[Foo](capacity),
+		"MPMC": NewMPMC[Foo](capacity),
+	}
+}
+
+func TestFullAndEmpty(t *testing.T) {
+	for name, q := range queues(4) {
+		// Go around the ring a few times, so the positions wrap.
+		for lap := range 3 {
+			if _, ok := q.TryPop(); ok {
+				t.Fatalf("%s lap %d: TryPop on an empty queue succeeded", name, lap)
+			}
+			for i := range 4 {
+				if !q.TryPush(Foo{i, i}) {
+					t.Fatalf("%s lap %d: TryPush %d failed", name, lap, i)
+				}
+			}
+			if q.TryPush(Foo{4, 4}) {
+				t.Fatalf("%s lap %d: TryPush on a full queue succeeded", name, lap)
+			}
+			if q.Len() != 4 {
+				t.Fatalf("%s lap %d: Len() = %d, want 4", name, lap, q.Len())
+			}
+			for i := range 4 {
+				if v, ok := q.TryPop(); !ok || v != (Foo{i, i}) {
+					t.Fatalf("%s lap %d: TryPop = %v, %v, want %v", name, lap, v, ok, Foo{i, i})
+				}
+			}
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	for name, q := range queues(4) {
+		q.TryPush(Foo{1, 1})
+		q.Close()
+		if v, ok := q.Pop(); !ok || v != (Foo{1, 1}) {
+			t.Errorf("%s: Pop after Close = %v, %v, want what was left", name, v, ok)
+		}
+		if _, ok := q.Pop(); ok {
+			t.Errorf("%s: Pop on a closed, empty queue succeeded", name)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: TryPush on a closed queue didn't panic", name)
+				}
+			}()
+			q.TryPush(Foo{2, 2})
+		}()
+	}
+}
+
+// One producer and one consumer, with a small queue so that both sides
+// spend a lot of time waiting on each other. Everything has to arrive
+// whole, once, and in order.
+func TestSPSCStress(t *testing.T) {
+	n := stressCount(t)
+	q := NewSPSC[Foo](8)
+	go func() {
+		for i := range n {
+			q.Push(Foo{i, i})
+		}
+		q.Close()
+	}()
+	next := 0
+	for {
+		v, ok := q.Pop()
+		if !ok {
+			break
+		}
+		if v.A != v.B {
+			t.Fatalf("torn Foo: %v", v)
+		}
+		if v.A != next {
+			t.Fatalf("got Foo %d, want %d", v.A, next)
+		}
+		next++
+	}
+	if next != n {
+		t.Fatalf("got %d Foos, want %d", next, n)
+	}
+}
+
+// Several producers and consumers. Every value has to arrive whole and
+// exactly once, and each consumer has to see each producer's values in the
+// order they were pushed.
+func TestMPMCStress(t *testing.T) {
+	const producers, consumers = 4, 4
+	perProducer := stressCount(t) / producers
+	q := NewMPMC[Foo](8)
+
+	var pushers sync.WaitGroup
+	for p := range producers {
+		pushers.Go(func() {
+			for i := range perProducer {
+				v := p*perProducer + i
+				q.Push(Foo{v, v})
+			}
+		})
+	}
+	go func() {
+		pushers.Wait()
+		q.Close()
+	}()
+
+	received := make([][]int, consumers)
+	var poppers sync.WaitGroup
+	for c := range consumers {
+		poppers.Go(func() {
+			for {
+				v, ok := q.Pop()
+				if !ok {
+					return
+				}
+				if v.A != v.B {
+					t.Errorf("torn Foo: %v", v)
+					return
+				}
+				received[c] = append(received[c], v.A)
+			}
+		})
+	}
+	poppers.Wait()
+
+	seen := make([]int, producers*perProducer)
+	for c, values := range received {
+		last := make([]int, producers)
+		for p := range last {
+			last[p] = -1
+		}
+		for _, v := range values {
+			seen[v]++
+			p := v / perProducer
+			if v <= last[p] {
+				t.Fatalf("consumer %d got %d after %d from the same producer", c, v, last[p])
+			}
+			last[p] = v
+		}
+	}
+	for v, count := range seen {
+		if count != 1 {
+			t.Fatalf("Foo %d arrived %d times", v, count)
+		}
+	}
+}
+
+// The benchmarks hand b.N Foos from producers to consumers, through a queue
+// or through a buffered channel of the same size.
+
+const benchCapacity = 1024
+
+func BenchmarkSPSC(b *testing.B) {
+	q := NewSPSC[Foo](benchCapacity)
+	go func() {
+		for i := range b.N {
+			q.Push(Foo{i, i})
+		}
+		q.Close()
+	}()
+	for {
+		if _, ok := q.Pop(); !ok {
+			break
+		}
+	}
+}
+
+func BenchmarkChanOneToOne(b *testing.B) {
+	ch := make(chan Foo, benchCapacity)
+	go func() {
+		for i := range b.N {
+			ch <- Foo{i, i}
+		}
+		close(ch)
+	}()
+	for range ch {
+	}
+}
+
+func benchmarkMany(b *testing.B, workers int, push func(Foo), pop func() bool, done func()) {
+	var pushers, poppers sync.WaitGroup
+	for w := range workers {
+		pushers.Go(func() {
+			for i := w; i < b.N; i += workers {
+				push(Foo{i, i})
+			}
+		})
+		poppers.Go(func() {
+			for pop() {
+			}
+		})
+	}
+	pushers.Wait()
+	done()
+	poppers.Wait()
+}
+
+func BenchmarkMPMC(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("%dx%d", workers, workers), func(b *testing.B) {
+			q := NewMPMC[Foo](benchCapacity)
+			benchmarkMany(b, workers, q.Push, func() bool { _, ok := q.Pop(); return ok }, q.Close)
+		})
+	}
+}
+
+func BenchmarkChanMany(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("%dx%d", workers, workers), func(b *testing.B) {
+			ch := make(chan Foo, benchCapacity)
+			benchmarkMany(b, workers, func(v Foo) { ch <- v }, func() bool { _, ok := <-ch; return ok }, func() { close(ch) })
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package ringbuf
+
+import "sync/atomic"
+
+// SPSC is a bounded queue for one producer goroutine and one consumer
+// goroutine. Calling TryPush or Push from two goroutines at once (or TryPop
+// or Pop from two goroutines at once) is a data race.
+type SPSC[T any] struct {
+	_ pad
+	// head is the next position to read. Only the consumer writes it.
+	head atomic.Uint64
+	// cachedTail is the consumer's last look at tail. It saves the consumer
+	// from touching the producer's cache line on every pop.
+	cachedTail uint64
+	_          pad
+	// tail is the next position to write. Only the producer writes it.
+	tail atomic.Uint64
+	// cachedHead is the producer's last look at head.
+	cachedHead uint64
+	_          pad
+	mask       uint64
+	buf        []T
+	closed     atomic.Bool
+}
+
+// NewSPSC returns an empty queue that holds at least capacity values. The
+// capacity is rounded up to a power of two.
+func NewSPSC[T any](capacity int) *SPSC[T] {
+	n := roundCapacity(capacity)
+	return &SPSC[T]{mask: n - 1, buf: make([]T, n)}
+}
+
+// TryPush adds v to the queue and returns true, or returns false if the
+// queue is full. It's wait-free.
+func (q *SPSC[T]) TryPush(v T) bool {
+	if q.closed.Load() {
+		panic("ringbuf: push on closed queue")
+	}
+	t := q.tail.Load()
+	if t-q.cachedHead > q.mask {
+		q.cachedHead = q.head.Load()
+		if t-q.cachedHead > q.mask {
+			return false
+		}
+	}
+	q.buf[t&q.mask] = v
+	// This store publishes the slot we just wrote. The consumer won't look at
+	// the slot until it loads a tail past it.
+	q.tail.Store(t + 1)
+	return true
+}
+
+// TryPop removes the oldest value from the queue and returns it, or returns
+// false if the queue is empty. It's wait-free.
+func (q *SPSC[T]) TryPop() (T, bool) {
+	var zero T
+	h := q.head.Load()
+	if h == q.cachedTail {
+		q.cachedTail = q.tail.Load()
+		if h == q.cachedTail {
+			return zero, false
+		}
+	}
+	v := q.buf[h&q.mask]
+	// Don't keep the value alive (if it holds pointers) after it's gone.
+	q.buf[h&q.mask] = zero
+	q.head.Store(h + 1)
+	return v, true
+}
+
+// Push adds v to the queue, waiting for space if it's full. It panics if the
+// queue is closed.
+func (q *SPSC[T]) Push(v T) {
+	var b backoff
+	for !q.TryPush(v) {
+		b.wait()
+	}
+}
+
+// Pop removes the oldest value from the queue, waiting for one if the queue
+// is empty. It returns false if the queue is closed and there's nothing left
+// in it.
+func (q *SPSC[T]) Pop() (T, bool) {
+	var b backoff
+	for {
+		if v, ok := q.TryPop(); ok {
+			return v, true
+		}
+		if q.closed.Load() {
+			// The producer might've pushed something right before it closed
+			// the queue, after our TryPop above.
+			return q.TryPop()
+		}
+		b.wait()
+	}
+}
+
+// Close tells the consumer that no more values are coming. Only the producer
+// should call it, after its last push.
+func (q *SPSC[T]) Close() {
+	q.closed.Store(true)
+}
+
+// Len returns the number of values in the queue. If the other side is busy,
+// it might be out of date as soon as it returns.
+func (q *SPSC[T]) Len() int {
+	h := q.head.Load()
+	t := q.tail.Load()
+	return int(t - h)
+}
+
+// Cap returns the number of values the queue can hold.
+func (q *SPSC[T]) Cap() int {
+	return len(q.buf)
+}
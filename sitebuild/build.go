@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oconnor663/jacko.io/duct"
+)
+
+// selfHash is the hash of the running sitebuild, so that a change to the
+// code, like the Markdown renderer, rebuilds everything it made.
+func selfHash() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return hashFile(exe)
+}
+
+func historyHash(revs []revision) string {
+	var b strings.Builder
+	for _, r := range revs {
+		fmt.Fprintf(&b, "%s %s %s %s %s\n", r.Hash, r.Date.Format(time.RFC3339), r.Path, r.Author, r.Subject)
+	}
+	return hashBytes([]byte(b.String()))
+}
+
+// postImages finds the images a post uses that live in the repo, as paths
+// relative to it. Images on other sites aren't ours to copy.
+func postImages(src string) []string {
+	var paths []string
+	for _, m := range image.FindAllStringSubmatch(src, -1) {
+		ref := m[2]
+		if strings.Contains(ref, "://") || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "data:") {
+			continue
+		}
+		paths = append(paths, filepath.Clean(ref))
+	}
+	return paths
+}
+
+// peruImports lists the directories that peru.yaml imports into, or nothing
+// if there's no peru.yaml.
+func peruImports(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var dirs []string
+	inImports := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "imports:":
+			inImports = true
+		case strings.TrimSpace(line) == "":
+		case !strings.HasPrefix(line, " "):
+			inImports = false
+		case inImports:
+			if _, dir, ok := strings.Cut(line, ":"); ok {
+				dirs = append(dirs, strings.TrimSpace(dir))
+			}
+		}
+	}
+	return dirs, scanner.Err()
+}
+
+// plan works out the steps for building paths, with their inputs hashed.
+// Reading the posts' histories happens here, since they're inputs, but
+// nothing gets rendered until a step runs.
+func (s *site) plan(paths []string) ([]*step, error) {
+	self, err := selfHash()
+	if err != nil {
+		return nil, err
+	}
+	var steps []*step
+	images := make(map[string]bool)
+	for _, path := range paths {
+		p, err := s.loadPost(path)
+		if err != nil {
+			return nil, err
+		}
+		history := historyHash(p.History)
+		postOut := filepath.Join(s.out, p.Slug+".html")
+		steps = append(steps, &step{
+			id: "post " + path,
+			inputs: map[string]string{
+				path:                     hashBytes(p.src),
+				"the history of " + path: history,
+				"the post template":      hashBytes([]byte(postSource)),
+				"sitebuild":              self,
+			},
+			outputs: []string{postOut},
+			run: func() error {
+				p.Body = template.HTML(renderMarkdown(p.body))
+				return s.write(postOut, postPage, p)
+			},
+		})
+		if len(p.History) > 0 {
+			historyOut := filepath.Join(s.out, "history", p.Slug+".html")
+			steps = append(steps, &step{
+				id: "history " + path,
+				inputs: map[string]string{
+					"the title of " + path:   hashBytes([]byte(p.Title)),
+					"the history of " + path: history,
+					"the history template":   hashBytes([]byte(historySource)),
+					"-repo":                  hashBytes([]byte(s.repo)),
+					"sitebuild":              self,
+				},
+				outputs: []string{historyOut},
+				run:     func() error { return s.write(historyOut, historyPage, p) },
+			})
+		}
+		for _, img := range postImages(p.body) {
+			if images[img] {
+				continue
+			}
+			images[img] = true
+			if !filepath.IsLocal(img) {
+				return nil, fmt.Errorf("%s: image %s is outside the repo", path, img)
+			}
+			src := filepath.Join(s.root, img)
+			h, err := hashFile(src)
+			if err != nil {
+				return nil, fmt.Errorf("%s: image: %w", path, err)
+			}
+			imageOut := filepath.Join(s.out, img)
+			steps = append(steps, &step{
+				id:      "image " + img,
+				inputs:  map[string]string{img: h},
+				outputs: []string{imageOut},
+				run:     func() error { return copyFile(imageOut, src) },
+			})
+		}
+	}
+
+	peruYAML := filepath.Join(s.root, "peru.yaml")
+	dirs, err := peruImports(peruYAML)
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) > 0 {
+		h, err := hashFile(peruYAML)
+		if err != nil {
+			return nil, err
+		}
+		st := &step{
+			id:     "peru",
+			inputs: map[string]string{"peru.yaml": h},
+			run: func() error {
+				_, err := duct.Cmd("peru", "sync").Dir(s.root).Run()
+				return err
+			},
+		}
+		for _, dir := range dirs {
+			st.outputs = append(st.outputs, filepath.Join(s.root, dir))
+		}
+		if !s.peru {
+			st.hold = "it only runs with -peru"
+		}
+		steps = append(steps, st)
+	}
+	return steps, nil
+}
+
+func copyFile(dst, src string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o644)
+}
+
+// build runs the steps for paths that are stale, and returns why each one
+// ran. With prune, it also deletes whatever the graph says an earlier build
+// made that nothing builds anymore, like the pages of a post that's gone.
+// The graph gets saved even if a step fails, so the steps that finished
+// don't run again next time.
+func (s *site) build(paths []string, prune bool) (map[string][]string, error) {
+	g, err := loadGraph(s.graph)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := s.plan(paths)
+	if err != nil {
+		return nil, err
+	}
+	rebuilt := make(map[string][]string)
+	err = s.runSteps(g, steps, rebuilt)
+	if err == nil && prune {
+		err = s.prune(g, steps)
+	}
+	if saveErr := g.save(s.graph); err == nil {
+		err = saveErr
+	}
+	fmt.Fprintf(s.log, "rebuilt %d of %d steps\n", len(rebuilt), len(steps))
+	return rebuilt, err
+}
+
+func (s *site) runSteps(g *graph, steps []*step, rebuilt map[string][]string) error {
+	for _, st := range steps {
+		reasons, err := g.stale(st)
+		if err != nil {
+			return err
+		}
+		if s.force && len(reasons) == 0 {
+			reasons = []string{"-force"}
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		if st.hold != "" {
+			if s.explain {
+				fmt.Fprintf(s.log, "skipped %s (%s), since %s\n", st.id, strings.Join(reasons, "; "), st.hold)
+			}
+			continue
+		}
+		if err := st.run(); err != nil {
+			return fmt.Errorf("%s: %w", st.id, err)
+		}
+		if err := g.done(st); err != nil {
+			return err
+		}
+		rebuilt[st.id] = reasons
+		if s.explain {
+			for _, out := range st.outputs {
+				fmt.Fprintf(s.log, "%s: %s\n", out, strings.Join(reasons, "; "))
+			}
+		}
+	}
+	return nil
+}
+
+func (s *site) prune(g *graph, steps []*step) error {
+	planned := make(map[string]bool)
+	for _, st := range steps {
+		planned[st.id] = true
+	}
+	for _, id := range slices.Sorted(maps.Keys(g.Steps)) {
+		if planned[id] {
+			continue
+		}
+		for _, out := range slices.Sorted(maps.Keys(g.Steps[id].Outputs)) {
+			if err := os.RemoveAll(out); err != nil {
+				return err
+			}
+			fmt.Fprintf(s.log, "removed %s, since nothing builds it anymore\n", out)
+		}
+		delete(g.Steps, id)
+	}
+	return nil
+}
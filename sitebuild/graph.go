@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// The graph remembers what each step was built from and what it wrote, by
+// content hash, so that the next build only runs the steps whose inputs
+// changed, or whose outputs went missing or got edited by hand. Timestamps
+// don't come into it: checking out an old branch and coming back touches
+// everything without changing anything.
+
+// A step makes some outputs out of some inputs. Its inputs are hashed
+// before it runs, by name. The names are what --explain prints, so they
+// read like "duct.md" or "the post template".
+type step struct {
+	id      string
+	inputs  map[string]string
+	outputs []string
+	run     func() error
+	// hold, if it's set, is why the step shouldn't run even when it's
+	// stale, like a tool that's only installed on the server.
+	hold string
+}
+
+type record struct {
+	Inputs  map[string]string `json:"inputs"`
+	Outputs map[string]string `json:"outputs"`
+}
+
+type graph struct {
+	Steps map[string]*record `json:"steps"`
+}
+
+func loadGraph(path string) (*graph, error) {
+	g := &graph{Steps: make(map[string]*record)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return g, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if g.Steps == nil {
+		g.Steps = make(map[string]*record)
+	}
+	return g, nil
+}
+
+func (g *graph) save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// stale says why s needs to run, or nothing if it doesn't.
+func (g *graph) stale(s *step) ([]string, error) {
+	rec := g.Steps[s.id]
+	if rec == nil {
+		return []string{"it hasn't been built before"}, nil
+	}
+	var reasons []string
+	for _, name := range slices.Sorted(maps.Keys(s.inputs)) {
+		old, ok := rec.Inputs[name]
+		switch {
+		case !ok:
+			reasons = append(reasons, name+" is a new input")
+		case old != s.inputs[name]:
+			reasons = append(reasons, name+" changed")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(rec.Inputs)) {
+		if _, ok := s.inputs[name]; !ok {
+			reasons = append(reasons, name+" isn't an input anymore")
+		}
+	}
+	for _, out := range s.outputs {
+		old, ok := rec.Outputs[out]
+		if !ok {
+			reasons = append(reasons, out+" is a new output")
+			continue
+		}
+		h, err := hashPath(out)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case h == "":
+			reasons = append(reasons, out+" is missing")
+		case h != old:
+			reasons = append(reasons, out+" was changed since it was built")
+		}
+	}
+	return reasons, nil
+}
+
+// done records what s was built from and what it wrote.
+func (g *graph) done(s *step) error {
+	rec := &record{Inputs: s.inputs, Outputs: make(map[string]string)}
+	for _, out := range s.outputs {
+		h, err := hashPath(out)
+		if err != nil {
+			return err
+		}
+		rec.Outputs[out] = h
+	}
+	g.Steps[s.id] = rec
+	return nil
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashPath hashes a file, or a whole directory by the names and hashes of
+// everything in it, like a peru import. Something that isn't there hashes
+// to "".
+func hashPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return hashFile(path)
+	}
+	var lines []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		h, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(path, p)
+		lines = append(lines, rel+"\x00"+h+"\n")
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	slices.Sort(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		io.WriteString(h, line)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oconnor663/jacko.io/duct"
+)
+
+// A revision is one commit that changed a post. Path is what the post was
+// called in that commit, which isn't its name now if it's been renamed
+// since.
+type revision struct {
+	Hash    string
+	Date    time.Time
+	Author  string
+	Subject string
+	Path    string
+}
+
+// Each commit in the log starts with a record separator, and its fields are
+// split by unit separators, so that nothing a commit subject can contain
+// gets in the way. --name-only puts the path on its own line after that.
+const logFormat = "--format=%x1e%H%x1f%aI%x1f%an%x1f%s"
+
+// pageHistory lists the commits that changed path, newest first, following
+// it back through renames. path is relative to repo. A file that git doesn't
+// know about has no history, and that's not an error.
+func pageHistory(repo, path string) ([]revision, error) {
+	out, err := duct.Cmd("git", "log", "--follow", "--name-only", logFormat, "--", path).Dir(repo).Read()
+	if err != nil {
+		return nil, err
+	}
+	var revs []revision
+	for _, record := range strings.Split(out, "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+		header, names, _ := strings.Cut(record, "\n")
+		fields := strings.Split(header, "\x1f")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected git log output: %q", header)
+		}
+		date, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("commit %s: %w", fields[0], err)
+		}
+		rev := revision{Hash: fields[0], Date: date, Author: fields[2], Subject: fields[3], Path: path}
+		// A merge lists no files. Otherwise the one file is the post, under
+		// whatever name it had then.
+		if name := strings.TrimSpace(names); name != "" {
+			rev.Path = name
+		}
+		revs = append(revs, rev)
+	}
+	return revs, nil
+}
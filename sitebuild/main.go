@@ -0,0 +1,175 @@
+package main
+
+// sitebuild renders the Markdown posts at the top of the repo into pages in
+// www/, with the dates each one was first published and last changed, and
+// a history page for each listing every commit that touched it. The dates
+// and the history come from `git log --follow`, so renaming a post doesn't
+// reset its age. Git runs through the Duct port in ../duct.
+//
+//     go run ./sitebuild
+//     go run ./sitebuild -o /tmp/www iterator_invalidation.md
+//
+// foo.md becomes www/foo.html, and its history www/history/foo.html. The
+// dates are author dates, and only committed changes count, so a post with
+// edits that haven't been committed yet still shows its last commit. A post
+// git doesn't know about yet gets no dates and no history page.
+//
+// Builds are incremental. Each step (a post, a history page, an image a post
+// uses, or the peru imports) records the content hashes of its inputs and
+// outputs in -graph, and the next build only runs the steps where something
+// changed. --explain says why each page got rebuilt, and -force rebuilds
+// everything anyway. Building every post also removes the pages of posts
+// that are gone; naming posts builds only those. peru sync only runs with
+// -peru, since peru is only installed on the server.
+//
+//     go run ./sitebuild --explain
+//     go run ./sitebuild -peru
+//
+// go test ./sitebuild scripts a throwaway repo with a few commits and a
+// rename, and checks the history, the pages built from it, and what gets
+// rebuilt as the repo changes.
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type site struct {
+	root    string // the repo, which post paths are relative to
+	out     string // where the pages go, usually www
+	repo    string // the repo on GitHub, for links to commits
+	graph   string // where the dependency graph is kept
+	peru    bool
+	force   bool
+	explain bool
+	log     io.Writer // what got built, and with explain, why
+}
+
+type post struct {
+	Slug      string
+	Title     string
+	TitleHTML template.HTML
+	Body      template.HTML
+	History   []revision // newest first
+	Repo      string
+
+	src  []byte // the whole file
+	body string // the Markdown after the title
+}
+
+// Published and Updated look at every revision rather than trusting the
+// order, since a rebase can leave author dates out of order.
+func (p *post) Published() time.Time {
+	t := p.History[0].Date
+	for _, r := range p.History {
+		if r.Date.Before(t) {
+			t = r.Date
+		}
+	}
+	return t
+}
+
+func (p *post) Updated() time.Time {
+	t := p.History[0].Date
+	for _, r := range p.History {
+		if r.Date.After(t) {
+			t = r.Date
+		}
+	}
+	return t
+}
+
+// Edited is whether there's a later day worth mentioning. Fixing a typo an
+// hour after publishing doesn't count.
+func (p *post) Edited() bool {
+	return p.Published().Format(time.DateOnly) != p.Updated().Format(time.DateOnly)
+}
+
+// loadPost reads a post and its history, but leaves rendering it for when
+// it's needed. The first "# " line is the title, and it comes out of the
+// body so that the dates can go right under it.
+func (s *site) loadPost(path string) (*post, error) {
+	src, err := os.ReadFile(filepath.Join(s.root, path))
+	if err != nil {
+		return nil, err
+	}
+	p := &post{
+		Slug: strings.TrimSuffix(filepath.Base(path), ".md"),
+		Repo: s.repo,
+		src:  src,
+		body: string(src),
+	}
+	p.Title = p.Slug
+	for _, line := range strings.Split(p.body, "\n") {
+		if title, ok := strings.CutPrefix(line, "# "); ok {
+			p.Title = strings.TrimSpace(title)
+			p.body = strings.Replace(p.body, line, "", 1)
+			break
+		}
+	}
+	p.TitleHTML = template.HTML(inline(p.Title))
+	if p.History, err = pageHistory(s.root, path); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (s *site) write(path string, tmpl *template.Template, p *post) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, p); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// findPosts lists the .md files at the top of the repo.
+func findPosts(root string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(root, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, m := range matches {
+		paths = append(paths, filepath.Base(m))
+	}
+	return paths, nil
+}
+
+func run() error {
+	s := site{log: os.Stdout}
+	flag.StringVar(&s.root, "root", ".", "the repo to find posts and history in")
+	flag.StringVar(&s.out, "o", "www", "the directory to write pages to")
+	flag.StringVar(&s.repo, "repo", "https://github.com/oconnor663/jacko.io", "the repo's web page, for links to commits")
+	flag.StringVar(&s.graph, "graph", ".sitebuild-graph.json", "where to keep the record of what was built from what")
+	flag.BoolVar(&s.peru, "peru", false, "run peru sync when peru.yaml changes")
+	flag.BoolVar(&s.force, "force", false, "rebuild everything, whether or not it changed")
+	flag.BoolVar(&s.explain, "explain", false, "say why each page was rebuilt")
+	flag.Parse()
+	paths := flag.Args()
+	all := len(paths) == 0
+	if all {
+		var err error
+		if paths, err = findPosts(s.root); err != nil {
+			return err
+		}
+	}
+	_, err := s.build(paths, all)
+	return err
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
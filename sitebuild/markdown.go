@@ -0,0 +1,129 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// This is the Markdown renderer from slides, grown enough for the posts:
+// headings, paragraphs, bullet and numbered lists whose items can wrap onto
+// indented lines, fenced code blocks, and inline code, bold, italics, images
+// and links. Anything fancier can be written as raw HTML, which passes
+// through as long as the line starts with "<".
+
+var (
+	inlineCode = regexp.MustCompile("`([^`]+)`")
+	bold       = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italic     = regexp.MustCompile(`\*([^*]+)\*`)
+	image      = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`)
+	link       = regexp.MustCompile(`\[([^\]]+)\]\(([^)]*)\)`)
+	numbered   = regexp.MustCompile(`^[0-9]+\. `)
+)
+
+func inline(text string) string {
+	// Pull the code spans out first, so that nothing inside them gets
+	// formatted.
+	var spans []string
+	text = inlineCode.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00"
+	})
+	text = html.EscapeString(text)
+	text = bold.ReplaceAllString(text, "<strong>$1</strong>")
+	text = italic.ReplaceAllString(text, "<em>$1</em>")
+	text = image.ReplaceAllString(text, `<img src="$2" alt="$1">`)
+	text = link.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	for _, span := range spans {
+		text = strings.Replace(text, "\x00", span, 1)
+	}
+	return text
+}
+
+// renderMarkdown converts a post to HTML.
+func renderMarkdown(src string) string {
+	var out strings.Builder
+	var para []string
+	// list is "ul" or "ol" while we're in one, and item is the text of the
+	// item so far, since it can go on for more than one line.
+	list := ""
+	var item []string
+	flushPara := func() {
+		if len(para) > 0 {
+			out.WriteString("<p>" + inline(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+	}
+	flushItem := func() {
+		if len(item) > 0 {
+			out.WriteString("<li>" + inline(strings.Join(item, " ")) + "</li>\n")
+			item = nil
+		}
+	}
+	closeList := func() {
+		flushItem()
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(kind string) {
+		flushPara()
+		flushItem()
+		if list != kind {
+			closeList()
+			out.WriteString("<" + kind + ">\n")
+			list = kind
+		}
+	}
+
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flushPara()
+			closeList()
+			lang := strings.TrimPrefix(trimmed, "```")
+			var code []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = ` class="language-` + html.EscapeString(lang) + `"`
+			}
+			out.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case trimmed == "":
+			flushPara()
+			closeList()
+		case strings.HasPrefix(trimmed, "#"):
+			flushPara()
+			closeList()
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			level = min(level, 6)
+			text := strings.TrimSpace(trimmed[level:])
+			out.WriteString("<h" + string(rune('0'+level)) + ">" + inline(text) + "</h" + string(rune('0'+level)) + ">\n")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			openList("ul")
+			item = append(item, trimmed[2:])
+		case numbered.MatchString(trimmed):
+			openList("ol")
+			item = append(item, numbered.ReplaceAllString(trimmed, ""))
+		case list != "" && line != trimmed:
+			// An indented line inside a list carries on the item above.
+			item = append(item, trimmed)
+		case strings.HasPrefix(trimmed, "<"):
+			flushPara()
+			closeList()
+			out.WriteString(line + "\n")
+		default:
+			closeList()
+			para = append(para, trimmed)
+		}
+	}
+	flushPara()
+	closeList()
+	return out.String()
+}
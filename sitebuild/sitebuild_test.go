@@ -0,0 +1,322 @@
+package main
+
+import (
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oconnor663/jacko.io/duct"
+)
+
+// scriptGit runs git in the scripted repo, as someone with no config of
+// their own, at a fixed time.
+func scriptGit(dir, date string, args ...string) *duct.Expression {
+	return duct.Cmd("git", args...).Dir(dir).
+		Env("GIT_CONFIG_GLOBAL", os.DevNull).
+		Env("GIT_CONFIG_NOSYSTEM", "1").
+		Env("GIT_AUTHOR_NAME", "Ada").
+		Env("GIT_AUTHOR_EMAIL", "ada@example.com").
+		Env("GIT_AUTHOR_DATE", date).
+		Env("GIT_COMMITTER_NAME", "Ada").
+		Env("GIT_COMMITTER_EMAIL", "ada@example.com").
+		Env("GIT_COMMITTER_DATE", date).
+		StdoutNull()
+}
+
+// scriptCommit writes files into the scripted repo and commits everything.
+func scriptCommit(t *testing.T, dir, date, message string, files map[string]string) {
+	t.Helper()
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := scriptGit(dir, date, "add", "-A").Then(scriptGit(dir, date, "commit", "-q", "-m", message)).Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// scriptedRepo makes a repo with a known history: a post that gets edited,
+// renamed, and edited again, and another post edited twice in one day.
+// There's also new.md, which is never committed.
+func scriptedRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := scriptGit(dir, "", "init", "-q").Run(); err != nil {
+		t.Fatal(err)
+	}
+	scriptCommit(t, dir, "2019-01-02T10:00:00Z", "Add a post", map[string]string{
+		"post.md": "# A *first* post\n\nHello.\n",
+	})
+	scriptCommit(t, dir, "2019-02-03T09:00:00Z", "Add another post", map[string]string{
+		"other.md": "# Other\n\nHi.\n",
+	})
+	scriptCommit(t, dir, "2020-03-04T10:00:00-05:00", "Fix a typo", map[string]string{
+		"post.md": "# A *first* post\n\nHello!\n",
+	})
+	if _, err := scriptGit(dir, "", "mv", "post.md", "renamed.md").Run(); err != nil {
+		t.Fatal(err)
+	}
+	scriptCommit(t, dir, "2021-05-06T10:00:00Z", "Rename the post", nil)
+	scriptCommit(t, dir, "2022-07-08T10:00:00Z", "Say <why> & how", map[string]string{
+		"renamed.md": "# A *first* post\n\nHello!\n\nThis is why.\n",
+	})
+	scriptCommit(t, dir, "2019-02-03T18:00:00Z", "Tweak the other post", map[string]string{
+		"other.md": "# Other\n\nHi there.\n",
+	})
+	if err := os.WriteFile(filepath.Join(dir, "new.md"), []byte("# New\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestHistoryFollowsRenames(t *testing.T) {
+	dir := scriptedRepo(t)
+	revs, err := pageHistory(dir, "renamed.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range revs {
+		got = append(got, r.Date.Format("2006-01-02")+" "+r.Path+" "+r.Subject)
+	}
+	want := []string{
+		"2022-07-08 renamed.md Say <why> & how",
+		"2021-05-06 renamed.md Rename the post",
+		"2020-03-04 post.md Fix a typo",
+		"2019-01-02 post.md Add a post",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if revs[0].Author != "Ada" || len(revs[0].Hash) != 40 {
+		t.Errorf("got author %q and hash %q", revs[0].Author, revs[0].Hash)
+	}
+
+	// A file git doesn't know has no history.
+	revs, err = pageHistory(dir, "new.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 0 {
+		t.Errorf("new.md has %d revisions", len(revs))
+	}
+}
+
+func TestMarkdownLists(t *testing.T) {
+	got := renderMarkdown("- a\n  b\n- c\n\n1. x\n2. y\ntext\n")
+	want := "<ul>\n<li>a b</li>\n<li>c</li>\n</ul>\n<ol>\n<li>x</li>\n<li>y</li>\n</ol>\n<p>text</p>\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestBuild builds the scripted repo, checks the pages, and then changes
+// things one at a time to see what gets rebuilt. The subtests share the
+// repo and the output, so each builds on the ones before it.
+func TestBuild(t *testing.T) {
+	dir := scriptedRepo(t)
+	s := site{
+		root:  dir,
+		out:   filepath.Join(dir, "www"),
+		repo:  "https://example.com/repo",
+		graph: filepath.Join(dir, "graph.json"),
+		log:   io.Discard,
+	}
+	posts := []string{"renamed.md", "other.md", "new.md"}
+	// rebuilds builds posts and checks which steps ran. If want has a
+	// reason after a step, one of the step's reasons has to contain it.
+	rebuilds := func(t *testing.T, posts []string, want ...string) {
+		t.Helper()
+		rebuilt, err := s.build(posts, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for i := 0; i < len(want); i += 2 {
+			id, reason := want[i], want[i+1]
+			ids = append(ids, id)
+			if !slices.ContainsFunc(rebuilt[id], func(r string) bool { return strings.Contains(r, reason) }) {
+				t.Errorf("%s was rebuilt because %q, not %q", id, rebuilt[id], reason)
+			}
+		}
+		if got := slices.Sorted(maps.Keys(rebuilt)); !slices.Equal(got, slices.Sorted(slices.Values(ids))) {
+			t.Errorf("rebuilt %q, want %q", got, ids)
+		}
+	}
+	writeFile := func(t *testing.T, name, text string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := func(name string) string {
+		b, _ := os.ReadFile(filepath.Join(s.out, name))
+		return string(b)
+	}
+	contains := func(t *testing.T, name string, want ...string) {
+		t.Helper()
+		text := page(name)
+		for _, w := range want {
+			if !strings.Contains(text, w) {
+				t.Errorf("%s doesn't contain %q", name, w)
+			}
+		}
+	}
+	lacks := func(t *testing.T, name string, unwanted ...string) {
+		t.Helper()
+		text := page(name)
+		for _, u := range unwanted {
+			if strings.Contains(text, u) {
+				t.Errorf("%s contains %q", name, u)
+			}
+		}
+	}
+
+	if !t.Run("the first build builds everything", func(t *testing.T) {
+		rebuilds(t, posts,
+			"history other.md", "hasn't been built",
+			"history renamed.md", "hasn't been built",
+			"post new.md", "hasn't been built",
+			"post other.md", "hasn't been built",
+			"post renamed.md", "hasn't been built",
+		)
+	}) {
+		t.FailNow()
+	}
+
+	t.Run("a renamed post keeps its publication date", func(t *testing.T) {
+		contains(t, "renamed.html",
+			`<title>A *first* post</title>`,
+			`<h1>A <em>first</em> post</h1>`,
+			`<meta property="article:published_time" content="2019-01-02T10:00:00Z">`,
+			`<meta property="article:modified_time" content="2022-07-08T10:00:00Z">`,
+			`Published <time datetime="2019-01-02T10:00:00Z">January 2, 2019</time>`,
+			`last updated <time datetime="2022-07-08T10:00:00Z">July 8, 2022</time>`,
+			`<a href="history/renamed.html">history</a>`,
+			`<p>This is why.</p>`,
+		)
+	})
+	t.Run("edits on the day it was published don't count", func(t *testing.T) {
+		contains(t, "other.html", "February 3, 2019", "history/other.html")
+		lacks(t, "other.html", "last updated")
+	})
+	t.Run("an uncommitted post has no dates", func(t *testing.T) {
+		lacks(t, "new.html", "Published", "article:")
+		if _, err := os.Stat(filepath.Join(s.out, "history", "new.html")); !os.IsNotExist(err) {
+			t.Errorf("history/new.html exists")
+		}
+	})
+	t.Run("the history page lists every revision", func(t *testing.T) {
+		revs, err := pageHistory(dir, "renamed.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for _, r := range revs {
+			want = append(want,
+				`<a href="https://example.com/repo/commit/`+r.Hash+`"><code>`+r.Hash[:10]+`</code></a>`,
+				`<a href="https://example.com/repo/blob/`+r.Hash+`/`+r.Path+`">`+r.Path+`</a>`)
+		}
+		want = append(want,
+			`<h1>History of <a href="../renamed.html">A <em>first</em> post</a></h1>`,
+			"4 revisions, from",
+			`<time datetime="2020-03-04T10:00:00-05:00">March 4, 2020</time>`,
+			"<td>Say &lt;why&gt; &amp; how</td>",
+		)
+		contains(t, "history/renamed.html", want...)
+	})
+
+	// From here on, each subtest changes something and sees what that
+	// rebuilds.
+	t.Run("nothing changed, so nothing is rebuilt", func(t *testing.T) {
+		rebuilds(t, posts)
+	})
+	t.Run("an uncommitted edit rebuilds the post but not its history", func(t *testing.T) {
+		writeFile(t, "other.md", "# Other\n\nHi again.\n")
+		rebuilds(t, posts, "post other.md", "other.md changed")
+	})
+	t.Run("committing it rebuilds both", func(t *testing.T) {
+		// Just other.md, so that new.md stays uncommitted.
+		if _, err := scriptGit(dir, "2023-01-01T10:00:00Z", "commit", "-q", "-m", "Say hi again", "other.md").Run(); err != nil {
+			t.Fatal(err)
+		}
+		rebuilds(t, posts,
+			"history other.md", "the history of other.md changed",
+			"post other.md", "the history of other.md changed",
+		)
+		contains(t, "other.html", "last updated")
+	})
+	t.Run("a deleted page is rebuilt", func(t *testing.T) {
+		os.Remove(filepath.Join(s.out, "renamed.html"))
+		rebuilds(t, posts, "post renamed.md", "renamed.html is missing")
+	})
+	t.Run("a page edited by hand is rebuilt", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(s.out, "history", "renamed.html"), []byte("oops"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rebuilds(t, posts, "history renamed.md", "renamed.html was changed since it was built")
+	})
+	t.Run("changing -repo rebuilds the history pages", func(t *testing.T) {
+		s.repo = "https://example.com/moved"
+		rebuilds(t, posts,
+			"history other.md", "-repo changed",
+			"history renamed.md", "-repo changed",
+		)
+	})
+	t.Run("an image in a post is copied", func(t *testing.T) {
+		writeFile(t, "img/pic.png", "not really a png")
+		writeFile(t, "new.md", "# New\n\n![a pic](img/pic.png)\n")
+		rebuilds(t, posts,
+			"image img/pic.png", "hasn't been built",
+			"post new.md", "new.md changed",
+		)
+		contains(t, "img/pic.png", "not really a png")
+		writeFile(t, "img/pic.png", "a png")
+		rebuilds(t, posts, "image img/pic.png", "img/pic.png changed")
+		contains(t, "img/pic.png", "a png")
+	})
+	t.Run("an image outside the repo is an error", func(t *testing.T) {
+		writeFile(t, "new.md", "# New\n\n![a pic](../pic.png)\n")
+		defer writeFile(t, "new.md", "# New\n\n![a pic](img/pic.png)\n")
+		if _, err := s.build(posts, true); err == nil || !strings.Contains(err.Error(), "outside the repo") {
+			t.Errorf("got %v", err)
+		}
+	})
+	t.Run("a post that's gone has its pages removed", func(t *testing.T) {
+		rebuilds(t, []string{"renamed.md", "other.md"})
+		for _, name := range []string{"new.html", "img/pic.png"} {
+			if _, err := os.Stat(filepath.Join(s.out, name)); !os.IsNotExist(err) {
+				t.Errorf("%s is still there", name)
+			}
+		}
+	})
+	t.Run("peru imports wait for -peru", func(t *testing.T) {
+		writeFile(t, "peru.yaml", "imports:\n    talk: www/talk\n    talk|slides: www/slides\n\ngit module talk:\n    url: https://example.com/talk\n")
+		dirs, err := peruImports(filepath.Join(dir, "peru.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"www/talk", "www/slides"}; !slices.Equal(dirs, want) {
+			t.Errorf("imports %q, want %q", dirs, want)
+		}
+		rebuilds(t, []string{"renamed.md", "other.md"})
+	})
+	t.Run("-force rebuilds everything", func(t *testing.T) {
+		s.force = true
+		defer func() { s.force = false }()
+		rebuilds(t, []string{"renamed.md", "other.md"},
+			"history other.md", "-force",
+			"history renamed.md", "-force",
+			"post other.md", "-force",
+			"post renamed.md", "-force",
+		)
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"html/template"
+	"time"
+)
+
+var funcs = template.FuncMap{
+	"date":  func(t time.Time) string { return t.Format("January 2, 2006") },
+	"iso":   func(t time.Time) string { return t.Format(time.RFC3339) },
+	"short": func(hash string) string { return hash[:min(len(hash), 10)] },
+}
+
+// The style is copied from www/index.html, like the report's, plus what the
+// code blocks and the history table need. It goes in the head, where
+// htmlcheck wants it.
+const style = `<style>
+body {
+  /* https://jgthms.com/web-design-in-4-minutes */
+  margin: 0 auto;
+  max-width: 50em;
+  font-family: sans-serif;
+  line-height: 1.5;
+  padding: 4em 1em;
+  color: #555;
+}
+h1,
+h2,
+strong {
+  color: #333;
+}
+a {
+  color: #55f;
+  text-decoration: none;
+}
+pre {
+  background: #f6f6f6;
+  padding: 0.8em;
+  overflow-x: auto;
+}
+.dates {
+  font-size: 0.9em;
+  color: #666;
+}
+table {
+  border-collapse: collapse;
+  margin: 1em 0;
+}
+th,
+td {
+  padding: 0.2em 0.8em;
+  border-bottom: 1px solid #ddd;
+  vertical-align: top;
+}
+th {
+  color: #333;
+  text-align: left;
+}
+</style>
+`
+
+var (
+	postPage    = template.Must(template.New("post").Funcs(funcs).Parse(postSource))
+	historyPage = template.Must(template.New("history").Funcs(funcs).Parse(historySource))
+)
+
+// The templates' sources are inputs in the graph, so that changing one
+// rebuilds the pages made from it.
+const postSource = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+{{- with .History}}
+<meta property="article:published_time" content="{{iso $.Published}}">
+<meta property="article:modified_time" content="{{iso $.Updated}}">
+{{- end}}
+` + style + `</head>
+<body>
+
+<h1>{{.TitleHTML}}</h1>
+
+{{with .History -}}
+<p class="dates">
+Published <time datetime="{{iso $.Published}}">{{date $.Published}}</time>
+{{- if $.Edited}}, last updated <time datetime="{{iso $.Updated}}">{{date $.Updated}}</time>{{end}}
+(<a href="history/{{$.Slug}}.html">history</a>)
+</p>
+{{- end}}
+
+{{.Body}}
+</body>
+</html>
+`
+
+const historySource = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>History of {{.Title}}</title>
+` + style + `</head>
+<body>
+
+<h1>History of <a href="../{{.Slug}}.html">{{.TitleHTML}}</a></h1>
+
+<p>
+{{len .History}} revision{{if ne (len .History) 1}}s{{end}}, from
+<time datetime="{{iso .Published}}">{{date .Published}}</time> to
+<time datetime="{{iso .Updated}}">{{date .Updated}}</time>.
+Each commit links to the whole change, and each file to the post as it was
+then.
+</p>
+
+<table>
+<tr><th>date</th><th>commit</th><th>file</th><th>change</th><th>author</th></tr>
+{{- range .History}}
+<tr>
+<td><time datetime="{{iso .Date}}">{{date .Date}}</time></td>
+<td><a href="{{$.Repo}}/commit/{{.Hash}}"><code>{{short .Hash}}</code></a></td>
+<td><a href="{{$.Repo}}/blob/{{.Hash}}/{{.Path}}">{{.Path}}</a></td>
+<td>{{.Subject}}</td>
+<td>{{.Author}}</td>
+</tr>
+{{- end}}
+</table>
+
+</body>
+</html>
+`
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type client struct {
+	base   string
+	secret []byte
+}
+
+// do sends a signed request. body has to be seekable, or at least
+// re-readable by the caller, since the hash has to be known up front.
+func (c *client) do(method, path string, body io.Reader, bodyHash string, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.base, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(timeHeader, timestamp)
+	req.Header.Set(bodyHashHeader, bodyHash)
+	req.Header.Set(signatureHeader, signature(c.secret, method, req.URL.Path, timestamp, bodyHash))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		text, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(text)))
+	}
+	return resp, nil
+}
+
+// call sends in as JSON and decodes the response into out.
+func (c *client) call(method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	sum := sha256.Sum256(body)
+	resp, err := c.do(method, path, bytes.NewReader(body), hex.EncodeToString(sum[:]), int64(len(body)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *client) upload(path string, e entry) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	resp, err := c.do("PUT", "/objects/"+e.Hash, f, e.Hash, e.Size)
+	if err != nil {
+		return fmt.Errorf("uploading %s: %w", path, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// push syncs the tree at dir to the server: it compares manifests, uploads
+// whatever the server doesn't have, and then activates the new manifest.
+// With dryRun it stops after printing the comparison.
+func (c *client) push(dir string, dryRun bool, jobs int) error {
+	local, err := scan(dir)
+	if err != nil {
+		return err
+	}
+	var remote manifest
+	if err := c.call("GET", "/manifest", nil, &remote); err != nil {
+		return err
+	}
+	changes := diff(remote, local)
+	printChanges(os.Stdout, remote, changes)
+	if dryRun || len(changes) == 0 {
+		return nil
+	}
+
+	// The server might have more than the live manifest, like objects from
+	// older releases, or from a push that died halfway.
+	var missing []string
+	if err := c.call("POST", "/missing", local.hashes(), &missing); err != nil {
+		return err
+	}
+	// Any path with the right contents will do for uploading a hash.
+	pathFor := make(map[string]string)
+	for p, e := range local {
+		pathFor[e.Hash] = p
+	}
+	work := make(chan string)
+	errs := make(chan error, len(missing))
+	var wg sync.WaitGroup
+	for range max(jobs, 1) {
+		wg.Go(func() {
+			for hash := range work {
+				p, ok := pathFor[hash]
+				if !ok {
+					errs <- fmt.Errorf("the server asked for %s, which isn't in %s", hash, dir)
+					continue
+				}
+				errs <- c.upload(filepath.Join(dir, filepath.FromSlash(p)), local[p])
+			}
+		})
+	}
+	for _, hash := range missing {
+		work <- hash
+	}
+	close(work)
+	wg.Wait()
+	close(errs)
+	failed := 0
+	for err := range errs {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed, so nothing changed on the server", failed, len(missing))
+	}
+	fmt.Printf("uploaded %d files\n", len(missing))
+
+	var result struct{ Release string }
+	if err := c.call("POST", "/activate", local, &result); err != nil {
+		return err
+	}
+	fmt.Printf("release %s is live\n", result.Release)
+	return nil
+}
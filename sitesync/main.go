@@ -0,0 +1,107 @@
+package main
+
+// sitesync deploys a built site by content hash, instead of running git pull
+// on the server, which never knew what to do with generated files or peru
+// imports. The client hashes every file in www/, compares that with the
+// manifest of the live release, and uploads only the files the server
+// doesn't have. Renamed files cost nothing, since the server stores files by
+// hash. When every upload has been checked against its hash, the server
+// builds the new release out of hard links and swaps it in all at once.
+//
+//     go run ./sitesync serve -root /srv/jacko.io/sync -secret-file /etc/sitesync.secret
+//     go run ./sitesync push -server https://jacko.io/sync --dry-run www
+//     go run ./sitesync push -server https://jacko.io/sync www
+//
+// nginx's root should be ROOT/current. Both sides read the shared secret
+// from -secret-file, or from $SITESYNC_SECRET.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func readSecret(path string) ([]byte, error) {
+	secret := os.Getenv("SITESYNC_SECRET")
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	if secret == "" {
+		return nil, errors.New("no secret: use -secret-file or $SITESYNC_SECRET")
+	}
+	return []byte(secret), nil
+}
+
+func cmdServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	root := fs.String("root", "", "where objects and releases live (required)")
+	addr := fs.String("addr", "localhost:8041", "where to listen")
+	secretFile := fs.String("secret-file", "", "the file with the shared secret")
+	keep := fs.Int("keep", 5, "how many releases to keep")
+	fs.Parse(args)
+	if *root == "" {
+		return errors.New("-root is required")
+	}
+	secret, err := readSecret(*secretFile)
+	if err != nil {
+		return err
+	}
+	s := &store{root: *root, secret: secret, keep: *keep}
+	fmt.Fprintf(os.Stderr, "listening on %s\n", *addr)
+	return http.ListenAndServe(*addr, s.handler())
+}
+
+func cmdPush(args []string) error {
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	server := fs.String("server", "", "the sitesync server's URL (required)")
+	secretFile := fs.String("secret-file", "", "the file with the shared secret")
+	dryRun := fs.Bool("dry-run", false, "print what would change, without uploading anything")
+	jobs := fs.Int("j", 4, "how many files to upload at once")
+	fs.Parse(args)
+	if *server == "" {
+		return errors.New("-server is required")
+	}
+	dir := "www"
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	secret, err := readSecret(*secretFile)
+	if err != nil {
+		return err
+	}
+	c := &client{base: *server, secret: secret}
+	return c.push(dir, *dryRun, *jobs)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sitesync serve [flags] | push [flags] [DIR]")
+		fmt.Fprintln(os.Stderr, "run `sitesync serve -h` or `sitesync push -h` for the flags")
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch flag.Arg(0) {
+	case "serve":
+		err = cmdServe(flag.Args()[1:])
+	case "push":
+		err = cmdPush(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
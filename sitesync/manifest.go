@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A manifest maps every file in a tree, by slash-separated relative path,
+// to its SHA-256 and size. Two trees with the same manifest have the same
+// contents, and the server stores files by hash, so a manifest plus the
+// objects it names is a whole release.
+type manifest map[string]entry
+
+type entry struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// scan hashes every file under root. Symlinks and other special files are
+// errors, since there'd be no good way to recreate them on the server.
+func scan(root string) (manifest, error) {
+	m := make(manifest)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s isn't a regular file", path)
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		hash, size, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		m[filepath.ToSlash(rel)] = entry{hash, size}
+		return nil
+	})
+	return m, err
+}
+
+// validPath rejects anything that could escape the release directory.
+func validPath(p string) bool {
+	return fs.ValidPath(p) && p != "." && !strings.Contains(p, `\`)
+}
+
+func validHash(h string) bool {
+	if len(h) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(h)
+	return err == nil && strings.ToLower(h) == h
+}
+
+func (m manifest) validate() error {
+	for p, e := range m {
+		if !validPath(p) {
+			return fmt.Errorf("bad path %q", p)
+		}
+		if !validHash(e.Hash) || e.Size < 0 {
+			return fmt.Errorf("bad entry for %s", p)
+		}
+	}
+	return nil
+}
+
+// hashes returns the distinct hashes in m, sorted.
+func (m manifest) hashes() []string {
+	var hs []string
+	for _, e := range m {
+		hs = append(hs, e.Hash)
+	}
+	slices.Sort(hs)
+	return slices.Compact(hs)
+}
+
+type change struct {
+	kind    string // added, changed, renamed, or removed
+	path    string
+	from    string // the old path, for renames
+	size    int64
+	oldSize int64
+	hash    string
+}
+
+// diff lists what it takes to turn old into new. A file that disappears from
+// one path and appears with the same contents at another is a rename, which
+// costs nothing to upload.
+func diff(old, new manifest) []change {
+	var added, removed []change
+	var changes []change
+	for p, e := range new {
+		o, ok := old[p]
+		switch {
+		case !ok:
+			added = append(added, change{kind: "added", path: p, size: e.Size, hash: e.Hash})
+		case o.Hash != e.Hash:
+			changes = append(changes, change{kind: "changed", path: p, size: e.Size, oldSize: o.Size, hash: e.Hash})
+		}
+	}
+	for p, o := range old {
+		if _, ok := new[p]; !ok {
+			removed = append(removed, change{kind: "removed", path: p, oldSize: o.Size, hash: o.Hash})
+		}
+	}
+	// Pair them up in path order, so the same trees always give the same
+	// renames.
+	byPath := func(a, b change) int { return strings.Compare(a.path, b.path) }
+	slices.SortFunc(added, byPath)
+	slices.SortFunc(removed, byPath)
+	for _, a := range added {
+		i := slices.IndexFunc(removed, func(r change) bool { return r.hash == a.hash })
+		if i < 0 {
+			changes = append(changes, a)
+			continue
+		}
+		a.kind, a.from, a.oldSize = "renamed", removed[i].path, removed[i].oldSize
+		changes = append(changes, a)
+		removed = slices.Delete(removed, i, i+1)
+	}
+	changes = append(changes, removed...)
+	slices.SortFunc(changes, byPath)
+	return changes
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
+
+// printChanges prints a line per change and a summary of what would need
+// uploading, which is every new hash the old tree doesn't already have.
+func printChanges(w io.Writer, old manifest, changes []change) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+	have := make(map[string]bool)
+	for _, e := range old {
+		have[e.Hash] = true
+	}
+	var uploads, uploadBytes int64
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.kind]++
+		size, what := formatSize(c.size), c.path
+		switch c.kind {
+		case "changed":
+			what += " (was " + formatSize(c.oldSize) + ")"
+		case "renamed":
+			what = c.from + " -> " + c.path
+		case "removed":
+			size = formatSize(c.oldSize)
+		}
+		fmt.Fprintf(w, "%-8s %10s  %s\n", c.kind, size, what)
+		if (c.kind == "added" || c.kind == "changed") && !have[c.hash] {
+			have[c.hash] = true
+			uploads++
+			uploadBytes += c.size
+		}
+	}
+	fmt.Fprintf(w, "%d added, %d changed, %d renamed, %d removed; %d files (%s) to upload\n",
+		counts["added"], counts["changed"], counts["renamed"], counts["removed"], uploads, formatSize(uploadBytes))
+}
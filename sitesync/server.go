@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every request is signed with HMAC-SHA256 over the method, the path, the
+// time, and the SHA-256 of the body, which the client sends in its own
+// header. The server checks the signature before it reads the body, and the
+// body against the hash after. The time keeps old requests from being
+// replayed later, which matters here, because replaying an old activation
+// would roll the site back.
+const (
+	timeHeader      = "X-Sitesync-Time"
+	bodyHashHeader  = "X-Sitesync-Content-Sha256"
+	signatureHeader = "X-Sitesync-Signature"
+	maxSkew         = 5 * time.Minute
+	maxManifest     = 64 << 20
+)
+
+func signature(secret []byte, method, path, timestamp, bodyHash string) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", method, path, timestamp, bodyHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// A store is the server's side: every object ever uploaded and not yet
+// garbage collected, by hash, and a directory per release built out of them.
+//
+//	ROOT/objects/ab/cdef...   uploaded files, named by SHA-256
+//	ROOT/releases/NAME/       a release, hard linked from objects
+//	ROOT/releases/NAME.json   its manifest
+//	ROOT/current              a symlink to the live release, for nginx
+type store struct {
+	root   string
+	secret []byte
+	keep   int
+	// mu serializes activations, and keeps garbage collection from
+	// running in the middle of one.
+	mu sync.Mutex
+}
+
+func (s *store) objectPath(hash string) string {
+	return filepath.Join(s.root, "objects", hash[:2], hash[2:])
+}
+
+func (s *store) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /manifest", s.getManifest)
+	mux.HandleFunc("POST /missing", s.missing)
+	mux.HandleFunc("PUT /objects/{hash}", s.putObject)
+	mux.HandleFunc("POST /activate", s.activate)
+	return s.authenticate(mux)
+}
+
+func (s *store) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestamp := r.Header.Get(timeHeader)
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(seconds, 0)).Abs() > maxSkew {
+			http.Error(w, "missing or stale "+timeHeader, http.StatusUnauthorized)
+			return
+		}
+		bodyHash := r.Header.Get(bodyHashHeader)
+		want := signature(s.secret, r.Method, r.URL.Path, timestamp, bodyHash)
+		if !validHash(bodyHash) || !hmac.Equal([]byte(r.Header.Get(signatureHeader)), []byte(want)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readBody reads a small body and checks it against the signed hash.
+func readBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxManifest))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != r.Header.Get(bodyHashHeader) {
+		http.Error(w, "the body doesn't match its hash", http.StatusBadRequest)
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// current returns the name of the live release and its manifest. Before the
+// first activation, that's an empty manifest.
+func (s *store) current() (string, manifest, error) {
+	name, err := os.Readlink(filepath.Join(s.root, "current"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", manifest{}, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	name = filepath.Base(name)
+	data, err := os.ReadFile(filepath.Join(s.root, "releases", name+".json"))
+	if err != nil {
+		return "", nil, err
+	}
+	var m manifest
+	return name, m, json.Unmarshal(data, &m)
+}
+
+func (s *store) getManifest(w http.ResponseWriter, r *http.Request) {
+	_, m, err := s.current()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, m)
+}
+
+// missing takes a list of hashes and returns the ones we don't have.
+func (s *store) missing(w http.ResponseWriter, r *http.Request) {
+	var hashes []string
+	if !readBody(w, r, &hashes) {
+		return
+	}
+	missing := []string{}
+	for _, h := range hashes {
+		if !validHash(h) {
+			http.Error(w, "bad hash "+h, http.StatusBadRequest)
+			return
+		}
+		if _, err := os.Stat(s.objectPath(h)); err != nil {
+			missing = append(missing, h)
+		}
+	}
+	writeJSON(w, missing)
+}
+
+// putObject stores one file. It goes to a temporary file first, and only
+// gets its real name if its contents hash to that name.
+func (s *store) putObject(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	if !validHash(hash) || hash != r.Header.Get(bodyHashHeader) {
+		http.Error(w, "bad hash", http.StatusBadRequest)
+		return
+	}
+	final := s.objectPath(hash)
+	if err := os.MkdirAll(filepath.Dir(final), 0o755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(final), ".upload-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		http.Error(w, "the upload doesn't match its hash", http.StatusBadRequest)
+		return
+	}
+	// Objects are shared between releases through hard links, so they're
+	// read-only for everyone.
+	if err := os.Chmod(tmp.Name(), 0o444); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmp.Name(), final); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// activate builds a release from a manifest and makes it live. Every object
+// has to be there already, with the right size, or nothing changes.
+func (s *store) activate(w http.ResponseWriter, r *http.Request) {
+	var m manifest
+	if !readBody(w, r, &m) {
+		return
+	}
+	if err := m.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var problems []string
+	for p, e := range m {
+		info, err := os.Stat(s.objectPath(e.Hash))
+		if err != nil {
+			problems = append(problems, p+": never uploaded")
+		} else if info.Size() != e.Size {
+			problems = append(problems, fmt.Sprintf("%s: %d bytes, not %d", p, info.Size(), e.Size))
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		http.Error(w, "can't activate:\n"+strings.Join(problems, "\n"), http.StatusConflict)
+		return
+	}
+	name, err := s.build(m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.prune(name)
+	writeJSON(w, map[string]string{"release": name})
+}
+
+func (s *store) build(m manifest) (string, error) {
+	releases := filepath.Join(s.root, "releases")
+	// Names only go down to the millisecond, so a second activation in the
+	// same one waits for the next, rather than writing over the first.
+	var name string
+	for {
+		name = time.Now().UTC().Format("20060102T150405.000Z")
+		if _, err := os.Lstat(filepath.Join(releases, name+".json")); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	dir := filepath.Join(releases, name)
+	tmpDir := filepath.Join(releases, "."+name)
+	// After the rename below there's nothing left here to remove, so this
+	// only cleans up after errors.
+	defer os.RemoveAll(tmpDir)
+	for p, e := range m {
+		target := filepath.Join(tmpDir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.Link(s.objectPath(e.Hash), target); err != nil {
+			return "", err
+		}
+	}
+	// An empty site is still a release.
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dir+".json", data, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		os.Remove(dir + ".json")
+		return "", err
+	}
+	// Renaming a new symlink over the old one is atomic, so nginx sees
+	// either the old release or the new one.
+	link := filepath.Join(s.root, "current")
+	os.Remove(link + ".tmp")
+	if err := os.Symlink(filepath.Join("releases", name), link+".tmp"); err != nil {
+		return "", err
+	}
+	return name, os.Rename(link+".tmp", link)
+}
+
+// prune deletes all but the newest releases, and then every object that the
+// remaining manifests don't mention. Objects from the last hour are spared,
+// since they might belong to a push that hasn't activated yet. Errors are
+// only logged, because the activation already worked.
+func (s *store) prune(live string) {
+	releases := filepath.Join(s.root, "releases")
+	matches, err := filepath.Glob(filepath.Join(releases, "*.json"))
+	if err != nil {
+		return
+	}
+	slices.Sort(matches)
+	for len(matches) > max(s.keep, 1) {
+		name := strings.TrimSuffix(filepath.Base(matches[0]), ".json")
+		if name != live {
+			os.RemoveAll(filepath.Join(releases, name))
+			os.Remove(matches[0])
+		}
+		matches = matches[1:]
+	}
+	used := make(map[string]bool)
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		var m manifest
+		if err == nil {
+			err = json.Unmarshal(data, &m)
+		}
+		if err != nil {
+			// Better to keep garbage than to delete something live.
+			fmt.Fprintln(os.Stderr, "sitesync: not collecting garbage:", err)
+			return
+		}
+		for _, h := range m.hashes() {
+			used[h] = true
+		}
+	}
+	objects := filepath.Join(s.root, "objects")
+	filepath.WalkDir(objects, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(objects, path)
+		hash := strings.ReplaceAll(filepath.ToSlash(rel), "/", "")
+		info, err := d.Info()
+		if err == nil && !used[hash] && time.Since(info.ModTime()) > time.Hour {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
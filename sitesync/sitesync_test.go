@@ -0,0 +1,445 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var secret = []byte("test secret")
+
+// A testServer is a store behind an httptest.Server. It counts uploads, and
+// it can be told to fail the upload of one hash, like a connection dying
+// halfway through a push.
+type testServer struct {
+	*httptest.Server
+	root string
+
+	mu      sync.Mutex
+	puts    int
+	failPut string
+}
+
+func newServer(t *testing.T) *testServer {
+	s := &testServer{root: t.TempDir()}
+	st := &store{root: s.root, secret: secret, keep: 5}
+	next := st.handler()
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			s.mu.Lock()
+			s.puts++
+			fail := s.failPut != "" && strings.HasSuffix(r.URL.Path, s.failPut)
+			s.mu.Unlock()
+			if fail {
+				http.Error(w, "connection reset, pretend", http.StatusBadGateway)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) client() *client {
+	return &client{base: s.URL, secret: secret}
+}
+
+// uploads returns how many PUTs there have been since the last call.
+func (s *testServer) uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.puts
+	s.puts = 0
+	return n
+}
+
+func (s *testServer) currentLink(t *testing.T) string {
+	t.Helper()
+	link, err := os.Readlink(filepath.Join(s.root, "current"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return link
+}
+
+// live reads every file in the live release.
+func (s *testServer) live(t *testing.T) map[string]string {
+	t.Helper()
+	// WalkDir doesn't follow a symlink at the top.
+	dir, err := filepath.EvalSymlinks(filepath.Join(s.root, "current"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readTree(t, dir)
+}
+
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// writeTree replaces everything in dir with files.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sameFiles(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+func hashOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// send makes a request with whatever headers the test wants, signed or not.
+func send(t *testing.T, method, url string, body string, headers map[string]string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	text, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(text)
+}
+
+// signed returns the headers for a request signed with key at time when.
+func signed(key []byte, method, path string, when time.Time, bodyHash string) map[string]string {
+	timestamp := strconv.FormatInt(when.Unix(), 10)
+	return map[string]string{
+		timeHeader:      timestamp,
+		bodyHashHeader:  bodyHash,
+		signatureHeader: signature(key, method, path, timestamp, bodyHash),
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	s := newServer(t)
+	empty := hashOf("")
+	now := time.Now()
+	withSignature := func(sig string) map[string]string {
+		h := signed(secret, "GET", "/manifest", now, empty)
+		h[signatureHeader] = sig
+		return h
+	}
+	for _, c := range []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"good", "GET", "/manifest", signed(secret, "GET", "/manifest", now, empty), http.StatusOK},
+		{"unsigned", "GET", "/manifest", nil, http.StatusUnauthorized},
+		{"no signature", "GET", "/manifest", withSignature(""), http.StatusUnauthorized},
+		{"garbage signature", "GET", "/manifest", withSignature("00ff"), http.StatusUnauthorized},
+		{"wrong secret", "GET", "/manifest", signed([]byte("not the secret"), "GET", "/manifest", now, empty), http.StatusUnauthorized},
+		{"signed for another path", "POST", "/activate", signed(secret, "POST", "/missing", now, empty), http.StatusUnauthorized},
+		{"signed for another method", "POST", "/manifest", signed(secret, "GET", "/manifest", now, empty), http.StatusUnauthorized},
+		{"too old", "GET", "/manifest", signed(secret, "GET", "/manifest", now.Add(-time.Hour), empty), http.StatusUnauthorized},
+		{"from the future", "GET", "/manifest", signed(secret, "GET", "/manifest", now.Add(time.Hour), empty), http.StatusUnauthorized},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if got, text := send(t, c.method, s.URL+c.path, "", c.headers); got != c.want {
+				t.Errorf("got %d (%s), want %d", got, strings.TrimSpace(text), c.want)
+			}
+		})
+	}
+
+	t.Run("a push with the wrong secret", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTree(t, dir, map[string]string{"index.html": "hi"})
+		c := &client{base: s.URL, secret: []byte("not the secret")}
+		if err := c.push(dir, false, 1); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("got %v, want a 401", err)
+		}
+		if link := s.currentLink(t); link != "" {
+			t.Errorf("the push went live anyway, as %s", link)
+		}
+	})
+}
+
+func TestHashMismatch(t *testing.T) {
+	s := newServer(t)
+	contents := "the real contents"
+	hash := hashOf(contents)
+	object := filepath.Join(s.root, "objects", hash[:2], hash[2:])
+
+	t.Run("an upload that doesn't hash to its name", func(t *testing.T) {
+		path := "/objects/" + hash
+		code, text := send(t, "PUT", s.URL+path, "something else", signed(secret, "PUT", path, time.Now(), hash))
+		if code != http.StatusBadRequest {
+			t.Errorf("got %d (%s), want %d", code, strings.TrimSpace(text), http.StatusBadRequest)
+		}
+		if _, err := os.Stat(object); !os.IsNotExist(err) {
+			t.Errorf("the bad upload got stored anyway: %v", err)
+		}
+		leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(object), ".upload-*"))
+		if len(leftovers) > 0 {
+			t.Errorf("left behind %v", leftovers)
+		}
+	})
+
+	t.Run("an upload signed for a different hash", func(t *testing.T) {
+		path := "/objects/" + hash
+		other := hashOf(contents + "!")
+		code, _ := send(t, "PUT", s.URL+path, contents, signed(secret, "PUT", path, time.Now(), other))
+		if code != http.StatusBadRequest {
+			t.Errorf("got %d, want %d", code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("a JSON body that doesn't match its hash", func(t *testing.T) {
+		signedBody := `["` + hash + `"]`
+		code, _ := send(t, "POST", s.URL+"/missing", `["`+hashOf("x")+`"]`, signed(secret, "POST", "/missing", time.Now(), hashOf(signedBody)))
+		if code != http.StatusBadRequest {
+			t.Errorf("got %d, want %d", code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("the right contents", func(t *testing.T) {
+		path := "/objects/" + hash
+		code, _ := send(t, "PUT", s.URL+path, contents, signed(secret, "PUT", path, time.Now(), hash))
+		if code != http.StatusCreated {
+			t.Errorf("got %d, want %d", code, http.StatusCreated)
+		}
+		if data, err := os.ReadFile(object); err != nil || string(data) != contents {
+			t.Errorf("stored %q, %v", data, err)
+		}
+	})
+}
+
+func TestPush(t *testing.T) {
+	s := newServer(t)
+	c := s.client()
+	dir := filepath.Join(t.TempDir(), "www")
+
+	// Each step pushes a tree, and checks how many files that uploaded.
+	for _, step := range []struct {
+		name    string
+		files   map[string]string
+		uploads int
+	}{
+		{"the first push uploads everything once", map[string]string{
+			"index.html":      "<h1>hi</h1>",
+			"style.css":       "h1 { color: red }",
+			"copy/index.html": "<h1>hi</h1>",
+			"empty.txt":       "",
+		}, 3},
+		{"the second uploads only what changed", map[string]string{
+			"index.html":      "<h1>hello</h1>",    // changed
+			"css/style.css":   "h1 { color: red }", // renamed
+			"copy/index.html": "<h1>hi</h1>",
+			"new.js":          "alert(1)", // added
+			// empty.txt removed
+		}, 2},
+		{"content the server already has costs nothing", map[string]string{
+			"index.html":    "<h1>hello</h1>",
+			"css/style.css": "h1 { color: red }",
+			"old.html":      "<h1>hi</h1>",
+			"also.html":     "<h1>hi</h1>",
+		}, 0},
+		{"no changes", map[string]string{
+			"index.html":    "<h1>hello</h1>",
+			"css/style.css": "h1 { color: red }",
+			"old.html":      "<h1>hi</h1>",
+			"also.html":     "<h1>hi</h1>",
+		}, 0},
+	} {
+		t.Run(step.name, func(t *testing.T) {
+			writeTree(t, dir, step.files)
+			if err := c.push(dir, false, 2); err != nil {
+				t.Fatal(err)
+			}
+			if n := s.uploads(); n != step.uploads {
+				t.Errorf("uploaded %d files, want %d", n, step.uploads)
+			}
+			if live := s.live(t); !sameFiles(live, step.files) {
+				t.Errorf("live site is %v, want %v", live, step.files)
+			}
+		})
+	}
+
+	t.Run("a dry run changes nothing", func(t *testing.T) {
+		before := s.currentLink(t)
+		writeTree(t, dir, map[string]string{"index.html": "dry"})
+		if err := c.push(dir, true, 2); err != nil {
+			t.Fatal(err)
+		}
+		if n := s.uploads(); n != 0 {
+			t.Errorf("uploaded %d files", n)
+		}
+		if after := s.currentLink(t); after != before {
+			t.Errorf("the live release went from %s to %s", before, after)
+		}
+	})
+}
+
+func TestPartialUploadNeverActivates(t *testing.T) {
+	s := newServer(t)
+	c := s.client()
+	dir := filepath.Join(t.TempDir(), "www")
+	v1 := map[string]string{"index.html": "v1"}
+	writeTree(t, dir, v1)
+	if err := c.push(dir, false, 1); err != nil {
+		t.Fatal(err)
+	}
+	s.uploads()
+	before := s.currentLink(t)
+
+	v2 := map[string]string{"index.html": "v2", "extra.html": "more"}
+	writeTree(t, dir, v2)
+	t.Run("a failed upload", func(t *testing.T) {
+		s.mu.Lock()
+		s.failPut = hashOf("more")
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.failPut = ""
+			s.mu.Unlock()
+		}()
+		if err := c.push(dir, false, 1); err == nil {
+			t.Fatal("the push worked")
+		}
+		if after := s.currentLink(t); after != before {
+			t.Errorf("the live release went from %s to %s", before, after)
+		}
+		if live := s.live(t); !sameFiles(live, v1) {
+			t.Errorf("live site is %v, want %v", live, v1)
+		}
+	})
+
+	t.Run("activating objects that were never uploaded", func(t *testing.T) {
+		local, err := scan(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		local["ghost.html"] = entry{hashOf("never uploaded"), 14}
+		var result struct{ Release string }
+		err = c.call("POST", "/activate", local, &result)
+		if err == nil || !strings.Contains(err.Error(), "ghost.html: never uploaded") {
+			t.Errorf("got %v, want a complaint about ghost.html", err)
+		}
+		if after := s.currentLink(t); after != before {
+			t.Errorf("the live release went from %s to %s", before, after)
+		}
+	})
+
+	t.Run("activating with the wrong size", func(t *testing.T) {
+		local, err := scan(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := local["index.html"]
+		e.Size++
+		local["index.html"] = e
+		var result struct{ Release string }
+		if err := c.call("POST", "/activate", local, &result); err == nil {
+			t.Error("activated anyway")
+		}
+		if after := s.currentLink(t); after != before {
+			t.Errorf("the live release went from %s to %s", before, after)
+		}
+	})
+
+	t.Run("the retry uploads only what's still missing", func(t *testing.T) {
+		s.uploads()
+		if err := c.push(dir, false, 1); err != nil {
+			t.Fatal(err)
+		}
+		if n := s.uploads(); n != 1 {
+			t.Errorf("uploaded %d files, want 1", n)
+		}
+		if live := s.live(t); !sameFiles(live, v2) {
+			t.Errorf("live site is %v, want %v", live, v2)
+		}
+	})
+}
+
+// A manifest with both a and a/b can't be built. That has to fail without
+// leaving the half-built release behind.
+func TestBuildFailureCleansUp(t *testing.T) {
+	s := newServer(t)
+	c := s.client()
+	dir := filepath.Join(t.TempDir(), "www")
+	writeTree(t, dir, map[string]string{"a": "file"})
+	if err := c.push(dir, false, 1); err != nil {
+		t.Fatal(err)
+	}
+	before := s.currentLink(t)
+	e := entry{hashOf("file"), 4}
+	var result struct{ Release string }
+	for _, m := range []manifest{{"a": e, "a/b": e}, {"a/b": e, "a/b/c": e}} {
+		if err := c.call("POST", "/activate", m, &result); err == nil {
+			t.Errorf("activated %v", m)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(s.root, "releases"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 2 {
+		t.Errorf("releases has %v, want just the first release and its manifest", names)
+	}
+	if after := s.currentLink(t); after != before {
+		t.Errorf("the live release went from %s to %s", before, after)
+	}
+}
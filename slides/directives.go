@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/oconnor663/jacko.io/internal/harnessbin"
+)
+
+// A directive is a line in the outline that starts with "!". It gets
+// replaced by the output of running something when the deck is built:
+//
+//	!harness -mode plain,atomicfields -duration 1s
+//	    runs the harness and shows its table
+//	!chart -mode all -duration 500ms
+//	    runs the harness and draws tears/sec as a bar chart
+//	!run go run not_atomic.go
+//	    runs any command and shows its output
+//
+// Arguments are split on whitespace. There's no quoting.
+type runner struct {
+	harnessDir string
+	timeout    time.Duration
+	harnessBin string
+	cleanup    func()
+}
+
+func (r *runner) close() {
+	if r.cleanup != nil {
+		r.cleanup()
+	}
+}
+
+// harness builds the harness the first time a directive needs it.
+func (r *runner) harness() (string, error) {
+	if r.harnessBin != "" {
+		return r.harnessBin, nil
+	}
+	bin, cleanup, err := harnessbin.Build(r.harnessDir)
+	if err != nil {
+		return "", err
+	}
+	r.harnessBin, r.cleanup = bin, cleanup
+	return bin, nil
+}
+
+// capture runs a command with a timeout. not_atomic.go itself runs until it
+// sees a torn read, which might be never, so hitting the timeout isn't an
+// error. It just goes in the output.
+func (r *runner) capture(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	killWholeGroup(cmd)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		fmt.Fprintf(&out, "(still running after %s)\n", r.timeout)
+		return out.String(), nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		fmt.Fprintf(&out, "(exit status %d)\n", exitErr.ExitCode())
+		return out.String(), nil
+	}
+	return out.String(), err
+}
+
+func (r *runner) expand(line string) (string, error) {
+	fields := strings.Fields(strings.TrimPrefix(line, "!"))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty directive")
+	}
+	name, args := fields[0], fields[1:]
+	fmt.Fprintf(os.Stderr, "running %s\n", line)
+	switch name {
+	case "run":
+		if len(args) == 0 {
+			return "", fmt.Errorf("!run needs a command")
+		}
+		out, err := r.capture(args[0], args[1:]...)
+		return `<pre class="output">` + html.EscapeString(out) + `</pre>`, err
+	case "harness":
+		bin, err := r.harness()
+		if err != nil {
+			return "", err
+		}
+		out, err := r.capture(bin, args...)
+		return `<pre class="output">` + html.EscapeString(out) + `</pre>`, err
+	case "chart":
+		bin, err := r.harness()
+		if err != nil {
+			return "", err
+		}
+		out, err := r.capture(bin, append(args, "-json")...)
+		if err != nil {
+			return "", err
+		}
+		return chart(out)
+	}
+	return "", fmt.Errorf("unknown directive %q", name)
+}
+
+// chart draws the harness's tears/sec for each strategy, on a log scale.
+func chart(jsonLines string) (string, error) {
+	type result struct {
+		Mode        string  `json:"mode"`
+		Broken      bool    `json:"broken"`
+		TearsPerSec float64 `json:"tears_per_sec"`
+	}
+	var results []result
+	for _, line := range strings.Split(strings.TrimSpace(jsonLines), "\n") {
+		var res result
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			// Probably a message from the harness, like a correct strategy
+			// tearing. Keep going with the results we have.
+			continue
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("no results from the harness")
+	}
+	maxLog := 0.0
+	for _, res := range results {
+		maxLog = max(maxLog, math.Log10(1+res.TearsPerSec))
+	}
+	const rowHeight = 44
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1000 %d" class="chart">`, rowHeight*len(results)+10)
+	for i, res := range results {
+		y := i*rowHeight + 5
+		w := 0.0
+		if maxLog > 0 {
+			w = math.Log10(1+res.TearsPerSec) / maxLog * 600
+		}
+		color := "#9d9"
+		if res.Broken {
+			color = "#55f"
+		}
+		fmt.Fprintf(&b, `<text x="240" y="%d" text-anchor="end">%s</text>`, y+28, html.EscapeString(res.Mode))
+		fmt.Fprintf(&b, `<rect x="255" y="%d" width="%.1f" height="34" fill="%s"/>`, y+4, w, color)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d">%.0f/s</text>`, 265+w, y+28, res.TearsPerSec)
+	}
+	b.WriteString(`</svg>`)
+	return b.String(), nil
+}
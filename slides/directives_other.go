@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// Without process groups, the timeout only kills cmd itself, so a demo
+// started with `go run` can outlive it. Use a built binary in !run lines
+// there.
+func killWholeGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killWholeGroup runs cmd in its own process group, and kills the whole
+// group on timeout. Otherwise killing `go run not_atomic.go` would kill the
+// go command and leave the compiled demo spinning in the background forever.
+func killWholeGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+// slides turns a Markdown outline into a static HTML slide deck, running any
+// experiments in it along the way, so the numbers on the slides come from a
+// real run instead of being pasted in by hand. Slides are separated by lines
+// containing only "---". See directives.go for the "!" lines.
+//
+//     go run ./slides/*.go -o www/torn_reads talk.md
+//
+// The output directory has a single index.html with everything inlined, like
+// the decks that peru.yaml pulls into www/.
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func splitSlides(src string) []string {
+	var slides []string
+	var cur []string
+	for _, line := range strings.Split(src, "\n") {
+		if strings.TrimSpace(line) == "---" {
+			slides = append(slides, strings.Join(cur, "\n"))
+			cur = nil
+			continue
+		}
+		cur = append(cur, line)
+	}
+	slides = append(slides, strings.Join(cur, "\n"))
+	var nonEmpty []string
+	for _, s := range slides {
+		if strings.TrimSpace(s) != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	return nonEmpty
+}
+
+// renderSlide swaps each directive for a placeholder comment, renders the
+// Markdown, and then swaps the directive's output in, so that the output
+// doesn't get mangled as Markdown.
+func renderSlide(src string, r *runner) (string, error) {
+	var outputs []string
+	lines := strings.Split(src, "\n")
+	inFence := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if inFence || !strings.HasPrefix(trimmed, "!") {
+			continue
+		}
+		out, err := r.expand(trimmed)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", trimmed, err)
+		}
+		lines[i] = fmt.Sprintf("<!--directive %d-->", len(outputs))
+		outputs = append(outputs, out)
+	}
+	rendered := renderMarkdown(strings.Join(lines, "\n"))
+	for i, out := range outputs {
+		rendered = strings.Replace(rendered, fmt.Sprintf("<!--directive %d-->", i), out, 1)
+	}
+	return rendered, nil
+}
+
+func main() {
+	outDir := flag.String("o", "", "output directory (default: the outline's name without .md)")
+	harnessDir := flag.String("harness", "harness", "directory containing the harness source")
+	timeout := flag.Duration("timeout", 10*time.Second, "how long to let each directive run")
+	title := flag.String("title", "", "the page title (default: the first heading)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: slides [flags] OUTLINE.md")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	outline := flag.Arg(0)
+	if *outDir == "" {
+		*outDir = strings.TrimSuffix(outline, filepath.Ext(outline))
+	}
+	if err := build(outline, *outDir, *title, &runner{harnessDir: *harnessDir, timeout: *timeout}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func build(outline, outDir, title string, r *runner) error {
+	defer r.close()
+	src, err := os.ReadFile(outline)
+	if err != nil {
+		return err
+	}
+	var slides []string
+	for i, s := range splitSlides(string(src)) {
+		rendered, err := renderSlide(s, r)
+		if err != nil {
+			return fmt.Errorf("slide %d: %w", i+1, err)
+		}
+		slides = append(slides, rendered)
+		if title == "" {
+			for _, line := range strings.Split(s, "\n") {
+				if strings.HasPrefix(line, "#") {
+					title = strings.TrimSpace(strings.TrimLeft(line, "#"))
+					break
+				}
+			}
+		}
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+	var page strings.Builder
+	page.WriteString(strings.Replace(header, "{{title}}", html.EscapeString(title), 1))
+	for i, s := range slides {
+		fmt.Fprintf(&page, "<section id=\"%d\">\n%s</section>\n", i+1, s)
+	}
+	page.WriteString(footer)
+	return os.WriteFile(filepath.Join(outDir, "index.html"), []byte(page.String()), 0o644)
+}
+
+// One slide is shown at a time. Arrow keys, space and clicking move between
+// them, and the URL fragment keeps track of where you are, so reloading stays
+// on the same slide.
+const header = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{title}}</title>
+<style>
+body {
+  margin: 0;
+  font-family: sans-serif;
+  color: #555;
+  background: white;
+}
+h1,
+h2,
+strong {
+  color: #333;
+}
+a {
+  color: #55f;
+  text-decoration: none;
+}
+section {
+  display: none;
+  box-sizing: border-box;
+  width: 100vw;
+  height: 100vh;
+  padding: 5vh 8vw;
+  font-size: 3.2vh;
+  line-height: 1.5;
+  overflow: hidden;
+}
+section.current {
+  display: block;
+}
+pre {
+  background: #f4f4f4;
+  padding: 0.5em 1em;
+  font-size: 0.8em;
+  overflow: hidden;
+}
+pre.output {
+  background: #333;
+  color: #eee;
+}
+svg.chart {
+  width: 100%;
+  font-size: 24px;
+  fill: #555;
+}
+</style>
+</head>
+<body>
+`
+
+const footer = `<script>
+const slides = document.querySelectorAll("section");
+let current = 0;
+function show(n) {
+  current = Math.max(0, Math.min(slides.length - 1, n));
+  slides.forEach((s, i) => s.classList.toggle("current", i === current));
+  history.replaceState(null, "", "#" + (current + 1));
+}
+document.addEventListener("keydown", (e) => {
+  if (["ArrowRight", "ArrowDown", "PageDown", " "].includes(e.key)) show(current + 1);
+  if (["ArrowLeft", "ArrowUp", "PageUp"].includes(e.key)) show(current - 1);
+  if (e.key === "Home") show(0);
+  if (e.key === "End") show(slides.length - 1);
+});
+document.addEventListener("click", (e) => {
+  if (e.target.tagName !== "A") show(current + (e.clientX < window.innerWidth / 3 ? -1 : 1));
+});
+show((parseInt(location.hash.slice(1)) || 1) - 1);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// This is just enough Markdown for slides: headings, paragraphs, bullet
+// lists, fenced code blocks, and inline code, bold, italics and links.
+// Anything fancier can be written as raw HTML, which passes through as long
+// as the line starts with "<".
+
+var (
+	inlineCode = regexp.MustCompile("`([^`]+)`")
+	bold       = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italic     = regexp.MustCompile(`\*([^*]+)\*`)
+	link       = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+)
+
+func inline(text string) string {
+	// Pull the code spans out first, so that nothing inside them gets
+	// formatted.
+	var spans []string
+	text = inlineCode.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00"
+	})
+	text = html.EscapeString(text)
+	text = bold.ReplaceAllString(text, "<strong>$1</strong>")
+	text = italic.ReplaceAllString(text, "<em>$1</em>")
+	text = link.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	for _, span := range spans {
+		text = strings.Replace(text, "\x00", span, 1)
+	}
+	return text
+}
+
+// renderMarkdown converts one slide's worth of Markdown to HTML.
+func renderMarkdown(src string) string {
+	var out strings.Builder
+	var para []string
+	inList := false
+	flushPara := func() {
+		if len(para) > 0 {
+			out.WriteString("<p>" + inline(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if inList {
+			out.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flushPara()
+			closeList()
+			lang := strings.TrimPrefix(trimmed, "```")
+			var code []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = ` class="language-` + html.EscapeString(lang) + `"`
+			}
+			out.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case trimmed == "":
+			flushPara()
+			closeList()
+		case strings.HasPrefix(trimmed, "#"):
+			flushPara()
+			closeList()
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			level = min(level, 6)
+			text := strings.TrimSpace(trimmed[level:])
+			out.WriteString("<h" + string(rune('0'+level)) + ">" + inline(text) + "</h" + string(rune('0'+level)) + ">\n")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			flushPara()
+			if !inList {
+				out.WriteString("<ul>\n")
+				inList = true
+			}
+			out.WriteString("<li>" + inline(trimmed[2:]) + "</li>\n")
+		case strings.HasPrefix(trimmed, "<"):
+			flushPara()
+			closeList()
+			out.WriteString(line + "\n")
+		default:
+			closeList()
+			para = append(para, trimmed)
+		}
+	}
+	flushPara()
+	closeList()
+	return out.String()
+}
@@ -0,0 +1,294 @@
+package main
+
+// The reader loop in not_atomic.go has a second bug hiding behind the torn
+// reads. Nothing in it synchronizes with the writer, so as far as the memory
+// model is concerned, the compiler is allowed to load myFoo once, notice that
+// nothing in the loop changes it, and spin forever on that one copy. Go's
+// compiler doesn't happen to do that today, but C and C++ compilers do it all
+// the time, and "the compiler isn't smart enough to break my program yet"
+// isn't a great place to be.
+//
+// This pass looks for loops where:
+//
+//   - every way out of the loop depends only on loads from memory that
+//     another goroutine might write, plus values that don't change inside the
+//     loop, and
+//   - nothing in the loop synchronizes with anyone: no calls (which covers
+//     atomics, mutexes and WaitGroups), no channel operations, no go or defer
+//     statements, and no stores to the memory that the exit depends on.
+
+import (
+	"fmt"
+	"go/token"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "spinloop",
+	Doc:      "report loops that spin on shared variables without synchronization",
+	Requires: []*analysis.Analyzer{buildssa.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	ssainfo := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA)
+	for _, fn := range ssainfo.SrcFuncs {
+		for _, loop := range findLoops(fn) {
+			checkLoop(pass, loop)
+		}
+	}
+	return nil, nil
+}
+
+type loop struct {
+	header *ssa.BasicBlock
+	blocks map[*ssa.BasicBlock]bool
+}
+
+// findLoops returns the natural loops in fn. A back edge is an edge from b to
+// a block h that dominates b, and the loop is h plus every block that can
+// reach b without going through h. Back edges to the same header make one
+// loop.
+func findLoops(fn *ssa.Function) []*loop {
+	byHeader := make(map[*ssa.BasicBlock]*loop)
+	var loops []*loop
+	for _, b := range fn.Blocks {
+		for _, h := range b.Succs {
+			if !h.Dominates(b) {
+				continue
+			}
+			l := byHeader[h]
+			if l == nil {
+				l = &loop{header: h, blocks: map[*ssa.BasicBlock]bool{h: true}}
+				byHeader[h] = l
+				loops = append(loops, l)
+			}
+			stack := []*ssa.BasicBlock{b}
+			for len(stack) > 0 {
+				x := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if l.blocks[x] {
+					continue
+				}
+				l.blocks[x] = true
+				stack = append(stack, x.Preds...)
+			}
+		}
+	}
+	return loops
+}
+
+func checkLoop(pass *analysis.Pass, l *loop) {
+	var exits []*ssa.If
+	for b := range l.blocks {
+		if cond, ok := b.Instrs[len(b.Instrs)-1].(*ssa.If); ok {
+			for _, s := range b.Succs {
+				if !l.blocks[s] {
+					exits = append(exits, cond)
+					break
+				}
+			}
+		}
+	}
+	// A loop with no conditional exits is either infinite on purpose (like
+	// fooWriter) or exits some other way, like a return from a call.
+	if len(exits) == 0 {
+		return
+	}
+
+	t := &tracer{loop: l, seen: make(map[ssa.Value]bool), locals: make(map[*ssa.Alloc]bool)}
+	for _, cond := range exits {
+		t.trace(cond.Cond)
+	}
+	if t.impure || len(t.loads) == 0 {
+		return
+	}
+	for b := range l.blocks {
+		for _, instr := range b.Instrs {
+			if synchronizes(instr, t.roots) {
+				return
+			}
+		}
+	}
+
+	load := t.loads[0]
+	pos := load.Pos()
+	if pos == token.NoPos {
+		pos = l.header.Instrs[0].Pos()
+	}
+	pass.Reportf(pos, "loop spins on %s without synchronization; it may never see another goroutine's writes", describe(t.roots[0]))
+}
+
+// A tracer walks backwards from a loop's exit conditions to find out what
+// they depend on.
+type tracer struct {
+	loop   *loop
+	seen   map[ssa.Value]bool
+	locals map[*ssa.Alloc]bool
+	loads  []*ssa.UnOp
+	roots  []ssa.Value
+	// impure means the exit depends on something that changes from one
+	// iteration to the next other than shared memory, like a loop counter or
+	// the result of a call. Loops like that aren't spinning.
+	impure bool
+}
+
+func (t *tracer) trace(v ssa.Value) {
+	if t.seen[v] {
+		return
+	}
+	t.seen[v] = true
+	instr, ok := v.(ssa.Instruction)
+	if !ok || !t.loop.blocks[instr.Block()] {
+		// Constants, parameters, globals and anything computed before the
+		// loop started are all the same on every iteration.
+		return
+	}
+	switch v := v.(type) {
+	case *ssa.Phi, *ssa.Call:
+		t.impure = true
+		return
+	case *ssa.UnOp:
+		switch v.Op {
+		case token.ARROW:
+			t.impure = true
+			return
+		case token.MUL:
+			root := addrRoot(v.X)
+			if shared(root) {
+				t.loads = append(t.loads, v)
+				t.roots = append(t.roots, root)
+			} else if local, ok := root.(*ssa.Alloc); ok {
+				// A local variable that only this goroutine can see, like
+				// fooCopy. What matters is whatever the loop stores in it.
+				t.traceStores(local)
+			} else {
+				t.impure = true
+				return
+			}
+		}
+	}
+	for _, op := range instr.Operands(nil) {
+		if *op != nil {
+			t.trace(*op)
+		}
+	}
+}
+
+func (t *tracer) traceStores(local *ssa.Alloc) {
+	if t.locals[local] {
+		return
+	}
+	t.locals[local] = true
+	for b := range t.loop.blocks {
+		for _, instr := range b.Instrs {
+			if store, ok := instr.(*ssa.Store); ok && addrRoot(store.Addr) == local {
+				t.trace(store.Val)
+			}
+		}
+	}
+}
+
+// addrRoot returns the variable that an address points into, looking through
+// field and element addressing.
+func addrRoot(addr ssa.Value) ssa.Value {
+	for {
+		switch a := addr.(type) {
+		case *ssa.FieldAddr:
+			addr = a.X
+		case *ssa.IndexAddr:
+			addr = a.X
+		default:
+			return addr
+		}
+	}
+}
+
+// shared reports whether another goroutine could be writing the variable at
+// root. Globals, captured variables and memory behind pointer parameters all
+// might be. A local variable is shared if its address is passed to a go
+// statement, directly or by a closure that captures it.
+func shared(root ssa.Value) bool {
+	switch root := root.(type) {
+	case *ssa.Global, *ssa.FreeVar, *ssa.Parameter:
+		return true
+	case *ssa.Alloc:
+		return escapesToGoroutine(root, make(map[ssa.Value]bool))
+	case *ssa.UnOp:
+		// A pointer that we loaded from somewhere else. We can't tell who
+		// else has it, so assume the worst.
+		return root.Op == token.MUL
+	}
+	return false
+}
+
+func escapesToGoroutine(v ssa.Value, seen map[ssa.Value]bool) bool {
+	if seen[v] {
+		return false
+	}
+	seen[v] = true
+	refs := v.Referrers()
+	if refs == nil {
+		return false
+	}
+	for _, ref := range *refs {
+		switch ref := ref.(type) {
+		case *ssa.Go:
+			return true
+		case *ssa.MakeClosure:
+			if escapesToGoroutine(ref, seen) {
+				return true
+			}
+		case *ssa.FieldAddr:
+			if escapesToGoroutine(ref, seen) {
+				return true
+			}
+		case *ssa.IndexAddr:
+			if escapesToGoroutine(ref, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// synchronizes reports whether instr could make the loop see another
+// goroutine's writes, or could change the loop's exit condition itself.
+func synchronizes(instr ssa.Instruction, roots []ssa.Value) bool {
+	switch instr := instr.(type) {
+	case *ssa.Call:
+		_, builtin := instr.Call.Value.(*ssa.Builtin)
+		return !builtin
+	case *ssa.Go, *ssa.Defer, *ssa.Send, *ssa.Select:
+		return true
+	case *ssa.UnOp:
+		return instr.Op == token.ARROW
+	case *ssa.Store:
+		root := addrRoot(instr.Addr)
+		for _, r := range roots {
+			if r == root {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describe(root ssa.Value) string {
+	switch root := root.(type) {
+	case *ssa.Alloc:
+		if root.Comment != "" {
+			return root.Comment
+		}
+	case *ssa.Global:
+		return root.Name()
+	case *ssa.FreeVar:
+		return root.Name()
+	case *ssa.Parameter:
+		return fmt.Sprintf("*%s", root.Name())
+	}
+	return "shared memory"
+}
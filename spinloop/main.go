@@ -0,0 +1,17 @@
+package main
+
+// spinloop is a vet-style checker for loops that wait on another goroutine
+// without synchronizing with it. See analyzer.go for the details.
+//
+//     spinloop ./...
+//     go vet -vettool=$(which spinloop) ./...
+//
+// go test runs it over the examples in testdata, which include not_atomic.go
+// and the ways of fixing it, and checks the reports against their "// want"
+// comments.
+
+import "golang.org/x/tools/go/analysis/singlechecker"
+
+func main() {
+	singlechecker.Main(Analyzer)
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// notatomic is not_atomic.go itself, and fixed has the usual fixes for it,
+// plus a few smaller loops with the same bug.
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "notatomic", "fixed")
+}
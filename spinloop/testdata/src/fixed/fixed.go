@@ -0,0 +1,131 @@
+package main
+
+// The ways of fixing not_atomic.go's reader loop, none of which spinloop
+// should complain about, and a couple of near misses that it should.
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type Foo struct {
+	A int
+	B int
+}
+
+func withMutex() {
+	var mu sync.Mutex
+	var myFoo Foo
+	go func() {
+		for i := 0; ; i++ {
+			mu.Lock()
+			myFoo = Foo{i, i}
+			mu.Unlock()
+		}
+	}()
+	for {
+		mu.Lock()
+		fooCopy := myFoo
+		mu.Unlock()
+		if fooCopy.A != fooCopy.B {
+			fmt.Println("We got an inconsistent Foo!", fooCopy)
+			return
+		}
+	}
+}
+
+func withAtomicPointer() {
+	var ptr atomic.Pointer[Foo]
+	ptr.Store(&Foo{})
+	go func() {
+		for i := 0; ; i++ {
+			ptr.Store(&Foo{i, i})
+		}
+	}()
+	for {
+		fooCopy := *ptr.Load()
+		if fooCopy.A != fooCopy.B {
+			fmt.Println("We got an inconsistent Foo!", fooCopy)
+			return
+		}
+	}
+}
+
+func withChannel() {
+	foos := make(chan Foo)
+	go func() {
+		for i := 0; ; i++ {
+			foos <- Foo{i, i}
+		}
+	}()
+	for {
+		fooCopy := <-foos
+		if fooCopy.A != fooCopy.B {
+			fmt.Println("We got an inconsistent Foo!", fooCopy)
+			return
+		}
+	}
+}
+
+// Counting iterations means the loop ends on its own, whatever the other
+// goroutine does.
+func withLimit() {
+	var myFoo Foo
+	go func() {
+		for i := 0; ; i++ {
+			myFoo = Foo{i, i}
+		}
+	}()
+	for n := 0; n < 1000; n++ {
+		fooCopy := myFoo
+		if fooCopy.A != fooCopy.B {
+			fmt.Println("We got an inconsistent Foo!", fooCopy)
+			return
+		}
+	}
+}
+
+// A variable no other goroutine can see isn't shared.
+func localOnly() {
+	var myFoo Foo
+	for {
+		fooCopy := myFoo
+		if fooCopy.A != fooCopy.B {
+			return
+		}
+	}
+}
+
+// Waiting on a flag is the classic version of the bug.
+var done bool
+
+func flagWait() {
+	go func() { done = true }()
+	for !done { // want `loop spins on done without synchronization`
+	}
+}
+
+func flagWaitAtomic() {
+	var done atomic.Bool
+	go func() { done.Store(true) }()
+	for !done.Load() {
+	}
+}
+
+// Behind a pointer parameter counts as shared too.
+func waitFor(foo *Foo) {
+	for foo.A == foo.B { // want `loop spins on \*foo without synchronization`
+	}
+}
+
+func main() {
+	withMutex()
+	withAtomicPointer()
+	withChannel()
+	withLimit()
+	localOnly()
+	flagWait()
+	flagWaitAtomic()
+	waitFor(new(Foo))
+}
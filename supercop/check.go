@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The macros each operation's api.h has to define, from the SUPERCOP call
+// for submissions. Operations that aren't here are reported as unknown,
+// which is more likely a typo than a new operation.
+var requiredMacros = map[string][]string{
+	"crypto_hash":        {"CRYPTO_BYTES"},
+	"crypto_xof":         {},
+	"crypto_stream":      {"CRYPTO_KEYBYTES", "CRYPTO_NONCEBYTES"},
+	"crypto_auth":        {"CRYPTO_BYTES", "CRYPTO_KEYBYTES"},
+	"crypto_onetimeauth": {"CRYPTO_BYTES", "CRYPTO_KEYBYTES"},
+	"crypto_aead":        {"CRYPTO_KEYBYTES", "CRYPTO_NSECBYTES", "CRYPTO_NPUBBYTES", "CRYPTO_ABYTES"},
+	"crypto_scalarmult":  {"CRYPTO_BYTES", "CRYPTO_SCALARBYTES"},
+	"crypto_dh":          {"CRYPTO_PUBLICKEYBYTES", "CRYPTO_SECRETKEYBYTES", "CRYPTO_BYTES"},
+	"crypto_sign":        {"CRYPTO_SECRETKEYBYTES", "CRYPTO_PUBLICKEYBYTES", "CRYPTO_BYTES"},
+	"crypto_kem":         {"CRYPTO_SECRETKEYBYTES", "CRYPTO_PUBLICKEYBYTES", "CRYPTO_CIPHERTEXTBYTES", "CRYPTO_BYTES"},
+	"crypto_encrypt":     {"CRYPTO_SECRETKEYBYTES", "CRYPTO_PUBLICKEYBYTES", "CRYPTO_BYTES"},
+}
+
+// Files SUPERCOP itself keeps next to the implementations of a primitive.
+var primitiveFiles = []string{"checksumsmall", "checksumbig", "used"}
+
+// Every implementation needs these, and at least one source file.
+var requiredFiles = []string{"api.h", "designers", "description"}
+
+var sourceExts = []string{".c", ".cc", ".cpp", ".s", ".S"}
+
+// Names SUPERCOP accepts for primitives and implementations. They end up in
+// C identifiers, so no dashes or dots.
+var validName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Build products and editor leftovers that have no business in a
+// submission. The test.py and bench.py in our tarballs build into a temp
+// directory, but these are what a build in place would leave behind.
+var artifacts = []*regexp.Regexp{
+	regexp.MustCompile(`\.(o|obj|a|so|dylib|dll|exe|pyc|pyo|swp|orig|rej)$`),
+	regexp.MustCompile(`(^|/)(a\.out|core|\.DS_Store|Thumbs\.db)$`),
+	regexp.MustCompile(`(^|/)(__pycache__|\.git|\.svn|\.hg|\.vscode|\.idea)(/|$)`),
+	regexp.MustCompile(`~$`),
+}
+
+func isArtifact(p string) bool {
+	for _, re := range artifacts {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// artifactRoot finds the outermost part of p that's an artifact, so that a
+// __pycache__ directory is one problem, not one per file in it.
+func artifactRoot(p string) (string, bool) {
+	parts := strings.Split(p, "/")
+	for i := range parts {
+		if prefix := strings.Join(parts[:i+1], "/"); isArtifact(prefix) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+var define = regexp.MustCompile(`(?m)^\s*#\s*define\s+(CRYPTO_[A-Z_]+)\s+(.*?)\s*(?://.*|/\*.*)?$`)
+
+// parseAPI returns the CRYPTO_ macros api.h defines, and their values.
+func parseAPI(data []byte) map[string]string {
+	macros := make(map[string]string)
+	for _, m := range define.FindAllSubmatch(data, -1) {
+		macros[string(m[1])] = string(m[2])
+	}
+	return macros
+}
+
+type impl struct {
+	op, primitive, name string
+	files               map[string]file // by name within the implementation
+	subdirs             bool
+}
+
+func (i *impl) dir() string { return path.Join(i.op, i.primitive, i.name) }
+
+// A report is what check found.
+type report struct {
+	problems []string
+	impls    []*impl
+}
+
+func (r *report) add(p, format string, args ...any) {
+	r.problems = append(r.problems, p+": "+fmt.Sprintf(format, args...))
+}
+
+// check validates a submission's layout. It returns every problem it finds,
+// not just the first, so one run is enough to fix everything.
+func check(files []file) *report {
+	r := &report{}
+	impls := make(map[string]*impl)
+	// Report a bad directory once, not once for everything in it.
+	reported := make(map[string]bool)
+	once := func(p, format string, args ...any) {
+		if !reported[p] {
+			r.add(p, format, args...)
+		}
+		reported[p] = true
+	}
+	for _, f := range files {
+		p := f.path
+		clean := path.Clean(p)
+		switch {
+		case path.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../"):
+			r.add(p, "the path escapes the submission")
+			continue
+		case strings.HasPrefix(p, "./"):
+			r.add(p, "paths should start with the operation, like crypto_hash/, not ./")
+		}
+		if f.mode&(fs.ModeSymlink|fs.ModeIrregular|fs.ModeDevice|fs.ModeNamedPipe|fs.ModeSocket) != 0 {
+			r.add(p, "only regular files and directories belong in a submission")
+			continue
+		}
+		if root, ok := artifactRoot(clean); ok {
+			once(root, "looks like a build artifact or editor leftover")
+			continue
+		}
+		op, primitive, name, rest := split(clean)
+		isDir := f.mode.IsDir()
+		_, knownOp := requiredMacros[op]
+		switch {
+		case primitive == "" && !isDir:
+			r.add(p, "everything goes under an operation directory like crypto_hash/")
+			continue
+		case !knownOp:
+			once(op, "isn't an operation SUPERCOP knows")
+			continue
+		case primitive == "":
+			continue
+		case !validName.MatchString(primitive):
+			once(path.Join(op, primitive), "isn't a valid primitive name, which has to be lowercase letters, digits, and underscores")
+			continue
+		case name == "":
+			continue
+		case rest == "" && !isDir:
+			if !slices.Contains(primitiveFiles, name) {
+				r.add(p, "only %s go next to the implementations", strings.Join(primitiveFiles, ", "))
+			}
+			continue
+		case !validName.MatchString(name):
+			once(path.Join(op, primitive, name), "isn't a valid implementation name, which has to be lowercase letters, digits, and underscores")
+			continue
+		}
+		key := path.Join(op, primitive, name)
+		im := impls[key]
+		if im == nil {
+			im = &impl{op: op, primitive: primitive, name: name, files: make(map[string]file)}
+			impls[key] = im
+		}
+		switch {
+		case rest == "":
+		case strings.Contains(rest, "/") || isDir:
+			// SUPERCOP compiles the files in the implementation
+			// directory, and nothing below it.
+			if !im.subdirs {
+				r.add(p, "SUPERCOP doesn't look in subdirectories of an implementation")
+			}
+			im.subdirs = true
+		default:
+			im.files[rest] = f
+		}
+	}
+
+	for _, key := range sortedKeys(impls) {
+		im := impls[key]
+		r.impls = append(r.impls, im)
+		r.checkImpl(im)
+	}
+	r.checkConsistency()
+	slices.Sort(r.problems)
+	return r
+}
+
+func (r *report) checkImpl(im *impl) {
+	dir := im.dir()
+	for _, name := range requiredFiles {
+		f, ok := im.files[name]
+		switch {
+		case !ok:
+			r.add(dir, "no %s", name)
+		case strings.TrimSpace(string(f.data)) == "":
+			r.add(path.Join(dir, name), "is empty")
+		}
+	}
+	var sources []file
+	for name, f := range im.files {
+		if slices.Contains(sourceExts, path.Ext(name)) {
+			sources = append(sources, f)
+		}
+	}
+	if len(sources) == 0 {
+		r.add(dir, "no source files (%s)", strings.Join(sourceExts, " "))
+	} else {
+		header := fmt.Sprintf(`#include "%s.h"`, im.op)
+		found := false
+		for _, f := range sources {
+			found = found || strings.Contains(string(f.data), header)
+		}
+		if !found {
+			r.add(dir, "no source file includes %s.h, which is where SUPERCOP renames %s for each implementation", im.op, im.op)
+		}
+	}
+	if api, ok := im.files["api.h"]; ok {
+		macros := parseAPI(api.data)
+		for _, want := range requiredMacros[im.op] {
+			val, ok := macros[want]
+			if !ok {
+				r.add(path.Join(dir, "api.h"), "doesn't define %s", want)
+			} else if _, err := strconv.ParseUint(val, 0, 32); err != nil {
+				r.add(path.Join(dir, "api.h"), "%s is %q, which isn't a number", want, val)
+			}
+		}
+	}
+}
+
+// checkConsistency compares the implementations of each primitive. They're
+// the same function, so they need the same sizes in api.h, and the same
+// people designed them.
+func (r *report) checkConsistency() {
+	byPrimitive := make(map[string][]*impl)
+	for _, im := range r.impls {
+		key := path.Join(im.op, im.primitive)
+		byPrimitive[key] = append(byPrimitive[key], im)
+	}
+	for _, key := range sortedKeys(byPrimitive) {
+		impls := byPrimitive[key]
+		first := impls[0]
+		firstAPI := parseAPI(first.files["api.h"].data)
+		firstDesigners := normalizeDesigners(first.files["designers"].data)
+		for _, im := range impls[1:] {
+			api := parseAPI(im.files["api.h"].data)
+			for _, macro := range sortedKeys(firstAPI) {
+				if val, ok := api[macro]; ok && val != firstAPI[macro] {
+					r.add(path.Join(im.dir(), "api.h"), "%s is %s, but it's %s in %s", macro, val, firstAPI[macro], first.name)
+				}
+			}
+			_, hasDesigners := im.files["designers"]
+			_, firstHas := first.files["designers"]
+			if hasDesigners && firstHas && normalizeDesigners(im.files["designers"].data) != firstDesigners {
+				r.add(path.Join(im.dir(), "designers"), "is different from %s", path.Join(first.dir(), "designers"))
+			}
+		}
+	}
+}
+
+// normalizeDesigners ignores whitespace and blank lines, but not the order
+// of the names, which people do care about.
+func normalizeDesigners(data []byte) string {
+	var lines []string
+	for _, l := range strings.Split(string(data), "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
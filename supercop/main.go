@@ -0,0 +1,161 @@
+package main
+
+// supercop checks that a submission follows SUPERCOP's layout, and packs
+// one into a tarball. The BLAKE3 tarballs in www/files look like
+//
+//     crypto_hash/blake3/sse41/{api.h,designers,description,hash.c,...}
+//
+// with one directory per implementation, and SUPERCOP is picky about what
+// goes in them. check looks for the required files, the macros api.h has to
+// define, build artifacts that shouldn't have been shipped, and
+// implementations of one primitive that disagree about their sizes or their
+// designers.
+//
+//     go run ./supercop/*.go check www/files/blake3-2.tar.gz
+//     go run ./supercop/*.go check path/to/submission
+//     go run ./supercop/*.go pack -o www/files/blake3-3.tar.gz path/to/submission
+//
+// pack leaves out build artifacts, checks what's left, and refuses to write
+// anything if there are problems.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+func printReport(name string, r *report) {
+	for _, p := range r.problems {
+		fmt.Printf("%s: %s\n", name, p)
+	}
+	primitives := make(map[string]bool)
+	for _, im := range r.impls {
+		primitives[path.Join(im.op, im.primitive)] = true
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s of %s, %s\n", name,
+		plural(len(r.impls), "implementation"), plural(len(primitives), "primitive"), plural(len(r.problems), "problem"))
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func cmdCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: supercop check TARBALL|DIR...")
+	}
+	problems := 0
+	for _, src := range fs.Args() {
+		files, err := load(src)
+		if err != nil {
+			return err
+		}
+		r := check(files)
+		printReport(src, r)
+		problems += len(r.problems)
+	}
+	if problems > 0 {
+		return errors.New(plural(problems, "problem"))
+	}
+	return nil
+}
+
+func cmdPack(args []string) error {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	out := fs.String("o", "", "the tarball to write (required)")
+	fs.Parse(args)
+	if *out == "" || fs.NArg() != 1 {
+		return errors.New("usage: supercop pack -o OUT.tar.gz DIR")
+	}
+	dir := fs.Arg(0)
+	if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s isn't a directory", dir)
+	}
+	all, err := loadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []file
+	for _, f := range all {
+		if root, ok := artifactRoot(f.path); ok {
+			if root == f.path {
+				fmt.Fprintf(os.Stderr, "leaving out %s\n", f.path)
+			}
+			continue
+		}
+		files = append(files, f)
+	}
+	if r := check(files); len(r.problems) > 0 {
+		printReport(dir, r)
+		return fmt.Errorf("not packing %s until that's fixed", dir)
+	}
+	mtime, err := packTime(files)
+	if err != nil {
+		return err
+	}
+	data, err := pack(files, mtime)
+	if err != nil {
+		return err
+	}
+	// Check the tarball too, in case pack and check disagree about
+	// something.
+	tmp := *out + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	packed, err := loadTarball(tmp)
+	if err != nil {
+		return err
+	}
+	if r := check(packed); len(r.problems) > 0 {
+		printReport(*out, r)
+		return errors.New("the packed tarball has problems the directory didn't")
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		return err
+	}
+	count := 0
+	for _, f := range files {
+		if !f.mode.IsDir() {
+			count++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s: %s, %d bytes\n", *out, plural(count, "file"), len(data))
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: supercop check TARBALL|DIR... | pack -o OUT.tar.gz DIR")
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch flag.Arg(0) {
+	case "check":
+		err = cmdCheck(flag.Args()[1:])
+	case "pack":
+		err = cmdPack(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, strings.TrimSpace(err.Error()))
+		os.Exit(1)
+	}
+}
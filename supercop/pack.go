@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pack writes files into a gzipped tarball the way SUPERCOP wants it, and
+// the same way every time: sorted paths, a directory entry before its
+// contents, modes that are only 0644 or 0755, no owners, and one timestamp
+// for everything. The same tree always gives the same bytes, so a new
+// tarball only looks different from the last one if the contents are.
+func pack(files []file, mtime time.Time) ([]byte, error) {
+	// Every directory gets an entry, even the ones loadDir didn't see
+	// because they were only implied by a path.
+	dirs := make(map[string]bool)
+	var regular []file
+	for _, f := range files {
+		if f.mode.IsDir() {
+			dirs[f.path] = true
+			continue
+		}
+		regular = append(regular, f)
+		for d := path.Dir(f.path); d != "."; d = path.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	entries := slices.Clone(regular)
+	for d := range dirs {
+		entries = append(entries, file{path: d, mode: fs.ModeDir | 0o755})
+	}
+	// Sorting "a/" before "a/b" puts each directory before what's in it.
+	name := func(f file) string {
+		if f.mode.IsDir() {
+			return f.path + "/"
+		}
+		return f.path
+	}
+	slices.SortFunc(entries, func(a, b file) int { return strings.Compare(name(a), name(b)) })
+
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(gz)
+	for _, f := range entries {
+		h := &tar.Header{
+			Name:    name(f),
+			ModTime: mtime,
+			Format:  tar.FormatUSTAR,
+		}
+		switch {
+		case f.mode.IsDir():
+			h.Typeflag, h.Mode = tar.TypeDir, 0o755
+		case f.mode&0o111 != 0:
+			h.Typeflag, h.Mode, h.Size = tar.TypeReg, 0o755, int64(len(f.data))
+		default:
+			h.Typeflag, h.Mode, h.Size = tar.TypeReg, 0o644, int64(len(f.data))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.path, err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// packTime is $SOURCE_DATE_EPOCH if it's set, like other reproducible
+// builds, and otherwise the newest mtime in the tree.
+func packTime(files []file) (time.Time, error) {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		var secs int64
+		if _, err := fmt.Sscan(epoch, &secs); err != nil {
+			return time.Time{}, fmt.Errorf("bad SOURCE_DATE_EPOCH %q", epoch)
+		}
+		return time.Unix(secs, 0), nil
+	}
+	var newest time.Time
+	for _, f := range files {
+		if !f.mode.IsDir() && f.mtime.After(newest) {
+			newest = f.mtime
+		}
+	}
+	return newest.Truncate(time.Second), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A file is one entry of a submission, from a tarball or a directory, with
+// a slash-separated path relative to the top, where crypto_hash/ and the
+// like live.
+type file struct {
+	path  string
+	mode  fs.FileMode // includes fs.ModeDir and fs.ModeSymlink
+	mtime time.Time
+	data  []byte
+}
+
+// load reads a submission from a tarball or a directory.
+func load(src string) ([]file, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadDir(src)
+	}
+	return loadTarball(src)
+}
+
+func loadDir(dir string) ([]file, error) {
+	var files []file
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := file{path: filepath.ToSlash(rel), mode: info.Mode(), mtime: info.ModTime()}
+		if info.Mode().IsRegular() {
+			if f.data, err = os.ReadFile(p); err != nil {
+				return err
+			}
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files, err
+}
+
+func loadTarball(name string) ([]file, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	var files []file
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		// Keep the name as written, so check can complain about ./ and
+		// absolute paths, but without the trailing slash on directories.
+		p := strings.TrimSuffix(h.Name, "/")
+		if p == "." || p == "" {
+			continue
+		}
+		entry := file{path: p, mode: h.FileInfo().Mode(), mtime: h.ModTime}
+		switch h.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink:
+		default:
+			// Hard links and the like come out looking like regular files.
+			entry.mode |= fs.ModeIrregular
+		}
+		if h.Typeflag == tar.TypeReg {
+			if entry.data, err = io.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", name, p, err)
+			}
+		}
+		files = append(files, entry)
+	}
+}
+
+// split breaks a path in a submission into its operation, primitive,
+// implementation, and the rest, as far as it goes.
+func split(p string) (op, primitive, impl, rest string) {
+	parts := strings.SplitN(path.Clean(p), "/", 4)
+	parts = append(parts, "", "", "", "")
+	return parts[0], parts[1], parts[2], parts[3]
+}
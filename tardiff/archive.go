@@ -0,0 +1,106 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// An entry is one member of a tarball, with the contents of regular files
+// held in memory. The SUPERCOP tarballs are a few hundred kilobytes, so
+// that's fine.
+type entry struct {
+	name  string
+	kind  string // file, dir, symlink, hardlink, or other
+	mode  fs.FileMode
+	size  int64
+	link  string
+	owner string
+	data  []byte
+}
+
+// kindOf maps a tar type flag to the words we print.
+func kindOf(typ byte) string {
+	switch typ {
+	case tar.TypeReg:
+		return "file"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	}
+	return "other"
+}
+
+// cleanName makes "./a/b/" and "a/b" the same entry.
+func cleanName(name string) string {
+	name = path.Clean("/" + name)
+	return strings.TrimPrefix(name, "/")
+}
+
+// readTarball reads a tarball, gzipped or not, into a map by name. Metadata
+// that changes on every build, like mtimes, is left out, since it would make
+// every entry look changed.
+func readTarball(filename string) (map[string]*entry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	entries := make(map[string]*entry)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		name := cleanName(h.Name)
+		if name == "" {
+			continue
+		}
+		owner := h.Uname + ":" + h.Gname
+		if owner == ":" {
+			owner = fmt.Sprintf("%d:%d", h.Uid, h.Gid)
+		}
+		e := &entry{
+			name:  name,
+			kind:  kindOf(h.Typeflag),
+			mode:  h.FileInfo().Mode() &^ fs.ModeType,
+			size:  h.Size,
+			link:  h.Linkname,
+			owner: owner,
+		}
+		if e.kind == "file" {
+			if e.data, err = io.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", filename, name, err)
+			}
+		}
+		if _, dup := entries[name]; dup {
+			// tar extracts the last one over the others, so that's the one
+			// that counts.
+			fmt.Fprintf(os.Stderr, "%s: %s appears more than once\n", filename, name)
+		}
+		entries[name] = e
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// A change is one entry that differs between the two tarballs. Changes to
+// the contents get hunks, or binary set; changes to the metadata, like
+// mode, owner, or symlink target, get a note each.
+type change struct {
+	kind   string // added, removed, changed, or meta
+	name   string
+	old    *entry
+	new    *entry
+	notes  []string
+	binary bool
+	hunks  []hunk
+}
+
+type hunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	lines              []line
+}
+
+// A line is one line of a unified diff: ' ', '-', or '+', and the text
+// without its newline. noEOL marks the last line of a file that doesn't end
+// in one.
+type line struct {
+	op    byte
+	text  string
+	noEOL bool
+}
+
+func (h hunk) header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.oldStart, h.oldLines), hunkRange(h.newStart, h.newLines))
+}
+
+// hunkRange formats one side of a hunk header the way diff -u does.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+// compare lists the changes from old to new, sorted by name. Directories
+// only show up if they're added or removed, or their mode changes.
+func compare(old, new map[string]*entry, context int) []change {
+	var changes []change
+	for name, n := range new {
+		o, ok := old[name]
+		if !ok {
+			changes = append(changes, change{kind: "added", name: name, new: n})
+			continue
+		}
+		c := change{kind: "meta", name: name, old: o, new: n}
+		if o.kind != n.kind {
+			c.notes = append(c.notes, fmt.Sprintf("was a %s, now a %s", o.kind, n.kind))
+		}
+		if o.mode != n.mode {
+			c.notes = append(c.notes, fmt.Sprintf("mode %04o -> %04o (%s -> %s)", o.mode.Perm(), n.mode.Perm(), o.mode, n.mode))
+		}
+		if o.owner != n.owner {
+			c.notes = append(c.notes, fmt.Sprintf("owner %s -> %s", o.owner, n.owner))
+		}
+		if o.link != n.link {
+			c.notes = append(c.notes, fmt.Sprintf("link %s -> %s", o.link, n.link))
+		}
+		if o.kind == "file" && n.kind == "file" && !bytes.Equal(o.data, n.data) {
+			c.kind = "changed"
+			if isText(o.data) && isText(n.data) {
+				c.hunks = hunks(diffLines(splitLines(o.data), splitLines(n.data)), context)
+			} else {
+				c.binary = true
+			}
+		}
+		if c.kind == "changed" || len(c.notes) > 0 {
+			changes = append(changes, c)
+		}
+	}
+	for name, o := range old {
+		if _, ok := new[name]; !ok {
+			changes = append(changes, change{kind: "removed", name: name, old: o})
+		}
+	}
+	slices.SortFunc(changes, func(a, b change) int { return strings.Compare(a.name, b.name) })
+	return changes
+}
+
+// isText is git's rule of thumb, plus valid UTF-8.
+func isText(data []byte) bool {
+	head := data[:min(len(data), 8000)]
+	return bytes.IndexByte(head, 0) < 0 && utf8.Valid(data)
+}
+
+// splitLines splits after each newline. The last line keeps no newline if
+// the file doesn't end with one, which is how diffLines tells them apart.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// diffLines is Myers' O(ND) diff, which finds the shortest edit script, so
+// it gives the same hunks as diff and git for most inputs. The common
+// prefix and suffix are trimmed first, since most changes here are small.
+func diffLines(a, b []string) []line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var out []line
+	for _, s := range a[:prefix] {
+		out = append(out, toLine(' ', s))
+	}
+	out = append(out, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, s := range a[len(a)-suffix:] {
+		out = append(out, toLine(' ', s))
+	}
+	return out
+}
+
+func toLine(op byte, s string) line {
+	text, ok := strings.CutSuffix(s, "\n")
+	return line{op: op, text: text, noEOL: !ok}
+}
+
+func myers(a, b []string) []line {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	// trace[d] is v after step d, for walking back.
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				trace = append(trace, slices.Clone(v))
+				return backtrack(a, b, trace, offset)
+			}
+		}
+		trace = append(trace, slices.Clone(v))
+	}
+	panic("unreachable")
+}
+
+func backtrack(a, b []string, trace [][]int, offset int) []line {
+	var rev []line
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d-1]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, toLine(' ', a[x]))
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, toLine('+', b[y]))
+		} else {
+			x--
+			rev = append(rev, toLine('-', a[x]))
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, toLine(' ', a[x]))
+	}
+	slices.Reverse(rev)
+	return rev
+}
+
+// hunks groups an edit script into hunks with the given lines of context,
+// merging hunks whose context would overlap.
+func hunks(lines []line, context int) []hunk {
+	var out []hunk
+	oldLine, newLine := 1, 1
+	var cur *hunk
+	lastChange := -1 // index in lines of the last change in cur
+	for i, l := range lines {
+		if l.op != ' ' {
+			if cur == nil || i-lastChange-1 > 2*context {
+				if cur != nil {
+					out = append(out, finish(*cur, lastChange, lines, context))
+				}
+				start := max(0, i-context)
+				cur = &hunk{
+					oldStart: oldLine - (i - start),
+					newStart: newLine - (i - start),
+				}
+				cur.lines = append(cur.lines, lines[start:i]...)
+			} else {
+				cur.lines = append(cur.lines, lines[lastChange+1:i]...)
+			}
+			cur.lines = append(cur.lines, l)
+			lastChange = i
+		}
+		if l.op != '+' {
+			oldLine++
+		}
+		if l.op != '-' {
+			newLine++
+		}
+	}
+	if cur != nil {
+		out = append(out, finish(*cur, lastChange, lines, context))
+	}
+	return out
+}
+
+// finish adds the trailing context to a finished hunk and counts its lines.
+func finish(h hunk, lastChange int, lines []line, context int) hunk {
+	h.lines = append(h.lines, lines[lastChange+1:min(len(lines), lastChange+1+context)]...)
+	h.oldLines, h.newLines = 0, 0
+	for _, l := range h.lines {
+		if l.op != '+' {
+			h.oldLines++
+		}
+		if l.op != '-' {
+			h.newLines++
+		}
+	}
+	return h
+}
@@ -0,0 +1,173 @@
+package main
+
+// tardiff shows what changed between two release tarballs: entries added,
+// removed, and changed, mode, owner, and symlink changes, and unified diffs
+// of the text files, as plain text or as an HTML page in the site's style.
+//
+//     go run ./tardiff/*.go www/files/blake3-1.tar.gz www/files/blake3-2.tar.gz
+//     go run ./tardiff/*.go -html -o diff.html OLD.tar.gz NEW.tar.gz
+//     go run ./tardiff/*.go -publish www/files
+//
+// -publish is the site build step. It looks for numbered releases in a
+// directory, like blake3-1.tar.gz and blake3-2.tar.gz, and writes
+// blake3-1-to-2.html and blake3-1-to-2.diff next to them for each
+// consecutive pair. Diffs that are newer than both tarballs are left alone.
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+func diffFiles(oldPath, newPath string, context int) ([]change, error) {
+	old, err := readTarball(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	new, err := readTarball(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return compare(old, new, context), nil
+}
+
+// writeFile only replaces path if the contents changed, so that publishing
+// twice doesn't look like a change to sitesync or anything else that
+// watches mtimes.
+func writeFile(path string, render func(io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		return err
+	}
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, buf.Bytes()) {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+var release = regexp.MustCompile(`^(.+)-(\d+)\.(tar\.gz|tgz|tar)$`)
+
+// upToDate says whether out is newer than every input.
+func upToDate(out string, inputs ...string) bool {
+	o, err := os.Stat(out)
+	if err != nil {
+		return false
+	}
+	for _, in := range inputs {
+		i, err := os.Stat(in)
+		if err != nil || !o.ModTime().After(i.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+func publish(dir string, context int, force bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type version struct {
+		n    int
+		file string
+	}
+	series := make(map[string][]version)
+	for _, e := range entries {
+		m := release.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() {
+			continue
+		}
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		series[m[1]] = append(series[m[1]], version{n, e.Name()})
+	}
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		versions := series[name]
+		slices.SortFunc(versions, func(a, b version) int { return a.n - b.n })
+		for i := 1; i < len(versions); i++ {
+			a, b := versions[i-1], versions[i]
+			base := filepath.Join(dir, fmt.Sprintf("%s-%d-to-%d", name, a.n, b.n))
+			oldPath, newPath := filepath.Join(dir, a.file), filepath.Join(dir, b.file)
+			if !force && upToDate(base+".html", oldPath, newPath) && upToDate(base+".diff", oldPath, newPath) {
+				continue
+			}
+			changes, err := diffFiles(oldPath, newPath, context)
+			if err != nil {
+				return err
+			}
+			// The links in the page are relative, since it sits next to the
+			// tarballs.
+			err = writeFile(base+".html", func(w io.Writer) error { return writeHTML(w, a.file, b.file, changes) })
+			if err == nil {
+				err = writeFile(base+".diff", func(w io.Writer) error { return writeText(w, a.file, b.file, changes) })
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "wrote %s.html and .diff: %s\n", base, summary(changes))
+		}
+	}
+	return nil
+}
+
+func main() {
+	asHTML := flag.Bool("html", false, "write an HTML page instead of text")
+	out := flag.String("o", "", "where to write the diff, instead of stdout")
+	context := flag.Int("context", 3, "lines of context around each change")
+	publishDir := flag.String("publish", "", "write diffs for every consecutive pair of releases in this directory")
+	force := flag.Bool("force", false, "with -publish, rewrite diffs even if they look up to date")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tardiff [-html] [-o FILE] OLD NEW | -publish DIR")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *publishDir != "" {
+		if err := publish(*publishDir, *context, *force); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	oldPath, newPath := flag.Arg(0), flag.Arg(1)
+	changes, err := diffFiles(oldPath, newPath, *context)
+	if err == nil {
+		render := func(w io.Writer) error {
+			return writeText(w, filepath.Base(oldPath), filepath.Base(newPath), changes)
+		}
+		if *asHTML {
+			render = func(w io.Writer) error {
+				return writeHTML(w, filepath.Base(oldPath), filepath.Base(newPath), changes)
+			}
+		}
+		if *out == "" {
+			err = render(os.Stdout)
+		} else {
+			err = writeFile(*out, render)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+func counts(changes []change) map[string]int {
+	n := make(map[string]int)
+	for _, c := range changes {
+		n[c.kind]++
+	}
+	return n
+}
+
+func summary(changes []change) string {
+	n := counts(changes)
+	return fmt.Sprintf("%d added, %d removed, %d changed, %d with only metadata changes",
+		n["added"], n["removed"], n["changed"], n["meta"])
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// detail is the one-line description of a change in the list at the top.
+func detail(c change) string {
+	describe := func(e *entry) string {
+		if e.kind == "file" {
+			return fmt.Sprintf("%s, %s", plural(int(e.size), "byte"), e.mode)
+		}
+		if e.link != "" {
+			return fmt.Sprintf("%s to %s", e.kind, e.link)
+		}
+		return fmt.Sprintf("%s, %s", e.kind, e.mode)
+	}
+	switch c.kind {
+	case "added":
+		return describe(c.new)
+	case "removed":
+		return describe(c.old)
+	}
+	var parts []string
+	if c.kind == "changed" {
+		if c.binary {
+			parts = append(parts, fmt.Sprintf("binary, %d -> %d bytes", c.old.size, c.new.size))
+		} else {
+			added, removed := 0, 0
+			for _, h := range c.hunks {
+				for _, l := range h.lines {
+					switch l.op {
+					case '+':
+						added++
+					case '-':
+						removed++
+					}
+				}
+			}
+			parts = append(parts, fmt.Sprintf("+%d -%d lines", added, removed))
+		}
+	}
+	return strings.Join(append(parts, c.notes...), "; ")
+}
+
+// writeText writes the list of changes and then a patch that patch -p1
+// would accept, with the metadata changes as notes above each file's hunks.
+func writeText(out io.Writer, oldName, newName string, changes []change) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "%s -> %s: %s\n", oldName, newName, summary(changes))
+	if len(changes) == 0 {
+		return w.Flush()
+	}
+	fmt.Fprintln(w)
+	for _, c := range changes {
+		fmt.Fprintf(w, "%-8s %s  (%s)\n", c.kind, c.name, detail(c))
+	}
+	for _, c := range changes {
+		if c.kind != "changed" {
+			continue
+		}
+		fmt.Fprintf(w, "\ndiff a/%s b/%s\n", c.name, c.name)
+		for _, note := range c.notes {
+			fmt.Fprintln(w, note)
+		}
+		if c.binary {
+			fmt.Fprintf(w, "Binary files a/%s and b/%s differ\n", c.name, c.name)
+			continue
+		}
+		fmt.Fprintf(w, "--- a/%s\n+++ b/%s\n", c.name, c.name)
+		for _, h := range c.hunks {
+			fmt.Fprintln(w, h.header())
+			for _, l := range h.lines {
+				fmt.Fprintf(w, "%c%s\n", l.op, l.text)
+				if l.noEOL {
+					fmt.Fprintln(w, `\ No newline at end of file`)
+				}
+			}
+		}
+	}
+	return w.Flush()
+}
+
+type htmlRow struct {
+	Kind, Name, Detail string
+	Anchor             string // empty if there's no diff to link to
+}
+
+type htmlFile struct {
+	Name, Anchor string
+	Notes        []string
+	Binary       bool
+	Hunks        []htmlHunk
+}
+
+type htmlHunk struct {
+	Header string
+	Lines  []htmlLine
+}
+
+type htmlLine struct {
+	Class, Text string
+}
+
+func anchor(name string) string {
+	return "f-" + strings.NewReplacer("/", "-", ".", "-").Replace(name)
+}
+
+func writeHTML(w io.Writer, oldName, newName string, changes []change) error {
+	var data struct {
+		Title, Old, New, Summary string
+		Rows                     []htmlRow
+		Files                    []htmlFile
+	}
+	data.Title = fmt.Sprintf("%s to %s", oldName, newName)
+	data.Old, data.New, data.Summary = oldName, newName, summary(changes)
+	for _, c := range changes {
+		row := htmlRow{Kind: c.kind, Name: c.name, Detail: detail(c)}
+		if c.kind == "changed" {
+			row.Anchor = anchor(c.name)
+			f := htmlFile{Name: c.name, Anchor: row.Anchor, Notes: c.notes, Binary: c.binary}
+			for _, h := range c.hunks {
+				hv := htmlHunk{Header: h.header()}
+				for _, l := range h.lines {
+					class := map[byte]string{' ': "ctx", '+': "add", '-': "del"}[l.op]
+					hv.Lines = append(hv.Lines, htmlLine{class, string(l.op) + l.text})
+					if l.noEOL {
+						hv.Lines = append(hv.Lines, htmlLine{"note", `\ No newline at end of file`})
+					}
+				}
+				f.Hunks = append(f.Hunks, hv)
+			}
+			data.Files = append(data.Files, f)
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	return page.Execute(w, data)
+}
+
+// The style is the site's, from www/index.html, plus what the diffs need.
+var page = template.Must(template.New("tardiff").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body {
+  margin: 0 auto;
+  max-width: 60em;
+  font-family: sans-serif;
+  line-height: 1.5;
+  padding: 4em 1em;
+  color: #555;
+}
+h1,
+h2,
+strong {
+  color: #333;
+}
+a {
+  color: #55f;
+  text-decoration: none;
+}
+table {
+  border-collapse: collapse;
+  margin: 1em 0;
+}
+td {
+  padding: 0.1em 0.8em 0.1em 0;
+  vertical-align: top;
+}
+td.kind {
+  font-weight: bold;
+}
+code,
+pre {
+  font-size: 0.85em;
+}
+pre {
+  line-height: 1.3;
+  overflow-x: auto;
+  border: 1px solid #ddd;
+  padding: 0.5em 0;
+}
+pre span {
+  display: block;
+  padding: 0 0.5em;
+  white-space: pre;
+}
+.add {
+  color: #333;
+  background-color: #e6ffec;
+}
+.del {
+  color: #333;
+  background-color: #ffebe9;
+}
+.hunk {
+  color: #555;
+  background-color: #eef;
+}
+.note {
+  color: #555;
+  font-style: italic;
+}
+</style>
+</head>
+<body>
+
+<h1>{{.Title}}</h1>
+
+<p>
+What changed from <a href="{{.Old}}">{{.Old}}</a> to <a href="{{.New}}">{{.New}}</a>:
+{{.Summary}}.
+</p>
+
+{{if .Rows}}
+<table>
+{{range .Rows}}<tr>
+<td class="kind">{{.Kind}}</td>
+<td><code>{{if .Anchor}}<a href="#{{.Anchor}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</code></td>
+<td>{{.Detail}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+
+{{range .Files}}
+<h2 id="{{.Anchor}}"><code>{{.Name}}</code></h2>
+{{range .Notes}}<p>{{.}}</p>
+{{end}}{{if .Binary}}<p>The contents changed, and they're binary.</p>
+{{else}}<pre>{{range .Hunks}}<span class="hunk">{{.Header}}</span>{{range .Lines}}<span class="{{.Class}}">{{.Text}}</span>{{end}}{{end}}</pre>
+{{end}}{{end}}
+</body>
+</html>
+`))
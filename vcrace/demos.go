@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type Foo struct {
+	A int
+	B int
+}
+
+// Each demo is a bounded version of not_atomic.go, or of one of the ways to
+// fix it (or not fix it) from ../harness. They do the real reads and writes,
+// and they tell the detector about each one.
+type demo struct {
+	name string
+	// goRace is what `go run -race ./harness/*.go -mode <name>` reports for
+	// the same pattern.
+	goRace goRace
+	note   string
+	run    func(main *Thread, n int)
+}
+
+type goRace int
+
+const (
+	never goRace = iota
+	always
+	// sometimes means that whether -race catches it depends on how the
+	// goroutines get scheduled. See rlockWriter.
+	sometimes
+)
+
+var demos = []demo{
+	{"notatomic", always, "", notAtomic},
+	{"atomicfields", never, "no race, but A and B can still disagree; see ../harness", atomicFields},
+	{"writerlock", always, "", writerLock},
+	{"rlockwriter", sometimes, "it's a race either way; -race misses it with GOMAXPROCS=1 and often catches it with more", rlockWriter},
+	{"mutex", never, "", mutex},
+	{"rwmutex", never, "", rwmutex},
+	{"channel", never, "", channel},
+	{"atomicpointer", never, "", atomicPointer},
+}
+
+// The demos below need to wait for their writer goroutine before returning,
+// but the main thread never touches anything after that, so there's no need
+// to tell the detector about the WaitGroup.
+
+func notAtomic(main *Thread, n int) {
+	var myFoo Foo
+	var wg sync.WaitGroup
+	wg.Add(1)
+	main.Go(func(t *Thread) {
+		defer wg.Done()
+		for i := range n {
+			t.Write("myFoo.A")
+			t.Write("myFoo.B")
+			myFoo = Foo{A: i, B: i}
+		}
+	})
+	for range n {
+		main.Read("myFoo.A")
+		main.Read("myFoo.B")
+		fooCopy := myFoo
+		if fooCopy.A != fooCopy.B {
+			fmt.Println("We got an inconsistent Foo!", fooCopy)
+		}
+	}
+	wg.Wait()
+}
+
+func atomicFields(main *Thread, n int) {
+	var a, b atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(1)
+	main.Go(func(t *Thread) {
+		defer wg.Done()
+		for i := range n {
+			t.AtomicStore("myFoo.A")
+			a.Store(int64(i))
+			t.AtomicStore("myFoo.B")
+			b.Store(int64(i))
+		}
+	})
+	for range n {
+		a.Load()
+		main.AtomicLoad("myFoo.A")
+		b.Load()
+		main.AtomicLoad("myFoo.B")
+	}
+	wg.Wait()
+}
+
+func writerLock(main *Thread, n int) {
+	var mu sync.Mutex
+	var myFoo Foo
+	var wg sync.WaitGroup
+	wg.Add(1)
+	main.Go(func(t *Thread) {
+		defer wg.Done()
+		for i := range n {
+			mu.Lock()
+			t.Acquire("mu")
+			t.Write("myFoo.A")
+			t.Write("myFoo.B")
+			myFoo = Foo{A: i, B: i}
+			t.Release("mu")
+			mu.Unlock()
+		}
+	})
+	for range n {
+		main.Read("myFoo.A")
+		main.Read("myFoo.B")
+		_ = myFoo
+	}
+	wg.Wait()
+}
+
+// Two RLocks don't exclude each other, and RWMutex doesn't tell -race that
+// they synchronize either, so this is a race the same way notatomic is. But
+// -race doesn't report it reliably. With GOMAXPROCS=1 it never did in our
+// runs, and with more Ps it usually did, more often for bigger n. So the
+// detector's answer here depends on the scheduler, not on the code.
+func rlockWriter(main *Thread, n int) {
+	var mu sync.RWMutex
+	var myFoo Foo
+	var wg sync.WaitGroup
+	wg.Add(1)
+	main.Go(func(t *Thread) {
+		defer wg.Done()
+		for i := range n {
+			mu.RLock()
+			t.RAcquire("mu")
+			t.Write("myFoo.A")
+			t.Write("myFoo.B")
+			myFoo = Foo{A: i, B: i}
+			t.RRelease("mu")
+			mu.RUnlock()
+		}
+	})
+	for range n {
+		mu.RLock()
+		main.RAcquire("mu")
+		main.Read("myFoo.A")
+		main.Read("myFoo.B")
+		_ = myFoo
+		main.RRelease("mu")
+		mu.RUnlock()
+	}
+	wg.Wait()
+}
+
+func mutex(main *Thread, n int) {
+	var mu sync.Mutex
+	var myFoo Foo
+	var wg sync.WaitGroup
+	wg.Add(1)
+	main.Go(func(t *Thread) {
+		defer wg.Done()
+		for i := range n {
+			mu.Lock()
+			t.Acquire("mu")
+			t.Write("myFoo.A")
+			t.Write("myFoo.B")
+			myFoo = Foo{A: i, B: i}
+			t.Release("mu")
+			mu.Unlock()
+		}
+	})
+	for range n {
+		mu.Lock()
+		main.Acquire("mu")
+		main.Read("myFoo.A")
+		main.Read("myFoo.B")
+		_ = myFoo
+		main.Release("mu")
+		mu.Unlock()
+	}
+	wg.Wait()
+}
+
+func rwmutex(main *Thread, n int) {
+	var mu sync.RWMutex
+	var myFoo Foo
+	var wg sync.WaitGroup
+	wg.Add(1)
+	main.Go(func(t *Thread) {
+		defer wg.Done()
+		for i := range n {
+			mu.Lock()
+			t.Acquire("mu")
+			t.Write("myFoo.A")
+			t.Write("myFoo.B")
+			myFoo = Foo{A: i, B: i}
+			t.Release("mu")
+			mu.Unlock()
+		}
+	})
+	for range n {
+		mu.RLock()
+		main.RAcquire("mu")
+		main.Read("myFoo.A")
+		main.Read("myFoo.B")
+		_ = myFoo
+		main.RRelease("mu")
+		mu.RUnlock()
+	}
+	wg.Wait()
+}
+
+// Each Foo is built by the writer and then handed off. Once it's sent, the
+// writer never touches it again.
+func channel(main *Thread, n int) {
+	foos := NewChan[*Foo]("foos", 1)
+	main.Go(func(t *Thread) {
+		for i := range n {
+			addr := fmt.Sprintf("foo%d", i)
+			t.Write(addr + ".A")
+			t.Write(addr + ".B")
+			foos.Send(t, &Foo{A: i, B: i})
+		}
+		foos.Close(t)
+	})
+	for i := 0; ; i++ {
+		foo, ok := foos.Recv(main)
+		if !ok {
+			break
+		}
+		addr := fmt.Sprintf("foo%d", i)
+		main.Read(addr + ".A")
+		main.Read(addr + ".B")
+		_ = *foo
+	}
+}
+
+func atomicPointer(main *Thread, n int) {
+	var ptr atomic.Pointer[Foo]
+	var wg sync.WaitGroup
+	wg.Add(1)
+	main.Go(func(t *Thread) {
+		defer wg.Done()
+		for i := range n {
+			addr := fmt.Sprintf("foo%d", i)
+			t.Write(addr + ".A")
+			t.Write(addr + ".B")
+			newFoo := &Foo{A: i, B: i}
+			t.AtomicStore("ptr")
+			ptr.Store(newFoo)
+		}
+	})
+	for range n {
+		foo := ptr.Load()
+		main.AtomicLoad("ptr")
+		if foo == nil {
+			continue
+		}
+		addr := fmt.Sprintf("foo%d", foo.A)
+		main.Read(addr + ".A")
+		main.Read(addr + ".B")
+		_ = *foo
+	}
+	wg.Wait()
+}
@@ -0,0 +1,388 @@
+package main
+
+// This is a small version of the FastTrack algorithm (Flanagan & Freund,
+// PLDI 2009), which is the same happens-before idea that the Go race detector
+// (ThreadSanitizer) is built on. Nothing here is automatic. The demo programs
+// call Read, Write, Acquire, Release and friends themselves, right next to
+// the real operations they stand for.
+//
+// Every goroutine has a vector clock: one counter per goroutine, saying how
+// much of that goroutine's history it has "heard about" through
+// synchronization. Every lock and channel message carries a copy of the clock
+// of whoever last released it, and acquiring it merges that copy into your
+// own. Two accesses to the same variable race if at least one is a write and
+// neither one's goroutine had heard about the other when it happened.
+//
+// FastTrack's trick is that most of the time you don't need a whole vector
+// clock per variable. The last write is always totally ordered with the
+// writes before it (or else we'd have reported a race), so an epoch, "clock
+// value c of goroutine t", written c@t, is enough. Reads get the same
+// treatment until two goroutines read concurrently, and only then does the
+// variable switch to a full vector of read clocks.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+type vc []int
+
+func (v vc) get(t int) int {
+	if t < len(v) {
+		return v[t]
+	}
+	return 0
+}
+
+func (v vc) clone() vc {
+	return append(vc(nil), v...)
+}
+
+func (v *vc) set(t, c int) {
+	for len(*v) <= t {
+		*v = append(*v, 0)
+	}
+	(*v)[t] = c
+}
+
+func (v *vc) join(other vc) {
+	for t, c := range other {
+		if c > v.get(t) {
+			v.set(t, c)
+		}
+	}
+}
+
+func (v vc) String() string {
+	parts := make([]string, len(v))
+	for t, c := range v {
+		parts[t] = fmt.Sprint(c)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+type epoch struct {
+	thread int
+	clock  int
+}
+
+// none is the epoch of a variable that hasn't been accessed. It happens
+// before everything.
+var none = epoch{-1, 0}
+
+// happensBefore reports whether e is covered by the clock v.
+func (e epoch) happensBefore(v vc) bool {
+	return e == none || e.clock <= v.get(e.thread)
+}
+
+func (e epoch) String() string {
+	if e == none {
+		return "-"
+	}
+	return fmt.Sprintf("%d@T%d", e.clock, e.thread)
+}
+
+type varState struct {
+	write epoch
+	// read is the last read, unless reads are shared, in which case readVC
+	// holds the last read clock of every goroutine and read is unused.
+	read   epoch
+	readVC vc
+}
+
+func (s *varState) String() string {
+	r := s.read.String()
+	if s.readVC != nil {
+		r = s.readVC.String()
+	}
+	return fmt.Sprintf("W=%s R=%s", s.write, r)
+}
+
+type Race struct {
+	Kind   string // "write-write", "write-read" or "read-write"
+	Addr   string
+	Prev   epoch
+	Thread int
+	Clock  vc
+}
+
+func (r Race) String() string {
+	return fmt.Sprintf("%s race on %s: T%d with clock %s hadn't heard about the access at %s", r.Kind, r.Addr, r.Thread, r.Clock, r.Prev)
+}
+
+// A Detector holds the state for one instrumented program. The real
+// goroutines in a demo call into it concurrently, so all its state is behind
+// a mutex. (That mutex is invisible to the algorithm. It doesn't add anything
+// to anyone's vector clock.)
+type Detector struct {
+	mu       sync.Mutex
+	verbose  io.Writer
+	nthreads int
+	vars     map[string]*varState
+	locks    map[string]vc
+	// RWMutexes get two clocks, like in the Go runtime. Readers acquire what
+	// the last writer released and release into a clock that only writers
+	// acquire, so readers never synchronize with each other.
+	rlocks   map[string]vc
+	races    []Race
+	reported map[string]bool
+}
+
+// A Thread is one instrumented goroutine.
+type Thread struct {
+	d  *Detector
+	id int
+	vc vc
+}
+
+// NewDetector returns a detector and the Thread for the main goroutine. If
+// verbose isn't nil, every event is printed to it along with the clocks it
+// touched.
+func NewDetector(verbose io.Writer) (*Detector, *Thread) {
+	d := &Detector{
+		verbose:  verbose,
+		vars:     make(map[string]*varState),
+		locks:    make(map[string]vc),
+		rlocks:   make(map[string]vc),
+		reported: make(map[string]bool),
+	}
+	return d, d.newThread(nil)
+}
+
+func (d *Detector) newThread(parent vc) *Thread {
+	t := &Thread{d: d, id: d.nthreads, vc: parent.clone()}
+	d.nthreads++
+	t.vc.set(t.id, t.vc.get(t.id)+1)
+	return t
+}
+
+func (d *Detector) logf(t *Thread, format string, args ...any) {
+	if d.verbose != nil {
+		fmt.Fprintf(d.verbose, "T%d  %-28s %s\n", t.id, fmt.Sprintf(format, args...), t.vc)
+	}
+}
+
+// Races returns the races found so far. Each (kind, address) pair is only
+// reported once, since the demos do the same racy thing in a loop.
+func (d *Detector) Races() []Race {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Race(nil), d.races...)
+}
+
+func (d *Detector) race(kind, addr string, prev epoch, t *Thread) {
+	key := kind + " " + addr
+	if d.reported[key] {
+		return
+	}
+	d.reported[key] = true
+	r := Race{kind, addr, prev, t.id, t.vc.clone()}
+	d.races = append(d.races, r)
+	if d.verbose != nil {
+		fmt.Fprintf(d.verbose, "    RACE: %s\n", r)
+	}
+}
+
+func (d *Detector) varState(addr string) *varState {
+	s, ok := d.vars[addr]
+	if !ok {
+		s = &varState{write: none, read: none}
+		d.vars[addr] = s
+	}
+	return s
+}
+
+func (t *Thread) epoch() epoch {
+	return epoch{t.id, t.vc.get(t.id)}
+}
+
+// tick starts a new epoch for t, after it releases something.
+func (t *Thread) tick() {
+	t.vc.set(t.id, t.vc.get(t.id)+1)
+}
+
+// Go starts f in a new goroutine, with its own Thread. Everything the parent
+// did before Go happens before everything f does.
+func (t *Thread) Go(f func(*Thread)) {
+	t.d.mu.Lock()
+	child := t.d.newThread(t.vc)
+	t.d.logf(t, "go T%d", child.id)
+	t.tick()
+	t.d.mu.Unlock()
+	go f(child)
+}
+
+func (t *Thread) Read(addr string) {
+	d := t.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.varState(addr)
+	e := t.epoch()
+	if s.readVC == nil && s.read == e {
+		// Same epoch as our last read. Nothing new to learn.
+		return
+	}
+	d.logf(t, "read %s", addr)
+	if !s.write.happensBefore(t.vc) {
+		d.race("write-read", addr, s.write, t)
+	}
+	switch {
+	case s.readVC != nil:
+		s.readVC.set(t.id, e.clock)
+	case s.read.happensBefore(t.vc):
+		// The last read happened before this one, so we can forget it.
+		s.read = e
+	default:
+		// Two concurrent reads. That's fine, but now a single epoch isn't
+		// enough to remember them both.
+		s.readVC.set(s.read.thread, s.read.clock)
+		s.readVC.set(t.id, e.clock)
+	}
+	if d.verbose != nil {
+		fmt.Fprintf(d.verbose, "    %s: %s\n", addr, s)
+	}
+}
+
+func (t *Thread) Write(addr string) {
+	d := t.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.varState(addr)
+	e := t.epoch()
+	if s.write == e {
+		return
+	}
+	d.logf(t, "write %s", addr)
+	if !s.write.happensBefore(t.vc) {
+		d.race("write-write", addr, s.write, t)
+	}
+	if s.readVC != nil {
+		for reader, c := range s.readVC {
+			if c > t.vc.get(reader) {
+				d.race("read-write", addr, epoch{reader, c}, t)
+			}
+		}
+		s.readVC = nil
+	} else if !s.read.happensBefore(t.vc) {
+		d.race("read-write", addr, s.read, t)
+	}
+	// Every read so far happened before this write (or was reported), so the
+	// next write only needs to check reads that come after it.
+	s.read = none
+	s.write = e
+	if d.verbose != nil {
+		fmt.Fprintf(d.verbose, "    %s: %s\n", addr, s)
+	}
+}
+
+// Acquire should be called right after locking the real mutex.
+func (t *Thread) Acquire(lock string) {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.vc.join(t.d.locks[lock])
+	t.vc.join(t.d.rlocks[lock])
+	t.d.logf(t, "acquire %s", lock)
+}
+
+// Release should be called right before unlocking the real mutex.
+func (t *Thread) Release(lock string) {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.locks[lock] = t.vc.clone()
+	t.d.logf(t, "release %s", lock)
+	t.tick()
+}
+
+// RAcquire and RRelease are the read side of an RWMutex. Acquire and Release
+// on the same name are the write side.
+func (t *Thread) RAcquire(lock string) {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.vc.join(t.d.locks[lock])
+	t.d.logf(t, "racquire %s", lock)
+}
+
+func (t *Thread) RRelease(lock string) {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	merged := t.d.rlocks[lock]
+	merged.join(t.vc)
+	t.d.rlocks[lock] = merged
+	t.d.logf(t, "rrelease %s", lock)
+	t.tick()
+}
+
+// AtomicLoad and AtomicStore stand for sync/atomic operations, which the Go
+// memory model says are sequentially consistent. That makes every atomic
+// variable act like a tiny lock: a load acquires it, and a store both
+// acquires and releases it. AtomicStore should be called right before the
+// real store, and AtomicLoad right after the real load.
+func (t *Thread) AtomicLoad(addr string) {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.vc.join(t.d.locks["atomic "+addr])
+	t.d.logf(t, "atomic load %s", addr)
+}
+
+func (t *Thread) AtomicStore(addr string) {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	clock := t.d.locks["atomic "+addr]
+	t.vc.join(clock)
+	clock.join(t.vc)
+	t.d.locks["atomic "+addr] = clock
+	t.d.logf(t, "atomic store %s", addr)
+	t.tick()
+}
+
+// A Chan is a real channel that carries the sender's vector clock along with
+// each value, so a send happens before the matching receive. Closing it
+// happens before any receive that sees it closed.
+type Chan[T any] struct {
+	name    string
+	ch      chan message[T]
+	closeVC vc
+}
+
+type message[T any] struct {
+	val T
+	vc  vc
+}
+
+func NewChan[T any](name string, size int) *Chan[T] {
+	return &Chan[T]{name: name, ch: make(chan message[T], size)}
+}
+
+func (c *Chan[T]) Send(t *Thread, v T) {
+	t.d.mu.Lock()
+	m := message[T]{v, t.vc.clone()}
+	t.d.logf(t, "send %s", c.name)
+	t.tick()
+	t.d.mu.Unlock()
+	c.ch <- m
+}
+
+func (c *Chan[T]) Recv(t *Thread) (T, bool) {
+	m, ok := <-c.ch
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	if ok {
+		t.vc.join(m.vc)
+		t.d.logf(t, "recv %s", c.name)
+	} else {
+		t.vc.join(c.closeVC)
+		t.d.logf(t, "recv %s (closed)", c.name)
+	}
+	return m.val, ok
+}
+
+func (c *Chan[T]) Close(t *Thread) {
+	t.d.mu.Lock()
+	c.closeVC = t.vc.clone()
+	t.d.logf(t, "close %s", c.name)
+	t.tick()
+	t.d.mu.Unlock()
+	close(c.ch)
+}
@@ -0,0 +1,71 @@
+package main
+
+// vcrace runs small instrumented versions of not_atomic.go through a
+// FastTrack-style race detector, to show what the real race detector is doing
+// under the hood. With -v, it prints every event along with the vector clock
+// of the goroutine that did it, and the state of every variable it touched.
+//
+//     go run ./vcrace/*.go -demo notatomic -n 2 -v
+//
+// The demos do the real memory accesses too, so running this under -race
+// should flag exactly the demos that it says -race flags, except for the
+// ones it says -race only sometimes flags.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	names := make([]string, len(demos))
+	for i, d := range demos {
+		names[i] = d.name
+	}
+	which := flag.String("demo", "all", "which demo to run: all, "+strings.Join(names, ", "))
+	n := flag.Int("n", 3, "how many times each goroutine loops")
+	verbose := flag.Bool("v", false, "print every event step by step")
+	flag.Parse()
+
+	ran := false
+	for _, d := range demos {
+		if *which != "all" && *which != d.name {
+			continue
+		}
+		ran = true
+		fmt.Printf("== %s\n", d.name)
+		var detector *Detector
+		var main *Thread
+		if *verbose {
+			detector, main = NewDetector(os.Stdout)
+		} else {
+			detector, main = NewDetector(nil)
+		}
+		d.run(main, *n)
+
+		races := detector.Races()
+		for _, r := range races {
+			fmt.Println(r)
+		}
+		if len(races) == 0 {
+			fmt.Println("no races")
+		}
+		switch {
+		case d.goRace == sometimes:
+			fmt.Print("go run -race only sometimes reports this")
+		case (len(races) > 0) == (d.goRace == always):
+			fmt.Print("agrees with go run -race")
+		default:
+			fmt.Print("disagrees with go run -race")
+		}
+		if d.note != "" {
+			fmt.Printf(" (%s)", d.note)
+		}
+		fmt.Print("\n\n")
+	}
+	if !ran {
+		fmt.Fprintf(os.Stderr, "unknown demo %q\n", *which)
+		os.Exit(2)
+	}
+}
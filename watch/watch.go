@@ -0,0 +1,109 @@
+// Package watch provides a latest-value broadcast: one or more goroutines
+// publish a value, and any number of goroutines read the newest one or wait
+// for it to change.
+//
+// This is what the reader loop in not_atomic.go actually wanted. Get always
+// returns a value that some call to Set stored in full, never a mix of two,
+// and waiting for a change blocks instead of spinning. Subscribers that fall
+// behind don't see every value, just the latest one, which is usually what
+// you want for state like configuration or progress.
+package watch
+
+import (
+	"context"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// Each Set publishes a new snapshot, and nothing modifies a snapshot after
+// it's published. The changed channel is closed when the next snapshot
+// replaces this one, which wakes up everyone waiting on it at once.
+type snapshot[T any] struct {
+	val     T
+	version uint64
+	changed chan struct{}
+}
+
+// A Value holds the latest T. The zero Value holds the zero T at version 0.
+// A Value must not be copied after first use.
+type Value[T any] struct {
+	state atomic.Pointer[snapshot[T]]
+	// mu serializes Set, so that versions go up one at a time and every
+	// snapshot's channel gets closed exactly once.
+	mu sync.Mutex
+}
+
+// New returns a Value holding initial at version 0.
+func New[T any](initial T) *Value[T] {
+	v := new(Value[T])
+	v.state.Store(&snapshot[T]{val: initial, changed: make(chan struct{})})
+	return v
+}
+
+func (v *Value[T]) load() *snapshot[T] {
+	if s := v.state.Load(); s != nil {
+		return s
+	}
+	// This is a zero Value that nobody has used yet. If another goroutine
+	// races us to initialize it, theirs wins, and that's fine.
+	v.state.CompareAndSwap(nil, &snapshot[T]{changed: make(chan struct{})})
+	return v.state.Load()
+}
+
+// Set stores x and wakes up everyone waiting for a change. It returns the
+// new version.
+func (v *Value[T]) Set(x T) uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	old := v.load()
+	next := &snapshot[T]{val: x, version: old.version + 1, changed: make(chan struct{})}
+	v.state.Store(next)
+	close(old.changed)
+	return next.version
+}
+
+// Get returns the latest value and its version. It doesn't block or take
+// any locks.
+func (v *Value[T]) Get() (T, uint64) {
+	s := v.load()
+	return s.val, s.version
+}
+
+// Changed waits until the version is greater than since, and then returns
+// the latest value and version. Passing the version from a previous Get or
+// Changed waits for the next Set after that. If ctx is done first, Changed
+// returns ctx.Err() along with the latest value and version anyway.
+func (v *Value[T]) Changed(ctx context.Context, since uint64) (T, uint64, error) {
+	for {
+		s := v.load()
+		if s.version > since {
+			return s.val, s.version, nil
+		}
+		select {
+		case <-s.changed:
+		case <-ctx.Done():
+			s = v.load()
+			return s.val, s.version, ctx.Err()
+		}
+	}
+}
+
+// All returns an iterator over the value: first the current value, and then
+// the latest value after each change, until ctx is done or the loop breaks.
+// A slow subscriber skips intermediate values rather than falling behind.
+func (v *Value[T]) All(ctx context.Context) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		val, version := v.Get()
+		for {
+			if !yield(val) {
+				return
+			}
+			var err error
+			val, version, err = v.Changed(ctx, version)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Foo is the struct from not_atomic.go. Every Foo that gets Set in these
+// tests has A == B, so a torn one shows up as A != B.
+type Foo struct {
+	A int
+	B int
+}
+
+func TestZeroValue(t *testing.T) {
+	var v Value[Foo]
+	if foo, version := v.Get(); foo != (Foo{}) || version != 0 {
+		t.Fatalf("zero Value: Get() = %v, %d", foo, version)
+	}
+	if version := v.Set(Foo{1, 1}); version != 1 {
+		t.Fatalf("first Set returned version %d", version)
+	}
+	if foo, version := v.Get(); foo != (Foo{1, 1}) || version != 1 {
+		t.Fatalf("after Set: Get() = %v, %d", foo, version)
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	v := New(Foo{7, 7})
+	if foo, version := v.Get(); foo != (Foo{7, 7}) || version != 0 {
+		t.Fatalf("Get() = %v, %d, want the initial value at version 0", foo, version)
+	}
+	for i := 1; i <= 3; i++ {
+		if version := v.Set(Foo{i, i}); version != uint64(i) {
+			t.Fatalf("Set %d returned version %d", i, version)
+		}
+	}
+	if foo, version := v.Get(); foo != (Foo{3, 3}) || version != 3 {
+		t.Fatalf("Get() = %v, %d, want the last Set", foo, version)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	v := New(Foo{})
+	ctx := context.Background()
+
+	// A version that's already behind returns right away.
+	v.Set(Foo{1, 1})
+	if foo, version, err := v.Changed(ctx, 0); err != nil || foo != (Foo{1, 1}) || version != 1 {
+		t.Fatalf("Changed(0) = %v, %d, %v", foo, version, err)
+	}
+
+	// The current version waits for the next Set.
+	done := make(chan Foo)
+	go func() {
+		foo, _, _ := v.Changed(ctx, 1)
+		done <- foo
+	}()
+	select {
+	case foo := <-done:
+		t.Fatalf("Changed(1) returned %v before the next Set", foo)
+	case <-time.After(20 * time.Millisecond):
+	}
+	v.Set(Foo{2, 2})
+	if foo := <-done; foo != (Foo{2, 2}) {
+		t.Fatalf("Changed(1) = %v, want the new value", foo)
+	}
+}
+
+func TestChangedCanceled(t *testing.T) {
+	v := New(Foo{5, 5})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	foo, version, err := v.Changed(ctx, 0)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if foo != (Foo{5, 5}) || version != 0 {
+		t.Fatalf("Changed returned %v, %d, want the latest value anyway", foo, version)
+	}
+}
+
+func TestAll(t *testing.T) {
+	v := New(Foo{0, 0})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got := make(chan Foo)
+	go func() {
+		for foo := range v.All(ctx) {
+			got <- foo
+			if foo.A == 2 {
+				break
+			}
+		}
+		close(got)
+	}()
+	// Each Set waits for the subscriber to see it, so none are skipped.
+	for i := 0; i <= 2; i++ {
+		if foo := <-got; foo != (Foo{i, i}) {
+			t.Fatalf("got %v, want %v", foo, Foo{i, i})
+		}
+		if i < 2 {
+			v.Set(Foo{i + 1, i + 1})
+		}
+	}
+	if _, ok := <-got; ok {
+		t.Fatal("All kept going after the loop broke")
+	}
+}
+
+func TestAllStopsOnCancel(t *testing.T) {
+	v := New(Foo{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range v.All(ctx) {
+			n++
+		}
+		done <- n
+	}()
+	cancel()
+	if n := <-done; n != 1 {
+		t.Fatalf("saw %d values, want just the first", n)
+	}
+}
+
+// Writers and subscribers all at once, which is mostly for -race. Nobody
+// should see a torn Foo, versions should only go up, and everyone should
+// end up at the last value.
+func TestConcurrent(t *testing.T) {
+	const writers, perWriter, subscribers = 4, 500, 50
+	v := New(Foo{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	final := writers * perWriter
+
+	var subs sync.WaitGroup
+	for range subscribers {
+		subs.Go(func() {
+			var last uint64
+			for {
+				foo, version, err := v.Changed(ctx, last)
+				if err != nil {
+					t.Errorf("Changed: %v", err)
+					return
+				}
+				if foo.A != foo.B {
+					t.Errorf("torn Foo: %v", foo)
+				}
+				if version <= last {
+					t.Errorf("version went from %d to %d", last, version)
+				}
+				last = version
+				if version == uint64(final) {
+					return
+				}
+			}
+		})
+	}
+	var sets sync.WaitGroup
+	for w := range writers {
+		sets.Go(func() {
+			for i := range perWriter {
+				n := w*perWriter + i
+				v.Set(Foo{n, n})
+				if foo, _ := v.Get(); foo.A != foo.B {
+					t.Errorf("torn Foo: %v", foo)
+				}
+			}
+		})
+	}
+	sets.Wait()
+	subs.Wait()
+	if _, version := v.Get(); version != uint64(final) {
+		t.Fatalf("final version %d, want %d", version, final)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	v := New(Foo{1, 1})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			v.Get()
+		}
+	})
+}
+
+// Each Set wakes every subscriber, and the benchmark waits until they've
+// all seen it, so ns/op is the cost of one broadcast to all of them.
+func BenchmarkBroadcast(b *testing.B) {
+	for _, subscribers := range []int{1_000, 10_000} {
+		b.Run(fmt.Sprint(subscribers), func(b *testing.B) {
+			v := New(Foo{})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var seen sync.WaitGroup
+			var subs sync.WaitGroup
+			ready := make(chan struct{})
+			for range subscribers {
+				subs.Go(func() {
+					var version uint64
+					ready <- struct{}{}
+					for {
+						var err error
+						if _, version, err = v.Changed(ctx, version); err != nil {
+							return
+						}
+						seen.Done()
+					}
+				})
+			}
+			for range subscribers {
+				<-ready
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				seen.Add(subscribers)
+				v.Set(Foo{i, i})
+				seen.Wait()
+			}
+			b.StopTimer()
+			cancel()
+			subs.Wait()
+		})
+	}
+}
+
+// Set only closes a channel, so the writer never waits for subscribers.
+// The ones that fall behind skip values instead of holding it up.
+func BenchmarkSetWithSubscribers(b *testing.B) {
+	for _, subscribers := range []int{1_000, 10_000} {
+		b.Run(fmt.Sprint(subscribers), func(b *testing.B) {
+			v := New(Foo{})
+			ctx, cancel := context.WithCancel(context.Background())
+			var subs sync.WaitGroup
+			for range subscribers {
+				subs.Go(func() {
+					for range v.All(ctx) {
+					}
+				})
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				v.Set(Foo{i, i})
+			}
+			b.StopTimer()
+			cancel()
+			subs.Wait()
+		})
+	}
+}